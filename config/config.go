@@ -6,6 +6,10 @@ package config
 import (
 	"flag"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // app meta
@@ -24,12 +28,252 @@ var bindPort int
 var accessToken string
 var sendStats bool
 var printVersionAndExit bool
+var dumpConfigAndExit bool
+var listMetricsAndExit string
+var deleteMetricsAndExit string
+var confirmDelete bool
+var retryAttempts int
+var retryBudget time.Duration
+var attemptTimeout time.Duration
+var retryStatusCodes string
+var duplicates string
+var timestampFallback bool
+var nullForMissing time.Duration
+var degradedErrorRate float64
+var degradedReduction float64
+var degradedDelay time.Duration
+var logSampleRate int
+var logSampleInterval time.Duration
+var injectFailureRate float64
+var injectFailures string
+var requestPriority string
+var auditLog string
+var readCacheTTL time.Duration
+var metricRequestPriorities stringList
+var seriesRateLimit float64
+var seriesMinInterval time.Duration
+var onlyOnChange bool
+var dedupWindow time.Duration
+var dedupBloomItems int
+var dedupBloomFPRate float64
+var fingerprintCache int
+var logDuplicates bool
+var changeHeartbeat time.Duration
+var throttle bool
+var throttleStart float64
+var throttleFull float64
+var throttleMin float64
+var federateURL string
+var federateMatch stringList
+var federateInterval time.Duration
+var federateUser string
+var federatePassword string
+var federateToken string
+var federateTokenFile string
+var federateSecret string
+var federateExemplars string
+var aggregationSize int
+var aggregationStrategy string
+var aggregationInterval time.Duration
+var lokiURL string
+var lokiQuery string
+var dogstatsdAddress string
+var dogstatsdInterval time.Duration
+var lokiFields stringList
+var loadTest time.Duration
+var loadTestMetrics int
+var loadTestSeries int
+var loadTestTags int
+var loadTestRate float64
+var allowlist stringList
+var denylist stringList
+var stageTiming bool
+var summaryInterval time.Duration
+var reportWindow time.Duration
+var healthMetric string
+var metricInventory bool
+var inventoryInterval time.Duration
+var healthInterval time.Duration
+var livenessWindow time.Duration
+var summaryFormat string
+var pprofEnabled bool
+var pprofUser string
+var pprofPassword string
+var adminUser string
+var adminPassword string
+var payloadBudget int
+var bufferCapacity int
+var walDir string
+var walSegmentBytes int
+var metricPriorities stringList
+var valueTransforms stringList
+var requiredTags stringList
+var requestIDHeader string
+var outgoingIDHeader string
+var cardinalityThreshold uint64
+var cardinalityAction string
+var ndjsonURL string
+var ndjsonMaxBytes int
+var strictResponses bool
+var integerValues bool
+var maxBatchBytes int
+var commonTags string
+var flushBytes int
+var hmacSecret string
+var provisionFile string
+var pruneTagValues stringList
+var preValidate bool
+var localChecks bool
+var maxAge time.Duration
+var latencyAlert time.Duration
+var apiURL string
+var annotationStream string
+var alertSnapshotSpace int
+var decompression bool
+var keepAlive time.Duration
+var localStore time.Duration
+var queryAppOptics bool
+var configFile string
+var tagCollision string
+var nameTemplate string
+var tagsTemplate string
+var metricAttributes string
+var unitAnnotation bool
+var metricUnits stringList
+var logSink string
+var logSinkFormat string
+var bucketTag string
+var histogramMode string
+var nameSuffixes string
+var nameSuffixMap string
+var quantileTag string
+var basicAuthEncoding string
 
 func init() {
 	flag.IntVar(&bindPort, "bind-port", 4567, "the port the HTTP server binds to")
 	flag.StringVar(&accessToken, "access-token", "", "the API token used for auth")
 	flag.BoolVar(&sendStats, "send-stats", false, "sends data on the wire if true, prints to stdout if false")
 	flag.BoolVar(&printVersionAndExit, "version", false, "print version and exit")
+	flag.BoolVar(&dumpConfigAndExit, "dump-config", false, "print the effective configuration as JSON, with credentials redacted, and exit")
+	flag.StringVar(&listMetricsAndExit, "list-metrics", "", "print the name, type and period of every AppOptics metric whose name starts with this prefix, and exit")
+	flag.StringVar(&deleteMetricsAndExit, "delete-metrics", "", "a file of AppOptics metric names, one per line, to delete along with all of their measurements, and exit; only listed unless --confirm-delete is given")
+	flag.BoolVar(&confirmDelete, "confirm-delete", false, "actually delete the metrics of --delete-metrics")
+	flag.IntVar(&retryAttempts, "retry-attempts", 3, "the number of times a batch is sent to AppOptics before giving up")
+	flag.DurationVar(&retryBudget, "retry-budget", 0, "if set, the time all attempts at a batch and the pauses between them may take together")
+	flag.DurationVar(&attemptTimeout, "attempt-timeout", 0, "if set, the time a single attempt at a batch may take")
+	flag.StringVar(&federateURL, "federate-url", "", "if set, samples are also pulled from the /federate endpoint of the Prometheus server at this URL")
+	flag.Var(&federateMatch, "federate-match", "a series selector passed to /federate as match[], may be repeated")
+	flag.DurationVar(&federateInterval, "federate-interval", time.Minute, "how often samples are pulled from /federate")
+	flag.IntVar(&aggregationSize, "aggregation-cache-size", 0, "if set, values are aggregated per series between flushes, keeping the state of at most this many series")
+	flag.StringVar(&aggregationStrategy, "aggregation-strategy", "last", "how aggregated values are combined: last, sum, min, max or summary")
+	flag.DurationVar(&aggregationInterval, "aggregation-interval", time.Minute, "how often aggregated values are flushed")
+	flag.StringVar(&federateUser, "federate-user", "", "the basic auth user /federate is requested with")
+	flag.StringVar(&federatePassword, "federate-password", "", "the basic auth password /federate is requested with")
+	flag.StringVar(&federateToken, "federate-bearer-token", "", "the bearer token /federate is requested with")
+	flag.StringVar(&federateTokenFile, "federate-bearer-token-file", "", "a file holding the bearer token /federate is requested with, read again for every request")
+	flag.StringVar(&federateSecret, "federate-secret", "", "a namespace/name Kubernetes Secret whose token, or username and password, /federate is requested with, watched for updates")
+	flag.StringVar(&federateExemplars, "federate-exemplar-stream", "", "if set, OpenMetrics is asked for and the exemplars with a trace ID it carries are recorded as annotations on this stream")
+	flag.StringVar(&lokiURL, "loki-url", "", "if set, JSON log lines are also tailed from the Grafana Loki server at this URL")
+	flag.StringVar(&lokiQuery, "loki-query", "", "the LogQL stream selector of the log lines tailed from Loki")
+	flag.Var(&lokiFields, "loki-field", "a field=metric pair sending a numeric JSON field of Loki log lines as a metric, may be repeated")
+	flag.StringVar(&dogstatsdAddress, "dogstatsd-address", "", "if set, DogStatsD packets are also received on this UDP address, e.g. :8125, and their metrics run through the same filters and checks as Prometheus samples")
+	flag.DurationVar(&dogstatsdInterval, "dogstatsd-flush-interval", 10*time.Second, "how often the metrics received over DogStatsD are submitted")
+	flag.DurationVar(&loadTest, "load-test", 0, "if set, synthetic measurements are submitted for this long instead of serving Prometheus, then the adapter exits")
+	flag.IntVar(&loadTestMetrics, "load-test-metrics", 100, "the number of distinct metrics a --load-test submits")
+	flag.IntVar(&loadTestSeries, "load-test-series", 10, "the number of series of every --load-test metric")
+	flag.IntVar(&loadTestTags, "load-test-tags", 3, "the number of tags of every --load-test series")
+	flag.Float64Var(&loadTestRate, "load-test-rate", 1000, "the number of measurements a --load-test submits per second")
+	flag.Var(&allowlist, "allow-metric", "a regular expression metric names must match to be sent, may be repeated")
+	flag.Var(&denylist, "deny-metric", "a regular expression of metric names that are never sent, may be repeated")
+	flag.DurationVar(&summaryInterval, "summary-interval", 0, "how often a summary of submitted, failed and dropped measurements is printed, 0 to disable")
+	flag.StringVar(&summaryFormat, "summary-format", "table", "the format of the periodic summary: table or json")
+	flag.DurationVar(&reportWindow, "report-window", 0, "how often a report of submissions, drops, retries, lag and error rate over the last window is logged, 0 to disable")
+	flag.StringVar(&healthMetric, "health-metric", "", "if set, a gauge of this name reporting the adapter's health is submitted to AppOptics every --health-interval")
+	flag.DurationVar(&healthInterval, "health-interval", time.Minute, "how often the --health-metric gauge is submitted")
+	flag.DurationVar(&livenessWindow, "liveness-window", 0, "if set, /healthz reports the adapter unhealthy once no submission has succeeded for this long")
+	flag.BoolVar(&metricInventory, "metric-inventory", false, "if true, gauges of the number of distinct metric names received and of measurements per metric are submitted to AppOptics every --metric-inventory-interval")
+	flag.DurationVar(&inventoryInterval, "metric-inventory-interval", time.Minute, "how often the --metric-inventory gauges are submitted")
+	flag.BoolVar(&stageTiming, "stage-timing", false, "record how long each pipeline stage takes in the self-metrics")
+	flag.BoolVar(&pprofEnabled, "pprof", false, "serve runtime profiling data under /debug/pprof/")
+	flag.StringVar(&pprofUser, "pprof-user", "", "the basic auth user required to access /debug/pprof/")
+	flag.StringVar(&pprofPassword, "pprof-password", "", "the basic auth password required to access /debug/pprof/")
+	flag.StringVar(&adminUser, "admin-user", "", "the basic auth user required to replace the metric lists through PUT /config/*, which is only served if set")
+	flag.StringVar(&adminPassword, "admin-password", "", "the basic auth password required to replace the metric lists through PUT /config/*")
+	flag.IntVar(&bufferCapacity, "buffer-capacity", 0, "the number of measurements buffered before low-priority ones are dropped, 0 to block on a full queue instead")
+	flag.StringVar(&walDir, "wal-dir", "", "if set, batches are written to a write-ahead log in this directory before being sent, and those left unsent by a crash are sent first on restart")
+	flag.IntVar(&walSegmentBytes, "wal-segment-bytes", 16<<20, "the size in bytes a write-ahead log segment grows to before a new one is started")
+	flag.Var(&metricPriorities, "metric-priority", "a pattern=priority pair, metrics with higher priorities are dropped last from a full buffer, may be repeated")
+	flag.Var(&valueTransforms, "value-transform", "a pattern=operation:operand transform (multiply, divide or offset) applied to the values of matching metrics, may be repeated")
+	flag.Var(&requiredTags, "require-tag", "a tag key every submitted measurement must have, measurements without it are dropped, may be repeated")
+	flag.IntVar(&payloadBudget, "payload-budget", 0, "the target size in bytes of a single encoded measurement, reached by trimming value precision and tags, 0 to disable")
+	flag.Uint64Var(&cardinalityThreshold, "cardinality-threshold", 0, "the number of distinct tag sets a metric may have before --cardinality-action applies, 0 to disable")
+	flag.StringVar(&cardinalityAction, "cardinality-action", "keep", "what to do with metrics over --cardinality-threshold: keep, drop or drop-tags")
+	flag.StringVar(&ndjsonURL, "ndjson-url", "", "if set, measurements are streamed to this bulk ingest URL as newline-delimited JSON")
+	flag.IntVar(&ndjsonMaxBytes, "ndjson-max-bytes", 1<<20, "the maximum size of a single newline-delimited JSON request body")
+	flag.BoolVar(&strictResponses, "strict-responses", false, "if true, newline-delimited JSON requests answered with a 2xx whose body carries an errors field fail")
+	flag.BoolVar(&integerValues, "integer-values", false, "if true, whole values are sent as JSON integers in newline-delimited JSON requests")
+	flag.StringVar(&commonTags, "common-tags", "off", "how tags shared by a batch are sent once for the batch: off, identical (only when all measurements have the same tags) or merge")
+	flag.IntVar(&maxBatchBytes, "max-batch-bytes", 0, "the maximum size in bytes of an encoded batch, larger ones are split, 0 for no limit")
+	flag.IntVar(&flushBytes, "flush-bytes", 0, "flushes a batch once its buffered measurements take up roughly this many bytes of memory, 0 to only flush by count and time")
+	flag.StringVar(&basicAuthEncoding, "basic-auth-encoding", "standard", "the base64 variant of the newline-delimited JSON Authorization header: standard, url or url-nopad")
+	flag.StringVar(&histogramMode, "histogram-mode", "buckets", "how histograms are forwarded: buckets, one measurement per bucket, or heatmap, one measurement per histogram")
+	flag.StringVar(&nameSuffixes, "name-suffixes", "keep", "what happens to the _bucket, _sum, _count and _total suffixes of metric names: keep, strip or map")
+	flag.StringVar(&nameSuffixMap, "name-suffix-map", "", "comma-separated suffix=replacement pairs --name-suffixes=map applies, by default _total=.total and likewise for the others")
+	flag.StringVar(&bucketTag, "bucket-tag", "le", "the tag key histogram bucket bounds are forwarded under")
+	flag.StringVar(&quantileTag, "quantile-tag", "quantile", "the tag key summary quantiles are forwarded under")
+	flag.StringVar(&logSink, "log-sink", "", "if set, every submitted measurement is also appended to this file")
+	flag.StringVar(&logSinkFormat, "log-sink-format", "json", "the format measurements are appended to the log sink in: json or csv")
+	flag.StringVar(&metricAttributes, "metric-attributes", "", "if set, a JSON file of metric names to the AppOptics display attributes they are kept in line with")
+	flag.BoolVar(&unitAnnotation, "unit-annotation", false, "if true, measurements of metrics named like foo_bytes or foo_seconds carry their display unit")
+	flag.Var(&metricUnits, "metric-unit", "a pattern=unit pair, measurements of matching metrics carry the display unit with --unit-annotation, may be repeated")
+	flag.StringVar(&nameTemplate, "name-template", "", "a Go text/template computing each measurement's name from its .Name and .Tags")
+	flag.StringVar(&tagsTemplate, "tags-template", "", "a Go text/template rendering each measurement's tags as key=value lines from its .Name and .Tags")
+	flag.StringVar(&tagCollision, "tag-collision", "prefer-metric", "what happens when a measurement already has a global tag: prefer-metric, prefer-injected, prefix or error")
+	flag.StringVar(&configFile, "config-file", "", "if set, a YAML file of allowlist, denylist, global_tags and label_mappings that is reloaded whenever it changes")
+	flag.DurationVar(&keepAlive, "keep-alive-interval", 0, "if set, the AppOptics connection is warmed up at startup and pinged after being idle this long")
+	flag.DurationVar(&localStore, "local-store-retention", 0, "if set, received measurements are kept in memory this long and served from /api/v1/query_range")
+	flag.BoolVar(&queryAppOptics, "query-appoptics", false, "if set, /api/v1/query_range is answered with the measurements forwarded to AppOptics, queried back at the resolution closest to step")
+	flag.BoolVar(&decompression, "response-decompression", true, "request gzip-compressed responses from AppOptics and other HTTP endpoints and decompress them")
+	flag.StringVar(&apiURL, "api-url", "https://api.appoptics.com/v1/", "the base URL of the AppOptics API, including any path prefix added by a gateway")
+	flag.StringVar(&requestIDHeader, "request-id-header", "", "if set, the request ID is read from this header of incoming requests, or generated, and forwarded to AppOptics")
+	flag.StringVar(&outgoingIDHeader, "outgoing-request-id-header", "X-Request-Id", "the header the request ID is sent to AppOptics in when --request-id-header is set")
+	flag.StringVar(&annotationStream, "annotation-stream", "", "if set, Alertmanager notifications POSTed to /webhook are recorded as annotations on this stream")
+	flag.IntVar(&alertSnapshotSpace, "alert-snapshot-space", 0, "if set with --annotation-stream, a snapshot of the Space with this ID is taken whenever an alert starts firing and linked from its annotation")
+	flag.BoolVar(&localChecks, "check-measurements", false, "drops measurements with names, tags or values AppOptics would reject before they are batched")
+	flag.DurationVar(&maxAge, "max-measurement-age", 0, "with --check-measurements, also drops measurements older than this, 0 for no limit")
+	flag.DurationVar(&latencyAlert, "latency-alert", 0, "if set, a warning is logged for every metric whose measurements reach AppOptics longer than this after they were sampled")
+	flag.BoolVar(&preValidate, "pre-validate", false, "validates every batch with AppOptics first and drops invalid measurements instead of failing the batch")
+	flag.StringVar(&hmacSecret, "hmac-secret", "", "if set, newline-delimited JSON requests are signed with this shared secret for a fronting API gateway")
+	flag.Float64Var(&seriesRateLimit, "series-rate-limit", 0, "the maximum measurements per second sent for any one series, 0 for no limit")
+	flag.DurationVar(&seriesMinInterval, "series-min-interval", 0, "the minimum time between two measurements sent for any one series, 0 for none")
+	flag.Var(&pruneTagValues, "prune-tag-values", "a metric:tag:age triple, values of the metric's tag not reported for age are deleted at start and then weekly, may be repeated")
+	flag.StringVar(&provisionFile, "provision-file", "", "a JSON file of AppOptics spaces, notification services and alerts to create or update at startup")
+	flag.DurationVar(&dedupWindow, "deduplicate", 0, "if set, measurements of a series and timestamp already submitted within this window are suppressed")
+	flag.IntVar(&dedupBloomItems, "dedup-bloom-items", 0, "if set, --deduplicate remembers this many measurements per window in a fixed-size Bloom filter instead of exactly")
+	flag.Float64Var(&dedupBloomFPRate, "dedup-bloom-fp-rate", 0.01, "the false positive rate of the --dedup-bloom-items Bloom filter")
+	flag.IntVar(&fingerprintCache, "dedup-fingerprint-cache", 0, "if set, the number of tag maps whose series key --deduplicate caches instead of sorting their tags again")
+	flag.BoolVar(&logDuplicates, "log-duplicates", false, "if true, every measurement suppressed by --deduplicate is logged")
+	flag.BoolVar(&onlyOnChange, "only-on-change", false, "if true, a gauge measurement is only sent when its value differs from the last one sent for its series")
+	flag.DurationVar(&changeHeartbeat, "change-heartbeat", 10*time.Minute, "with --only-on-change, unchanged values are still sent this often")
+	flag.BoolVar(&throttle, "throttle", false, "forwards a shrinking fraction of measurements as the queue fills up instead of dropping them once it is full")
+	flag.Float64Var(&throttleStart, "throttle-start", 0.5, "the fraction of queue capacity at which throttling begins")
+	flag.Float64Var(&throttleFull, "throttle-full", 0.9, "the fraction of queue capacity at which the throttle factor reaches --throttle-min-factor")
+	flag.Float64Var(&throttleMin, "throttle-min-factor", 0.1, "the smallest fraction of measurements forwarded while throttling")
+	flag.StringVar(&retryStatusCodes, "retry-status-codes", "408,429", "comma-separated 4xx status codes other than 400 to retry (5xx and network errors are always retried)")
+	flag.StringVar(&duplicates, "duplicate-measurements", "fail", "what happens to a batch AppOptics rejects because a measurement already exists at its timestamp: fail or ignore, treating it as already ingested")
+	flag.BoolVar(&timestampFallback, "timestamp-fallback", false, "if true, samples without a timestamp are timed with the time they are received at instead of being rejected by AppOptics")
+	flag.DurationVar(&nullForMissing, "null-for-missing", 0, "the detection interval of missing series: if set, a measurement with a null value is submitted for every series received in one interval of this length but not in the next, 0 to disable")
+	flag.Float64Var(&degradedErrorRate, "degraded-error-rate", 0, "if set, batches are sent in smaller parts with a pause between them while more than this fraction of submissions failed over the last minute")
+	flag.Float64Var(&degradedReduction, "degraded-reduction", 0.5, "the fraction of its size each part of a batch has in degraded mode")
+	flag.DurationVar(&degradedDelay, "degraded-delay", time.Second, "the pause between the parts of a batch in degraded mode")
+	flag.IntVar(&logSampleRate, "log-sample-rate", 1, "only 1 in this many identical errors repeated for every batch is logged")
+	flag.DurationVar(&logSampleInterval, "log-sample-interval", 0, "if set, identical errors repeated for every batch are logged the first time and then at most once per interval, overriding --log-sample-rate")
+	flag.Float64Var(&injectFailureRate, "inject-failure-rate", 0, "FOR CHAOS TESTING ONLY: the fraction of the adapter's own requests to AppOptics failed on purpose with one of --inject-failures")
+	flag.StringVar(&injectFailures, "inject-failures", "500,503,error", "comma-separated status codes, or error for a transport error, --inject-failure-rate fails requests with")
+	flag.StringVar(&requestPriority, "request-priority", "normal", "priority AppOptics processes the adapter's requests with during API congestion: low, normal or high")
+	flag.StringVar(&auditLog, "audit-log", "", "if set, every request the adapter makes to AppOptics and its response is recorded in this file")
+	flag.DurationVar(&readCacheTTL, "read-cache-ttl", 0, "if set, 2xx responses to the adapter's GET requests for AppOptics metric definitions are cached this long")
+	flag.Var(&metricRequestPriorities, "metric-request-priority", "a metric=priority pair, measurements of the metric are sent in requests of that priority, may be repeated")
 
 	flag.Parse()
 
@@ -37,20 +281,315 @@ func init() {
 }
 
 type Config struct {
-	bindPort    int
-	accessEmail string
-	accessToken string
-	sendStats   bool
+	bindPort         int
+	accessEmail      string
+	accessToken      string
+	sendStats        bool
+	retryAttempts    int
+	retryBudget      time.Duration
+	attemptTimeout   time.Duration
+	retryStatusCodes []int
+	duplicates       string
+	requestPriority  string
+	auditLog         string
+	readCacheTTL     time.Duration
+	injectRate       float64
+	nowFallback      bool
+	nullInterval     time.Duration
+	degradedRate     float64
+	degradedFactor   float64
+	degradedDelay    time.Duration
+	logSampleRate    int
+	logSampleEvery   time.Duration
+	injectFailures   string
+	seriesRateLimit  float64
+	minInterval      time.Duration
+	onlyOnChange     bool
+	dedupWindow      time.Duration
+	dedupBloomItems  int
+	dedupBloomFP     float64
+	fingerprintCache int
+	logDuplicates    bool
+	changeHeartbeat  time.Duration
+	throttle         bool
+	throttleStart    float64
+	throttleFull     float64
+	throttleMin      float64
+	payloadBudget    int
+	ndjsonURL        string
+	ndjsonMaxBytes   int
+	strictResponses  bool
+	integerValues    bool
+	maxBatchBytes    int
+	commonTags       string
+	flushBytes       int
+	hmacSecret       string
+	preValidate      bool
+	localChecks      bool
+	maxAge           time.Duration
+	latencyAlert     time.Duration
+	apiURL           string
+	annotationStream string
+	decompression    bool
+	keepAlive        time.Duration
+	localStore       time.Duration
+	queryAppOptics   bool
+	configFile       string
+	tagCollision     string
+	nameTemplate     string
+	tagsTemplate     string
+	metricAttributes string
+	unitAnnotation   bool
+	metricUnits      []string
+	logSink          string
+	logSinkFormat    string
+	bucketTag        string
+	histogramMode    string
+	nameSuffixes     string
+	nameSuffixMap    string
+	quantileTag      string
+
+	cardinalityThreshold uint64
+	cardinalityAction    string
+	basicAuthEncoding    string
+	bufferCapacity       int
+	walDir               string
+	walSegmentBytes      int
+	metricPriorities     []string
+	requestPriorities    []string
+	valueTransforms      []string
+	requiredTags         []string
+	requestIDHeader      string
+	outgoingIDHeader     string
+
+	stageTiming     bool
+	summaryInterval time.Duration
+	reportWindow    time.Duration
+	healthMetric    string
+	healthInterval  time.Duration
+	livenessWindow  time.Duration
+	metricInventory bool
+	inventoryPeriod time.Duration
+	summaryFormat   string
+	pprofEnabled    bool
+	pprofUser       string
+	pprofPassword   string
+	adminUser       string
+	adminPassword   string
+
+	allowlist []string
+	denylist  []string
+
+	federateURL      string
+	federateMatch    []string
+	federateInterval time.Duration
+
+	federateUser      string
+	federatePassword  string
+	federateToken     string
+	federateTokenFile string
+	federateSecret    string
+	federateExemplars string
+
+	aggregationSize     int
+	aggregationStrategy string
+	aggregationInterval time.Duration
+
+	lokiURL    string
+	lokiQuery  string
+	lokiFields []string
+
+	provisionFile  string
+	pruneTagValues []string
+
+	alertSnapshotSpace int
+
+	dogstatsdAddress  string
+	dogstatsdInterval time.Duration
+
+	loadTest        time.Duration
+	loadTestMetrics int
+	loadTestSeries  int
+	loadTestTags    int
+	loadTestRate    float64
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
 }
 
 func New() *Config {
+	codes, err := parseStatusCodes(retryStatusCodes)
+	if err != nil {
+		log.Fatalf("invalid --retry-status-codes: %s", err)
+	}
+
 	return &Config{
-		bindPort:    bindPort,
-		accessToken: accessToken,
-		sendStats:   sendStats,
+		bindPort:         bindPort,
+		accessToken:      accessToken,
+		sendStats:        sendStats,
+		retryAttempts:    retryAttempts,
+		retryBudget:      retryBudget,
+		attemptTimeout:   attemptTimeout,
+		retryStatusCodes: codes,
+		duplicates:       duplicates,
+		requestPriority:  requestPriority,
+		auditLog:         auditLog,
+		readCacheTTL:     readCacheTTL,
+		injectRate:       injectFailureRate,
+		nowFallback:      timestampFallback,
+		nullInterval:     nullForMissing,
+		degradedRate:     degradedErrorRate,
+		degradedFactor:   degradedReduction,
+		degradedDelay:    degradedDelay,
+		logSampleRate:    logSampleRate,
+		logSampleEvery:   logSampleInterval,
+		injectFailures:   injectFailures,
+		seriesRateLimit:  seriesRateLimit,
+		minInterval:      seriesMinInterval,
+		onlyOnChange:     onlyOnChange,
+		dedupWindow:      dedupWindow,
+		dedupBloomItems:  dedupBloomItems,
+		dedupBloomFP:     dedupBloomFPRate,
+		fingerprintCache: fingerprintCache,
+		logDuplicates:    logDuplicates,
+		changeHeartbeat:  changeHeartbeat,
+		throttle:         throttle,
+		throttleStart:    throttleStart,
+		throttleFull:     throttleFull,
+		throttleMin:      throttleMin,
+		payloadBudget:    payloadBudget,
+		ndjsonURL:        ndjsonURL,
+		ndjsonMaxBytes:   ndjsonMaxBytes,
+		strictResponses:  strictResponses,
+		integerValues:    integerValues,
+		maxBatchBytes:    maxBatchBytes,
+		commonTags:       commonTags,
+		flushBytes:       flushBytes,
+		hmacSecret:       hmacSecret,
+		preValidate:      preValidate,
+		localChecks:      localChecks,
+		maxAge:           maxAge,
+		latencyAlert:     latencyAlert,
+		apiURL:           apiURL,
+		annotationStream: annotationStream,
+		decompression:    decompression,
+		keepAlive:        keepAlive,
+		localStore:       localStore,
+		queryAppOptics:   queryAppOptics,
+		configFile:       configFile,
+		tagCollision:     tagCollision,
+		nameTemplate:     nameTemplate,
+		tagsTemplate:     tagsTemplate,
+		metricAttributes: metricAttributes,
+		unitAnnotation:   unitAnnotation,
+		metricUnits:      metricUnits,
+		logSink:          logSink,
+		logSinkFormat:    logSinkFormat,
+		bucketTag:        bucketTag,
+		histogramMode:    histogramMode,
+		nameSuffixes:     nameSuffixes,
+		nameSuffixMap:    nameSuffixMap,
+		quantileTag:      quantileTag,
+
+		cardinalityThreshold: cardinalityThreshold,
+		cardinalityAction:    cardinalityAction,
+		basicAuthEncoding:    basicAuthEncoding,
+		bufferCapacity:       bufferCapacity,
+		walDir:               walDir,
+		walSegmentBytes:      walSegmentBytes,
+		metricPriorities:     metricPriorities,
+		requestPriorities:    metricRequestPriorities,
+		valueTransforms:      valueTransforms,
+		requiredTags:         requiredTags,
+		requestIDHeader:      requestIDHeader,
+		outgoingIDHeader:     outgoingIDHeader,
+
+		stageTiming:     stageTiming,
+		summaryInterval: summaryInterval,
+		reportWindow:    reportWindow,
+		healthMetric:    healthMetric,
+		healthInterval:  healthInterval,
+		livenessWindow:  livenessWindow,
+		metricInventory: metricInventory,
+		inventoryPeriod: inventoryInterval,
+		summaryFormat:   summaryFormat,
+		pprofEnabled:    pprofEnabled,
+		pprofUser:       pprofUser,
+		pprofPassword:   pprofPassword,
+		adminUser:       adminUser,
+		adminPassword:   adminPassword,
+
+		allowlist: allowlist,
+		denylist:  denylist,
+
+		federateURL:      federateURL,
+		federateMatch:    federateMatch,
+		federateInterval: federateInterval,
+
+		federateUser:      federateUser,
+		federatePassword:  federatePassword,
+		federateToken:     federateToken,
+		federateTokenFile: federateTokenFile,
+		federateSecret:    federateSecret,
+		federateExemplars: federateExemplars,
+
+		aggregationSize:     aggregationSize,
+		aggregationStrategy: aggregationStrategy,
+		aggregationInterval: aggregationInterval,
+
+		lokiURL:    lokiURL,
+		lokiQuery:  lokiQuery,
+		lokiFields: lokiFields,
+
+		provisionFile:  provisionFile,
+		pruneTagValues: pruneTagValues,
+
+		alertSnapshotSpace: alertSnapshotSpace,
+
+		dogstatsdAddress:  dogstatsdAddress,
+		dogstatsdInterval: dogstatsdInterval,
+
+		loadTest:        loadTest,
+		loadTestMetrics: loadTestMetrics,
+		loadTestSeries:  loadTestSeries,
+		loadTestTags:    loadTestTags,
+		loadTestRate:    loadTestRate,
 	}
 }
 
+// parseStatusCodes converts a comma-separated list of HTTP status codes into ints. 400 is rejected, as a malformed
+// request fails the same way however often it is sent.
+func parseStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if code < 400 || code > 499 {
+			return nil, fmt.Errorf("%d is not a 4xx status code", code)
+		}
+		if code == 400 {
+			return nil, fmt.Errorf("400 is never retried")
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
 
 // AccessToken returns a string representing a AppOptics API token
 func AccessToken() string {
@@ -62,11 +601,540 @@ func BindPort() int {
 	return globalConf.bindPort
 }
 
+// BufferCapacity returns the number of measurements buffered before low-priority ones are dropped. Zero disables the
+// buffer, so a full queue blocks incoming requests instead.
+func BufferCapacity() int {
+	return globalConf.bufferCapacity
+}
+
+// WAL returns the directory batches are logged to before being sent, or an empty string if they are not, and the size
+// a segment of the log grows to before a new one is started
+func WAL() (string, int) {
+	return globalConf.walDir, globalConf.walSegmentBytes
+}
+
+// MetricPriorities returns the pattern=priority pairs deciding which metrics are dropped last from a full buffer
+func MetricPriorities() []string {
+	return globalConf.metricPriorities
+}
+
+// ValueTransforms returns the pattern=operation:operand transforms converting the values of matching metrics
+func ValueTransforms() []string {
+	return globalConf.valueTransforms
+}
+
+// RequiredTags returns the tag keys every submitted measurement must have
+func RequiredTags() []string {
+	return globalConf.requiredTags
+}
+
+// PayloadBudget returns the target size in bytes of a single encoded measurement. Zero disables trimming.
+func PayloadBudget() int {
+	return globalConf.payloadBudget
+}
+
+// CardinalityThreshold returns the number of distinct tag sets a metric may have before CardinalityAction applies.
+// Zero disables cardinality tracking.
+func CardinalityThreshold() uint64 {
+	return globalConf.cardinalityThreshold
+}
+
+// CardinalityAction returns what to do with metrics over the cardinality threshold: keep, drop or drop-tags
+func CardinalityAction() string {
+	return globalConf.cardinalityAction
+}
+
+// NDJSONURL returns the bulk ingest URL measurements are streamed to as newline-delimited JSON, or an empty string if
+// they are sent through the AppOptics measurements API
+func NDJSONURL() string {
+	return globalConf.ndjsonURL
+}
+
+// APIURL returns the base URL of the AppOptics API
+func APIURL() string {
+	return globalConf.apiURL
+}
+
+// AnnotationStream returns the annotation stream Alertmanager notifications are recorded on, or an empty string if
+// the webhook is disabled
+func AnnotationStream() string {
+	return globalConf.annotationStream
+}
+
+// AlertSnapshotSpace returns the ID of the Space a snapshot is taken of whenever an alert starts firing, 0 if none
+// are taken
+func AlertSnapshotSpace() int {
+	return globalConf.alertSnapshotSpace
+}
+
+// RequestIDHeaders returns the header request IDs are read from on incoming requests, empty if request IDs are not
+// propagated, and the header they are sent to AppOptics in
+func RequestIDHeaders() (incoming, outgoing string) {
+	return globalConf.requestIDHeader, globalConf.outgoingIDHeader
+}
+
+// ResponseDecompression returns whether gzip-compressed responses are requested and decompressed
+func ResponseDecompression() bool {
+	return globalConf.decompression
+}
+
+// PreValidate returns whether batches are validated with AppOptics before being submitted
+func PreValidate() bool {
+	return globalConf.preValidate
+}
+
+// MetricAttributes returns the JSON file of desired metric attributes, or an empty string if attributes are left alone
+func MetricAttributes() string {
+	return globalConf.metricAttributes
+}
+
+// UnitAnnotation returns whether measurements carry the display unit of their metric, and the pattern=unit pairs
+// applied before the defaults
+func UnitAnnotation() (bool, []string) {
+	return globalConf.unitAnnotation, globalConf.metricUnits
+}
+
+// TagCollision returns what happens when a measurement already has a global tag: prefer-metric, prefer-injected,
+// prefix or error
+func TagCollision() string {
+	return globalConf.tagCollision
+}
+
+// NameTemplate returns the text/template measurement names are computed with, or an empty string to keep them
+func NameTemplate() string {
+	return globalConf.nameTemplate
+}
+
+// TagsTemplate returns the text/template measurement tags are computed with, or an empty string to keep them
+func TagsTemplate() string {
+	return globalConf.tagsTemplate
+}
+
+// KeepAliveInterval returns how long the AppOptics connection may be idle before it is pinged. Zero disables the
+// warm-up and keep-alive pings.
+func KeepAliveInterval() time.Duration {
+	return globalConf.keepAlive
+}
+
+// LocalStoreRetention returns how long received measurements are kept in memory to answer queries. Zero disables the
+// local store.
+func LocalStoreRetention() time.Duration {
+	return globalConf.localStore
+}
+
+// QueryAppOptics returns whether queries are answered with measurements queried back from AppOptics rather than from
+// the local store
+func QueryAppOptics() bool {
+	return globalConf.queryAppOptics
+}
+
+// ConfigFile returns the YAML file of reloadable settings, or an empty string if there is none
+func ConfigFile() string {
+	return globalConf.configFile
+}
+
+// LogSink returns the file every submitted measurement is also appended to, or an empty string if there is none
+func LogSink() string {
+	return globalConf.logSink
+}
+
+// LogSinkFormat returns the format measurements are appended to the log sink in: json or csv
+func LogSinkFormat() string {
+	return globalConf.logSinkFormat
+}
+
+// HistogramMode returns how histograms are forwarded: buckets or heatmap
+func HistogramMode() string {
+	return globalConf.histogramMode
+}
+
+// NameSuffixes returns what happens to the suffixes of metric names, keep, strip or map, and the suffix=replacement
+// pairs mapping applies
+func NameSuffixes() (string, string) {
+	return globalConf.nameSuffixes, globalConf.nameSuffixMap
+}
+
+// BucketTag returns the tag key histogram bucket bounds are forwarded under
+func BucketTag() string {
+	return globalConf.bucketTag
+}
+
+// QuantileTag returns the tag key summary quantiles are forwarded under
+func QuantileTag() string {
+	return globalConf.quantileTag
+}
+
+// CheckMeasurements returns whether measurements AppOptics would reject are dropped before they are batched
+func CheckMeasurements() bool {
+	return globalConf.localChecks
+}
+
+// MaxMeasurementAge returns the age beyond which checked measurements are dropped. Zero means no limit.
+func MaxMeasurementAge() time.Duration {
+	return globalConf.maxAge
+}
+
+// CommonTags returns how the tags shared by the measurements of a batch are sent once for the batch: off, identical or
+// merge
+func CommonTags() string {
+	return globalConf.commonTags
+}
+
+// LatencyAlert returns the latency beyond which a late metric is logged. Zero disables the warnings.
+func LatencyAlert() time.Duration {
+	return globalConf.latencyAlert
+}
+
+// MaxBatchBytes returns the maximum size in bytes of an encoded batch of measurements. Zero means no limit.
+func MaxBatchBytes() int {
+	return globalConf.maxBatchBytes
+}
+
+// FlushBytes returns how much memory, in bytes, buffered measurements may take up before their batch is flushed.
+// Zero means batches are only flushed by count and time.
+func FlushBytes() int {
+	return globalConf.flushBytes
+}
+
+// NDJSONMaxBytes returns the maximum size of a single newline-delimited JSON request body
+func NDJSONMaxBytes() int {
+	return globalConf.ndjsonMaxBytes
+}
+
+// StrictResponses returns whether newline-delimited JSON requests answered with a 2xx carrying errors fail
+func StrictResponses() bool {
+	return globalConf.strictResponses
+}
+
+// IntegerValues returns whether whole values are sent as JSON integers in newline-delimited JSON requests
+func IntegerValues() bool {
+	return globalConf.integerValues
+}
+
+// FederateURL returns the base URL of the Prometheus server samples are pulled from, or an empty string if federation
+// is disabled
+func FederateURL() string {
+	return globalConf.federateURL
+}
+
+// FederateMatch returns the series selectors passed to /federate
+func FederateMatch() []string {
+	return globalConf.federateMatch
+}
+
+// FederateInterval returns how often samples are pulled from /federate
+func FederateInterval() time.Duration {
+	return globalConf.federateInterval
+}
+
+// FederateBasicAuth returns the basic auth credentials /federate is requested with, empty if there are none
+func FederateBasicAuth() (string, string) {
+	return globalConf.federateUser, globalConf.federatePassword
+}
+
+// FederateBearerToken returns the bearer token /federate is requested with, or an empty string if there is none
+func FederateBearerToken() string {
+	return globalConf.federateToken
+}
+
+// FederateBearerTokenFile returns the file holding the bearer token /federate is requested with, or an empty string
+// if there is none
+func FederateBearerTokenFile() string {
+	return globalConf.federateTokenFile
+}
+
+// FederateSecret returns the namespace and name of the Kubernetes Secret holding the credentials /federate is
+// requested with, empty if there is none
+func FederateSecret() (string, string) {
+	if i := strings.Index(globalConf.federateSecret, "/"); i >= 0 {
+		return globalConf.federateSecret[:i], globalConf.federateSecret[i+1:]
+	}
+	return "", globalConf.federateSecret
+}
+
+// FederateExemplarStream returns the annotation stream the exemplars of pulled samples are recorded on, or an empty
+// string if they are not
+func FederateExemplarStream() string {
+	return globalConf.federateExemplars
+}
+
+// AggregationCacheSize returns how many series values are aggregated for at most. Zero disables aggregation.
+func AggregationCacheSize() int {
+	return globalConf.aggregationSize
+}
+
+// AggregationStrategy returns how the values of a series are combined between flushes
+func AggregationStrategy() string {
+	return globalConf.aggregationStrategy
+}
+
+// AggregationInterval returns how often aggregated values are flushed
+func AggregationInterval() time.Duration {
+	return globalConf.aggregationInterval
+}
+
+// LokiURL returns the Grafana Loki server log lines are tailed from, or an empty string if there is none
+func LokiURL() string {
+	return globalConf.lokiURL
+}
+
+// LokiQuery returns the LogQL stream selector of the log lines tailed from Loki
+func LokiQuery() string {
+	return globalConf.lokiQuery
+}
+
+// LokiFields returns the field=metric pairs of numeric fields sent from Loki log lines
+func LokiFields() []string {
+	return globalConf.lokiFields
+}
+
+// DogStatsD returns the UDP address DogStatsD packets are received on, or an empty string if they are not, and how
+// often the metrics received are submitted
+func DogStatsD() (string, time.Duration) {
+	return globalConf.dogstatsdAddress, globalConf.dogstatsdInterval
+}
+
+// LoadTest returns how long synthetic measurements are submitted for instead of serving Prometheus, zero if they are
+// not
+func LoadTest() time.Duration {
+	return globalConf.loadTest
+}
+
+// LoadTestShape returns the number of metrics a load test submits, of series per metric and of tags per series
+func LoadTestShape() (metrics, series, tags int) {
+	return globalConf.loadTestMetrics, globalConf.loadTestSeries, globalConf.loadTestTags
+}
+
+// LoadTestRate returns the number of measurements a load test submits per second
+func LoadTestRate() float64 {
+	return globalConf.loadTestRate
+}
+
+// Allowlist returns the regular expressions metric names must match to be sent to AppOptics
+func Allowlist() []string {
+	return globalConf.allowlist
+}
+
+// Denylist returns the regular expressions of metric names that are never sent to AppOptics
+func Denylist() []string {
+	return globalConf.denylist
+}
+
+// ProvisionFile returns the path of the file of AppOptics resources to create at startup, or an empty string
+func ProvisionFile() string {
+	return globalConf.provisionFile
+}
+
+// PruneTagValues returns the metric:tag:age triples of the tag values to delete once they are no longer reported
+func PruneTagValues() []string {
+	return globalConf.pruneTagValues
+}
+
+// AdminUser returns the basic auth user required to change the configuration over HTTP, or an empty string if it
+// cannot be changed that way
+func AdminUser() string {
+	return globalConf.adminUser
+}
+
+// AdminPassword returns the basic auth password required to change the configuration over HTTP
+func AdminPassword() string {
+	return globalConf.adminPassword
+}
+
+// StageTiming returns true if the time spent in each pipeline stage is recorded
+func StageTiming() bool {
+	return globalConf.stageTiming
+}
+
+// SummaryInterval returns how often a summary of the adapter's stats is printed. Zero disables the summary.
+func SummaryInterval() time.Duration {
+	return globalConf.summaryInterval
+}
+
+// ReportWindow returns the length of the windows the adapter's performance is reported over. Zero disables the
+// report.
+func ReportWindow() time.Duration {
+	return globalConf.reportWindow
+}
+
+// HealthMetric returns the name of the gauge the adapter's health is submitted to AppOptics as, empty if it is not,
+// and how often it is submitted
+func HealthMetric() (string, time.Duration) {
+	return globalConf.healthMetric, globalConf.healthInterval
+}
+
+// LivenessWindow returns how long the adapter may go without a successful submission before /healthz reports it
+// unhealthy, zero if /healthz is not served
+func LivenessWindow() time.Duration {
+	return globalConf.livenessWindow
+}
+
+// MetricInventory returns whether the number of distinct metric names received, and of measurements per metric, are
+// submitted to AppOptics, and how often
+func MetricInventory() (bool, time.Duration) {
+	return globalConf.metricInventory, globalConf.inventoryPeriod
+}
+
+// SummaryFormat returns the format of the periodic summary: table or json
+func SummaryFormat() string {
+	return globalConf.summaryFormat
+}
+
+// PprofEnabled returns true if runtime profiling data is served under /debug/pprof/
+func PprofEnabled() bool {
+	return globalConf.pprofEnabled
+}
+
+// PprofUser returns the basic auth user required to access /debug/pprof/, or an empty string if it is unprotected
+func PprofUser() string {
+	return globalConf.pprofUser
+}
+
+// PprofPassword returns the basic auth password required to access /debug/pprof/
+func PprofPassword() string {
+	return globalConf.pprofPassword
+}
+
+// BasicAuthEncoding returns the base64 variant of the newline-delimited JSON Authorization header: standard, url or
+// url-nopad
+func BasicAuthEncoding() string {
+	return globalConf.basicAuthEncoding
+}
+
+// HMACSecret returns the shared secret newline-delimited JSON requests are signed with, or an empty string if they
+// are not signed
+func HMACSecret() string {
+	return globalConf.hmacSecret
+}
+
 // PushErrorLimit is a hardcoded limit on how many errors will be tolerated before the service stops attempting push
 func PushErrorLimit() int {
 	return 5
 }
 
+// RetryAttempts returns the number of times a batch is sent to AppOptics before giving up
+func RetryAttempts() int {
+	return globalConf.retryAttempts
+}
+
+// RetryBudget returns the time all attempts at a batch may take together and the time a single attempt may take,
+// zero for no bound
+func RetryBudget() (time.Duration, time.Duration) {
+	return globalConf.retryBudget, globalConf.attemptTimeout
+}
+
+// DuplicateMeasurements returns what happens to a batch rejected because a measurement already exists at its
+// timestamp: fail or ignore
+func DuplicateMeasurements() string {
+	return globalConf.duplicates
+}
+
+// TimestampFallback returns whether samples without a timestamp are timed with the time they are received at
+func TimestampFallback() bool {
+	return globalConf.nowFallback
+}
+
+// NullForMissing returns the interval a series must be received in not to get a null measurement in the next, zero
+// if no null measurements are submitted
+func NullForMissing() time.Duration {
+	return globalConf.nullInterval
+}
+
+// DegradedMode returns the error rate above which submissions enter degraded mode, zero if they never do, the fraction
+// of its size each part of a batch has while in it and the pause between the parts
+func DegradedMode() (float64, float64, time.Duration) {
+	return globalConf.degradedRate, globalConf.degradedFactor, globalConf.degradedDelay
+}
+
+// LogSampling returns how many identical errors repeated for every batch are logged one of, and the interval at most
+// one of them is logged in, zero if the rate applies instead
+func LogSampling() (int, time.Duration) {
+	return globalConf.logSampleRate, globalConf.logSampleEvery
+}
+
+// InjectedFailures returns the fraction of requests failed on purpose for chaos testing, zero outside of it, and the
+// comma-separated status codes and transport errors they are failed with
+func InjectedFailures() (float64, string) {
+	return globalConf.injectRate, globalConf.injectFailures
+}
+
+// RequestPriority returns the priority AppOptics processes the adapter's requests with: low, normal or high
+func RequestPriority() string {
+	return globalConf.requestPriority
+}
+
+// AuditLog returns the file requests to AppOptics and their responses are recorded in, or an empty string if they
+// are not recorded
+func AuditLog() string {
+	return globalConf.auditLog
+}
+
+// ReadCacheTTL returns how long responses to the adapter's GET requests to AppOptics are cached. Zero means they are
+// not cached.
+func ReadCacheTTL() time.Duration {
+	return globalConf.readCacheTTL
+}
+
+// MetricRequestPriorities returns the metric=priority pairs overriding RequestPriority for measurements of a metric
+func MetricRequestPriorities() []string {
+	return globalConf.requestPriorities
+}
+
+// RetryStatusCodes returns the 4xx HTTP status codes that cause a batch to be retried
+func RetryStatusCodes() []int {
+	return globalConf.retryStatusCodes
+}
+
+// Deduplicate returns how long submitted measurements are remembered to suppress duplicates. Zero disables
+// deduplication.
+func Deduplicate() time.Duration {
+	return globalConf.dedupWindow
+}
+
+// DedupBloom returns the number of measurements the deduplication Bloom filter is sized for, zero to remember them
+// exactly, and its false positive rate
+func DedupBloom() (int, float64) {
+	return globalConf.dedupBloomItems, globalConf.dedupBloomFP
+}
+
+// DedupFingerprintCache returns the number of tag maps whose series key the deduplication caches, zero for none
+func DedupFingerprintCache() int {
+	return globalConf.fingerprintCache
+}
+
+// LogDuplicates returns whether every measurement suppressed as a duplicate is logged
+func LogDuplicates() bool {
+	return globalConf.logDuplicates
+}
+
+// OnlyOnChange returns whether gauge measurements are only sent when their value changed, and how often unchanged
+// values are sent anyway
+func OnlyOnChange() (bool, time.Duration) {
+	return globalConf.onlyOnChange, globalConf.changeHeartbeat
+}
+
+// SeriesRateLimit returns the maximum rate, in measurements per second, at which any one series is sent to AppOptics.
+// Zero means no limit.
+func SeriesRateLimit() float64 {
+	return globalConf.seriesRateLimit
+}
+
+// SeriesMinInterval returns the minimum time between two measurements sent for any one series. Zero means none.
+func SeriesMinInterval() time.Duration {
+	return globalConf.minInterval
+}
+
+// Throttle returns true if measurements should be thinned out as the queue fills up
+func Throttle() bool {
+	return globalConf.throttle
+}
+
+// ThrottleThresholds returns the fractions of queue capacity at which throttling begins and reaches its minimum, and
+// that minimum fraction of measurements forwarded
+func ThrottleThresholds() (start, full, min float64) {
+	return globalConf.throttleStart, globalConf.throttleFull, globalConf.throttleMin
+}
+
 // SendStats returns true if the application should persist stats over the network to AppOptics, false otherwise
 func SendStats() bool {
 	return globalConf.sendStats
@@ -76,6 +1144,28 @@ func PrintVersionAndExit() bool  {
 	return printVersionAndExit
 }
 
+// DumpConfigAndExit returns true if the effective configuration should be printed instead of starting the adapter
+func DumpConfigAndExit() bool {
+	return dumpConfigAndExit
+}
+
+// ListMetricsAndExit returns the prefix of the AppOptics metrics to list instead of starting the adapter, or an empty
+// string if the adapter should start
+func ListMetricsAndExit() string {
+	return listMetricsAndExit
+}
+
+// DeleteMetricsAndExit returns the file listing the AppOptics metrics to delete instead of starting the adapter, or an
+// empty string if there is none
+func DeleteMetricsAndExit() string {
+	return deleteMetricsAndExit
+}
+
+// ConfirmDelete returns true if the metrics of DeleteMetricsAndExit are to be deleted rather than only listed
+func ConfirmDelete() bool {
+	return confirmDelete
+}
+
 // VersionString returns the semver string representing the current version
 func VersionString() string {
 	return fmt.Sprintf("%d.%d.%d", MajorVersion, MinorVersion, PatchVersion)
@@ -0,0 +1,19 @@
+package config
+
+import "testing"
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := parseStatusCodes("408, 429")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if len(codes) != 2 || codes[0] != 408 || codes[1] != 429 {
+		t.Errorf("expected [408 429] but got %v", codes)
+	}
+
+	for _, s := range []string{"400", "408,400", "500", "abc"} {
+		if _, err := parseStatusCodes(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted replaces credentials in an EffectiveConfig
+const Redacted = "***"
+
+// EffectiveConfig is the configuration in effect once defaults and flags have been applied, for confirming which
+// options a running adapter actually uses. Credentials, including passwords in URLs, are Redacted. Fields are named
+// after their flags.
+type EffectiveConfig struct {
+	BindPort                int           `json:"bind-port"`
+	AccessToken             string        `json:"access-token"`
+	SendStats               bool          `json:"send-stats"`
+	RetryAttempts           int           `json:"retry-attempts"`
+	RetryBudget             time.Duration `json:"retry-budget"`
+	AttemptTimeout          time.Duration `json:"attempt-timeout"`
+	RetryStatusCodes        []int         `json:"retry-status-codes"`
+	DuplicateMeasurements   string        `json:"duplicate-measurements"`
+	TimestampFallback       bool          `json:"timestamp-fallback"`
+	NullForMissing          time.Duration `json:"null-for-missing"`
+	DegradedErrorRate       float64       `json:"degraded-error-rate"`
+	DegradedReduction       float64       `json:"degraded-reduction"`
+	DegradedDelay           time.Duration `json:"degraded-delay"`
+	LogSampleRate           int           `json:"log-sample-rate"`
+	LogSampleInterval       time.Duration `json:"log-sample-interval"`
+	InjectFailureRate       float64       `json:"inject-failure-rate"`
+	InjectFailures          string        `json:"inject-failures"`
+	RequestPriority         string        `json:"request-priority"`
+	AuditLog                string        `json:"audit-log"`
+	ReadCacheTTL            time.Duration `json:"read-cache-ttl"`
+	MetricRequestPriorities []string      `json:"metric-request-priority"`
+	SeriesRateLimit         float64       `json:"series-rate-limit"`
+	SeriesMinInterval       time.Duration `json:"series-min-interval"`
+	Deduplicate             time.Duration `json:"deduplicate"`
+	DedupBloomItems         int           `json:"dedup-bloom-items"`
+	DedupBloomFPRate        float64       `json:"dedup-bloom-fp-rate"`
+	DedupFingerprintCache   int           `json:"dedup-fingerprint-cache"`
+	LogDuplicates           bool          `json:"log-duplicates"`
+	OnlyOnChange            bool          `json:"only-on-change"`
+	ChangeHeartbeat         time.Duration `json:"change-heartbeat"`
+	Throttle                bool          `json:"throttle"`
+	ThrottleStart           float64       `json:"throttle-start"`
+	ThrottleFull            float64       `json:"throttle-full"`
+	ThrottleMinFactor       float64       `json:"throttle-min-factor"`
+	PayloadBudget           int           `json:"payload-budget"`
+	NDJSONURL               string        `json:"ndjson-url"`
+	NDJSONMaxBytes          int           `json:"ndjson-max-bytes"`
+	StrictResponses         bool          `json:"strict-responses"`
+	IntegerValues           bool          `json:"integer-values"`
+	MaxBatchBytes           int           `json:"max-batch-bytes"`
+	CommonTags              string        `json:"common-tags"`
+	FlushBytes              int           `json:"flush-bytes"`
+	HMACSecret              string        `json:"hmac-secret"`
+	PreValidate             bool          `json:"pre-validate"`
+	CheckMeasurements       bool          `json:"check-measurements"`
+	MaxMeasurementAge       time.Duration `json:"max-measurement-age"`
+	LatencyAlert            time.Duration `json:"latency-alert"`
+	APIURL                  string        `json:"api-url"`
+	AnnotationStream        string        `json:"annotation-stream"`
+	AlertSnapshotSpace      int           `json:"alert-snapshot-space"`
+	ResponseDecompression   bool          `json:"response-decompression"`
+	KeepAliveInterval       time.Duration `json:"keep-alive-interval"`
+	LocalStoreRetention     time.Duration `json:"local-store-retention"`
+	QueryAppOptics          bool          `json:"query-appoptics"`
+	ConfigFile              string        `json:"config-file"`
+	TagCollision            string        `json:"tag-collision"`
+	NameTemplate            string        `json:"name-template"`
+	TagsTemplate            string        `json:"tags-template"`
+	MetricAttributes        string        `json:"metric-attributes"`
+	UnitAnnotation          bool          `json:"unit-annotation"`
+	MetricUnits             []string      `json:"metric-unit"`
+	LogSink                 string        `json:"log-sink"`
+	LogSinkFormat           string        `json:"log-sink-format"`
+	BucketTag               string        `json:"bucket-tag"`
+	HistogramMode           string        `json:"histogram-mode"`
+	NameSuffixes            string        `json:"name-suffixes"`
+	NameSuffixMap           string        `json:"name-suffix-map"`
+	QuantileTag             string        `json:"quantile-tag"`
+	CardinalityThreshold    uint64        `json:"cardinality-threshold"`
+	CardinalityAction       string        `json:"cardinality-action"`
+	BasicAuthEncoding       string        `json:"basic-auth-encoding"`
+	BufferCapacity          int           `json:"buffer-capacity"`
+	WALDir                  string        `json:"wal-dir"`
+	WALSegmentBytes         int           `json:"wal-segment-bytes"`
+	MetricPriorities        []string      `json:"metric-priority"`
+	ValueTransforms         []string      `json:"value-transform"`
+	RequiredTags            []string      `json:"require-tag"`
+	RequestIDHeader         string        `json:"request-id-header"`
+	OutgoingIDHeader        string        `json:"outgoing-request-id-header"`
+	StageTiming             bool          `json:"stage-timing"`
+	SummaryInterval         time.Duration `json:"summary-interval"`
+	ReportWindow            time.Duration `json:"report-window"`
+	HealthMetric            string        `json:"health-metric"`
+	HealthInterval          time.Duration `json:"health-interval"`
+	LivenessWindow          time.Duration `json:"liveness-window"`
+	MetricInventory         bool          `json:"metric-inventory"`
+	MetricInventoryInterval time.Duration `json:"metric-inventory-interval"`
+	SummaryFormat           string        `json:"summary-format"`
+	Pprof                   bool          `json:"pprof"`
+	PprofUser               string        `json:"pprof-user"`
+	PprofPassword           string        `json:"pprof-password"`
+	AdminUser               string        `json:"admin-user"`
+	AdminPassword           string        `json:"admin-password"`
+	Allowlist               []string      `json:"allow-metric"`
+	Denylist                []string      `json:"deny-metric"`
+	FederateURL             string        `json:"federate-url"`
+	FederateMatch           []string      `json:"federate-match"`
+	FederateInterval        time.Duration `json:"federate-interval"`
+	FederateUser            string        `json:"federate-user"`
+	FederatePassword        string        `json:"federate-password"`
+	FederateBearerToken     string        `json:"federate-bearer-token"`
+	FederateBearerTokenFile string        `json:"federate-bearer-token-file"`
+	FederateSecret          string        `json:"federate-secret"`
+	FederateExemplarStream  string        `json:"federate-exemplar-stream"`
+	AggregationCacheSize    int           `json:"aggregation-cache-size"`
+	AggregationStrategy     string        `json:"aggregation-strategy"`
+	AggregationInterval     time.Duration `json:"aggregation-interval"`
+	LokiURL                 string        `json:"loki-url"`
+	LokiQuery               string        `json:"loki-query"`
+	LokiFields              []string      `json:"loki-field"`
+	ProvisionFile           string        `json:"provision-file"`
+	PruneTagValues          []string      `json:"prune-tag-values"`
+	DogStatsDAddress        string        `json:"dogstatsd-address"`
+	DogStatsDFlushInterval  time.Duration `json:"dogstatsd-flush-interval"`
+	LoadTest                time.Duration `json:"load-test"`
+	LoadTestMetrics         int           `json:"load-test-metrics"`
+	LoadTestSeries          int           `json:"load-test-series"`
+	LoadTestTags            int           `json:"load-test-tags"`
+	LoadTestRate            float64       `json:"load-test-rate"`
+}
+
+// Effective returns the configuration in effect with its credentials redacted
+func Effective() EffectiveConfig {
+	return globalConf.Effective()
+}
+
+// Effective returns the configuration c holds with its credentials redacted
+func (c *Config) Effective() EffectiveConfig {
+	return EffectiveConfig{
+		BindPort:                c.bindPort,
+		AccessToken:             redact(c.accessToken),
+		SendStats:               c.sendStats,
+		RetryAttempts:           c.retryAttempts,
+		RetryBudget:             c.retryBudget,
+		AttemptTimeout:          c.attemptTimeout,
+		RetryStatusCodes:        c.retryStatusCodes,
+		DuplicateMeasurements:   c.duplicates,
+		TimestampFallback:       c.nowFallback,
+		NullForMissing:          c.nullInterval,
+		DegradedErrorRate:       c.degradedRate,
+		DegradedReduction:       c.degradedFactor,
+		DegradedDelay:           c.degradedDelay,
+		LogSampleRate:           c.logSampleRate,
+		LogSampleInterval:       c.logSampleEvery,
+		InjectFailureRate:       c.injectRate,
+		InjectFailures:          c.injectFailures,
+		RequestPriority:         c.requestPriority,
+		AuditLog:                c.auditLog,
+		ReadCacheTTL:            c.readCacheTTL,
+		MetricRequestPriorities: c.requestPriorities,
+		SeriesRateLimit:         c.seriesRateLimit,
+		SeriesMinInterval:       c.minInterval,
+		Deduplicate:             c.dedupWindow,
+		DedupBloomItems:         c.dedupBloomItems,
+		DedupBloomFPRate:        c.dedupBloomFP,
+		DedupFingerprintCache:   c.fingerprintCache,
+		LogDuplicates:           c.logDuplicates,
+		OnlyOnChange:            c.onlyOnChange,
+		ChangeHeartbeat:         c.changeHeartbeat,
+		Throttle:                c.throttle,
+		ThrottleStart:           c.throttleStart,
+		ThrottleFull:            c.throttleFull,
+		ThrottleMinFactor:       c.throttleMin,
+		PayloadBudget:           c.payloadBudget,
+		NDJSONURL:               redactURL(c.ndjsonURL),
+		NDJSONMaxBytes:          c.ndjsonMaxBytes,
+		StrictResponses:         c.strictResponses,
+		IntegerValues:           c.integerValues,
+		MaxBatchBytes:           c.maxBatchBytes,
+		CommonTags:              c.commonTags,
+		FlushBytes:              c.flushBytes,
+		HMACSecret:              redact(c.hmacSecret),
+		PreValidate:             c.preValidate,
+		CheckMeasurements:       c.localChecks,
+		MaxMeasurementAge:       c.maxAge,
+		LatencyAlert:            c.latencyAlert,
+		APIURL:                  redactURL(c.apiURL),
+		AnnotationStream:        c.annotationStream,
+		AlertSnapshotSpace:      c.alertSnapshotSpace,
+		ResponseDecompression:   c.decompression,
+		KeepAliveInterval:       c.keepAlive,
+		LocalStoreRetention:     c.localStore,
+		QueryAppOptics:          c.queryAppOptics,
+		ConfigFile:              c.configFile,
+		TagCollision:            c.tagCollision,
+		NameTemplate:            c.nameTemplate,
+		TagsTemplate:            c.tagsTemplate,
+		MetricAttributes:        c.metricAttributes,
+		UnitAnnotation:          c.unitAnnotation,
+		MetricUnits:             c.metricUnits,
+		LogSink:                 c.logSink,
+		LogSinkFormat:           c.logSinkFormat,
+		BucketTag:               c.bucketTag,
+		HistogramMode:           c.histogramMode,
+		NameSuffixes:            c.nameSuffixes,
+		NameSuffixMap:           c.nameSuffixMap,
+		QuantileTag:             c.quantileTag,
+		CardinalityThreshold:    c.cardinalityThreshold,
+		CardinalityAction:       c.cardinalityAction,
+		BasicAuthEncoding:       c.basicAuthEncoding,
+		BufferCapacity:          c.bufferCapacity,
+		WALDir:                  c.walDir,
+		WALSegmentBytes:         c.walSegmentBytes,
+		MetricPriorities:        c.metricPriorities,
+		ValueTransforms:         c.valueTransforms,
+		RequiredTags:            c.requiredTags,
+		RequestIDHeader:         c.requestIDHeader,
+		OutgoingIDHeader:        c.outgoingIDHeader,
+		StageTiming:             c.stageTiming,
+		SummaryInterval:         c.summaryInterval,
+		ReportWindow:            c.reportWindow,
+		HealthMetric:            c.healthMetric,
+		HealthInterval:          c.healthInterval,
+		LivenessWindow:          c.livenessWindow,
+		MetricInventory:         c.metricInventory,
+		MetricInventoryInterval: c.inventoryPeriod,
+		SummaryFormat:           c.summaryFormat,
+		Pprof:                   c.pprofEnabled,
+		PprofUser:               c.pprofUser,
+		PprofPassword:           redact(c.pprofPassword),
+		AdminUser:               c.adminUser,
+		AdminPassword:           redact(c.adminPassword),
+		Allowlist:               c.allowlist,
+		Denylist:                c.denylist,
+		FederateURL:             redactURL(c.federateURL),
+		FederateMatch:           c.federateMatch,
+		FederateInterval:        c.federateInterval,
+		FederateUser:            c.federateUser,
+		FederatePassword:        redact(c.federatePassword),
+		FederateBearerToken:     redact(c.federateToken),
+		FederateBearerTokenFile: c.federateTokenFile,
+		FederateSecret:          c.federateSecret,
+		FederateExemplarStream:  c.federateExemplars,
+		AggregationCacheSize:    c.aggregationSize,
+		AggregationStrategy:     c.aggregationStrategy,
+		AggregationInterval:     c.aggregationInterval,
+		LokiURL:                 redactURL(c.lokiURL),
+		LokiQuery:               c.lokiQuery,
+		LokiFields:              c.lokiFields,
+		ProvisionFile:           c.provisionFile,
+		PruneTagValues:          c.pruneTagValues,
+		DogStatsDAddress:        c.dogstatsdAddress,
+		DogStatsDFlushInterval:  c.dogstatsdInterval,
+		LoadTest:                c.loadTest,
+		LoadTestMetrics:         c.loadTestMetrics,
+		LoadTestSeries:          c.loadTestSeries,
+		LoadTestTags:            c.loadTestTags,
+		LoadTestRate:            c.loadTestRate,
+	}
+}
+
+// String returns one flag=value line for every option, sorted by flag, for logging
+func (ec EffectiveConfig) String() string {
+	v := reflect.ValueOf(ec)
+	lines := make([]string, v.NumField())
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s=%v", v.Type().Field(i).Tag.Get("json"), v.Field(i).Interface())
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// MarshalJSON renders the EffectiveConfig as an object keyed by flag, in sorted order so that dumps of it can be
+// diffed, with durations written as e.g. "1m30s" rather than nanoseconds
+func (ec EffectiveConfig) MarshalJSON() ([]byte, error) {
+	v := reflect.ValueOf(ec)
+	fields := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		value := v.Field(i).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		fields[v.Type().Field(i).Tag.Get("json")] = value
+	}
+	return json.Marshal(fields)
+}
+
+// redact returns Redacted for a credential that is set and an empty string otherwise
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// redactURL returns rawURL with the password of any credentials it carries Redacted
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); !ok {
+		return rawURL
+	}
+	// url.UserPassword would percent-encode Redacted
+	user := url.User(u.User.Username()).String()
+	u.User = nil
+	s := u.String()
+	i := strings.Index(s, "//") + len("//")
+	return s[:i] + user + ":" + Redacted + "@" + s[i:]
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"os/signal"
+	"strings"
+	"sync"
 	"time"
 
 	"os"
 
 	"github.com/solarwinds/prometheus2appoptics/config"
+	"github.com/solarwinds/prometheus2appoptics/promadapter"
 
 	"github.com/appoptics/appoptics-api-go"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // startTime helps us collect information on how long this process runs
@@ -21,11 +31,35 @@ var osSignalChan = make(chan os.Signal, 1)
 
 var stopChan chan<- bool
 
+// shutdownCtx is cancelled on SIGINT so that background flushers can drain, and shutdownWait waits for them to finish
+var shutdownCtx, cancelShutdown = context.WithCancel(context.Background())
+var shutdownWait sync.WaitGroup
+
 func main() {
 	if config.PrintVersionAndExit() {
 		fmt.Printf(config.VersionString())
 		os.Exit(0)
 	}
+	if config.DumpConfigAndExit() {
+		data, err := json.MarshalIndent(config.Effective(), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+		os.Exit(0)
+	}
+	if config.ListMetricsAndExit() != "" {
+		if err := listMetrics(config.ListMetricsAndExit()); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	if config.DeleteMetricsAndExit() != "" {
+		if err := deleteMetrics(config.DeleteMetricsAndExit(), config.ConfirmDelete()); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
 
 	signal.Notify(osSignalChan, os.Interrupt)
 	go handleShutdown()
@@ -35,18 +69,654 @@ func main() {
 
 	userAgentFragment := fmt.Sprintf("%s-%s", config.AppName, config.VersionString())
 
-	lc := appoptics.NewClient(config.AccessToken(), appoptics.UserAgentClientOption(userAgentFragment))
+	apiURL, err := promadapter.ParseAPIURL(config.APIURL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	lc := appoptics.NewClient(config.AccessToken(),
+		appoptics.UserAgentClientOption(userAgentFragment),
+		appoptics.BaseURLClientOption(apiURL.String()),
+	)
+
+	if config.ProvisionFile() != "" {
+		p, err := promadapter.LoadProvisioning(config.ProvisionFile())
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpClient := &http.Client{Timeout: 30 * time.Second}
+		pr := promadapter.NewProvisioner(
+			promadapter.NewSpacesClient(promadapter.EndpointURL(apiURL, promadapter.SpacesPath), config.AccessToken(), httpClient),
+			promadapter.NewNotificationServicesClient(promadapter.EndpointURL(apiURL, promadapter.ServicesPath), config.AccessToken(), httpClient),
+			promadapter.NewAlertsClient(promadapter.EndpointURL(apiURL, promadapter.AlertsPath), config.AccessToken(), httpClient),
+		)
+		if err := pr.Provision(context.Background(), p); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(config.PruneTagValues()) > 0 {
+		var opts []promadapter.TagsClientOption
+		for _, spec := range config.PruneTagValues() {
+			opt, err := promadapter.ParseAutoTagPrune(spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, opt)
+		}
+		tc := promadapter.NewTagsClient(promadapter.EndpointURL(apiURL, promadapter.TagsPath), config.AccessToken(), &http.Client{Timeout: 30 * time.Second}, opts...)
+		go tc.Run(nil)
+	}
+
+	retryPolicy := promadapter.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = config.RetryAttempts()
+	retryPolicy.Budget, retryPolicy.AttemptTimeout = config.RetryBudget()
+	retryPolicy.StatusCodes = make(map[int]bool)
+	for _, code := range config.RetryStatusCodes() {
+		retryPolicy.StatusCodes[code] = true
+	}
+	transport := promadapter.NewAPITransport(config.ResponseDecompression())
+	// audit innermost, so that the records show every header the other transports add
+	if config.AuditLog() != "" {
+		f, err := os.OpenFile(config.AuditLog(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		transport = promadapter.NewAuditTransport(transport, promadapter.WithAuditLogger(promadapter.NewJSONAuditLogger(f)))
+		if config.NDJSONURL() == "" {
+			// the client library sends measurements through an http.Client of its own, which cannot be replaced
+			log.Printf("WARNING: --audit-log does not record measurement submissions without --ndjson-url, only the adapter's other requests to AppOptics\n")
+		}
+	}
+	if rate, spec := config.InjectedFailures(); rate > 0 {
+		failures, err := promadapter.ParseInjectedFailures(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("WARNING: failing %.0f%% of requests to AppOptics on purpose for chaos testing, never do this in production\n", rate*100)
+		transport = promadapter.NewFailureInjectionTransport(rate, failures, transport)
+	}
+	incomingIDHeader, outgoingIDHeader := config.RequestIDHeaders()
+	if incomingIDHeader != "" {
+		transport = promadapter.NewRequestIDTransport(outgoingIDHeader, transport)
+	}
+	requestPriority, err := promadapter.ParseRequestPriority(config.RequestPriority())
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport = promadapter.NewPriorityTransport(requestPriority, transport)
+	transport = promadapter.NewRequestTimeoutTransport(transport)
+	if config.ReadCacheTTL() > 0 {
+		transport = promadapter.NewReadCacheTransport(transport, promadapter.WithReadCache(config.ReadCacheTTL()),
+			promadapter.WithReadCacheScope(promadapter.EndpointURL(apiURL, promadapter.MetricsPath)))
+	}
+	apiClient := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+
+	var base appoptics.MeasurementsCommunicator = lc.MeasurementsService()
+	if config.NDJSONURL() != "" {
+		httpClient := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+		if config.HMACSecret() != "" {
+			httpClient.Transport = promadapter.NewSigningTransport(config.HMACSecret(), transport)
+		}
+		authEncoding, err := promadapter.ParseBasicAuthEncoding(config.BasicAuthEncoding())
+		if err != nil {
+			log.Fatal(err)
+		}
+		nc := promadapter.NewNDJSONCommunicator(config.NDJSONURL(), config.AccessToken(), authEncoding, config.NDJSONMaxBytes(), httpClient)
+		priorities := promadapter.RequestPriorities{Default: requestPriority, Metrics: make(map[string]promadapter.RequestPriority)}
+		for _, pair := range config.MetricRequestPriorities() {
+			name, priority, err := promadapter.ParseMetricRequestPriority(pair)
+			if err != nil {
+				log.Fatal(err)
+			}
+			priorities.Metrics[name] = priority
+		}
+		nc.SetRequestPriorities(priorities)
+		nc.SetStrictResponses(config.StrictResponses())
+		nc.SetIntegerValues(config.IntegerValues())
+		base = nc
+	}
+
+	stats := promadapter.NewStats()
+	if config.StageTiming() {
+		stats.EnableTiming()
+	}
+	if rate, interval := config.LogSampling(); rate > 1 || interval > 0 {
+		sampler := promadapter.NewLogSampler(stats, promadapter.WithLogSampleRate(rate), promadapter.WithLogSampleInterval(interval))
+		promadapter.SetErrorLog(sampler.Printf)
+	}
+	if config.KeepAliveInterval() > 0 && config.NDJSONURL() == "" {
+		kc := promadapter.NewKeepAliveCommunicator(base, func() error {
+			_, _, err := lc.SpacesService().List()
+			return err
+		}, config.KeepAliveInterval())
+		go kc.Run(nil)
+		base = kc
+	}
+	commonTagsMode, err := promadapter.ParseCommonTagsMode(config.CommonTags())
+	if err != nil {
+		log.Fatal(err)
+	}
+	// newline-delimited JSON has no batch to carry common tags
+	if commonTagsMode != promadapter.CommonTagsOff && config.NDJSONURL() == "" {
+		base = promadapter.NewCommonTagsCommunicator(base, commonTagsMode)
+	}
+	duplicatePolicy, err := promadapter.ParseDuplicatePolicy(config.DuplicateMeasurements())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var submitter appoptics.MeasurementsCommunicator = promadapter.NewRetryingCommunicator(base, retryPolicy, stats)
+	if duplicatePolicy == promadapter.DuplicateIgnore {
+		submitter = promadapter.NewDuplicateTolerantCommunicator(submitter)
+	}
+	if errorRate, reduction, delay := config.DegradedMode(); errorRate > 0 {
+		submitter = promadapter.NewDegradedModeCommunicator(submitter, stats,
+			promadapter.WithDegradedModeThreshold(errorRate, reduction), promadapter.WithDegradedModeDelay(delay))
+	}
+	ic := promadapter.NewInstrumentedCommunicator(submitter, stats)
+	ic.SetRetryPolicy(retryPolicy)
+	var mc appoptics.MeasurementsCommunicator = ic
+	if dir, segmentBytes := config.WAL(); dir != "" {
+		wal, err := promadapter.OpenWAL(dir, segmentBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wc := promadapter.NewWALCommunicator(mc, wal, retryPolicy)
+		if err := wc.Replay(); err != nil {
+			log.Printf("could not replay the write-ahead log, the remaining batches are sent before any new ones: %s\n", err)
+		}
+		mc = wc
+	}
+	if config.LatencyAlert() > 0 {
+		mc = promadapter.NewLatencyAlertCommunicator(mc, config.LatencyAlert(), func(metric string, latency time.Duration) {
+			log.Printf("WARNING: %s reached AppOptics %s after it was sampled\n", metric, latency)
+		})
+	}
+	if config.MaxBatchBytes() > 0 {
+		mc = promadapter.NewSizeLimitedCommunicator(mc, config.MaxBatchBytes())
+	}
+	if config.PreValidate() {
+		validator := promadapter.NewValidator(promadapter.EndpointURL(apiURL, promadapter.ValidatePath), config.AccessToken(), apiClient)
+		mc = promadapter.NewPreValidatingCommunicator(mc, validator, stats)
+	}
+	if config.LogSink() != "" {
+		format, err := promadapter.ParseLogFormat(config.LogSinkFormat())
+		if err != nil {
+			log.Fatal(err)
+		}
+		f, err := os.OpenFile(config.LogSink(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mc = promadapter.NewMultiSink(mc, promadapter.NewLogSink(f, format))
+	}
+	if len(config.RequiredTags()) > 0 {
+		var hooks []promadapter.SubmitHook
+		for _, key := range config.RequiredTags() {
+			hooks = append(hooks, promadapter.RequireTag(key))
+		}
+		mc = promadapter.NewHookedCommunicator(mc, stats, hooks...)
+	}
+
+	var sink chan<- []appoptics.Measurement
+	if config.FlushBytes() > 0 {
+		if !config.SendStats() {
+			mc = promadapter.NewLogSink(os.Stdout, promadapter.LogJSON)
+		}
+		batcher := promadapter.NewBatcher(mc, appoptics.MeasurementPostMaxBatchSize, config.FlushBytes(), promadapter.DefaultFlushInterval,
+			promadapter.WithErrorChannelSize(promadapter.DefaultErrorChannelSize), promadapter.WithBatcherStats(stats))
+		go func() {
+			for se := range batcher.Errors() {
+				promadapter.LogError("persisting batch of %d measurements failed at %s: %s\n", len(se.Batch), se.At.Format(time.RFC3339), se.Err)
+			}
+		}()
+		batches := make(chan []appoptics.Measurement, appoptics.MeasurementPostMaxBatchSize)
+		stop := make(chan bool)
+		go batcher.Run(batches, stop)
+
+		stopChan = stop
+		sink = batches
+	} else {
+		bp := appoptics.NewBatchPersister(mc, config.SendStats())
+		bp.BatchAndPersistMeasurementsForever()
+
+		stopChan = bp.MeasurementsStopBatchingChannel()
+		sink = bp.MeasurementsSink()
+	}
+	queueDepth := func() int { return len(sink) }
+	queueCapacity := cap(sink)
+	if config.BufferCapacity() > 0 {
+		priorities := make(map[string]int)
+		for _, pair := range config.MetricPriorities() {
+			pattern, priority, err := promadapter.ParsePriority(pair)
+			if err != nil {
+				log.Fatal(err)
+			}
+			priorities[pattern] = priority
+		}
+		pb, err := promadapter.NewPriorityBuffer(config.BufferCapacity(), priorities, stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		buffered := make(chan []appoptics.Measurement)
+		go pb.Run(buffered, sink, appoptics.MeasurementPostMaxBatchSize)
+		sink = buffered
+		queueDepth = pb.Len
+		queueCapacity = config.BufferCapacity()
+	}
+
+	if config.LoadTest() > 0 {
+		metrics, series, tags := config.LoadTestShape()
+		cfg := promadapter.LoadTestConfig{
+			MetricCount:     metrics,
+			SeriesPerMetric: series,
+			TagsPerMetric:   tags,
+			SubmissionRate:  config.LoadTestRate(),
+			Duration:        config.LoadTest(),
+			Seed:            1,
+		}
+		result, err := promadapter.RunLoadTest(shutdownCtx, cfg, appoptics.MeasurementPostMaxBatchSize, promadapter.NewAppOpticsSink(sink))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("load test %s\n", result)
+		stopChan <- true
+		os.Exit(0)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(promadapter.NewCollector(stats, queueDepth))
+
+	if config.SummaryInterval() > 0 {
+		format, err := promadapter.ParseSummaryFormat(config.SummaryFormat())
+		if err != nil {
+			log.Fatal(err)
+		}
+		sp := promadapter.NewSummaryPrinter(stats, queueDepth, os.Stdout, format)
+		go sp.Run(config.SummaryInterval(), nil)
+	}
+	if config.ReportWindow() > 0 {
+		wr := promadapter.NewWindowReporter(stats, config.ReportWindow(), func(r promadapter.WindowReport) {
+			log.Printf("last %s: submitted=%d retries=%d errors=%d dropped=%v average_lag=%s error_rate=%.4f\n",
+				r.End.Sub(r.Start), r.Submitted, r.Retries, r.Errors, r.Dropped, r.AverageLag, r.ErrorRate)
+		})
+		go wr.Run(nil)
+	}
+	if name, interval := config.HealthMetric(); name != "" && config.SendStats() {
+		hr := promadapter.NewHealthReporter(base, stats, name, interval)
+		go hr.Run(nil)
+	}
+
+	filter, err := promadapter.NewMetricFilter(config.Allowlist(), config.Denylist(), stats)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	histogramMode, err := promadapter.ParseHistogramMode(config.HistogramMode())
+	if err != nil {
+		log.Fatal(err)
+	}
+	var stages []promadapter.Stage
+	if histogramMode == promadapter.HistogramHeatmap {
+		stages = append(stages, promadapter.NewHeatmap())
+	}
+	stages = append(stages, promadapter.NewBucketLabels(config.BucketTag(), config.QuantileTag()))
+	// units are annotated before suffixes are stripped or mapped, as the default rules match the Prometheus names
+	if enabled, pairs := config.UnitAnnotation(); enabled {
+		units := make(map[string]string)
+		for _, pair := range pairs {
+			pattern, unit, err := promadapter.ParseUnit(pair)
+			if err != nil {
+				log.Fatal(err)
+			}
+			units[pattern] = unit
+		}
+		ua, err := promadapter.NewUnitAnnotator(units)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, ua)
+	}
+	suffixes, suffixMap := config.NameSuffixes()
+	suffixMode, err := promadapter.ParseSuffixMode(suffixes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if suffixMode != promadapter.SuffixKeep {
+		mapping, err := promadapter.ParseSuffixMapping(suffixMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, promadapter.NewSuffixTranslator(suffixMode, mapping, promadapter.DefaultMaxTrackedSeries, stats))
+	}
+	if config.ConfigFile() != "" {
+		policy, err := promadapter.ParseCollisionPolicy(config.TagCollision())
+		if err != nil {
+			log.Fatal(err)
+		}
+		rewriter, err := promadapter.NewTagRewriter(nil, nil, policy, stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cw := promadapter.NewConfigWatcher(config.ConfigFile(), func(fc promadapter.FileConfig) error {
+			if err := promadapter.ValidateTagRules(fc.GlobalTags, fc.LabelMappings); err != nil {
+				return err
+			}
+			if err := filter.SetLists(fc.Allowlist, fc.Denylist); err != nil {
+				return err
+			}
+			return rewriter.SetRules(fc.GlobalTags, fc.LabelMappings)
+		}, stats)
+		if err := cw.Load(); err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			if err := cw.Watch(nil); err != nil {
+				log.Printf("not watching %s for changes: %s\n", config.ConfigFile(), err)
+			}
+		}()
+		stages = append(stages, rewriter)
+	}
+	stages = append(stages, filter)
+	if len(config.ValueTransforms()) > 0 {
+		var transforms []promadapter.ValueTransform
+		for _, spec := range config.ValueTransforms() {
+			vt, err := promadapter.ParseValueTransform(spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			transforms = append(transforms, vt)
+		}
+		uc, err := promadapter.NewUnitConversion(transforms, stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, uc)
+	}
+	if config.NameTemplate() != "" || config.TagsTemplate() != "" {
+		tt, err := promadapter.NewTemplateTransform(config.NameTemplate(), config.TagsTemplate(), stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, tt)
+	}
+	if config.CheckMeasurements() {
+		checks := []promadapter.MeasurementCheck{promadapter.CheckName, promadapter.CheckTags, promadapter.CheckFinite}
+		if config.MaxMeasurementAge() > 0 {
+			checks = append(checks, promadapter.CheckFreshness(config.MaxMeasurementAge(), time.Now))
+		}
+		if config.MaxBatchBytes() > 0 {
+			checks = append(checks, promadapter.CheckSize(config.MaxBatchBytes()))
+		}
+		stages = append(stages, promadapter.NewMeasurementValidator(stats, checks...))
+	}
+	if config.Deduplicate() > 0 {
+		var opts []promadapter.DeduplicatorOption
+		if items, fpRate := config.DedupBloom(); items > 0 {
+			if fpRate <= 0 || fpRate >= 1 {
+				log.Fatalf("--dedup-bloom-fp-rate must be between 0 and 1, got %g", fpRate)
+			}
+			opts = append(opts, promadapter.WithBloomDeduplication(items, fpRate))
+		}
+		if size := config.DedupFingerprintCache(); size > 0 {
+			opts = append(opts, promadapter.WithFingerprintCacheSize(size))
+		}
+		if config.LogDuplicates() {
+			opts = append(opts, promadapter.WithDuplicateLog(log.Printf))
+		}
+		dedup := promadapter.NewDeduplicator(stats, opts...)
+		go dedup.Run(config.Deduplicate(), nil)
+		stages = append(stages, dedup)
+	}
+	if config.Throttle() {
+		start, full, min := config.ThrottleThresholds()
+		th, err := promadapter.NewThrottle(queueCapacity, start, full, min, queueDepth, stats)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, th)
+	}
+	if config.SeriesRateLimit() > 0 || config.SeriesMinInterval() > 0 {
+		stages = append(stages, promadapter.NewSeriesRateLimiter(config.SeriesRateLimit(), promadapter.DefaultMaxTrackedSeries, stats,
+			promadapter.WithMinimumSubmissionInterval(config.SeriesMinInterval())))
+	}
+	if config.CardinalityThreshold() > 0 {
+		action, err := promadapter.ParseCardinalityAction(config.CardinalityAction())
+		if err != nil {
+			log.Fatal(err)
+		}
+		handler := func(metric string, estimate uint64) promadapter.CardinalityAction {
+			log.Printf("metric %s has roughly %d tag sets, over the cardinality threshold of %d\n", metric, estimate, config.CardinalityThreshold())
+			return action
+		}
+		stages = append(stages, promadapter.NewCardinalityGuard(config.CardinalityThreshold(), handler, stats))
+	}
+	if enabled, heartbeat := config.OnlyOnChange(); enabled {
+		stages = append(stages, promadapter.NewOnChangeCompactor(heartbeat, promadapter.DefaultMaxTrackedSeries, stats))
+	}
+	if config.PayloadBudget() > 0 {
+		stages = append(stages, promadapter.NewPayloadBudget(config.PayloadBudget(), stats))
+	}
+	if config.MetricAttributes() != "" {
+		data, err := ioutil.ReadFile(config.MetricAttributes())
+		if err != nil {
+			log.Fatal(err)
+		}
+		specs, err := promadapter.ParseMetricSpecs(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stages = append(stages, promadapter.NewAttributeReconciler(promadapter.EndpointURL(apiURL, promadapter.MetricsPath), config.AccessToken(), specs, apiClient))
+	}
+	var store *promadapter.LocalStore
+	if config.LocalStoreRetention() > 0 {
+		store = promadapter.NewLocalStore(config.LocalStoreRetention())
+		stages = append(stages, store)
+	}
+	if enabled, interval := config.MetricInventory(); enabled && config.SendStats() {
+		mi := promadapter.NewMetricInventory(base, interval)
+		go mi.Run(nil)
+		stages = append(stages, mi)
+	}
+	if config.NullForMissing() > 0 {
+		mt := promadapter.NewMissingSeriesTracker(promadapter.DefaultMaxTrackedSeries)
+		go mt.Run(shutdownCtx, config.NullForMissing(), promadapter.NewAppOpticsSink(sink))
+		stages = append(stages, mt)
+	}
+	snap := promadapter.NewSnapshot(promadapter.DefaultMaxTrackedSeries)
+	stages = append(stages, snap)
+	if config.AggregationCacheSize() > 0 {
+		strategy, err := promadapter.ParseAggregationStrategy(config.AggregationStrategy())
+		if err != nil {
+			log.Fatal(err)
+		}
+		ac := promadapter.NewLRUAggregationCache(config.AggregationCacheSize(), strategy, stats)
+		shutdownWait.Add(1)
+		go func() {
+			defer shutdownWait.Done()
+			ac.Run(shutdownCtx, config.AggregationInterval(), promadapter.DefaultShutdownGrace, sink)
+		}()
+		stages = append(stages, ac)
+	}
+
+	pipeline := promadapter.NewPipeline(stats, stages...)
+	if config.TimestampFallback() {
+		pipeline.SetTimestampFallback(time.Now)
+	}
+
+	if config.FederateURL() != "" {
+		var opts []promadapter.ScraperOption
+		if user, password := config.FederateBasicAuth(); user != "" {
+			opts = append(opts, promadapter.WithHTTPBasicAuth(user, password))
+		}
+		if config.FederateBearerToken() != "" {
+			opts = append(opts, promadapter.WithBearerToken(config.FederateBearerToken()))
+		}
+		if config.FederateBearerTokenFile() != "" {
+			opts = append(opts, promadapter.WithBearerTokenFile(config.FederateBearerTokenFile()))
+		}
+		if namespace, name := config.FederateSecret(); name != "" {
+			if namespace == "" {
+				log.Fatal("--federate-secret must be given as namespace/name")
+			}
+			opts = append(opts, promadapter.WithScrapeSecretRef(namespace, name))
+		}
+		if config.FederateExemplarStream() != "" {
+			annotations := promadapter.NewAnnotationsClient(promadapter.EndpointURL(apiURL, promadapter.AnnotationsPath), config.FederateExemplarStream(), config.AccessToken(), apiClient)
+			opts = append(opts, promadapter.WithExemplarAnnotations(annotations))
+		}
+		// Prometheus gets a client of its own, as the transports wrapping apiClient are meant for AppOptics only
+		federateClient := &http.Client{Timeout: 30 * time.Second, Transport: promadapter.NewAPITransport(config.ResponseDecompression())}
+		fs, err := promadapter.NewFederateSource(config.FederateURL(), config.FederateMatch(), config.FederateInterval(), federateClient, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go fs.Run(pipeline, sink, nil)
+	}
+	if config.LokiURL() != "" {
+		fields, err := promadapter.ParseFieldMapping(config.LokiFields())
+		if err != nil {
+			log.Fatal(err)
+		}
+		ls, err := promadapter.NewLokiSource(config.LokiURL(), config.LokiQuery(), fields, websocket.DefaultDialer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go ls.Run(pipeline, sink, nil)
+	}
+	if addr, interval := config.DogStatsD(); addr != "" {
+		dr := promadapter.NewDogStatsDReceiver(addr, mc)
+		dr.SetFlushInterval(interval)
+		dr.SetPipeline(pipeline)
+		if err := dr.Start(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		shutdownWait.Add(1)
+		go func() {
+			defer shutdownWait.Done()
+			<-shutdownCtx.Done()
+			dr.Stop()
+		}()
+	}
 
-	bp := appoptics.NewBatchPersister(lc.MeasurementsService(), config.SendStats())
-	bp.BatchAndPersistMeasurementsForever()
+	mux := http.NewServeMux()
+	withRequestID := func(h http.Handler) http.Handler {
+		if incomingIDHeader == "" {
+			return h
+		}
+		return promadapter.RequestIDHandler(incomingIDHeader, h)
+	}
+	mux.Handle("/receive", withRequestID(receiveHandler(promadapter.NewAppOpticsSink(sink), pipeline)))
+	mux.Handle("/spaces", listSpacesHandler(lc))
+	mux.Handle("/test", testMetricHandler(lc))
+	mux.Handle("/debug/snapshot", snapshotHandler(snap))
+	mux.Handle("/debug/stats", statsHandler(stats, queueDepth))
+	mux.Handle("/config", configHandler(config.Effective()))
+	if config.AdminUser() != "" {
+		allowlistHandler := patternListHandler("allowlist", filter.SetAllowlist)
+		denylistHandler := patternListHandler("denylist", filter.SetDenylist)
+		if config.ConfigFile() != "" {
+			allowlistHandler = managedByFileHandler(config.ConfigFile())
+			denylistHandler = managedByFileHandler(config.ConfigFile())
+		}
+		mux.Handle("/config/allowlist", basicAuthHandler(config.AdminUser(), config.AdminPassword(), allowlistHandler))
+		mux.Handle("/config/denylist", basicAuthHandler(config.AdminUser(), config.AdminPassword(), denylistHandler))
+	}
+	switch {
+	case config.QueryAppOptics() && store != nil:
+		log.Fatal("--query-appoptics and --local-store-retention cannot be used together")
+	case config.QueryAppOptics():
+		qc := promadapter.NewQueryClient(promadapter.EndpointURL(apiURL, promadapter.MeasurementsPath), promadapter.EndpointURL(apiURL, promadapter.MetricsPath), config.AccessToken(), apiClient)
+		mux.Handle("/api/v1/query_range", queryRangeHandler(qc))
+	case store != nil:
+		mux.Handle("/api/v1/query_range", queryRangeHandler(localStoreQuerier{store}))
+	}
+	if config.AnnotationStream() != "" {
+		annotations := promadapter.NewAnnotationsClient(promadapter.EndpointURL(apiURL, promadapter.AnnotationsPath), config.AnnotationStream(), config.AccessToken(), apiClient)
+		var opts []promadapter.AlertmanagerOption
+		if config.AlertSnapshotSpace() != 0 {
+			snapshots := promadapter.NewSnapshotsClient(promadapter.EndpointURL(apiURL, promadapter.SnapshotsPath), config.AccessToken(), apiClient)
+			opts = append(opts, promadapter.WithAlertSnapshots(snapshots, config.AlertSnapshotSpace()))
+		}
+		mux.Handle("/webhook", withRequestID(promadapter.AlertmanagerHandler(annotations, opts...)))
+	}
+	if config.LivenessWindow() > 0 {
+		mux.Handle("/healthz", promadapter.NewLivenessCheck(stats, config.LivenessWindow()))
+	}
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 
-	stopChan = bp.MeasurementsStopBatchingChannel()
+	if config.PprofEnabled() {
+		if config.PprofUser() == "" {
+			log.Println("WARNING: /debug/pprof/ is enabled without authentication, set --pprof-user and --pprof-password")
+		}
+		registerPprofHandlers(mux, config.PprofUser(), config.PprofPassword())
+	}
 
-	http.Handle("/receive", receiveHandler(bp.MeasurementsSink()))
-	http.Handle("/spaces", listSpacesHandler(lc))
-	http.Handle("/test", testMetricHandler(lc))
+	http.ListenAndServe(portString, mux)
+}
 
-	http.ListenAndServe(portString, nil)
+// listMetrics prints the name, type and period of every AppOptics metric whose name starts with prefix, e.g. to find
+// forwarded metrics to clean up
+func listMetrics(prefix string) error {
+	qc, err := newMetricsClient()
+	if err != nil {
+		return err
+	}
+	metrics, err := qc.ListMetrics(context.Background(), promadapter.MetricListOptions{NamePrefix: prefix})
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		fmt.Printf("%s\t%s\t%d\n", m.Name, m.Type, m.Period)
+	}
+	return nil
+}
+
+// deleteMetrics deletes the AppOptics metrics named in the file at path, one per line, if confirmed, and only prints
+// them otherwise. Blank lines and lines starting with # are skipped.
+func deleteMetrics(path string, confirmed bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			names = append(names, line)
+		}
+	}
+	qc, err := newMetricsClient()
+	if err != nil {
+		return err
+	}
+
+	deleted, err := promadapter.DeleteStaleMetrics(context.Background(), qc, names, promadapter.DefaultMetricDeleteBatchSize, confirmed)
+	if err == promadapter.ErrDeletionNotConfirmed {
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		fmt.Printf("%d metrics would be deleted, pass --confirm-delete to delete them\n", len(names))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deleted %d of %d metrics before failing: %s", deleted, len(names), err)
+	}
+	fmt.Printf("deleted %d metrics\n", deleted)
+	return nil
+}
+
+// newMetricsClient returns a QueryClient for the AppOptics API the adapter is configured for
+func newMetricsClient() (*promadapter.QueryClient, error) {
+	apiURL, err := promadapter.ParseAPIURL(config.APIURL())
+	if err != nil {
+		return nil, err
+	}
+	return promadapter.NewQueryClient(
+		promadapter.EndpointURL(apiURL, promadapter.MeasurementsPath),
+		promadapter.EndpointURL(apiURL, promadapter.MetricsPath),
+		config.AccessToken(),
+		&http.Client{Timeout: 30 * time.Second},
+	), nil
 }
 
 // handleShutdown defines the behavior of the application when it receives SIGINT
@@ -55,6 +725,8 @@ func handleShutdown() {
 	runDuration := time.Since(startTime) / time.Second
 	fmt.Println("\n[-] Sending stop signal and shutting down")
 	fmt.Printf("[-] Process ran for %d seconds\n", runDuration)
+	cancelShutdown()
+	shutdownWait.Wait()
 	stopChan <- true
 	os.Exit(0)
 }
@@ -0,0 +1,42 @@
+package promadapter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// AckingCommunicator wraps a MeasurementsCommunicator, calling ack once a batch has been accepted and nack once it
+// has finally failed, so that a source feeding the adapter from a queue can commit its offsets only for delivered
+// Measurements. Wrap it around a RetryingCommunicator so nack only sees permanent failures.
+type AckingCommunicator struct {
+	mc   appoptics.MeasurementsCommunicator
+	ack  func(*appoptics.MeasurementsBatch)
+	nack func(*appoptics.MeasurementsBatch, error)
+}
+
+// NewAckingCommunicator returns an AckingCommunicator sending through mc. Either callback may be nil.
+func NewAckingCommunicator(mc appoptics.MeasurementsCommunicator, ack func(*appoptics.MeasurementsBatch), nack func(*appoptics.MeasurementsBatch, error)) *AckingCommunicator {
+	return &AckingCommunicator{mc: mc, ack: ack, nack: nack}
+}
+
+// Create persists the batch and acknowledges it. A batch counts as accepted if there was no error and the response,
+// when there is one, is a 2xx.
+func (ac *AckingCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	resp, err := ac.mc.Create(batch)
+	if err == nil && resp != nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		err = fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	if err != nil {
+		if ac.nack != nil {
+			ac.nack(batch, err)
+		}
+		return resp, err
+	}
+	if ac.ack != nil {
+		ac.ack(batch)
+	}
+	return resp, nil
+}
@@ -0,0 +1,35 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestAckingCommunicator(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}}
+
+	for _, tc := range []struct {
+		status int
+		acked  bool
+	}{
+		{http.StatusAccepted, true},
+		{http.StatusBadRequest, false},
+	} {
+		var acked, nacked []*appoptics.MeasurementsBatch
+		ac := NewAckingCommunicator(
+			&stubCommunicator{statusCodes: []int{tc.status}},
+			func(b *appoptics.MeasurementsBatch) { acked = append(acked, b) },
+			func(b *appoptics.MeasurementsBatch, err error) { nacked = append(nacked, b) },
+		)
+		ac.Create(batch)
+
+		if tc.acked && (len(acked) != 1 || len(nacked) != 0) {
+			t.Errorf("expected a %d to be acked but got %d acks and %d nacks", tc.status, len(acked), len(nacked))
+		}
+		if !tc.acked && (len(acked) != 0 || len(nacked) != 1) {
+			t.Errorf("expected a %d to be nacked but got %d acks and %d nacks", tc.status, len(acked), len(nacked))
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package promadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// AggregationStrategy decides how an LRUAggregationCache combines the values of a series
+type AggregationStrategy int
+
+const (
+	// AggregateLast keeps the most recent value
+	AggregateLast AggregationStrategy = iota
+	// AggregateSum adds the values up
+	AggregateSum
+	// AggregateMin keeps the smallest value
+	AggregateMin
+	// AggregateMax keeps the largest value
+	AggregateMax
+	// AggregateSummary sends the count, sum, minimum, maximum, last value and standard deviation as an AppOptics summary
+	// measurement
+	AggregateSummary
+)
+
+// ParseAggregationStrategy converts "last", "sum", "min", "max" or "summary" into an AggregationStrategy
+func ParseAggregationStrategy(s string) (AggregationStrategy, error) {
+	switch s {
+	case "last":
+		return AggregateLast, nil
+	case "sum":
+		return AggregateSum, nil
+	case "min":
+		return AggregateMin, nil
+	case "max":
+		return AggregateMax, nil
+	case "summary":
+		return AggregateSummary, nil
+	}
+	return AggregateLast, fmt.Errorf("unknown aggregation strategy %q", s)
+}
+
+// ErrAggregatorClosed is returned when Measurements are added to an LRUAggregationCache that has shut down
+var ErrAggregatorClosed = errors.New("aggregation cache is closed")
+
+// DefaultShutdownGrace is how long an LRUAggregationCache waits to hand over its final flush when shutting down
+const DefaultShutdownGrace = 5 * time.Second
+
+// DropReasonShutdown is recorded for Measurements that arrive at an LRUAggregationCache after it has shut down
+const DropReasonShutdown = "shutdown"
+
+// aggregate is the accumulated state of one series in an LRUAggregationCache
+type aggregate struct {
+	name  string
+	tags  map[string]string
+	time  int64
+	count int
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+	// values are only kept for summaries, which NewHistogramMeasurement computes from them when the series is flushed
+	values []float64
+}
+
+func (a *aggregate) add(m appoptics.Measurement, v float64, strategy AggregationStrategy) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.count++
+	a.sum += v
+	a.last = v
+	if strategy == AggregateSummary {
+		a.values = append(a.values, v)
+	}
+	if m.Time > a.time {
+		a.time = m.Time
+	}
+}
+
+// measurement returns the aggregated Measurement of the series
+func (a *aggregate) measurement(strategy AggregationStrategy) appoptics.Measurement {
+	m := appoptics.Measurement{Name: a.name, Tags: a.tags, Time: a.time}
+	switch strategy {
+	case AggregateSum:
+		m.Value = a.sum
+	case AggregateMin:
+		m.Value = a.min
+	case AggregateMax:
+		m.Value = a.max
+	case AggregateSummary:
+		hm := NewHistogramMeasurement(a.name, a.values)
+		hm.Tags, hm.Time = a.tags, a.time
+		m = hm.Measurement()
+		m.Last = a.last
+	default:
+		m.Value = a.last
+	}
+	return m
+}
+
+// LRUAggregationCache is a Stage pre-aggregating the values of each series until it is flushed, so that only one
+// Measurement per series and interval is sent. The aggregation state of at most maxEntries series is kept; when a new
+// series arrives at a full cache the least recently updated series is evicted and its aggregate passed on right away,
+// bounding memory for workloads with very many series.
+//
+// Measurements are held back, so the cache should be the last Stage and Run should flush it into the sink.
+type LRUAggregationCache struct {
+	strategy AggregationStrategy
+	stats    *Stats
+
+	mu      sync.Mutex
+	cache   *lru
+	evicted []appoptics.Measurement
+	closed  bool
+}
+
+// NewLRUAggregationCache returns an LRUAggregationCache of at most maxEntries series combined with strategy
+func NewLRUAggregationCache(maxEntries int, strategy AggregationStrategy, stats *Stats) *LRUAggregationCache {
+	ac := &LRUAggregationCache{strategy: strategy, stats: stats}
+	ac.cache = newLRU(maxEntries, func(key string, value interface{}) {
+		ac.evicted = append(ac.evicted, value.(*aggregate).measurement(ac.strategy))
+		ac.stats.AddCacheEvictions(1)
+	})
+	return ac
+}
+
+// Process implements Stage, returning the aggregates of series evicted to make room for the Measurements. Once the
+// cache has shut down the Measurements are dropped.
+func (ac *LRUAggregationCache) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	out, err := ac.Add(measurements)
+	if err != nil {
+		ac.stats.AddDropped(DropReasonShutdown, len(measurements))
+	}
+	return out
+}
+
+// Add aggregates the Measurements and returns the aggregates of series evicted to make room for them, or
+// ErrAggregatorClosed once the cache has shut down. Values that are not floats, like those of summary measurements,
+// cannot be aggregated and are returned as they are.
+func (ac *LRUAggregationCache) Add(measurements []appoptics.Measurement) ([]appoptics.Measurement, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.closed {
+		return nil, ErrAggregatorClosed
+	}
+
+	var out []appoptics.Measurement
+	for _, m := range measurements {
+		v, ok := m.Value.(float64)
+		if !ok {
+			out = append(out, m)
+			continue
+		}
+
+		key := seriesKey(m)
+		cached, ok := ac.cache.Get(key)
+		if !ok {
+			cached = &aggregate{name: m.Name, tags: m.Tags}
+			ac.cache.Add(key, cached)
+		}
+		cached.(*aggregate).add(m, v, ac.strategy)
+	}
+	ac.stats.SetCacheSize(ac.cache.Len())
+
+	out = append(out, ac.evicted...)
+	ac.evicted = nil
+	return out, nil
+}
+
+// Flush empties the cache and returns the aggregate of every series in it
+func (ac *LRUAggregationCache) Flush() []appoptics.Measurement {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.cache.Len() == 0 {
+		return nil
+	}
+	var out []appoptics.Measurement
+	for el := ac.cache.ll.Back(); el != nil; el = el.Prev() {
+		out = append(out, el.Value.(*lruEntry).value.(*aggregate).measurement(ac.strategy))
+	}
+	ac.cache = newLRU(ac.cache.max, ac.cache.onEvict)
+	ac.stats.SetCacheSize(0)
+	return out
+}
+
+// Run flushes the cache into sink every interval until ctx is done. It then stops accepting Measurements and makes
+// a final flush, giving up on it if sink does not take the Measurements within grace.
+func (ac *LRUAggregationCache) Run(ctx context.Context, interval, grace time.Duration, sink chan<- []appoptics.Measurement) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if measurements := ac.Flush(); len(measurements) > 0 {
+				select {
+				case sink <- measurements:
+				case <-ctx.Done():
+					ac.shutdown(measurements, grace, sink)
+					return
+				}
+			}
+		case <-ctx.Done():
+			ac.shutdown(nil, grace, sink)
+			return
+		}
+	}
+}
+
+// shutdown closes the cache and sends pending, along with whatever is left in the cache, to sink within grace
+func (ac *LRUAggregationCache) shutdown(pending []appoptics.Measurement, grace time.Duration, sink chan<- []appoptics.Measurement) {
+	ac.mu.Lock()
+	ac.closed = true
+	ac.mu.Unlock()
+
+	measurements := append(pending, ac.Flush()...)
+	if len(measurements) == 0 {
+		return
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case sink <- measurements:
+	case <-timer.C:
+		ac.stats.AddDropped(DropReasonShutdown, len(measurements))
+	}
+}
@@ -0,0 +1,120 @@
+package promadapter
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestLRUAggregationCache(t *testing.T) {
+	series := func(host string, value float64, ts int64) appoptics.Measurement {
+		return appoptics.Measurement{Name: metricNameFixture, Value: value, Time: ts, Tags: map[string]string{"host": host}}
+	}
+
+	t.Run("values are aggregated until flushed", func(t *testing.T) {
+		stats := NewStats()
+		ac := NewLRUAggregationCache(10, AggregateSum, stats)
+
+		if out := ac.Process([]appoptics.Measurement{series("a", 1, 100), series("a", 2, 110), series("b", 5, 100)}); len(out) != 0 {
+			t.Errorf("expected measurements to be held back but got %v", out)
+		}
+		if stats.CacheSize() != 2 {
+			t.Errorf("expected 2 cached series but got %d", stats.CacheSize())
+		}
+
+		flushed := ac.Flush()
+		if len(flushed) != 2 {
+			t.Fatalf("expected 2 aggregates but got %d", len(flushed))
+		}
+		if m := flushed[0]; m.Tags["host"] != "a" || m.Value != 3.0 || m.Time != 110 {
+			t.Errorf("expected host a to sum to 3 at 110 but got %+v", m)
+		}
+		if len(ac.Flush()) != 0 || stats.CacheSize() != 0 {
+			t.Error("expected the cache to be empty after flushing")
+		}
+	})
+
+	t.Run("the least recently updated series is evicted", func(t *testing.T) {
+		stats := NewStats()
+		ac := NewLRUAggregationCache(2, AggregateMax, stats)
+
+		ac.Process([]appoptics.Measurement{series("a", 1, 100), series("b", 2, 100), series("a", 4, 110)})
+		out := ac.Process([]appoptics.Measurement{series("c", 3, 120)})
+		if len(out) != 1 || out[0].Tags["host"] != "b" || out[0].Value != 2.0 {
+			t.Errorf("expected host b to be evicted and sent but got %v", out)
+		}
+		if stats.CacheEvictions() != 1 || stats.CacheSize() != 2 {
+			t.Errorf("expected 1 eviction and 2 cached series but got %d and %d", stats.CacheEvictions(), stats.CacheSize())
+		}
+	})
+
+	t.Run("summaries carry every statistic", func(t *testing.T) {
+		ac := NewLRUAggregationCache(10, AggregateSummary, NewStats())
+		ac.Process([]appoptics.Measurement{series("a", 3, 100), series("a", 1, 110), series("a", 2, 120)})
+
+		m := ac.Flush()[0]
+		if m.Value != nil || m.Count != 3 || m.Sum != 6.0 || m.Min != 1.0 || m.Max != 3.0 || m.Last != 2.0 {
+			t.Errorf("expected a summary of count 3, sum 6, min 1, max 3 and last 2 but got %+v", m)
+		}
+		// the population standard deviation of 3, 1 and 2
+		if sd, ok := m.StdDev.(float64); !ok || math.Abs(sd-math.Sqrt(2.0/3)) > 1e-9 {
+			t.Errorf("expected a standard deviation of %v but got %v", math.Sqrt(2.0/3), m.StdDev)
+		}
+	})
+
+	t.Run("cancelling the context flushes and closes the cache", func(t *testing.T) {
+		stats := NewStats()
+		ac := NewLRUAggregationCache(10, AggregateLast, stats)
+		ac.Process([]appoptics.Measurement{series("a", 1, 100)})
+
+		sink := make(chan []appoptics.Measurement, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			ac.Run(ctx, time.Hour, time.Second, sink)
+			close(done)
+		}()
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected Run to return once the context was cancelled")
+		}
+		if flushed := <-sink; len(flushed) != 1 || flushed[0].Value != 1.0 {
+			t.Errorf("expected a final flush of the cached series but got %v", flushed)
+		}
+
+		if _, err := ac.Add([]appoptics.Measurement{series("b", 2, 110)}); err != ErrAggregatorClosed {
+			t.Errorf("expected ErrAggregatorClosed but got %v", err)
+		}
+		if out := ac.Process([]appoptics.Measurement{series("b", 2, 110)}); len(out) != 0 || stats.Dropped()[DropReasonShutdown] != 1 {
+			t.Errorf("expected the measurement to be dropped but got %v and %v", out, stats.Dropped())
+		}
+	})
+
+	t.Run("the final flush gives up after the grace period", func(t *testing.T) {
+		stats := NewStats()
+		ac := NewLRUAggregationCache(10, AggregateLast, stats)
+		ac.Process([]appoptics.Measurement{series("a", 1, 100), series("b", 2, 100)})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ac.Run(ctx, time.Hour, 10*time.Millisecond, make(chan []appoptics.Measurement))
+		if dropped := stats.Dropped()[DropReasonShutdown]; dropped != 2 {
+			t.Errorf("expected 2 measurements to be dropped but got %d", dropped)
+		}
+	})
+}
+
+func TestParseAggregationStrategy(t *testing.T) {
+	if s, err := ParseAggregationStrategy("summary"); err != nil || s != AggregateSummary {
+		t.Errorf("expected summary to parse but got %v, %v", s, err)
+	}
+	if _, err := ParseAggregationStrategy("median"); err == nil {
+		t.Error("expected median to be rejected")
+	}
+}
@@ -0,0 +1,165 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertmanagerSource is the source of annotations created for Alertmanager alerts
+const AlertmanagerSource = "alertmanager"
+
+// alertmanagerAlert is one alert of an Alertmanager webhook notification
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	Fingerprint  string            `json:"fingerprint"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// alertmanagerMessage is the body of an Alertmanager webhook notification: a group of alerts or, from senders
+// emulating Alertmanager, a single alert
+type alertmanagerMessage struct {
+	alertmanagerAlert
+	Alerts []alertmanagerAlert `json:"alerts"`
+}
+
+// key identifies an alert across notifications, by its fingerprint if Alertmanager sent one and its labels otherwise
+func (a alertmanagerAlert) key() string {
+	if a.Fingerprint != "" {
+		return a.Fingerprint
+	}
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + a.Labels[k]
+	}
+	return strings.Join(parts, "\xff")
+}
+
+// event returns the annotation for the alert
+func (a alertmanagerAlert) event() *AnnotationEvent {
+	var description []string
+	for _, field := range []string{"summary", "description"} {
+		if text := a.Annotations[field]; text != "" {
+			description = append(description, text)
+		} else if text := a.Labels[field]; text != "" {
+			description = append(description, text)
+		}
+	}
+
+	event := &AnnotationEvent{
+		Title:       a.Labels["alertname"],
+		Description: strings.Join(description, "\n"),
+		Source:      AlertmanagerSource,
+		StartTime:   a.StartsAt.Unix(),
+	}
+	// Alertmanager sends the zero time, or a time in the future, for alerts still firing
+	if a.Status == "resolved" && !a.EndsAt.IsZero() {
+		event.EndTime = a.EndsAt.Unix()
+	}
+	return event
+}
+
+// alertmanagerOptions are the optional settings of an AlertmanagerHandler
+type alertmanagerOptions struct {
+	snapshots SnapshotsCommunicator
+	spaceID   int
+}
+
+// AlertmanagerOption configures an AlertmanagerHandler
+type AlertmanagerOption func(*alertmanagerOptions)
+
+// WithAlertSnapshots takes a snapshot of the Space with spaceID through sc whenever an alert starts firing, and adds
+// its URL to the alert's annotation so the charts can be seen as they were. Alerts are annotated without a snapshot
+// if it cannot be taken.
+func WithAlertSnapshots(sc SnapshotsCommunicator, spaceID int) AlertmanagerOption {
+	return func(o *alertmanagerOptions) {
+		o.snapshots, o.spaceID = sc, spaceID
+	}
+}
+
+// AlertmanagerHandler receives Alertmanager webhook notifications, creating an annotation through svc for each alert
+// that starts firing and setting its end time once the alert is resolved
+func AlertmanagerHandler(svc AnnotationsCommunicator, opts ...AlertmanagerOption) http.Handler {
+	var o alertmanagerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var mu sync.Mutex
+	firing := make(map[string]*AnnotationEvent)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var msg alertmanagerMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		alerts := msg.Alerts
+		if len(alerts) == 0 && msg.Labels != nil {
+			alerts = []alertmanagerAlert{msg.alertmanagerAlert}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		failed := false
+		for _, alert := range alerts {
+			key := alert.key()
+			event := alert.event()
+			if existing, ok := firing[key]; ok {
+				if event.EndTime == 0 {
+					continue
+				}
+				event.ID = existing.ID
+				if err := svc.UpdateAnnotation(r.Context(), event); err != nil {
+					log.Printf("ending annotation of alert %s: %s\n", event.Title, err)
+					failed = true
+					continue
+				}
+				delete(firing, key)
+				continue
+			}
+
+			if o.snapshots != nil && event.EndTime == 0 {
+				if snapshot, err := o.snapshots.CreateSnapshot(r.Context(), o.spaceID); err != nil {
+					log.Printf("taking a snapshot for alert %s: %s\n", event.Title, err)
+				} else {
+					event.Description = strings.TrimPrefix(event.Description+"\nSnapshot: "+snapshot.URL, "\n")
+				}
+			}
+			created, err := svc.CreateAnnotation(r.Context(), event)
+			if err != nil {
+				log.Printf("annotating alert %s: %s\n", event.Title, err)
+				failed = true
+				continue
+			}
+			if event.EndTime == 0 {
+				firing[key] = created
+			}
+		}
+
+		// Alertmanager retries failed notifications, and alerts already annotated are skipped then
+		if failed {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
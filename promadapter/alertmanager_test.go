@@ -0,0 +1,167 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubAnnotations records the annotation events created and updated through it
+type stubAnnotations struct {
+	created []AnnotationEvent
+	updated []AnnotationEvent
+}
+
+func (sa *stubAnnotations) CreateAnnotation(ctx context.Context, event *AnnotationEvent) (*AnnotationEvent, error) {
+	created := *event
+	created.ID = len(sa.created) + 1
+	sa.created = append(sa.created, created)
+	return &created, nil
+}
+
+func (sa *stubAnnotations) UpdateAnnotation(ctx context.Context, event *AnnotationEvent) error {
+	sa.updated = append(sa.updated, *event)
+	return nil
+}
+
+func TestAlertmanagerHandler(t *testing.T) {
+	svc := &stubAnnotations{}
+	server := httptest.NewServer(AlertmanagerHandler(svc))
+	defer server.Close()
+
+	post := func(body string) {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 but received %d", resp.StatusCode)
+		}
+	}
+
+	t.Run("firing alerts are annotated", func(t *testing.T) {
+		post(`{"version": "4", "status": "firing", "alerts": [
+			{"status": "firing", "labels": {"alertname": "HighLatency", "job": "api"}, "annotations": {"summary": "Latency is high", "description": "p99 over 1s"}, "startsAt": "2018-03-01T10:00:00Z", "endsAt": "0001-01-01T00:00:00Z", "fingerprint": "a1"},
+			{"status": "firing", "labels": {"alertname": "DiskFull"}, "startsAt": "2018-03-01T10:05:00Z", "fingerprint": "b2"}
+		]}`)
+
+		if len(svc.created) != 2 {
+			t.Fatalf("expected 2 annotations but got %d", len(svc.created))
+		}
+		event := svc.created[0]
+		if event.Title != "HighLatency" || event.Description != "Latency is high\np99 over 1s" {
+			t.Errorf("expected the alert name and summary but got %+v", event)
+		}
+		if event.StartTime != 1519898400 || event.EndTime != 0 {
+			t.Errorf("expected an open event starting at 1519898400 but got %+v", event)
+		}
+	})
+
+	t.Run("repeated notifications are not annotated again", func(t *testing.T) {
+		post(`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "DiskFull"}, "startsAt": "2018-03-01T10:05:00Z", "fingerprint": "b2"}]}`)
+		if len(svc.created) != 2 {
+			t.Errorf("expected no new annotations but got %d", len(svc.created))
+		}
+	})
+
+	t.Run("resolved alerts end their annotation", func(t *testing.T) {
+		post(`{"status": "resolved", "alerts": [{"status": "resolved", "labels": {"alertname": "HighLatency", "job": "api"}, "startsAt": "2018-03-01T10:00:00Z", "endsAt": "2018-03-01T10:30:00Z", "fingerprint": "a1"}]}`)
+		if len(svc.updated) != 1 {
+			t.Fatalf("expected 1 updated annotation but got %d", len(svc.updated))
+		}
+		if event := svc.updated[0]; event.ID != 1 || event.EndTime != 1519900200 {
+			t.Errorf("expected annotation 1 to end at 1519900200 but got %+v", event)
+		}
+	})
+
+	t.Run("single alerts are accepted", func(t *testing.T) {
+		post(`{"status": "resolved", "labels": {"alertname": "Flapping"}, "startsAt": "2018-03-01T11:00:00Z", "endsAt": "2018-03-01T11:01:00Z"}`)
+		if len(svc.created) != 3 {
+			t.Fatalf("expected 3 annotations but got %d", len(svc.created))
+		}
+		if event := svc.created[2]; event.Title != "Flapping" || event.EndTime != 1519902060 {
+			t.Errorf("expected a closed Flapping annotation but got %+v", event)
+		}
+	})
+
+	t.Run("malformed notifications are rejected", func(t *testing.T) {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(`{"alerts": `))
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 but received %d", resp.StatusCode)
+		}
+	})
+}
+
+// stubSnapshots takes snapshots of Spaces, failing once fail is set
+type stubSnapshots struct {
+	taken []int
+	fail  bool
+}
+
+func (ss *stubSnapshots) CreateSnapshot(ctx context.Context, spaceID int) (*SpaceSnapshot, error) {
+	if ss.fail {
+		return nil, errors.New("snapshots API responded 500")
+	}
+	ss.taken = append(ss.taken, spaceID)
+	return &SpaceSnapshot{ID: "s1", SpaceID: spaceID, URL: "https://snapshots.example.com/s1.png"}, nil
+}
+
+func (ss *stubSnapshots) GetSnapshot(ctx context.Context, snapshotID string) (*SpaceSnapshot, error) {
+	return nil, nil
+}
+
+func (ss *stubSnapshots) ListSnapshots(ctx context.Context, spaceID int) ([]SpaceSnapshot, error) {
+	return nil, nil
+}
+
+func (ss *stubSnapshots) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	return nil
+}
+
+func TestAlertmanagerHandlerSnapshots(t *testing.T) {
+	svc := &stubAnnotations{}
+	snapshots := &stubSnapshots{}
+	server := httptest.NewServer(AlertmanagerHandler(svc, WithAlertSnapshots(snapshots, 42)))
+	defer server.Close()
+
+	post := func(body string) {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 but received %d", resp.StatusCode)
+		}
+	}
+
+	t.Run("firing alerts link a snapshot", func(t *testing.T) {
+		post(`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "HighLatency"}, "annotations": {"summary": "Latency is high"}, "startsAt": "2018-03-01T10:00:00Z", "fingerprint": "a1"}]}`)
+		if len(snapshots.taken) != 1 || snapshots.taken[0] != 42 {
+			t.Fatalf("expected a snapshot of space 42 but got %v", snapshots.taken)
+		}
+		if expected := "Latency is high\nSnapshot: https://snapshots.example.com/s1.png"; svc.created[0].Description != expected {
+			t.Errorf("expected %q but got %q", expected, svc.created[0].Description)
+		}
+	})
+
+	t.Run("resolved alerts take no snapshot", func(t *testing.T) {
+		post(`{"status": "resolved", "alerts": [{"status": "resolved", "labels": {"alertname": "HighLatency"}, "startsAt": "2018-03-01T10:00:00Z", "endsAt": "2018-03-01T10:30:00Z", "fingerprint": "a1"}]}`)
+		if len(snapshots.taken) != 1 {
+			t.Errorf("expected no new snapshot but got %v", snapshots.taken)
+		}
+	})
+
+	t.Run("alerts are annotated without a snapshot that fails", func(t *testing.T) {
+		snapshots.fail = true
+		post(`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "DiskFull"}, "startsAt": "2018-03-01T10:05:00Z", "fingerprint": "b2"}]}`)
+		if len(svc.created) != 2 || svc.created[1].Description != "" {
+			t.Errorf("expected DiskFull to be annotated without a snapshot but got %+v", svc.created)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Types of AlertCondition
+const (
+	// AlertAbove fires when the metric goes above the threshold
+	AlertAbove = "above"
+	// AlertBelow fires when the metric goes below the threshold
+	AlertBelow = "below"
+	// AlertAbsent fires when the metric has not been reported for the duration
+	AlertAbsent = "absent"
+)
+
+// ErrAlertNotFound is returned when AppOptics responds 404 Not Found for an alert
+var ErrAlertNotFound = errors.New("alert not found")
+
+// Alert is an AppOptics alert, fired when any of its conditions is met and sent to its notification Services
+type Alert struct {
+	ID          int              `json:"id,omitempty"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Conditions  []AlertCondition `json:"conditions"`
+	// Services are the IDs of the notification Services the alert is sent to
+	Services   []int           `json:"services"`
+	Attributes AlertAttributes `json:"attributes,omitempty"`
+	Active     bool            `json:"active"`
+	// RearmSeconds is how long the alert waits after firing before it can fire again
+	RearmSeconds int `json:"rearm_seconds,omitempty"`
+}
+
+// AlertCondition is a condition on a metric that fires an Alert
+type AlertCondition struct {
+	// Type is AlertAbove, AlertBelow or AlertAbsent
+	Type       string  `json:"type"`
+	MetricName string  `json:"metric_name"`
+	Threshold  float64 `json:"threshold,omitempty"`
+	// SummaryFunction is what is compared with the threshold, e.g. "average" or "max"
+	SummaryFunction string `json:"summary_function,omitempty"`
+	// Duration is how many seconds the condition must hold before the alert fires
+	Duration int              `json:"duration,omitempty"`
+	Tags     []AlertTagFilter `json:"tags,omitempty"`
+}
+
+// AlertTagFilter restricts an AlertCondition to the series with a tag of one of the values
+type AlertTagFilter struct {
+	Name    string   `json:"name"`
+	Values  []string `json:"values"`
+	Grouped bool     `json:"grouped,omitempty"`
+}
+
+// AlertAttributes are the optional attributes of an Alert
+type AlertAttributes struct {
+	RunbookURL string `json:"runbook_url,omitempty"`
+}
+
+// validate returns an error if AppOptics would reject the alert's conditions
+func (a *Alert) validate() error {
+	if len(a.Conditions) == 0 {
+		return fmt.Errorf("alert %q has no conditions", a.Name)
+	}
+	for _, c := range a.Conditions {
+		switch c.Type {
+		case AlertAbove, AlertBelow, AlertAbsent:
+		default:
+			return fmt.Errorf("alert %q has a condition of unknown type %q", a.Name, c.Type)
+		}
+		if c.MetricName == "" {
+			return fmt.Errorf("alert %q has a %s condition without a metric", a.Name, c.Type)
+		}
+		if c.Type == AlertAbsent && c.Duration <= 0 {
+			return fmt.Errorf("alert %q has an absent condition without a duration", a.Name)
+		}
+	}
+	return nil
+}
+
+// AlertsCommunicator creates and manages alerts
+type AlertsCommunicator interface {
+	// CreateAlert creates the alert and returns it as created
+	CreateAlert(ctx context.Context, alert *Alert) (*Alert, error)
+	// ListAlerts returns every alert of the account
+	ListAlerts(ctx context.Context) ([]Alert, error)
+	// UpdateAlert replaces the alert with alert.ID
+	UpdateAlert(ctx context.Context, alert *Alert) error
+	// DeleteAlert deletes the alert with the ID
+	DeleteAlert(ctx context.Context, alertID int) error
+}
+
+// AlertsClient is an AlertsCommunicator for the AppOptics alerts API
+type AlertsClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewAlertsClient returns an AlertsClient for the alerts API at endpoint, e.g. the AlertsPath EndpointURL
+func NewAlertsClient(endpoint, token string, httpClient *http.Client) *AlertsClient {
+	return &AlertsClient{url: endpoint, token: token, httpClient: httpClient}
+}
+
+// CreateAlert implements AlertsCommunicator
+func (ac *AlertsClient) CreateAlert(ctx context.Context, alert *Alert) (*Alert, error) {
+	if err := alert.validate(); err != nil {
+		return nil, err
+	}
+	var created Alert
+	if err := ac.do(ctx, http.MethodPost, ac.url, alert, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListAlerts implements AlertsCommunicator
+func (ac *AlertsClient) ListAlerts(ctx context.Context) ([]Alert, error) {
+	var alerts []Alert
+	for offset := 0; ; {
+		var page struct {
+			Query struct {
+				Found int `json:"found"`
+			} `json:"query"`
+			Alerts []Alert `json:"alerts"`
+		}
+		params := url.Values{"offset": {strconv.Itoa(offset)}}
+		if err := ac.do(ctx, http.MethodGet, ac.url+"?"+params.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, page.Alerts...)
+		offset += len(page.Alerts)
+		if len(page.Alerts) == 0 || offset >= page.Query.Found {
+			return alerts, nil
+		}
+	}
+}
+
+// UpdateAlert implements AlertsCommunicator
+func (ac *AlertsClient) UpdateAlert(ctx context.Context, alert *Alert) error {
+	if err := alert.validate(); err != nil {
+		return err
+	}
+	return ac.do(ctx, http.MethodPut, ac.url+"/"+strconv.Itoa(alert.ID), alert, nil)
+}
+
+// DeleteAlert implements AlertsCommunicator
+func (ac *AlertsClient) DeleteAlert(ctx context.Context, alertID int) error {
+	return ac.do(ctx, http.MethodDelete, ac.url+"/"+strconv.Itoa(alertID), nil, nil)
+}
+
+// do sends body as JSON if it is not nil, decoding the response into out if it is not nil
+func (ac *AlertsClient) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(ac.token, "")
+
+	resp, err := ac.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrAlertNotFound
+	}
+	if resp.StatusCode > 299 {
+		return responseError("alerts API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
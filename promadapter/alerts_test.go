@@ -0,0 +1,97 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAlertsClient(t *testing.T) {
+	var requests []string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == http.MethodPost:
+			body = nil
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Expected no error but received %s", err.Error())
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":42,"name":"node.disk.full","conditions":[{"type":"above","metric_name":"node_filesystem_avail","threshold":90}],"services":[5],"active":true}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"query":{"offset":0,"length":1,"found":1},"alerts":[{"id":42,"name":"node.disk.full"}]}`))
+		case r.URL.Path == "/alerts/42":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ac := NewAlertsClient(server.URL+"/alerts", "token", server.Client())
+	ctx := context.Background()
+	alert := &Alert{
+		Name: "node.disk.full",
+		Conditions: []AlertCondition{
+			{Type: AlertAbove, MetricName: "node_filesystem_avail", Threshold: 90, SummaryFunction: "max", Duration: 300},
+			{Type: AlertAbsent, MetricName: "node_filesystem_avail", Duration: 600, Tags: []AlertTagFilter{{Name: "env", Values: []string{"prod"}}}},
+		},
+		Services:   []int{5},
+		Attributes: AlertAttributes{RunbookURL: "https://runbooks.example.com/disk"},
+		Active:     true,
+	}
+
+	created, err := ac.CreateAlert(ctx, alert)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if created.ID != 42 {
+		t.Errorf("expected the created alert but got %+v", created)
+	}
+
+	expected := map[string]interface{}{
+		"name": "node.disk.full",
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "above", "metric_name": "node_filesystem_avail", "threshold": 90.0, "summary_function": "max", "duration": 300.0},
+			map[string]interface{}{"type": "absent", "metric_name": "node_filesystem_avail", "duration": 600.0, "tags": []interface{}{
+				map[string]interface{}{"name": "env", "values": []interface{}{"prod"}},
+			}},
+		},
+		"services":   []interface{}{5.0},
+		"attributes": map[string]interface{}{"runbook_url": "https://runbooks.example.com/disk"},
+		"active":     true,
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected the body %v but got %v", expected, body)
+	}
+
+	alerts, err := ac.ListAlerts(ctx)
+	if err != nil || len(alerts) != 1 || alerts[0].ID != 42 {
+		t.Errorf("expected the alert to be listed but got %+v (%v)", alerts, err)
+	}
+
+	created.Active = false
+	if err := ac.UpdateAlert(ctx, created); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if err := ac.DeleteAlert(ctx, 42); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if err := ac.DeleteAlert(ctx, 7); err != ErrAlertNotFound {
+		t.Errorf("expected ErrAlertNotFound but got %v", err)
+	}
+
+	if _, err := ac.CreateAlert(ctx, &Alert{Name: "broken", Conditions: []AlertCondition{{Type: "sideways", MetricName: "up"}}}); err == nil {
+		t.Error("expected an error for a condition of unknown type")
+	}
+	if len(requests) != 5 {
+		t.Errorf("expected the invalid alert not to be sent but got %v", requests)
+	}
+}
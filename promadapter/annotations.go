@@ -0,0 +1,89 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// AnnotationEvent is an event on an AppOptics annotation stream. Times are Unix seconds; an EndTime of zero means the
+// event has not ended.
+type AnnotationEvent struct {
+	ID          int    `json:"id,omitempty"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source,omitempty"`
+	StartTime   int64  `json:"start_time,omitempty"`
+	EndTime     int64  `json:"end_time,omitempty"`
+}
+
+// AnnotationsCommunicator creates and updates events on an annotation stream
+type AnnotationsCommunicator interface {
+	// CreateAnnotation adds the event to the stream and returns it as created, with its ID
+	CreateAnnotation(ctx context.Context, event *AnnotationEvent) (*AnnotationEvent, error)
+	// UpdateAnnotation replaces the event with the same ID
+	UpdateAnnotation(ctx context.Context, event *AnnotationEvent) error
+}
+
+// AnnotationsClient is an AnnotationsCommunicator for one stream of the AppOptics annotations API
+type AnnotationsClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewAnnotationsClient returns an AnnotationsClient for the named stream of the annotations API at endpoint, e.g. the
+// AnnotationsPath EndpointURL
+func NewAnnotationsClient(endpoint, stream, token string, httpClient *http.Client) *AnnotationsClient {
+	return &AnnotationsClient{url: endpoint + "/" + url.PathEscape(stream), token: token, httpClient: httpClient}
+}
+
+// CreateAnnotation implements AnnotationsCommunicator
+func (ac *AnnotationsClient) CreateAnnotation(ctx context.Context, event *AnnotationEvent) (*AnnotationEvent, error) {
+	var created AnnotationEvent
+	if err := ac.do(ctx, http.MethodPost, ac.url, event, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateAnnotation implements AnnotationsCommunicator
+func (ac *AnnotationsClient) UpdateAnnotation(ctx context.Context, event *AnnotationEvent) error {
+	return ac.do(ctx, http.MethodPut, fmt.Sprintf("%s/events/%d", ac.url, event.ID), event, nil)
+}
+
+// do sends body as JSON, decoding the response into out if it is not nil
+func (ac *AnnotationsClient) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(ac.token, "")
+
+	resp, err := ac.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError("annotations API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
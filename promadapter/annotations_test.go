@@ -0,0 +1,42 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnnotationsClient(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		var event AnnotationEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("expected an annotation event: %s", err.Error())
+		}
+		event.ID = 42
+		json.NewEncoder(w).Encode(event)
+	}))
+	defer server.Close()
+
+	ac := NewAnnotationsClient(server.URL+"/annotations", "prod alerts", "token", server.Client())
+	created, err := ac.CreateAnnotation(context.Background(), &AnnotationEvent{Title: "HighLatency", StartTime: 100})
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if created.ID != 42 || created.Title != "HighLatency" {
+		t.Errorf("expected the created event but got %+v", created)
+	}
+
+	created.EndTime = 200
+	if err := ac.UpdateAnnotation(context.Background(), created); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	expected := []string{"POST /annotations/prod%20alerts", "PUT /annotations/prod%20alerts/events/42"}
+	if len(requests) != 2 || requests[0] != expected[0] || requests[1] != expected[1] {
+		t.Errorf("expected %v but got %v", expected, requests)
+	}
+}
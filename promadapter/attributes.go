@@ -0,0 +1,140 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// MetricAttributes are the display attributes of an AppOptics metric. Empty or nil fields in a desired MetricSpec are
+// left as they are.
+type MetricAttributes struct {
+	DisplayUnitsShort string `json:"display_units_short,omitempty"`
+	DisplayUnitsLong  string `json:"display_units_long,omitempty"`
+	Aggregate         *bool  `json:"aggregate,omitempty"`
+}
+
+// MetricSpec is the desired definition of an AppOptics metric
+type MetricSpec struct {
+	DisplayName string           `json:"display_name,omitempty"`
+	Attributes  MetricAttributes `json:"attributes"`
+}
+
+// ParseMetricSpecs decodes a JSON object of metric names to their desired MetricSpec
+func ParseMetricSpecs(data []byte) (map[string]MetricSpec, error) {
+	var specs map[string]MetricSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("decoding metric attributes: %s", err)
+	}
+	return specs, nil
+}
+
+// drifted returns true if current differs from the fields set in desired
+func (desired MetricSpec) drifted(current MetricSpec) bool {
+	d, c := desired.Attributes, current.Attributes
+	return (desired.DisplayName != "" && desired.DisplayName != current.DisplayName) ||
+		(d.DisplayUnitsShort != "" && d.DisplayUnitsShort != c.DisplayUnitsShort) ||
+		(d.DisplayUnitsLong != "" && d.DisplayUnitsLong != c.DisplayUnitsLong) ||
+		(d.Aggregate != nil && (c.Aggregate == nil || *d.Aggregate != *c.Aggregate))
+}
+
+// AttributeReconciler is a Stage that makes sure the AppOptics definition of each metric it sees matches the desired
+// MetricSpec, updating it if it has drifted. Each metric is reconciled at most once per run, in the background.
+type AttributeReconciler struct {
+	url        string
+	token      string
+	httpClient *http.Client
+	desired    map[string]MetricSpec
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewAttributeReconciler returns an AttributeReconciler reading and updating metrics under url
+func NewAttributeReconciler(url, token string, desired map[string]MetricSpec, httpClient *http.Client) *AttributeReconciler {
+	return &AttributeReconciler{
+		url:        url,
+		token:      token,
+		httpClient: httpClient,
+		desired:    desired,
+		seen:       make(map[string]bool),
+	}
+}
+
+// Process implements Stage. The Measurements are passed through unchanged.
+func (ar *AttributeReconciler) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	for _, m := range measurements {
+		if _, ok := ar.desired[m.Name]; !ok || ar.seen[m.Name] {
+			continue
+		}
+		ar.seen[m.Name] = true
+		go func(name string) {
+			if err := ar.Reconcile(name); err != nil {
+				log.Printf("reconciling attributes of %s: %s\n", name, err)
+			}
+		}(m.Name)
+	}
+	return measurements
+}
+
+// Reconcile fetches the named metric and updates it if it differs from its desired MetricSpec
+func (ar *AttributeReconciler) Reconcile(name string) error {
+	desired, ok := ar.desired[name]
+	if !ok {
+		return nil
+	}
+
+	var current MetricSpec
+	if err := ar.do(http.MethodGet, name, nil, &current); err != nil {
+		return err
+	}
+	if !desired.drifted(current) {
+		return nil
+	}
+	log.Printf("updating drifted attributes of %s\n", name)
+	return ar.do(http.MethodPut, name, desired, nil)
+}
+
+// do sends a request for the named metric, encoding body and decoding the response into out if they are not nil
+func (ar *AttributeReconciler) do(method, name string, body interface{}, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, ar.url+"/"+url.PathEscape(name), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(ar.token, "")
+
+	resp, err := ar.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError(method+" "+name, resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
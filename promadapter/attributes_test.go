@@ -0,0 +1,65 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAttributeReconciler(t *testing.T) {
+	var updated []MetricSpec
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/http_request_duration_seconds" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"name":"http_request_duration_seconds","attributes":{"display_units_short":"ms"}}`))
+		case http.MethodPut:
+			var spec MetricSpec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				t.Errorf("Expected no error but received %s", err.Error())
+			}
+			updated = append(updated, spec)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	specs, err := ParseMetricSpecs([]byte(`{
+		"http_request_duration_seconds": {"attributes": {"display_units_short": "s"}},
+		"up": {"attributes": {"display_units_short": "ms"}}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	ar := NewAttributeReconciler(server.URL, "token", specs, server.Client())
+
+	if err := ar.Reconcile("http_request_duration_seconds"); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if len(updated) != 1 || updated[0].Attributes.DisplayUnitsShort != "s" {
+		t.Errorf("expected the units to be updated to s but got %v", updated)
+	}
+
+	// metrics without a desired spec are never fetched
+	if err := ar.Reconcile("node_load1"); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+}
+
+func TestMetricSpecDrifted(t *testing.T) {
+	yes, no := true, false
+	desired := MetricSpec{Attributes: MetricAttributes{Aggregate: &yes}}
+
+	if desired.drifted(MetricSpec{Attributes: MetricAttributes{Aggregate: &yes, DisplayUnitsShort: "ms"}}) {
+		t.Error("expected fields missing from the desired spec to be ignored")
+	}
+	if !desired.drifted(MetricSpec{Attributes: MetricAttributes{Aggregate: &no}}) {
+		t.Error("expected a different aggregate to be drift")
+	}
+	if !desired.drifted(MetricSpec{}) {
+		t.Error("expected an unset aggregate to be drift")
+	}
+}
@@ -0,0 +1,197 @@
+package promadapter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// auditRedacted replaces the values of credential headers in an AuditRequest
+const auditRedacted = "***"
+
+// auditRedactedHeaders are the headers whose values never reach an AuditLogger
+var auditRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", SignatureHeader}
+
+// AuditRequest is the audit record of a request made to AppOptics
+type AuditRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"headers"`
+	// BodySHA256 is the hex-encoded SHA-256 hash of the request body, that of an empty body if there was none
+	BodySHA256 string    `json:"body_sha256"`
+	Time       time.Time `json:"time"`
+}
+
+// AuditResponse is the audit record of the response to a request made to AppOptics. StatusCode is zero and Error
+// set if no response was received.
+type AuditResponse struct {
+	StatusCode int    `json:"status_code"`
+	BodySHA256 string `json:"body_sha256,omitempty"`
+	// Duration is the time from sending the request to receiving the whole response body
+	Duration  time.Duration `json:"duration_ns"`
+	RequestID string        `json:"request_id,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// AuditLogger records the requests made to AppOptics and their responses, e.g. for an audit trail in regulated
+// environments
+type AuditLogger interface {
+	LogRequest(req AuditRequest)
+	LogResponse(resp AuditResponse)
+}
+
+// noopAuditLogger is an AuditLogger discarding every record
+type noopAuditLogger struct{}
+
+// NewNoopAuditLogger returns an AuditLogger discarding every record
+func NewNoopAuditLogger() AuditLogger {
+	return noopAuditLogger{}
+}
+
+func (noopAuditLogger) LogRequest(AuditRequest)   {}
+func (noopAuditLogger) LogResponse(AuditResponse) {}
+
+// JSONAuditLogger is an AuditLogger writing every record as a line of JSON, with a "type" of "request" or "response".
+// It is safe for concurrent use.
+type JSONAuditLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditLogger returns a JSONAuditLogger writing to w
+func NewJSONAuditLogger(w io.Writer) *JSONAuditLogger {
+	return &JSONAuditLogger{enc: json.NewEncoder(w)}
+}
+
+// LogRequest implements AuditLogger
+func (jl *JSONAuditLogger) LogRequest(req AuditRequest) {
+	jl.write(struct {
+		Type string `json:"type"`
+		AuditRequest
+	}{"request", req})
+}
+
+// LogResponse implements AuditLogger
+func (jl *JSONAuditLogger) LogResponse(resp AuditResponse) {
+	jl.write(struct {
+		Type string `json:"type"`
+		AuditResponse
+	}{"response", resp})
+}
+
+func (jl *JSONAuditLogger) write(record interface{}) {
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+	jl.enc.Encode(record)
+}
+
+// AuditOption configures an AuditTransport
+type AuditOption func(*AuditTransport)
+
+// WithAuditLogger sends the records of an AuditTransport to al
+func WithAuditLogger(al AuditLogger) AuditOption {
+	return func(at *AuditTransport) {
+		at.logger = al
+	}
+}
+
+// AuditTransport is an http.RoundTripper recording every request and its response with an AuditLogger. Bodies are
+// read to be hashed and handed on unchanged; credential headers are redacted from the records. It should be the
+// innermost transport, so that the records show the headers every other transport added.
+type AuditTransport struct {
+	next   http.RoundTripper
+	logger AuditLogger
+	now    func() time.Time
+}
+
+// NewAuditTransport returns an AuditTransport sending requests through next, discarding its records unless
+// configured otherwise
+func NewAuditTransport(next http.RoundTripper, opts ...AuditOption) *AuditTransport {
+	at := &AuditTransport{next: next, logger: NewNoopAuditLogger(), now: time.Now}
+	for _, opt := range opts {
+		opt(at)
+	}
+	return at
+}
+
+// RoundTrip implements http.RoundTripper
+func (at *AuditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	audited := req
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		audited = new(http.Request)
+		*audited = *req
+		audited.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	start := at.now()
+	at.logger.LogRequest(AuditRequest{
+		Method:     req.Method,
+		URL:        auditURL(req),
+		Header:     redactHeader(req.Header),
+		BodySHA256: hashBody(body),
+		Time:       start,
+	})
+
+	resp, err := at.next.RoundTrip(audited)
+	if err != nil {
+		at.logger.LogResponse(AuditResponse{Duration: at.now().Sub(start), Error: err.Error()})
+		return resp, err
+	}
+
+	respBody, readErr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	record := AuditResponse{
+		StatusCode: resp.StatusCode,
+		BodySHA256: hashBody(respBody),
+		Duration:   at.now().Sub(start),
+		RequestID:  resp.Header.Get(RequestIDHeader),
+	}
+	if readErr != nil {
+		record.Error = readErr.Error()
+	}
+	at.logger.LogResponse(record)
+	return resp, nil
+}
+
+// auditURL returns the URL of req without the password of any credentials it carries
+func auditURL(req *http.Request) string {
+	if req.URL.User == nil {
+		return req.URL.String()
+	}
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}
+
+// redactHeader returns a copy of h with the values of credential headers replaced
+func redactHeader(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		redacted[k] = v
+	}
+	for _, name := range auditRedactedHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Set(name, auditRedacted)
+		}
+	}
+	return redacted
+}
+
+// hashBody returns the hex-encoded SHA-256 hash of body
+func hashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
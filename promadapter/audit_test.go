@@ -0,0 +1,81 @@
+package promadapter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set(RequestIDHeader, "c0ffee")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(bytes.ToUpper(body))
+	}))
+	defer server.Close()
+
+	var records bytes.Buffer
+	client := &http.Client{Transport: NewAuditTransport(http.DefaultTransport, WithAuditLogger(NewJSONAuditLogger(&records)))}
+	body := `{"name":"node_load1"}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/measurements", strings.NewReader(body))
+	req.Header.Set("Authorization", "Basic dG9rZW46")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	echoed, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	t.Run("bodies are passed on unchanged", func(t *testing.T) {
+		if string(echoed) != strings.ToUpper(body) {
+			t.Errorf("expected the server to receive and echo the body but got %q", echoed)
+		}
+		if req.Header.Get("Authorization") != "Basic dG9rZW46" {
+			t.Error("expected the request headers to be left alone")
+		}
+	})
+
+	lines := strings.Split(strings.TrimSpace(records.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a request and a response record but got %q", records.String())
+	}
+	var request, response map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &request)
+	json.Unmarshal([]byte(lines[1]), &response)
+
+	t.Run("the request is recorded with credentials redacted", func(t *testing.T) {
+		requestHash := sha256.Sum256([]byte(body))
+		if request["type"] != "request" || request["method"] != "POST" || request["url"] != server.URL+"/v1/measurements" {
+			t.Errorf("expected the POST to be recorded but got %v", request)
+		}
+		if request["body_sha256"] != hex.EncodeToString(requestHash[:]) {
+			t.Errorf("expected the hash of the body but got %v", request["body_sha256"])
+		}
+		headers, _ := request["headers"].(map[string]interface{})
+		if auth, _ := headers["Authorization"].([]interface{}); len(auth) != 1 || auth[0] != auditRedacted {
+			t.Errorf("expected the Authorization header to be redacted but got %v", headers["Authorization"])
+		}
+		if ct, _ := headers["Content-Type"].([]interface{}); len(ct) != 1 || ct[0] != "application/json" {
+			t.Errorf("expected other headers to be recorded but got %v", headers["Content-Type"])
+		}
+	})
+
+	t.Run("the response is recorded", func(t *testing.T) {
+		responseHash := sha256.Sum256(echoed)
+		if response["type"] != "response" || response["status_code"] != 202.0 || response["request_id"] != "c0ffee" {
+			t.Errorf("expected the 202 to be recorded but got %v", response)
+		}
+		if response["body_sha256"] != hex.EncodeToString(responseHash[:]) {
+			t.Errorf("expected the hash of the response body but got %v", response["body_sha256"])
+		}
+	})
+}
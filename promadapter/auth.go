@@ -0,0 +1,44 @@
+package promadapter
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// BasicAuthEncoding is the base64 variant used for the credentials in a basic Authorization header. Some proxies in
+// front of AppOptics-compatible endpoints only accept a non-standard variant.
+type BasicAuthEncoding int
+
+const (
+	// StandardPadded is the RFC 7617 encoding, as produced by http.Request.SetBasicAuth
+	StandardPadded BasicAuthEncoding = iota
+	// URLSafe uses the URL-safe base64 alphabet with padding
+	URLSafe
+	// URLSafeNoPadding uses the URL-safe base64 alphabet without padding
+	URLSafeNoPadding
+)
+
+// ParseBasicAuthEncoding converts "standard", "url" or "url-nopad" into a BasicAuthEncoding
+func ParseBasicAuthEncoding(s string) (BasicAuthEncoding, error) {
+	switch s {
+	case "standard":
+		return StandardPadded, nil
+	case "url":
+		return URLSafe, nil
+	case "url-nopad":
+		return URLSafeNoPadding, nil
+	}
+	return StandardPadded, fmt.Errorf("unknown basic auth encoding %q", s)
+}
+
+// Header returns the value of an Authorization header carrying user and password
+func (e BasicAuthEncoding) Header(user, password string) string {
+	enc := base64.StdEncoding
+	switch e {
+	case URLSafe:
+		enc = base64.URLEncoding
+	case URLSafeNoPadding:
+		enc = base64.RawURLEncoding
+	}
+	return "Basic " + enc.EncodeToString([]byte(user+":"+password))
+}
@@ -0,0 +1,29 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBasicAuthEncodingHeader(t *testing.T) {
+	// ">>>?:" encodes to a '+', which differs between the standard and URL-safe alphabets, and needs padding
+	const token = ">>>?"
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	req.SetBasicAuth(token, "")
+
+	cases := []struct {
+		encoding BasicAuthEncoding
+		expected string
+	}{
+		{StandardPadded, req.Header.Get("Authorization")},
+		{StandardPadded, "Basic Pj4+Pzo="},
+		{URLSafe, "Basic Pj4-Pzo="},
+		{URLSafeNoPadding, "Basic Pj4-Pzo"},
+	}
+	for _, c := range cases {
+		if got := c.encoding.Header(token, ""); got != c.expected {
+			t.Errorf("expected %s but got %s", c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package promadapter
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxDelay is the longest delay a Backoff returns, for delays too long to be represented
+const maxDelay = time.Duration(math.MaxInt64)
+
+// Backoff decides how long to wait before retrying a request. attempt is the number of the attempt that just failed,
+// starting at 1, and resp its response, which is nil after a network error.
+type Backoff interface {
+	NextDelay(attempt int, resp *http.Response) time.Duration
+}
+
+// ConstantBackoff waits the same time before every retry
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+// NextDelay implements Backoff
+func (b ConstantBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	return b.Delay
+}
+
+// LinearBackoff waits Step longer before every retry, up to Max if it is set
+type LinearBackoff struct {
+	Step time.Duration
+	Max  time.Duration
+}
+
+// NextDelay implements Backoff
+func (b LinearBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	return capDelay(time.Duration(attempt)*b.Step, b.Max)
+}
+
+// ExponentialBackoff doubles the wait before every retry, starting at Base and up to Max if it is set. Jitter is the
+// fraction of each delay that is randomized, between 0 and 1, so that clients failing together don't retry together.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64
+}
+
+// NextDelay implements Backoff
+func (b ExponentialBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	// compared as a float64, as the delay of a late attempt does not fit in a Duration
+	f := float64(b.Base) * math.Pow(2, float64(attempt-1))
+	var d time.Duration
+	switch {
+	case b.Max > 0 && f > float64(b.Max):
+		d = b.Max
+	case f >= float64(maxDelay):
+		d = maxDelay
+	default:
+		d = time.Duration(f)
+	}
+	if b.Jitter > 0 {
+		d -= time.Duration(b.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// DecorrelatedJitterBackoff picks each delay at random between Base and three times the previous delay, up to Max if
+// it is set. It remembers the previous delay, starting over on the first attempt, and is best given to a single
+// RetryingCommunicator.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	mu   sync.Mutex
+	last time.Duration
+}
+
+// NextDelay implements Backoff
+func (b *DecorrelatedJitterBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if attempt <= 1 || b.last < b.Base {
+		b.last = b.Base
+	}
+	upper := maxDelay
+	if b.last < maxDelay/3 {
+		upper = 3 * b.last
+	}
+	var jitter time.Duration
+	if span := upper - b.Base; span > 0 {
+		jitter = time.Duration(rand.Int63n(int64(span)))
+	}
+	b.last = capDelay(b.Base+jitter, b.Max)
+	return b.last
+}
+
+// capDelay limits d to max if max is set. A negative d is a delay that overflowed and is taken as the longest one.
+func capDelay(d, max time.Duration) time.Duration {
+	if d < 0 {
+		d = maxDelay
+	}
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// retryAfter returns the delay a response, typically a 429 or 503, asks for in its Retry-After header, given either
+// in seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffs(t *testing.T) {
+	t.Run("linear", func(t *testing.T) {
+		b := LinearBackoff{Step: time.Second, Max: 3 * time.Second}
+		for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 5: 3 * time.Second} {
+			if d := b.NextDelay(attempt, nil); d != expected {
+				t.Errorf("expected %s after attempt %d but got %s", expected, attempt, d)
+			}
+		}
+	})
+
+	t.Run("exponential", func(t *testing.T) {
+		b := ExponentialBackoff{Base: time.Second, Max: time.Minute}
+		for attempt, expected := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: time.Minute} {
+			if d := b.NextDelay(attempt, nil); d != expected {
+				t.Errorf("expected %s after attempt %d but got %s", expected, attempt, d)
+			}
+		}
+
+		b.Jitter = 0.5
+		for i := 0; i < 100; i++ {
+			if d := b.NextDelay(3, nil); d < 2*time.Second || d > 4*time.Second {
+				t.Fatalf("expected a jittered delay between 2s and 4s but got %s", d)
+			}
+		}
+	})
+
+	t.Run("decorrelated jitter", func(t *testing.T) {
+		b := &DecorrelatedJitterBackoff{Base: time.Second, Max: 10 * time.Second}
+		previous := time.Second
+		for attempt := 1; attempt <= 20; attempt++ {
+			d := b.NextDelay(attempt, nil)
+			if d < time.Second || d > 3*previous || d > 10*time.Second {
+				t.Fatalf("expected a delay between 1s and %s after attempt %d but got %s", 3*previous, attempt, d)
+			}
+			previous = d
+		}
+	})
+
+	t.Run("late attempts do not overflow", func(t *testing.T) {
+		backoffs := map[string]Backoff{
+			"linear":                    LinearBackoff{Step: time.Hour, Max: time.Minute},
+			"exponential":               ExponentialBackoff{Base: time.Second, Max: time.Minute},
+			"exponential without max":   ExponentialBackoff{Base: time.Second},
+			"decorrelated jitter":       &DecorrelatedJitterBackoff{Base: time.Second, Max: time.Minute},
+			"decorrelated without max":  &DecorrelatedJitterBackoff{Base: time.Second},
+			"decorrelated without base": &DecorrelatedJitterBackoff{},
+		}
+		for name, b := range backoffs {
+			for attempt := 1; attempt <= 200; attempt++ {
+				if d := b.NextDelay(attempt, nil); d < 0 {
+					t.Fatalf("%s: expected a positive delay after attempt %d but got %s", name, attempt, d)
+				}
+			}
+		}
+		if d := (LinearBackoff{Step: time.Hour, Max: time.Minute}).NextDelay(1<<40, nil); d != time.Minute {
+			t.Errorf("expected an overflowing linear delay to be capped but got %s", d)
+		}
+		if d := (ExponentialBackoff{Base: time.Second, Max: time.Minute}).NextDelay(100, nil); d != time.Minute {
+			t.Errorf("expected an overflowing exponential delay to be capped but got %s", d)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"30":                            30 * time.Second,
+		"Thu, 01 Mar 2018 10:01:00 GMT": time.Minute,
+		"Thu, 01 Mar 2018 09:00:00 GMT": 0,
+	} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {value}}}
+		if d, ok := retryAfter(resp, now); !ok || d != expected {
+			t.Errorf("expected %q to mean %s but got %s", value, expected, d)
+		}
+	}
+
+	if _, ok := retryAfter(&http.Response{Header: http.Header{"Retry-After": {"soon"}}}, now); ok {
+		t.Error("expected an invalid Retry-After to be ignored")
+	}
+	if _, ok := retryAfter(nil, now); ok {
+		t.Error("expected no delay without a response")
+	}
+}
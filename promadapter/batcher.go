@@ -0,0 +1,151 @@
+package promadapter
+
+import (
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DefaultFlushInterval is how long a Batcher holds Measurements before flushing a batch that has hit no other limit
+const DefaultFlushInterval = time.Second
+
+// measurementOverhead approximates the memory a buffered Measurement takes up besides its name and tags
+const measurementOverhead = 96
+
+// tagOverhead approximates the memory a tag takes up in a Measurement's map besides its key and value
+const tagOverhead = 48
+
+// DefaultErrorChannelSize is how many failed flushes the error channel of a Batcher holds for its reader
+const DefaultErrorChannelSize = 100
+
+// SubmissionError is a batch a Batcher failed to persist, after whatever retries the communicator it sends through
+// made
+type SubmissionError struct {
+	Batch []appoptics.Measurement
+	Err   error
+	At    time.Time
+}
+
+// BatcherOption configures a Batcher
+type BatcherOption func(*Batcher)
+
+// WithErrorChannelSize makes the Batcher send a SubmissionError for every failed flush on the channel returned by
+// Errors, which holds up to n of them, instead of logging it. An error arriving while the channel is full is dropped
+// and counted.
+func WithErrorChannelSize(n int) BatcherOption {
+	return func(b *Batcher) {
+		b.errors = make(chan SubmissionError, n)
+	}
+}
+
+// WithBatcherStats counts the errors dropped from a full error channel in stats
+func WithBatcherStats(stats *Stats) BatcherOption {
+	return func(b *Batcher) {
+		b.stats = stats
+	}
+}
+
+// Batcher persists the Measurements sent to it in batches, like the client library's BatchPersister, but also flushes
+// once the memory taken up by the buffered Measurements crosses a threshold, so a burst of Measurements with many
+// long tags is sent before it consumes too much heap. A batch is flushed when it holds maxCount Measurements, when
+// it takes up maxBytes, or after interval, whichever comes first.
+type Batcher struct {
+	mc       appoptics.MeasurementsCommunicator
+	maxCount int
+	maxBytes int
+	interval time.Duration
+	errors   chan SubmissionError
+	stats    *Stats
+	now      func() time.Time
+
+	pending []appoptics.Measurement
+	bytes   int
+}
+
+// NewBatcher returns a Batcher persisting batches through mc
+func NewBatcher(mc appoptics.MeasurementsCommunicator, maxCount, maxBytes int, interval time.Duration, opts ...BatcherOption) *Batcher {
+	b := &Batcher{mc: mc, maxCount: maxCount, maxBytes: maxBytes, interval: interval, stats: NewStats(), now: time.Now}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Errors returns the channel failed flushes are reported on, for callers to drain without blocking the Batcher. It
+// is nil unless the Batcher was configured with WithErrorChannelSize, and is never closed.
+func (b *Batcher) Errors() <-chan SubmissionError {
+	return b.errors
+}
+
+// Run batches the Measurements received from in until stop receives a value or in is closed, flushing whatever is
+// left before returning
+func (b *Batcher) Run(in <-chan []appoptics.Measurement, stop <-chan bool) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case measurements, ok := <-in:
+			if !ok {
+				b.Flush()
+				return
+			}
+			b.Add(measurements)
+		case <-ticker.C:
+			b.Flush()
+		case <-stop:
+			b.Flush()
+			return
+		}
+	}
+}
+
+// Add buffers the Measurements, flushing every time a limit is reached. It is not safe for concurrent use with Run.
+func (b *Batcher) Add(measurements []appoptics.Measurement) {
+	for _, m := range measurements {
+		b.pending = append(b.pending, m)
+		b.bytes += measurementCost(m)
+		if len(b.pending) >= b.maxCount || (b.maxBytes > 0 && b.bytes >= b.maxBytes) {
+			b.Flush()
+		}
+	}
+}
+
+// Flush persists the buffered Measurements, if there are any
+func (b *Batcher) Flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+	batch := &appoptics.MeasurementsBatch{Measurements: b.pending}
+	b.pending, b.bytes = nil, 0
+	if _, err := b.mc.Create(batch); err != nil {
+		b.notify(SubmissionError{Batch: batch.Measurements, Err: err, At: b.now()})
+	}
+}
+
+// notify sends se on the error channel, dropping it if the channel is full, or logs it if there is no channel
+func (b *Batcher) notify(se SubmissionError) {
+	if b.errors == nil {
+		LogError("persisting batch of %d measurements: %s\n", len(se.Batch), se.Err)
+		return
+	}
+	select {
+	case b.errors <- se:
+	default:
+		b.stats.AddDroppedErrors(1)
+	}
+}
+
+// Buffered returns the number of Measurements waiting to be flushed and roughly how much memory they take up
+func (b *Batcher) Buffered() (int, int) {
+	return len(b.pending), b.bytes
+}
+
+// measurementCost approximates the memory a buffered Measurement takes up, counting its strings and a fixed overhead
+// for the rest
+func measurementCost(m appoptics.Measurement) int {
+	cost := measurementOverhead + len(m.Name)
+	for k, v := range m.Tags {
+		cost += tagOverhead + len(k) + len(v)
+	}
+	return cost
+}
@@ -0,0 +1,86 @@
+package promadapter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestBatcher(t *testing.T) {
+	wide := appoptics.Measurement{Name: metricNameFixture, Value: valueFixture, Tags: map[string]string{"path": strings.Repeat("x", 1000)}}
+	narrow := appoptics.Measurement{Name: metricNameFixture, Value: valueFixture}
+
+	t.Run("wide measurements flush at the byte threshold", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		b := NewBatcher(stub, 100, 4*measurementCost(wide), time.Hour)
+
+		b.Add([]appoptics.Measurement{wide, wide, wide})
+		if len(stub.batches) != 0 {
+			t.Fatalf("expected no flush under the byte threshold but got %d", len(stub.batches))
+		}
+		b.Add([]appoptics.Measurement{wide, wide})
+		if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 4 {
+			t.Fatalf("expected a batch of 4 measurements at the byte threshold but got %d batches", len(stub.batches))
+		}
+		if n, bytes := b.Buffered(); n != 1 || bytes != measurementCost(wide) {
+			t.Errorf("expected 1 measurement of %d bytes to be left but got %d of %d", measurementCost(wide), n, bytes)
+		}
+	})
+
+	t.Run("narrow measurements flush at the count threshold", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		b := NewBatcher(stub, 3, 4*measurementCost(wide), time.Hour)
+
+		b.Add([]appoptics.Measurement{narrow, narrow, narrow, narrow})
+		if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 3 {
+			t.Errorf("expected a batch of 3 measurements at the count threshold but got %d batches", len(stub.batches))
+		}
+	})
+
+	t.Run("stopping flushes what is left", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		b := NewBatcher(stub, 100, 0, time.Hour)
+		in := make(chan []appoptics.Measurement)
+		stop := make(chan bool)
+		done := make(chan struct{})
+		go func() {
+			b.Run(in, stop)
+			close(done)
+		}()
+
+		in <- []appoptics.Measurement{narrow, narrow}
+		stop <- true
+		<-done
+		if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 2 {
+			t.Errorf("expected the remaining 2 measurements to be flushed but got %d batches", len(stub.batches))
+		}
+	})
+}
+
+func TestBatcherErrors(t *testing.T) {
+	narrow := appoptics.Measurement{Name: metricNameFixture, Value: valueFixture}
+	stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+	stats := NewStats()
+	b := NewBatcher(stub, 1, 0, time.Hour, WithErrorChannelSize(1), WithBatcherStats(stats))
+	b.now = func() time.Time { return time.Unix(timestampFixture, 0) }
+
+	b.Add([]appoptics.Measurement{narrow, narrow})
+	select {
+	case se := <-b.Errors():
+		if len(se.Batch) != 1 || se.Err == nil || se.At.Unix() != timestampFixture {
+			t.Errorf("expected the failed batch, its error and time but got %+v", se)
+		}
+	default:
+		t.Fatal("expected a failed flush to be reported")
+	}
+	if stats.DroppedErrors() != 1 {
+		t.Errorf("expected the error arriving at a full channel to be dropped but got %d drops", stats.DroppedErrors())
+	}
+
+	if NewBatcher(stub, 1, 0, time.Hour).Errors() != nil {
+		t.Error("expected no error channel unless one is configured")
+	}
+}
@@ -0,0 +1,64 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// SizeLimitedCommunicator wraps a MeasurementsCommunicator, splitting batches whose JSON encoding would exceed a
+// number of bytes. The BatchPersister only limits batches by count, which still lets Measurements with many long tags
+// add up to a request AppOptics rejects with a 413; both limits apply independently.
+type SizeLimitedCommunicator struct {
+	mc       appoptics.MeasurementsCommunicator
+	maxBytes int
+}
+
+// NewSizeLimitedCommunicator returns a SizeLimitedCommunicator sending batches of at most maxBytes through mc. A single
+// Measurement larger than maxBytes on its own is still sent, in a batch by itself.
+func NewSizeLimitedCommunicator(mc appoptics.MeasurementsCommunicator, maxBytes int) *SizeLimitedCommunicator {
+	return &SizeLimitedCommunicator{mc: mc, maxBytes: maxBytes}
+}
+
+// Create sends the batch in as many parts as maxBytes requires, stopping at the first failure. Each part keeps the
+// batch's own time, period and tags.
+func (sc *SizeLimitedCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	envelope := *batch
+	envelope.Measurements = nil
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	// the measurements key and brackets are added to whatever else the batch encodes to
+	overhead := len(encoded) + len(`,"measurements":[]`)
+
+	size := overhead
+	start := 0
+	var resp *http.Response
+	for i, m := range batch.Measurements {
+		encoded, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > start && size+len(encoded)+1 > sc.maxBytes {
+			if resp, err = sc.send(envelope, batch.Measurements[start:i]); err != nil {
+				return resp, err
+			}
+			start, size = i, overhead
+		}
+		size += len(encoded) + 1
+	}
+
+	if start == len(batch.Measurements) {
+		return resp, nil
+	}
+	return sc.send(envelope, batch.Measurements[start:])
+}
+
+// send creates a batch of measurements with the envelope's time, period and tags
+func (sc *SizeLimitedCommunicator) send(envelope appoptics.MeasurementsBatch, measurements []appoptics.Measurement) (*http.Response, error) {
+	envelope.Measurements = measurements
+	return sc.mc.Create(&envelope)
+}
@@ -0,0 +1,72 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestSizeLimitedCommunicator(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	tags := map[string]string{"region": "us-east-1"}
+	batch := &appoptics.MeasurementsBatch{Time: timestampFixture, Tags: &tags}
+	for i := 0; i < 10; i++ {
+		batch.Measurements = append(batch.Measurements, appoptics.Measurement{
+			Name:  metricNameFixture,
+			Value: valueFixture,
+			Tags:  map[string]string{"path": long},
+		})
+	}
+
+	t.Run("batches are split by encoded size", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		sc := NewSizeLimitedCommunicator(stub, 1000)
+		if _, err := sc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		if len(stub.batches) < 3 {
+			t.Fatalf("expected the batch to be split but got %d parts", len(stub.batches))
+		}
+		var sent int
+		for _, b := range stub.batches {
+			encoded, _ := json.Marshal(b)
+			if len(encoded) > 1000 {
+				t.Errorf("expected parts of at most 1000 bytes but got %d", len(encoded))
+			}
+			if b.Time != timestampFixture || b.Tags != &tags {
+				t.Errorf("expected each part to keep the batch's time and tags but got %+v", b)
+			}
+			sent += len(b.Measurements)
+		}
+		if sent != len(batch.Measurements) {
+			t.Errorf("expected %d measurements to be sent but got %d", len(batch.Measurements), sent)
+		}
+	})
+
+	t.Run("oversized measurements are sent alone", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		sc := NewSizeLimitedCommunicator(stub, 100)
+		if _, err := sc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(stub.batches) != len(batch.Measurements) {
+			t.Errorf("expected %d parts but got %d", len(batch.Measurements), len(stub.batches))
+		}
+	})
+
+	t.Run("sending stops at the first failure", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted, http.StatusRequestEntityTooLarge}}
+		sc := NewSizeLimitedCommunicator(stub, 1000)
+		resp, err := sc.Create(batch)
+		if err == nil || resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected the 413 to be returned but got %v", err)
+		}
+		if len(stub.batches) != 2 {
+			t.Errorf("expected 2 parts to be sent but got %d", len(stub.batches))
+		}
+	})
+}
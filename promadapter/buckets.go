@@ -0,0 +1,57 @@
+package promadapter
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/prometheus/common/model"
+)
+
+// BucketLabels is a Stage that renames the histogram "le" and summary "quantile" labels to the configured tag keys and
+// formats their values consistently, so the same bound always produces the same tag whatever the exporter wrote,
+// e.g. "1.0" and "1" both become "1" and "Inf" becomes "+Inf".
+type BucketLabels struct {
+	bucketTag   string
+	quantileTag string
+}
+
+// NewBucketLabels returns a BucketLabels forwarding bucket bounds as bucketTag and quantiles as quantileTag
+func NewBucketLabels(bucketTag, quantileTag string) *BucketLabels {
+	return &BucketLabels{bucketTag: bucketTag, quantileTag: quantileTag}
+}
+
+// Process implements Stage
+func (bl *BucketLabels) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for _, m := range measurements {
+		relabel(m.Tags, model.BucketLabel, bl.bucketTag)
+		relabel(m.Tags, model.QuantileLabel, bl.quantileTag)
+	}
+	return measurements
+}
+
+// relabel moves the value of tag from to tag to, formatting it as a float. Values that are not floats are moved as
+// they are.
+func relabel(tags map[string]string, from, to string) {
+	v, ok := tags[from]
+	if !ok {
+		return
+	}
+	delete(tags, from)
+	tags[to] = formatBound(v)
+}
+
+// formatBound returns the canonical form of a bucket bound or quantile
+func formatBound(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
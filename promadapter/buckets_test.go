@@ -0,0 +1,50 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestBucketLabels(t *testing.T) {
+	bl := NewBucketLabels("bucket", "percentile")
+
+	out := bl.Process([]appoptics.Measurement{
+		{Name: "http_request_duration_seconds_bucket", Value: 12.0, Tags: map[string]string{"le": "+Inf", "job": "api"}},
+		{Name: "http_request_duration_seconds_bucket", Value: 10.0, Tags: map[string]string{"le": "0.50"}},
+		{Name: "rpc_duration_seconds", Value: 0.2, Tags: map[string]string{"quantile": "0.99"}},
+	})
+
+	expected := []map[string]string{
+		{"bucket": "+Inf", "job": "api"},
+		{"bucket": "0.5"},
+		{"percentile": "0.99"},
+	}
+	for i, tags := range expected {
+		if len(out[i].Tags) != len(tags) {
+			t.Errorf("expected tags %v but got %v", tags, out[i].Tags)
+			continue
+		}
+		for k, v := range tags {
+			if out[i].Tags[k] != v {
+				t.Errorf("expected tag %s=%q but got %q", k, v, out[i].Tags[k])
+			}
+		}
+	}
+}
+
+func TestFormatBound(t *testing.T) {
+	for in, expected := range map[string]string{
+		"+Inf": "+Inf",
+		"Inf":  "+Inf",
+		"-Inf": "-Inf",
+		"1.0":  "1",
+		"1e3":  "1000",
+		"0.99": "0.99",
+		"high": "high",
+	} {
+		if got := formatBound(in); got != expected {
+			t.Errorf("expected %q to format as %q but got %q", in, expected, got)
+		}
+	}
+}
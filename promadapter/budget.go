@@ -0,0 +1,81 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// budgetPrecisions are the significant digits a PayloadBudget successively rounds values to
+var budgetPrecisions = []int{10, 6, 3}
+
+// PayloadBudget is a Stage that trims Measurements whose JSON encoding exceeds a number of bytes, first by reducing
+// the precision of their value and then by removing tags, longest first, until they fit. The name and value are
+// never removed, so a Measurement may still exceed the budget once there is nothing left to trim.
+type PayloadBudget struct {
+	maxBytes int
+	stats    *Stats
+}
+
+// NewPayloadBudget returns a PayloadBudget targeting maxBytes per Measurement
+func NewPayloadBudget(maxBytes int, stats *Stats) *PayloadBudget {
+	return &PayloadBudget{maxBytes: maxBytes, stats: stats}
+}
+
+// Process implements Stage
+func (pb *PayloadBudget) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for i, m := range measurements {
+		if pb.fits(m) {
+			continue
+		}
+		measurements[i] = pb.trim(m)
+		pb.stats.AddTrimmed(1)
+	}
+	return measurements
+}
+
+func (pb *PayloadBudget) trim(m appoptics.Measurement) appoptics.Measurement {
+	if v, ok := m.Value.(float64); ok {
+		for _, digits := range budgetPrecisions {
+			m.Value, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', digits, 64), 64)
+			if pb.fits(m) {
+				return m
+			}
+		}
+	}
+
+	if len(m.Tags) == 0 {
+		return m
+	}
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		li, lj := len(keys[i])+len(m.Tags[keys[i]]), len(keys[j])+len(m.Tags[keys[j]])
+		if li != lj {
+			return li > lj
+		}
+		return keys[i] < keys[j]
+	})
+
+	tags := make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	m.Tags = tags
+	for _, k := range keys {
+		delete(m.Tags, k)
+		if pb.fits(m) {
+			break
+		}
+	}
+	return m
+}
+
+func (pb *PayloadBudget) fits(m appoptics.Measurement) bool {
+	encoded, err := json.Marshal(m)
+	return err == nil && len(encoded) <= pb.maxBytes
+}
@@ -0,0 +1,60 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestPayloadBudget(t *testing.T) {
+	m := appoptics.Measurement{
+		Name:  metricNameFixture,
+		Value: 3.14159265358979,
+		Time:  1500000000,
+		Tags: map[string]string{
+			"environment": "production",
+			"pod":         "inventory-service-5d8f7c9b4-x7k2p-with-a-very-long-generated-suffix",
+		},
+	}
+
+	t.Run("measurements within budget are untouched", func(t *testing.T) {
+		stats := NewStats()
+		out := NewPayloadBudget(1000, stats).Process([]appoptics.Measurement{m})
+		if out[0].Value != m.Value || len(out[0].Tags) != 2 {
+			t.Errorf("expected the measurement to be unchanged but got %+v", out[0])
+		}
+		if stats.Trimmed() != 0 {
+			t.Errorf("expected nothing to be trimmed but got %d", stats.Trimmed())
+		}
+	})
+
+	t.Run("tight budgets trim precision then tags", func(t *testing.T) {
+		stats := NewStats()
+		out := NewPayloadBudget(120, stats).Process([]appoptics.Measurement{m})
+
+		encoded, _ := json.Marshal(out[0])
+		if len(encoded) > 120 {
+			t.Errorf("expected at most 120 bytes but got %d: %s", len(encoded), encoded)
+		}
+		if out[0].Name != metricNameFixture || out[0].Value == nil {
+			t.Errorf("expected name and value to be preserved but got %+v", out[0])
+		}
+		if _, ok := out[0].Tags["pod"]; ok {
+			t.Error("expected the longest tag to be removed first")
+		}
+		if out[0].Tags["environment"] != "production" {
+			t.Error("expected the short tag to be kept")
+		}
+		if stats.Trimmed() != 1 {
+			t.Errorf("expected 1 trimmed measurement but got %d", stats.Trimmed())
+		}
+	})
+
+	t.Run("name and value are never removed", func(t *testing.T) {
+		out := NewPayloadBudget(1, NewStats()).Process([]appoptics.Measurement{m})
+		if out[0].Name != metricNameFixture || out[0].Value == nil {
+			t.Errorf("expected name and value to be preserved but got %+v", out[0])
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package promadapter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// CardinalityAction is what a CardinalityGuard does with a metric's Measurements once the metric has crossed the
+// cardinality threshold
+type CardinalityAction int
+
+const (
+	// CardinalityKeep sends the Measurements unchanged
+	CardinalityKeep CardinalityAction = iota
+	// CardinalityDrop discards the Measurements
+	CardinalityDrop
+	// CardinalityDropTags sends the Measurements without any Tags, collapsing the metric into a single series
+	CardinalityDropTags
+)
+
+// ParseCardinalityAction converts "keep", "drop" or "drop-tags" into a CardinalityAction
+func ParseCardinalityAction(s string) (CardinalityAction, error) {
+	switch s {
+	case "keep":
+		return CardinalityKeep, nil
+	case "drop":
+		return CardinalityDrop, nil
+	case "drop-tags":
+		return CardinalityDropTags, nil
+	}
+	return CardinalityKeep, fmt.Errorf("unknown cardinality action %q", s)
+}
+
+// CardinalityHandler is called once for each metric whose estimated number of distinct tag sets crosses the threshold
+// and decides what happens to that metric from then on
+type CardinalityHandler func(metric string, estimate uint64) CardinalityAction
+
+// CardinalityGuard is a Stage that estimates the number of distinct tag sets of every metric and hands metrics that
+// grow past a threshold to a CardinalityHandler before they become expensive in AppOptics
+type CardinalityGuard struct {
+	threshold uint64
+	handler   CardinalityHandler
+	stats     *Stats
+
+	mu        sync.Mutex
+	estimates map[string]*hyperLogLog
+	actions   map[string]CardinalityAction
+}
+
+// NewCardinalityGuard returns a CardinalityGuard calling handler for metrics with more than threshold tag sets
+func NewCardinalityGuard(threshold uint64, handler CardinalityHandler, stats *Stats) *CardinalityGuard {
+	return &CardinalityGuard{
+		threshold: threshold,
+		handler:   handler,
+		stats:     stats,
+		estimates: make(map[string]*hyperLogLog),
+		actions:   make(map[string]CardinalityAction),
+	}
+}
+
+// Process implements Stage
+func (cg *CardinalityGuard) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
+	touched := make(map[string]bool)
+	kept := measurements[:0]
+	for _, m := range measurements {
+		hll, ok := cg.estimates[m.Name]
+		if !ok {
+			hll = newHyperLogLog()
+			cg.estimates[m.Name] = hll
+		}
+		hll.Add(seriesKey(m))
+		touched[m.Name] = true
+
+		action, crossed := cg.actions[m.Name]
+		if !crossed {
+			if estimate := hll.Estimate(); estimate > cg.threshold {
+				action = cg.handler(m.Name, estimate)
+				cg.actions[m.Name] = action
+			}
+		}
+
+		switch action {
+		case CardinalityDrop:
+			cg.stats.AddDropped(DropReasonCardinality, 1)
+			continue
+		case CardinalityDropTags:
+			m.Tags = nil
+		}
+		kept = append(kept, m)
+	}
+
+	for name := range touched {
+		cg.stats.SetCardinality(name, cg.estimates[name].Estimate())
+	}
+	return kept
+}
+
+// hyperLogLogPrecision is the number of hash bits used to pick a register; 2^10 registers give a standard error of
+// roughly 3% in 1KiB per metric
+const hyperLogLogPrecision = 10
+
+// hyperLogLog estimates the number of distinct strings added to it in constant memory
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hyperLogLogPrecision)}
+}
+
+// Add records s
+func (h *hyperLogLog) Add(s string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(s))
+	x := mix64(hasher.Sum64())
+
+	idx := x >> (64 - hyperLogLogPrecision)
+	rank := uint8(1)
+	for w := x << hyperLogLogPrecision; w&(1<<63) == 0 && rank <= 64-hyperLogLogPrecision; w <<= 1 {
+		rank++
+	}
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Estimate returns the approximate number of distinct strings added
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// small range correction
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits are poorly distributed for short inputs
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,42 @@
+package promadapter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestCardinalityGuard(t *testing.T) {
+	var calls []string
+	handler := func(metric string, estimate uint64) CardinalityAction {
+		calls = append(calls, metric)
+		return CardinalityDrop
+	}
+	stats := NewStats()
+	cg := NewCardinalityGuard(50, handler, stats)
+
+	var kept int
+	for i := 0; i < 200; i++ {
+		out := cg.Process([]appoptics.Measurement{
+			{Name: "per_container", Value: 1.0, Tags: map[string]string{"container": fmt.Sprintf("c-%d", i)}},
+			{Name: "steady", Value: 1.0, Tags: map[string]string{"environment": "production"}},
+		})
+		kept += len(out)
+	}
+
+	if len(calls) != 1 || calls[0] != "per_container" {
+		t.Fatalf("expected the handler to fire once for per_container but got %v", calls)
+	}
+	if stats.Dropped()[DropReasonCardinality] == 0 {
+		t.Error("expected measurements past the threshold to be dropped")
+	}
+	if kept <= 200 || kept >= 400 {
+		t.Errorf("expected steady and the first per_container measurements to be kept but got %d", kept)
+	}
+
+	estimate := stats.Cardinality()["per_container"]
+	if estimate < 180 || estimate > 220 {
+		t.Errorf("expected an estimate close to 200 but got %d", estimate)
+	}
+}
@@ -0,0 +1,97 @@
+package promadapter
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFailure is returned by a FailureInjectionTransport for requests it fails with a transport error
+var ErrInjectedFailure = errors.New("injected transport failure")
+
+// InjectedFailure is how a FailureInjectionTransport fails a request: with an HTTP status code, or with a transport
+// error if it is InjectTransportError
+type InjectedFailure int
+
+// InjectTransportError fails a request with ErrInjectedFailure instead of a response
+const InjectTransportError InjectedFailure = 0
+
+// ParseInjectedFailures converts a comma-separated list of HTTP status codes and the word "error", for transport
+// errors, into InjectedFailures
+func ParseInjectedFailures(s string) ([]InjectedFailure, error) {
+	var failures []InjectedFailure
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "error" {
+			failures = append(failures, InjectTransportError)
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("unknown injected failure %q", field)
+		}
+		failures = append(failures, InjectedFailure(code))
+	}
+	return failures, nil
+}
+
+// FailureInjectionTransport is an http.RoundTripper failing a fraction of requests instead of sending them, to check
+// how retries, backpressure and alerting cope with an unreliable AppOptics. It is chaos testing tooling and must never
+// be used in production.
+type FailureInjectionTransport struct {
+	rate     float64
+	failures []InjectedFailure
+	next     http.RoundTripper
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewFailureInjectionTransport returns a FailureInjectionTransport failing the fraction rate of requests with one of
+// failures chosen at random, and sending the others through next
+func NewFailureInjectionTransport(rate float64, failures []InjectedFailure, next http.RoundTripper) *FailureInjectionTransport {
+	return &FailureInjectionTransport{
+		rate:     rate,
+		failures: failures,
+		next:     next,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (ft *FailureInjectionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ft.mu.Lock()
+	fail := len(ft.failures) > 0 && ft.rand.Float64() < ft.rate
+	var failure InjectedFailure
+	if fail {
+		failure = ft.failures[ft.rand.Intn(len(ft.failures))]
+	}
+	ft.mu.Unlock()
+
+	if !fail {
+		return ft.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if failure == InjectTransportError {
+		return nil, ErrInjectedFailure
+	}
+	code := int(failure)
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"errors":{"request":["injected failure"]}}`)),
+		Request:    req,
+	}, nil
+}
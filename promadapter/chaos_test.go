@@ -0,0 +1,53 @@
+package promadapter
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFailureInjectionTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	failures, err := ParseInjectedFailures("503, 429,error")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	ft := NewFailureInjectionTransport(0.2, failures, http.DefaultTransport)
+	ft.rand = rand.New(rand.NewSource(1))
+	client := &http.Client{Transport: ft}
+
+	const requests = 5000
+	outcomes := make(map[int]int)
+	for i := 0; i < requests; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			outcomes[0]++
+			continue
+		}
+		resp.Body.Close()
+		outcomes[resp.StatusCode]++
+	}
+
+	failed := requests - outcomes[http.StatusAccepted]
+	if failed < 900 || failed > 1100 {
+		t.Errorf("expected about 20%% of %d requests to fail but got %d", requests, failed)
+	}
+	for _, code := range []int{0, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		if outcomes[code] < 250 {
+			t.Errorf("expected about a third of the failures to be %d but got %d", code, outcomes[code])
+		}
+	}
+
+	t.Run("unknown failures are rejected", func(t *testing.T) {
+		for _, invalid := range []string{"", "timeout", "42"} {
+			if _, err := ParseInjectedFailures(invalid); err == nil {
+				t.Errorf("expected an error for %q", invalid)
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package promadapter
+
+import (
+	"math"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Reasons a MeasurementValidator drops Measurements for, besides DropReasonNaN and DropReasonInf
+const (
+	DropReasonInvalidName = "invalid_name"
+	DropReasonInvalidTags = "invalid_tags"
+	DropReasonStale       = "stale"
+	DropReasonTooLarge    = "too_large"
+)
+
+// Limits AppOptics enforces on the names and tags of Measurements
+const (
+	MaxNameLength     = 255
+	MaxTagKeyLength   = 64
+	MaxTagValueLength = 255
+	MaxTags           = 50
+)
+
+// MeasurementCheck inspects a Measurement and returns the reason to drop it, or "" to accept it
+type MeasurementCheck func(m appoptics.Measurement) string
+
+// CheckName rejects Measurements whose name AppOptics would refuse
+func CheckName(m appoptics.Measurement) string {
+	if !validIdentifier(m.Name, MaxNameLength, false) {
+		return DropReasonInvalidName
+	}
+	return ""
+}
+
+// CheckTags rejects Measurements with more tags than AppOptics accepts, or with a tag key or value it would refuse
+func CheckTags(m appoptics.Measurement) string {
+	if len(m.Tags) > MaxTags {
+		return DropReasonInvalidTags
+	}
+	for k, v := range m.Tags {
+		if !validIdentifier(k, MaxTagKeyLength, false) || !validIdentifier(v, MaxTagValueLength, true) {
+			return DropReasonInvalidTags
+		}
+	}
+	return ""
+}
+
+// CheckFinite rejects Measurements with a NaN or infinite value, which cannot be encoded as JSON
+func CheckFinite(m appoptics.Measurement) string {
+	v, ok := m.Value.(float64)
+	switch {
+	case !ok:
+		return ""
+	case math.IsNaN(v):
+		return DropReasonNaN
+	case math.IsInf(v, 0):
+		return DropReasonInf
+	}
+	return ""
+}
+
+// CheckFreshness returns a MeasurementCheck rejecting Measurements timestamped more than maxAge before now
+func CheckFreshness(maxAge time.Duration, now func() time.Time) MeasurementCheck {
+	return func(m appoptics.Measurement) string {
+		if m.Time != 0 && now().Add(-maxAge).Unix() > m.Time {
+			return DropReasonStale
+		}
+		return ""
+	}
+}
+
+// CheckSize returns a MeasurementCheck rejecting Measurements whose JSON encoding is estimated to exceed maxBytes
+func CheckSize(maxBytes int) MeasurementCheck {
+	return func(m appoptics.Measurement) string {
+		if encodedSizeEstimate(m) > maxBytes {
+			return DropReasonTooLarge
+		}
+		return ""
+	}
+}
+
+// encodedSizeEstimate approximates the size of a Measurement's JSON encoding without encoding it, counting its
+// strings, the quoting around them and enough for the value and time
+func encodedSizeEstimate(m appoptics.Measurement) int {
+	size := 64 + len(m.Name)
+	for k, v := range m.Tags {
+		size += 6 + len(k) + len(v)
+	}
+	return size
+}
+
+// validIdentifier returns whether s is a non-empty name, tag key or tag value of at most max characters, made up of
+// letters, digits and -.:_ or, for tag values, also /\? and spaces
+func validIdentifier(s string, max int, value bool) bool {
+	if s == "" || len(s) > max {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == ':', c == '_':
+		case value && (c == '/' || c == '\\' || c == '?' || c == ' '):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// MeasurementValidator is a Stage dropping Measurements any of its MeasurementChecks reject. Every Measurement is run
+// through all the checks in turn before moving on to the next, so a large batch is iterated over once however many
+// checks there are.
+type MeasurementValidator struct {
+	checks []MeasurementCheck
+	stats  *Stats
+}
+
+// NewMeasurementValidator returns a MeasurementValidator applying checks in order and recording drops in stats
+func NewMeasurementValidator(stats *Stats, checks ...MeasurementCheck) *MeasurementValidator {
+	return &MeasurementValidator{checks: checks, stats: stats}
+}
+
+// Verdict returns the reason the first check rejecting m gives, or "" if every check accepts it
+func (mv *MeasurementValidator) Verdict(m appoptics.Measurement) string {
+	for _, check := range mv.checks {
+		if reason := check(m); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// Process implements Stage
+func (mv *MeasurementValidator) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	var dropped map[string]int
+	kept := measurements[:0]
+	for _, m := range measurements {
+		reason := mv.Verdict(m)
+		if reason == "" {
+			kept = append(kept, m)
+			continue
+		}
+		if dropped == nil {
+			dropped = make(map[string]int)
+		}
+		dropped[reason]++
+	}
+	for reason, n := range dropped {
+		mv.stats.AddDropped(reason, n)
+	}
+	return kept
+}
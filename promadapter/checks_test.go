@@ -0,0 +1,119 @@
+package promadapter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// checksFixture returns the checks a MeasurementValidator is tested with, as of timestampFixture
+func checksFixture() []MeasurementCheck {
+	now := func() time.Time { return time.Unix(timestampFixture, 0) }
+	return []MeasurementCheck{CheckName, CheckTags, CheckFinite, CheckFreshness(time.Hour, now), CheckSize(512)}
+}
+
+// multiPassVerdicts runs the measurements through each check in a separate pass, as individual stages would, and
+// returns the reason each measurement was dropped for
+func multiPassVerdicts(checks []MeasurementCheck, measurements []appoptics.Measurement) []string {
+	verdicts := make([]string, len(measurements))
+	for _, check := range checks {
+		for i, m := range measurements {
+			if verdicts[i] == "" {
+				verdicts[i] = check(m)
+			}
+		}
+	}
+	return verdicts
+}
+
+func TestMeasurementValidator(t *testing.T) {
+	manyTags := make(map[string]string)
+	for i := 0; i <= MaxTags; i++ {
+		manyTags[fmt.Sprintf("tag%d", i)] = "value"
+	}
+	measurements := []appoptics.Measurement{
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture, Tags: map[string]string{"path": "/api/v1?x"}},
+		{Name: "", Value: valueFixture, Time: timestampFixture},
+		{Name: "bad name!", Value: valueFixture, Time: timestampFixture},
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture, Tags: map[string]string{"bad key": "value"}},
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture, Tags: map[string]string{"empty": ""}},
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture, Tags: manyTags},
+		{Name: metricNameFixture, Value: math.NaN(), Time: timestampFixture},
+		{Name: metricNameFixture, Value: math.Inf(-1), Time: timestampFixture},
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture - 7200},
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture, Tags: map[string]string{"long": strings.Repeat("x", 250), "longer": strings.Repeat("y", 250)}},
+		{Name: "bad name!", Value: math.NaN(), Time: timestampFixture - 7200},
+	}
+	expected := []string{"", DropReasonInvalidName, DropReasonInvalidName, DropReasonInvalidTags, DropReasonInvalidTags,
+		DropReasonInvalidTags, DropReasonNaN, DropReasonInf, DropReasonStale, DropReasonTooLarge, DropReasonInvalidName}
+
+	checks := checksFixture()
+	mv := NewMeasurementValidator(NewStats(), checks...)
+
+	t.Run("verdicts match the individual checks", func(t *testing.T) {
+		composed := multiPassVerdicts(checks, measurements)
+		for i, m := range measurements {
+			verdict := mv.Verdict(m)
+			if verdict != composed[i] {
+				t.Errorf("expected measurement %d to get verdict %q from the individual checks but got %q", i, composed[i], verdict)
+			}
+			if verdict != expected[i] {
+				t.Errorf("expected measurement %d to get verdict %q but got %q", i, expected[i], verdict)
+			}
+		}
+	})
+
+	t.Run("rejected measurements are dropped and counted", func(t *testing.T) {
+		stats := NewStats()
+		input := append([]appoptics.Measurement(nil), measurements...)
+		kept := NewMeasurementValidator(stats, checks...).Process(input)
+		if len(kept) != 1 || kept[0].Tags["path"] != "/api/v1?x" {
+			t.Errorf("expected only the valid measurement to be kept but got %+v", kept)
+		}
+		dropped := stats.Dropped()
+		if dropped[DropReasonInvalidName] != 3 || dropped[DropReasonInvalidTags] != 3 || dropped[DropReasonStale] != 1 {
+			t.Errorf("expected the drops to be counted by reason but got %v", dropped)
+		}
+	})
+}
+
+// benchmarkBatch returns a batch of n measurements, a tenth of which are rejected by one of the fixture checks
+func benchmarkBatch(n int) []appoptics.Measurement {
+	batch := make([]appoptics.Measurement, n)
+	for i := range batch {
+		batch[i] = appoptics.Measurement{
+			Name:  metricNameFixture,
+			Value: float64(i),
+			Time:  timestampFixture,
+			Tags:  map[string]string{"instance": fmt.Sprintf("host-%d:9100", i%100), "job": "node", "region": "us-east-1"},
+		}
+		if i%10 == 0 {
+			batch[i].Time -= 7200
+		}
+	}
+	return batch
+}
+
+func BenchmarkMeasurementValidator(b *testing.B) {
+	checks := checksFixture()
+	batch := benchmarkBatch(10000)
+
+	b.Run("single pass", func(b *testing.B) {
+		mv := NewMeasurementValidator(NewStats(), checks...)
+		for i := 0; i < b.N; i++ {
+			for _, m := range batch {
+				mv.Verdict(m)
+			}
+		}
+	})
+
+	b.Run("multi pass", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			multiPassVerdicts(checks, batch)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package promadapter
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "prometheus2appoptics"
+
+// Collector exposes the adapter's own Stats as Prometheus metrics so they can be scraped alongside everything else
+type Collector struct {
+	stats      *Stats
+	queueDepth func() int
+
+	submittedDesc   *prometheus.Desc
+	droppedDesc     *prometheus.Desc
+	rateLimitedDesc *prometheus.Desc
+	byPriorityDesc  *prometheus.Desc
+	reloadsDesc     *prometheus.Desc
+	conversionDesc  *prometheus.Desc
+	cardinalityDesc *prometheus.Desc
+	stageTimeDesc   *prometheus.Desc
+	retriesDesc     *prometheus.Desc
+	intervalDesc    *prometheus.Desc
+	silencedDesc    *prometheus.Desc
+	errDropsDesc    *prometheus.Desc
+	trimmedDesc     *prometheus.Desc
+	transformDesc   *prometheus.Desc
+	collisionDesc   *prometheus.Desc
+	nameClashDesc   *prometheus.Desc
+	evictionsDesc   *prometheus.Desc
+	cacheSizeDesc   *prometheus.Desc
+	lagDesc         *prometheus.Desc
+	lastOKDesc      *prometheus.Desc
+	maxLagDesc      *prometheus.Desc
+	throttleDesc    *prometheus.Desc
+	degradedDesc    *prometheus.Desc
+	fpCacheDesc     *prometheus.Desc
+	outcomeDesc     *prometheus.Desc
+	queueDepthDesc  *prometheus.Desc
+}
+
+// NewCollector returns a Collector reporting stats. queueDepth is called on every scrape to report how many
+// Measurement collections are waiting to be batched.
+func NewCollector(stats *Stats, queueDepth func() int) *Collector {
+	return &Collector{
+		stats:      stats,
+		queueDepth: queueDepth,
+		submittedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "measurements_submitted_total"),
+			"Number of measurements accepted by AppOptics.",
+			nil, nil,
+		),
+		droppedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "measurements_dropped_total"),
+			"Number of measurements discarded before reaching AppOptics.",
+			[]string{"reason"}, nil,
+		),
+		rateLimitedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "series_rate_limited_total"),
+			"Number of measurements dropped because their series exceeded the per-series rate limit.",
+			[]string{"metric"}, nil,
+		),
+		byPriorityDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "backpressure_dropped_total"),
+			"Number of measurements dropped from the full buffer, by metric priority.",
+			[]string{"priority"}, nil,
+		),
+		reloadsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "config_reloads_total"),
+			"Number of attempts to reload the configuration file, by outcome.",
+			[]string{"status"}, nil,
+		),
+		conversionDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "value_transforms_total"),
+			"Number of measurement values converted, by transform.",
+			[]string{"transform"}, nil,
+		),
+		cardinalityDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "series_cardinality_estimate"),
+			"Estimated number of distinct tag sets seen for a metric.",
+			[]string{"metric"}, nil,
+		),
+		stageTimeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "stage_duration_seconds"),
+			"Time spent in each pipeline stage, recorded when stage timing is enabled.",
+			[]string{"stage"}, nil,
+		),
+		intervalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "throttled_per_interval_total"),
+			"Number of measurements dropped for arriving within the minimum submission interval of their series.",
+			nil, nil,
+		),
+		silencedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "log_lines_suppressed_total"),
+			"Number of repeated log lines not logged by log sampling.",
+			nil, nil,
+		),
+		errDropsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "dropped_errors_total"),
+			"Number of failed flushes not reported on the error channel because it was full.",
+			nil, nil,
+		),
+		retriesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "retries_total"),
+			"Number of times a batch was resent to AppOptics.",
+			nil, nil,
+		),
+		trimmedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "measurements_trimmed_total"),
+			"Number of measurements whose precision or tags were trimmed to fit the payload budget.",
+			nil, nil,
+		),
+		transformDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "transform_errors_total"),
+			"Number of measurements left untransformed because the name or tags template failed.",
+			nil, nil,
+		),
+		nameClashDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "name_collisions_total"),
+			"Number of measurements that kept their metric name because translating it would merge it with another metric.",
+			nil, nil,
+		),
+		collisionDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "tag_collisions_total"),
+			"Number of injected tags whose key a measurement already had.",
+			nil, nil,
+		),
+		evictionsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "aggregation_cache_evictions_total"),
+			"Number of series evicted from the full aggregation cache and sent early.",
+			nil, nil,
+		),
+		cacheSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "aggregation_cache_size"),
+			"Number of series whose values are being aggregated.",
+			nil, nil,
+		),
+		lagDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "submission_lag_seconds"),
+			"Age of the oldest measurement in the most recently submitted batch.",
+			nil, nil,
+		),
+		lastOKDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "last_success_timestamp_seconds"),
+			"Unix time of the most recent successful submission, 0 if there has been none.",
+			nil, nil,
+		),
+		maxLagDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "max_submission_latency_seconds"),
+			"Longest time between a measurement's timestamp and its acceptance by AppOptics.",
+			nil, nil,
+		),
+		throttleDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "throttle_factor"),
+			"Fraction of measurements currently forwarded, lowered as the queue fills up.",
+			nil, nil,
+		),
+		degradedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "degraded_mode_active"),
+			"1 while submissions are slowed down because of a high AppOptics error rate, 0 otherwise.",
+			nil, nil,
+		),
+		fpCacheDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "fingerprint_cache_hit_ratio"),
+			"Fraction of series keys the deduplicator found in its fingerprint cache.",
+			nil, nil,
+		),
+		outcomeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "submissions_total"),
+			"Number of batches sent to AppOptics, by final outcome after retries and class of the response status.",
+			[]string{"outcome", "status_class"}, nil,
+		),
+		queueDepthDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "queue_depth"),
+			"Number of measurement collections waiting to be batched.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.submittedDesc
+	ch <- c.droppedDesc
+	ch <- c.rateLimitedDesc
+	ch <- c.byPriorityDesc
+	ch <- c.reloadsDesc
+	ch <- c.conversionDesc
+	ch <- c.cardinalityDesc
+	ch <- c.stageTimeDesc
+	ch <- c.retriesDesc
+	ch <- c.intervalDesc
+	ch <- c.silencedDesc
+	ch <- c.errDropsDesc
+	ch <- c.trimmedDesc
+	ch <- c.transformDesc
+	ch <- c.collisionDesc
+	ch <- c.nameClashDesc
+	ch <- c.evictionsDesc
+	ch <- c.cacheSizeDesc
+	ch <- c.lagDesc
+	ch <- c.lastOKDesc
+	ch <- c.maxLagDesc
+	ch <- c.throttleDesc
+	ch <- c.degradedDesc
+	ch <- c.fpCacheDesc
+	ch <- c.outcomeDesc
+	ch <- c.queueDepthDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.submittedDesc, prometheus.CounterValue, float64(c.stats.Submitted()))
+	for reason, n := range c.stats.Dropped() {
+		ch <- prometheus.MustNewConstMetric(c.droppedDesc, prometheus.CounterValue, float64(n), reason)
+	}
+	for metric, n := range c.stats.RateLimited() {
+		ch <- prometheus.MustNewConstMetric(c.rateLimitedDesc, prometheus.CounterValue, float64(n), metric)
+	}
+	for priority, n := range c.stats.DroppedByPriority() {
+		ch <- prometheus.MustNewConstMetric(c.byPriorityDesc, prometheus.CounterValue, float64(n), priority)
+	}
+	for status, n := range c.stats.ConfigReloads() {
+		ch <- prometheus.MustNewConstMetric(c.reloadsDesc, prometheus.CounterValue, float64(n), status)
+	}
+	for transform, n := range c.stats.ValueTransforms() {
+		ch <- prometheus.MustNewConstMetric(c.conversionDesc, prometheus.CounterValue, float64(n), transform)
+	}
+	for outcome, n := range c.stats.SubmissionOutcomes() {
+		ch <- prometheus.MustNewConstMetric(c.outcomeDesc, prometheus.CounterValue, float64(n), outcome.Outcome, outcome.StatusClass)
+	}
+	for metric, n := range c.stats.Cardinality() {
+		ch <- prometheus.MustNewConstMetric(c.cardinalityDesc, prometheus.GaugeValue, float64(n), metric)
+	}
+	for stage, st := range c.stats.StageTimings() {
+		ch <- prometheus.MustNewConstSummary(c.stageTimeDesc, st.Count, st.Total.Seconds(), nil, stage)
+	}
+	ch <- prometheus.MustNewConstMetric(c.retriesDesc, prometheus.CounterValue, float64(c.stats.Retries()))
+	ch <- prometheus.MustNewConstMetric(c.intervalDesc, prometheus.CounterValue, float64(c.stats.IntervalLimited()))
+	ch <- prometheus.MustNewConstMetric(c.silencedDesc, prometheus.CounterValue, float64(c.stats.LogsSuppressed()))
+	ch <- prometheus.MustNewConstMetric(c.errDropsDesc, prometheus.CounterValue, float64(c.stats.DroppedErrors()))
+	ch <- prometheus.MustNewConstMetric(c.trimmedDesc, prometheus.CounterValue, float64(c.stats.Trimmed()))
+	ch <- prometheus.MustNewConstMetric(c.transformDesc, prometheus.CounterValue, float64(c.stats.TransformErrors()))
+	ch <- prometheus.MustNewConstMetric(c.collisionDesc, prometheus.CounterValue, float64(c.stats.TagCollisions()))
+	ch <- prometheus.MustNewConstMetric(c.nameClashDesc, prometheus.CounterValue, float64(c.stats.NameCollisions()))
+	ch <- prometheus.MustNewConstMetric(c.evictionsDesc, prometheus.CounterValue, float64(c.stats.CacheEvictions()))
+	ch <- prometheus.MustNewConstMetric(c.cacheSizeDesc, prometheus.GaugeValue, float64(c.stats.CacheSize()))
+	ch <- prometheus.MustNewConstMetric(c.lagDesc, prometheus.GaugeValue, c.stats.Lag().Seconds())
+	lastSuccess := 0.0
+	if last := c.stats.LastSuccess(); !last.IsZero() {
+		lastSuccess = float64(last.UnixNano()) / float64(time.Second)
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastOKDesc, prometheus.GaugeValue, lastSuccess)
+	ch <- prometheus.MustNewConstMetric(c.maxLagDesc, prometheus.GaugeValue, c.stats.MaxLag().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.throttleDesc, prometheus.GaugeValue, c.stats.ThrottleFactor())
+	degraded := 0.0
+	if c.stats.Degraded() {
+		degraded = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.degradedDesc, prometheus.GaugeValue, degraded)
+	ch <- prometheus.MustNewConstMetric(c.fpCacheDesc, prometheus.GaugeValue, c.stats.FingerprintCacheHitRatio())
+	ch <- prometheus.MustNewConstMetric(c.queueDepthDesc, prometheus.GaugeValue, float64(c.queueDepth()))
+}
@@ -0,0 +1,58 @@
+package promadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	stats := NewStats()
+	stats.AddSubmitted(10)
+	stats.AddRetries(2)
+	stats.AddDropped(DropReasonNaN, 3)
+	stats.SetLag(2500 * time.Millisecond)
+	stats.SetLag(1500 * time.Millisecond)
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewCollector(stats, func() int { return 4 })); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				values[mf.GetName()] += m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[mf.GetName()] += m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"prometheus2appoptics_measurements_submitted_total":   10,
+		"prometheus2appoptics_measurements_dropped_total":     3,
+		"prometheus2appoptics_retries_total":                  2,
+		"prometheus2appoptics_submission_lag_seconds":         1.5,
+		"prometheus2appoptics_max_submission_latency_seconds": 2.5,
+		"prometheus2appoptics_queue_depth":                    4,
+	}
+	for name, value := range expected {
+		got, ok := values[name]
+		if !ok {
+			t.Errorf("expected metric family %s to be exposed", name)
+			continue
+		}
+		if got != value {
+			t.Errorf("expected %s to be %f but got %f", name, value, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package promadapter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// CommonTagsMode decides how a CommonTagsCommunicator moves the tags shared by a batch to the batch itself
+type CommonTagsMode int
+
+const (
+	// CommonTagsOff sends every Measurement with all its tags
+	CommonTagsOff CommonTagsMode = iota
+	// CommonTagsIdentical sends the tags once for the batch, but only when every Measurement has the same tags. It suits
+	// the AppOptics measurements API, where Measurements with tags of their own ignore the batch tags.
+	CommonTagsIdentical
+	// CommonTagsMerge sends the tags all Measurements share once for the batch and only the remaining tags with each
+	// Measurement, for APIs that merge batch tags into the tags of each Measurement
+	CommonTagsMerge
+)
+
+// ParseCommonTagsMode converts "off", "identical" or "merge" into a CommonTagsMode
+func ParseCommonTagsMode(s string) (CommonTagsMode, error) {
+	switch s {
+	case "off":
+		return CommonTagsOff, nil
+	case "identical":
+		return CommonTagsIdentical, nil
+	case "merge":
+		return CommonTagsMerge, nil
+	}
+	return CommonTagsOff, fmt.Errorf("unknown common tags mode %q", s)
+}
+
+// CommonTagsCommunicator wraps a MeasurementsCommunicator, factoring the tags shared by the Measurements of a batch out
+// into the batch's own tags so they are sent once rather than with every Measurement
+type CommonTagsCommunicator struct {
+	mc   appoptics.MeasurementsCommunicator
+	mode CommonTagsMode
+}
+
+// NewCommonTagsCommunicator returns a CommonTagsCommunicator sending through mc
+func NewCommonTagsCommunicator(mc appoptics.MeasurementsCommunicator, mode CommonTagsMode) *CommonTagsCommunicator {
+	return &CommonTagsCommunicator{mc: mc, mode: mode}
+}
+
+// Create sends the batch with its common tags factored out. Batches that already carry tags of their own, or whose
+// Measurements share none, are sent as they are. The batch itself is not modified so that it can be resent.
+func (cc *CommonTagsCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	if cc.mode == CommonTagsOff || batch.Tags != nil || len(batch.Measurements) < 2 {
+		return cc.mc.Create(batch)
+	}
+	common := commonTags(batch.Measurements)
+	if len(common) == 0 {
+		return cc.mc.Create(batch)
+	}
+	if cc.mode == CommonTagsIdentical {
+		for _, m := range batch.Measurements {
+			if len(m.Tags) != len(common) {
+				return cc.mc.Create(batch)
+			}
+		}
+	}
+
+	factored := *batch
+	factored.Tags = &common
+	factored.Measurements = make([]appoptics.Measurement, len(batch.Measurements))
+	for i, m := range batch.Measurements {
+		var rest map[string]string
+		for k, v := range m.Tags {
+			if _, ok := common[k]; !ok {
+				if rest == nil {
+					rest = make(map[string]string, len(m.Tags)-len(common))
+				}
+				rest[k] = v
+			}
+		}
+		m.Tags = rest
+		factored.Measurements[i] = m
+	}
+	return cc.mc.Create(&factored)
+}
+
+// commonTags returns the tags every Measurement has with the same value
+func commonTags(measurements []appoptics.Measurement) map[string]string {
+	common := make(map[string]string, len(measurements[0].Tags))
+	for k, v := range measurements[0].Tags {
+		common[k] = v
+	}
+	for _, m := range measurements[1:] {
+		for k, v := range common {
+			if mv, ok := m.Tags[k]; !ok || mv != v {
+				delete(common, k)
+			}
+		}
+		if len(common) == 0 {
+			break
+		}
+	}
+	return common
+}
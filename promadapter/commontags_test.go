@@ -0,0 +1,63 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestCommonTagsCommunicator(t *testing.T) {
+	batch := func() *appoptics.MeasurementsBatch {
+		return &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+			{Name: metricNameFixture, Value: 1.0, Tags: map[string]string{"job": "node", "region": "us-east-1", "instance": "a:9100"}},
+			{Name: metricNameFixture, Value: 2.0, Tags: map[string]string{"job": "node", "region": "us-east-1", "instance": "b:9100"}},
+			{Name: "up", Value: 1.0, Tags: map[string]string{"job": "node", "region": "us-east-1"}},
+		}}
+	}
+
+	t.Run("shared tags are factored out of the payload", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		original := batch()
+		if _, err := NewCommonTagsCommunicator(stub, CommonTagsMerge).Create(original); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		sent := stub.batches[0]
+		if sent.Tags == nil || len(*sent.Tags) != 2 || (*sent.Tags)["job"] != "node" || (*sent.Tags)["region"] != "us-east-1" {
+			t.Fatalf("expected job and region to be sent once for the batch but got %v", sent.Tags)
+		}
+		if tags := sent.Measurements[0].Tags; len(tags) != 1 || tags["instance"] != "a:9100" {
+			t.Errorf("expected only the instance tag to be left but got %v", tags)
+		}
+		if tags := sent.Measurements[2].Tags; tags != nil {
+			t.Errorf("expected no tags to be left but got %v", tags)
+		}
+
+		payload, _ := json.Marshal(sent)
+		if n := strings.Count(string(payload), "us-east-1"); n != 1 {
+			t.Errorf("expected the shared tag once in the payload but found it %d times: %s", n, payload)
+		}
+		if len(original.Measurements[0].Tags) != 3 || original.Tags != nil {
+			t.Error("expected the original batch to be left unchanged")
+		}
+	})
+
+	t.Run("differing tags are kept per measurement when batch tags replace them", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		NewCommonTagsCommunicator(stub, CommonTagsIdentical).Create(batch())
+		if sent := stub.batches[0]; sent.Tags != nil || len(sent.Measurements[0].Tags) != 3 {
+			t.Errorf("expected the batch to be sent unchanged but got %v and %v", sent.Tags, sent.Measurements[0].Tags)
+		}
+
+		identical := batch()
+		identical.Measurements = identical.Measurements[2:]
+		identical.Measurements = append(identical.Measurements, identical.Measurements[0])
+		NewCommonTagsCommunicator(stub, CommonTagsIdentical).Create(identical)
+		if sent := stub.batches[1]; sent.Tags == nil || sent.Measurements[0].Tags != nil || sent.Measurements[1].Tags != nil {
+			t.Errorf("expected identical tags to be sent once for the batch but got %v and %v", sent.Tags, sent.Measurements)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package promadapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DropReasonUnchanged is recorded for Measurements an OnChangeCompactor suppresses because their value did not change
+const DropReasonUnchanged = "unchanged"
+
+// lastSent is the value and time of the last Measurement an OnChangeCompactor let through for a series
+type lastSent struct {
+	value interface{}
+	time  int64
+}
+
+// OnChangeCompactor is a Stage that only lets a gauge Measurement through when its value differs from the last one
+// let through for its series, or when heartbeat has passed since then, so gauges that rarely change still get a
+// periodic point without costing one every scrape. Measurements without a single Value are always let through.
+type OnChangeCompactor struct {
+	heartbeat time.Duration
+	stats     *Stats
+	now       func() time.Time
+
+	mu   sync.Mutex
+	last *lru
+}
+
+// NewOnChangeCompactor returns an OnChangeCompactor sending unchanged values at least every heartbeat, tracking at
+// most maxSeries series before forgetting the least recently seen ones
+func NewOnChangeCompactor(heartbeat time.Duration, maxSeries int, stats *Stats) *OnChangeCompactor {
+	return &OnChangeCompactor{heartbeat: heartbeat, stats: stats, now: time.Now, last: newLRU(maxSeries, nil)}
+}
+
+// Process implements Stage. The heartbeat is measured between Measurement timestamps, falling back to the current
+// time for Measurements without one.
+func (oc *OnChangeCompactor) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	heartbeat := int64(oc.heartbeat / time.Second)
+	changed := measurements[:0]
+	var suppressed int
+	for _, m := range measurements {
+		if m.Value == nil {
+			changed = append(changed, m)
+			continue
+		}
+		t := m.Time
+		if t <= 0 {
+			t = oc.now().Unix()
+		}
+
+		key := seriesKey(m)
+		if l, ok := oc.last.Get(key); ok {
+			last := l.(lastSent)
+			if last.value == m.Value && t-last.time < heartbeat {
+				suppressed++
+				continue
+			}
+		}
+		oc.last.Add(key, lastSent{value: m.Value, time: t})
+		changed = append(changed, m)
+	}
+	oc.stats.AddDropped(DropReasonUnchanged, suppressed)
+	return changed
+}
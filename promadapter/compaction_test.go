@@ -0,0 +1,51 @@
+package promadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestOnChangeCompactor(t *testing.T) {
+	stats := NewStats()
+	oc := NewOnChangeCompactor(time.Minute, DefaultMaxTrackedSeries, stats)
+	gauge := func(value float64, offset int64) []appoptics.Measurement {
+		return []appoptics.Measurement{{Name: metricNameFixture, Tags: map[string]string{"instance": "a"}, Value: value, Time: timestampFixture + offset}}
+	}
+
+	t.Run("repeated equal values are suppressed until the heartbeat", func(t *testing.T) {
+		expected := []int{1, 0, 0, 0, 1}
+		for i, offset := range []int64{0, 15, 30, 45, 60} {
+			if out := oc.Process(gauge(valueFixture, offset)); len(out) != expected[i] {
+				t.Errorf("expected %d measurements at +%ds but got %d", expected[i], offset, len(out))
+			}
+		}
+		if n := stats.Dropped()[DropReasonUnchanged]; n != 3 {
+			t.Errorf("expected 3 suppressed measurements but got %d", n)
+		}
+	})
+
+	t.Run("changed values are let through", func(t *testing.T) {
+		if out := oc.Process(gauge(valueFixture+1, 75)); len(out) != 1 {
+			t.Errorf("expected the changed value to be let through but got %d measurements", len(out))
+		}
+	})
+
+	t.Run("series are tracked separately", func(t *testing.T) {
+		other := gauge(valueFixture+1, 90)
+		other[0].Tags = map[string]string{"instance": "b"}
+		if out := oc.Process(other); len(out) != 1 {
+			t.Errorf("expected the first value of another series to be let through but got %d measurements", len(out))
+		}
+	})
+
+	t.Run("summaries are let through", func(t *testing.T) {
+		summary := []appoptics.Measurement{{Name: metricNameFixture, Count: 1, Sum: 1.0, Time: timestampFixture}}
+		for i := 0; i < 2; i++ {
+			if out := oc.Process(summary); len(out) != 1 {
+				t.Errorf("expected the summary to be let through but got %d measurements", len(out))
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package promadapter
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewAPITransport returns the http.RoundTripper used for the adapter's own requests. Go only decompresses responses
+// transparently when it added Accept-Encoding itself, so compression is handled explicitly instead: with decompress
+// set gzip is requested and decoded by a DecompressingTransport, without it the transport never asks for compression.
+func NewAPITransport(decompress bool) http.RoundTripper {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableCompression:    true,
+	}
+	if decompress {
+		return NewDecompressingTransport(transport)
+	}
+	return transport
+}
+
+// DecompressingTransport is an http.RoundTripper asking for gzip-compressed responses and decompressing them, whatever
+// the compression settings of the transport it wraps
+type DecompressingTransport struct {
+	next http.RoundTripper
+}
+
+// NewDecompressingTransport returns a DecompressingTransport sending requests through next
+func NewDecompressingTransport(next http.RoundTripper) *DecompressingTransport {
+	return &DecompressingTransport{next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (dt *DecompressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	compressed := new(http.Request)
+	*compressed = *req
+	compressed.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		compressed.Header[k] = v
+	}
+	compressed.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := dt.next.RoundTrip(compressed)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp, err
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &gzipBody{Reader: gz, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody decompresses a response body and closes the underlying body when closed
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (gb *gzipBody) Close() error {
+	gb.Reader.Close()
+	return gb.body.Close()
+}
@@ -0,0 +1,48 @@
+package promadapter
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPITransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte("plain"))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("compressed"))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		decompress     bool
+		acceptEncoding string
+		body           string
+	}{
+		{true, "gzip", "compressed"},
+		{false, "", "plain"},
+	} {
+		client := &http.Client{Transport: NewAPITransport(tc.decompress)}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Accept-Encoding"); got != tc.acceptEncoding {
+			t.Errorf("expected Accept-Encoding %q with decompression %t but got %q", tc.acceptEncoding, tc.decompress, got)
+		}
+		if string(body) != tc.body {
+			t.Errorf("expected body %q but got %q", tc.body, body)
+		}
+	}
+}
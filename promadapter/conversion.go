@@ -3,8 +3,6 @@ package promadapter
 import (
 	"math"
 
-	"time"
-
 	"github.com/prometheus/common/model"
 	promremote "github.com/prometheus/prometheus/storage/remote"
 	"github.com/appoptics/appoptics-api-go"
@@ -19,7 +17,9 @@ func PromDataToAppOpticsMeasurements(req *promremote.WriteRequest) []appoptics.M
 	return SamplesToMeasurements(WriteRequestToSamples(req))
 }
 
-// WriteRequestToSamples converts a Prometheus remote storage WriteRequest to a collection of Prometheus common model Samples
+// WriteRequestToSamples converts a Prometheus remote storage WriteRequest to a collection of Prometheus common model Samples.
+// AppOptics only keeps one measurement per series and second, so of the samples of a series falling into the same second
+// only the last is kept.
 func WriteRequestToSamples(req *promremote.WriteRequest) model.Samples {
 	var samples model.Samples
 	for _, ts := range req.Timeseries {
@@ -28,12 +28,17 @@ func WriteRequestToSamples(req *promremote.WriteRequest) model.Samples {
 			metric[model.LabelName(label.Name)] = model.LabelValue(label.Value)
 		}
 
+		first := len(samples)
 		for _, sample := range ts.Samples {
 			s := &model.Sample{
 				Metric:    metric,
 				Value:     model.SampleValue(sample.Value),
 				Timestamp: model.Time(sample.TimestampMs),
 			}
+			if last := len(samples) - 1; last >= first && sample.TimestampMs != 0 && samples[last].Timestamp.Unix() == s.Timestamp.Unix() {
+				samples[last] = s
+				continue
+			}
 			samples = append(samples, s)
 		}
 	}
@@ -44,16 +49,16 @@ func WriteRequestToSamples(req *promremote.WriteRequest) model.Samples {
 func SamplesToMeasurements(samples model.Samples) []appoptics.Measurement {
 	var measurements []appoptics.Measurement
 	for _, s := range samples {
-		if math.IsNaN(float64(s.Value)) {
+		// NaN is worthless and +/-Inf cannot be encoded as JSON
+		if math.IsNaN(float64(s.Value)) || math.IsInf(float64(s.Value), 0) {
 			continue
 		}
 
-		msTime := time.Duration(s.Timestamp) / time.Microsecond
-
+		// sample timestamps are in milliseconds, measurement times in seconds
 		m := appoptics.Measurement{
 			Name:  string(s.Metric[model.MetricNameLabel]),
 			Value: float64(s.Value),
-			Time:  int64(msTime),
+			Time:  s.Timestamp.Unix(),
 			Tags:  LabelsToTags(s),
 		}
 		measurements = append(measurements, m)
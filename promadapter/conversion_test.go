@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/prometheus/common/model"
+	promremote "github.com/prometheus/prometheus/storage/remote"
 )
 
 var metricNameFixture = "rpc_widget_count"
@@ -47,6 +48,54 @@ func TestSamplesToMeasurements(t *testing.T) {
 	}
 }
 
+func TestSampleTimestamps(t *testing.T) {
+	series := func(name string, timestamps ...int64) *promremote.TimeSeries {
+		ts := &promremote.TimeSeries{Labels: []*promremote.LabelPair{{Name: model.MetricNameLabel, Value: name}}}
+		for i, ms := range timestamps {
+			ts.Samples = append(ts.Samples, &promremote.Sample{Value: float64(i), TimestampMs: ms})
+		}
+		return ts
+	}
+	req := &promremote.WriteRequest{Timeseries: []*promremote.TimeSeries{
+		series("up", 1500000000000, 1500000000999, 1500000001000, 1500000015250),
+		series("node_load1", 1500000000500),
+	}}
+
+	ms := PromDataToAppOpticsMeasurements(req)
+	expected := []struct {
+		name  string
+		time  int64
+		value float64
+	}{
+		// the second sample falls into the same second as the first and replaces it
+		{"up", 1500000000, 1},
+		{"up", 1500000001, 2},
+		{"up", 1500000015, 3},
+		// other series may share a second
+		{"node_load1", 1500000000, 0},
+	}
+	if len(ms) != len(expected) {
+		t.Fatalf("expected %d measurements but got %+v", len(expected), ms)
+	}
+	for i, e := range expected {
+		if ms[i].Name != e.name || ms[i].Time != e.time || ms[i].Value != e.value {
+			t.Errorf("expected %s=%v at %d but got %+v", e.name, e.value, e.time, ms[i])
+		}
+	}
+
+	t.Run("samples without a timestamp fall back to now", func(t *testing.T) {
+		samples := model.Samples{&model.Sample{Metric: model.Metric(labels), Value: model.SampleValue(valueFixture)}}
+		pipeline := NewPipeline(NewStats())
+		if out := pipeline.ProcessSamples(samples); out[0].Time != 0 {
+			t.Errorf("expected no fallback by default but got %d", out[0].Time)
+		}
+		pipeline.SetTimestampFallback(func() time.Time { return time.Unix(timestampFixture, 0) })
+		if out := pipeline.ProcessSamples(samples); out[0].Time != timestampFixture {
+			t.Errorf("expected %d but got %d", timestampFixture, out[0].Time)
+		}
+	})
+}
+
 func TestLabelsToTags(t *testing.T) {
 	sample := promSamples[0]
 	tags := LabelsToTags(sample)
@@ -0,0 +1,205 @@
+package promadapter
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DropReasonDuplicate is recorded for Measurements a Deduplicator suppresses because they were already submitted
+const DropReasonDuplicate = "duplicate"
+
+// fingerprintSet records the fingerprints of Measurements seen since it was last reset
+type fingerprintSet interface {
+	// Add records fp and returns true if it, or with a Bloom filter possibly it, was already recorded
+	Add(fp uint64) bool
+	Reset()
+}
+
+// exactSet is a fingerprintSet remembering every fingerprint, growing with the number of series
+type exactSet map[uint64]struct{}
+
+func (s exactSet) Add(fp uint64) bool {
+	if _, ok := s[fp]; ok {
+		return true
+	}
+	s[fp] = struct{}{}
+	return false
+}
+
+func (s exactSet) Reset() {
+	for fp := range s {
+		delete(s, fp)
+	}
+}
+
+// bloomFilter is a fixed-size fingerprintSet that may wrongly report a fingerprint as already recorded
+type bloomFilter struct {
+	bits   []uint64
+	hashes int
+}
+
+// newBloomFilter returns a bloomFilter sized to hold expectedItems fingerprints with the false positive rate fpRate
+func newBloomFilter(expectedItems int, fpRate float64) *bloomFilter {
+	n := math.Max(1, float64(expectedItems))
+	m := math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Max(1, math.Floor(m/n*math.Ln2+0.5)))
+	return &bloomFilter{bits: make([]uint64, (int(m)+63)/64), hashes: k}
+}
+
+func (b *bloomFilter) Add(fp uint64) bool {
+	present := b.contains(fp)
+	b.each(fp, func(word int, mask uint64) bool {
+		b.bits[word] |= mask
+		return true
+	})
+	return present
+}
+
+// contains returns true if every bit of fp is set
+func (b *bloomFilter) contains(fp uint64) bool {
+	return b.each(fp, func(word int, mask uint64) bool {
+		return b.bits[word]&mask != 0
+	})
+}
+
+// each calls f with the word and mask of every bit of fp until f returns false, and returns false if it did
+func (b *bloomFilter) each(fp uint64, f func(word int, mask uint64) bool) bool {
+	size := uint64(len(b.bits) * 64)
+	h1, h2 := mix64(fp), mix64(fp^0x9e3779b97f4a7c15)|1
+	for i := 0; i < b.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % size
+		if !f(int(bit/64), uint64(1)<<(bit%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) Reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+}
+
+// DeduplicatorOption configures a Deduplicator
+type DeduplicatorOption func(*Deduplicator)
+
+// WithBloomDeduplication replaces the exact record of submitted Measurements, which grows with the number of series,
+// with a Bloom filter of fixed size holding expectedItems Measurements at a false positive rate of fpRate. A false
+// positive suppresses a Measurement that was not in fact submitted.
+func WithBloomDeduplication(expectedItems int, fpRate float64) DeduplicatorOption {
+	return func(d *Deduplicator) {
+		d.seen = newBloomFilter(expectedItems, fpRate)
+		d.approximate = true
+	}
+}
+
+// WithDuplicateLog calls logf for every suppressed Measurement. With a Bloom filter, some of them may be false
+// positives, which cannot be told apart from real duplicates.
+func WithDuplicateLog(logf func(format string, v ...interface{})) DeduplicatorOption {
+	return func(d *Deduplicator) {
+		d.logf = logf
+	}
+}
+
+// WithFingerprintCacheSize caches the series key of up to size tag maps, so that Measurements sharing the very same
+// Tags map as one fingerprinted before skip sorting and joining them. Maps decoded from a fresh remote write are never
+// shared, so it only pays off for Measurements resubmitted from a cache.
+func WithFingerprintCacheSize(size int) DeduplicatorOption {
+	return func(d *Deduplicator) {
+		d.keys = newFingerprintCache(size)
+	}
+}
+
+// Deduplicator is a Stage that suppresses Measurements of a series and timestamp already submitted since it was last
+// reset, e.g. those resent by Prometheus after a timed out remote write or scraped twice by overlapping federation
+type Deduplicator struct {
+	stats       *Stats
+	approximate bool
+	logf        func(format string, v ...interface{})
+
+	mu   sync.Mutex
+	seen fingerprintSet
+	keys *fingerprintCache
+}
+
+// NewDeduplicator returns a Deduplicator remembering every submitted Measurement exactly unless configured otherwise
+func NewDeduplicator(stats *Stats, opts ...DeduplicatorOption) *Deduplicator {
+	d := &Deduplicator{stats: stats, seen: make(exactSet)}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Process implements Stage
+func (d *Deduplicator) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	unique := measurements[:0]
+	var duplicates int
+	for _, m := range measurements {
+		if d.seen.Add(fingerprint(d.seriesKey(m), m.Time)) {
+			duplicates++
+			if d.logf != nil {
+				if d.approximate {
+					d.logf("suppressed %s at %d as a duplicate, possibly a Bloom filter false positive\n", m.Name, m.Time)
+				} else {
+					d.logf("suppressed %s at %d as a duplicate\n", m.Name, m.Time)
+				}
+			}
+			continue
+		}
+		unique = append(unique, m)
+	}
+	d.stats.AddDropped(DropReasonDuplicate, duplicates)
+	if d.keys != nil {
+		d.stats.SetFingerprintCacheHitRatio(d.keys.HitRatio())
+	}
+	return unique
+}
+
+// seriesKey returns the series key of m, from the fingerprint cache if there is one
+func (d *Deduplicator) seriesKey(m appoptics.Measurement) string {
+	if d.keys == nil {
+		return seriesKey(m)
+	}
+	return d.keys.seriesKey(m)
+}
+
+// Reset forgets every Measurement submitted so far
+func (d *Deduplicator) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seen.Reset()
+}
+
+// Run resets the Deduplicator every interval until stop is closed, bounding how long Measurements are remembered and,
+// with a Bloom filter, how full it gets
+func (d *Deduplicator) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Reset()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// fingerprint hashes the series key and timestamp of a Measurement
+func fingerprint(key string, timestamp int64) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	hasher.Write([]byte{0xff})
+	hasher.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	return hasher.Sum64()
+}
@@ -0,0 +1,63 @@
+package promadapter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestDeduplicator(t *testing.T) {
+	batch := func(time int64) []appoptics.Measurement {
+		return []appoptics.Measurement{
+			{Name: metricNameFixture, Tags: map[string]string{"instance": "a"}, Value: valueFixture, Time: time},
+			{Name: metricNameFixture, Tags: map[string]string{"instance": "b"}, Value: valueFixture, Time: time},
+		}
+	}
+
+	for name, opts := range map[string][]DeduplicatorOption{
+		"exact":  nil,
+		"bloom":  {WithBloomDeduplication(1000, 0.01)},
+		"cached": {WithFingerprintCacheSize(10)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stats := NewStats()
+			var logged int
+			d := NewDeduplicator(stats, append(opts, WithDuplicateLog(func(string, ...interface{}) { logged++ }))...)
+
+			if out := d.Process(batch(timestampFixture)); len(out) != 2 {
+				t.Errorf("expected both measurements to be let through but got %d", len(out))
+			}
+			if out := d.Process(batch(timestampFixture)); len(out) != 0 {
+				t.Errorf("expected the resent measurements to be suppressed but got %d", len(out))
+			}
+			if out := d.Process(batch(timestampFixture + 60)); len(out) != 2 {
+				t.Errorf("expected later measurements to be let through but got %d", len(out))
+			}
+			if n := stats.Dropped()[DropReasonDuplicate]; n != 2 || logged != 2 {
+				t.Errorf("expected 2 duplicates to be counted and logged but got %d and %d", n, logged)
+			}
+
+			d.Reset()
+			if out := d.Process(batch(timestampFixture)); len(out) != 2 {
+				t.Errorf("expected measurements to be let through after a reset but got %d", len(out))
+			}
+		})
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	b := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.Add(fingerprint(fmt.Sprintf("metric_%d", i), 0))
+	}
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if b.contains(fingerprint(fmt.Sprintf("other_%d", i), 0)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("expected a false positive rate around 1%% but got %d in 10000", falsePositives)
+	}
+}
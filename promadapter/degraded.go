@@ -0,0 +1,175 @@
+package promadapter
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+const (
+	// degradedWindowSeconds is how far back the error rate deciding degraded mode is measured
+	degradedWindowSeconds = 60
+	// degradedMinRequests is how many submissions the window needs before its error rate is trusted, so that a single
+	// failure after a quiet spell does not trip degraded mode
+	degradedMinRequests = 5
+	// DefaultDegradedModeDelay is the pause between the parts of a batch while in degraded mode
+	DefaultDegradedModeDelay = time.Second
+)
+
+// degradedBucket counts the submissions of one second of the window
+type degradedBucket struct {
+	second   int64
+	requests uint64
+	failures uint64
+}
+
+// DegradedModeCommunicator wraps a MeasurementsCommunicator, tracking the error rate of its submissions over a sliding
+// 60 second window. While the rate is above a threshold it is in degraded mode: batches are sent in smaller parts
+// with a pause between them, easing the load on an API that is already struggling.
+type DegradedModeCommunicator struct {
+	mc        appoptics.MeasurementsCommunicator
+	errorRate float64
+	reduction float64
+	delay     time.Duration
+	now       func() time.Time
+	sleep     func(time.Duration)
+
+	mu      sync.Mutex
+	buckets [degradedWindowSeconds]degradedBucket
+}
+
+// DegradedModeOption configures a DegradedModeCommunicator
+type DegradedModeOption func(*DegradedModeCommunicator)
+
+// WithDegradedModeThreshold enters degraded mode once more than errorRate of the submissions in the window failed,
+// and sends batches in parts of reductionFactor of their size while it lasts
+func WithDegradedModeThreshold(errorRate, reductionFactor float64) DegradedModeOption {
+	return func(dc *DegradedModeCommunicator) {
+		dc.errorRate = errorRate
+		dc.reduction = reductionFactor
+	}
+}
+
+// WithDegradedModeDelay sets the pause between the parts of a batch while in degraded mode
+func WithDegradedModeDelay(delay time.Duration) DegradedModeOption {
+	return func(dc *DegradedModeCommunicator) {
+		dc.delay = delay
+	}
+}
+
+// NewDegradedModeCommunicator returns a DegradedModeCommunicator sending through mc and reporting whether it is in
+// degraded mode through stats. Without WithDegradedModeThreshold it never enters degraded mode.
+func NewDegradedModeCommunicator(mc appoptics.MeasurementsCommunicator, stats *Stats, opts ...DegradedModeOption) *DegradedModeCommunicator {
+	dc := &DegradedModeCommunicator{
+		mc:        mc,
+		errorRate: 1,
+		reduction: 1,
+		delay:     DefaultDegradedModeDelay,
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(dc)
+	}
+	stats.SetDegradedCheck(dc.Degraded)
+	return dc
+}
+
+// Create implements appoptics.MeasurementsCommunicator. In degraded mode the batch is sent in parts, stopping at the
+// first failure; each part keeps the batch's own time, period and tags. If parts were accepted before the failure, the
+// error is a *PartialSubmissionError so that they are neither resent nor counted as failed.
+func (dc *DegradedModeCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	if !dc.Degraded() {
+		resp, err := dc.mc.Create(batch)
+		dc.record(err)
+		return resp, err
+	}
+
+	size := int(math.Ceil(float64(len(batch.Measurements)) * dc.reduction))
+	if size < 1 {
+		size = 1
+	}
+	var resp *http.Response
+	var err error
+	for start := 0; start < len(batch.Measurements); start += size {
+		if start > 0 {
+			dc.sleep(dc.delay)
+		}
+		end := start + size
+		if end > len(batch.Measurements) {
+			end = len(batch.Measurements)
+		}
+		part := *batch
+		part.Measurements = batch.Measurements[start:end]
+		resp, err = dc.mc.Create(&part)
+		dc.record(err)
+		if err != nil {
+			return resp, partialFrom(err, start, end, len(batch.Measurements))
+		}
+	}
+	return resp, err
+}
+
+// partialFrom returns err, which failed the part of a batch of n Measurements from start to end, as the error of the
+// whole batch: a *PartialSubmissionError holding the Measurements of the part that were not accepted and every one
+// after it, or err itself if nothing was accepted
+func partialFrom(err error, start, end, n int) error {
+	var unsent []int
+	if partial, ok := err.(*PartialSubmissionError); ok {
+		for _, idx := range partial.Unsent {
+			unsent = append(unsent, start+idx)
+		}
+		err = partial.Err
+	} else if start == 0 {
+		return err
+	} else {
+		for i := start; i < end; i++ {
+			unsent = append(unsent, i)
+		}
+	}
+	for i := end; i < n; i++ {
+		unsent = append(unsent, i)
+	}
+	return &PartialSubmissionError{Err: err, Unsent: unsent}
+}
+
+// Degraded returns true if the error rate over the window is above the threshold
+func (dc *DegradedModeCommunicator) Degraded() bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.degradedLocked(dc.now().Unix())
+}
+
+// record counts the outcome of a submission in the bucket of the current second
+func (dc *DegradedModeCommunicator) record(err error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	now := dc.now().Unix()
+	b := &dc.buckets[now%degradedWindowSeconds]
+	if b.second != now {
+		*b = degradedBucket{second: now}
+	}
+	b.requests++
+	if err != nil {
+		b.failures++
+	}
+}
+
+// degradedLocked sums the buckets still within the window ending at now. dc.mu must be held.
+func (dc *DegradedModeCommunicator) degradedLocked(now int64) bool {
+	var requests, failures uint64
+	for _, b := range dc.buckets {
+		if now-b.second < degradedWindowSeconds {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	if requests < degradedMinRequests {
+		return false
+	}
+	return float64(failures)/float64(requests) > dc.errorRate
+}
@@ -0,0 +1,114 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestDegradedModeCommunicator(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: benchmarkBatch(10)}
+	now := time.Unix(timestampFixture, 0)
+
+	newCommunicator := func(stub *stubCommunicator, stats *Stats) (*DegradedModeCommunicator, *[]time.Duration) {
+		var sleeps []time.Duration
+		dc := NewDegradedModeCommunicator(stub, stats, WithDegradedModeThreshold(0.5, 0.3), WithDegradedModeDelay(2*time.Second))
+		dc.now = func() time.Time { return now }
+		dc.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+		return dc, &sleeps
+	}
+
+	t.Run("batches are split and delayed once the error rate is exceeded", func(t *testing.T) {
+		stats := NewStats()
+		stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+		dc, sleeps := newCommunicator(stub, stats)
+		for i := 0; i < degradedMinRequests; i++ {
+			dc.Create(batch)
+		}
+		if !dc.Degraded() || !stats.Degraded() {
+			t.Fatal("expected degraded mode after only failures")
+		}
+
+		stub.statusCodes = []int{http.StatusAccepted}
+		stub.batches = nil
+		if _, err := dc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(stub.batches) != 4 || len(stub.batches[0].Measurements) != 3 || len(stub.batches[3].Measurements) != 1 {
+			t.Errorf("expected the batch in parts of 3 but got %d parts", len(stub.batches))
+		}
+		if len(*sleeps) != 3 || (*sleeps)[0] != 2*time.Second {
+			t.Errorf("expected 3 pauses of 2s but got %v", *sleeps)
+		}
+	})
+
+	t.Run("a failed part reports the measurements not sent", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+		dc, _ := newCommunicator(stub, NewStats())
+		for i := 0; i < degradedMinRequests; i++ {
+			dc.Create(batch)
+		}
+
+		// the first part is accepted and the second fails
+		stub.statusCodes = []int{http.StatusAccepted, http.StatusInternalServerError}
+		stub.batches = nil
+		_, err := dc.Create(batch)
+		partial, ok := err.(*PartialSubmissionError)
+		if !ok {
+			t.Fatalf("expected a *PartialSubmissionError but got %v", err)
+		}
+		if len(partial.Unsent) != 7 || partial.Unsent[0] != 3 || partial.Unsent[6] != 9 {
+			t.Errorf("expected measurements 3 to 9 to be unsent but got %v", partial.Unsent)
+		}
+	})
+
+	t.Run("degraded mode ends as failures leave the window", func(t *testing.T) {
+		stats := NewStats()
+		stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+		dc, _ := newCommunicator(stub, stats)
+		for i := 0; i < degradedMinRequests; i++ {
+			dc.Create(batch)
+		}
+
+		defer func(start time.Time) { now = start }(now)
+		now = now.Add(time.Minute)
+		stub.statusCodes = []int{http.StatusAccepted}
+		stub.batches = nil
+		dc.Create(batch)
+		if dc.Degraded() || stats.Degraded() {
+			t.Error("expected degraded mode to end")
+		}
+		if len(stub.batches) != 1 {
+			t.Errorf("expected the batch to be sent whole but got %d parts", len(stub.batches))
+		}
+	})
+
+	t.Run("degraded mode ends without further submissions", func(t *testing.T) {
+		stats := NewStats()
+		stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+		dc, _ := newCommunicator(stub, stats)
+		for i := 0; i < degradedMinRequests; i++ {
+			dc.Create(batch)
+		}
+		if !stats.Degraded() {
+			t.Fatal("expected degraded mode after only failures")
+		}
+
+		defer func(start time.Time) { now = start }(now)
+		now = now.Add(time.Minute)
+		if stats.Degraded() {
+			t.Error("expected degraded mode to end once the failures left the window")
+		}
+	})
+
+	t.Run("a few failures do not trip degraded mode", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}
+		dc, _ := newCommunicator(stub, NewStats())
+		dc.Create(batch)
+		if dc.Degraded() {
+			t.Error("expected a single failure not to be trusted")
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package promadapter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DefaultDogStatsDFlushInterval is how often a DogStatsDReceiver submits what it received
+const DefaultDogStatsDFlushInterval = 10 * time.Second
+
+// dogStatsDMaxPacket is the largest UDP packet a DogStatsDReceiver reads, the largest the Datadog agent accepts
+const dogStatsDMaxPacket = 65535
+
+// DogStatsD metric types
+const (
+	dogStatsDGauge        = "g"
+	dogStatsDCount        = "c"
+	dogStatsDHistogram    = "h"
+	dogStatsDTimer        = "ms"
+	dogStatsDDistribution = "d"
+	dogStatsDSet          = "s"
+)
+
+// dogStatsDMetric is one parsed DogStatsD metric line
+type dogStatsDMetric struct {
+	name   string
+	values []string
+	kind   string
+	rate   float64
+	tags   map[string]string
+}
+
+// parseDogStatsDLine parses a line of the form name:value[:value...]|type[|@rate][|#key:value,...]. Tags without a
+// value are given the value "true", as AppOptics tags must have one.
+func parseDogStatsDLine(line string) (dogStatsDMetric, error) {
+	sections := strings.Split(line, "|")
+	if len(sections) < 2 {
+		return dogStatsDMetric{}, fmt.Errorf("expected name:value|type but got %q", line)
+	}
+	i := strings.Index(sections[0], ":")
+	if i < 1 || i == len(sections[0])-1 {
+		return dogStatsDMetric{}, fmt.Errorf("expected name:value but got %q", sections[0])
+	}
+	m := dogStatsDMetric{
+		name:   sections[0][:i],
+		values: strings.Split(sections[0][i+1:], ":"),
+		kind:   sections[1],
+		rate:   1,
+	}
+	switch m.kind {
+	case dogStatsDGauge, dogStatsDCount, dogStatsDHistogram, dogStatsDTimer, dogStatsDDistribution:
+		for _, v := range m.values {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return dogStatsDMetric{}, fmt.Errorf("invalid value %q of %s", v, m.name)
+			}
+		}
+	case dogStatsDSet:
+		// set members are counted, not parsed
+	default:
+		return dogStatsDMetric{}, fmt.Errorf("unknown metric type %q of %s", m.kind, m.name)
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return dogStatsDMetric{}, fmt.Errorf("invalid sample rate %q of %s", section, m.name)
+			}
+			m.rate = rate
+		case strings.HasPrefix(section, "#"):
+			m.tags = make(map[string]string)
+			for _, tag := range strings.Split(section[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				if j := strings.Index(tag, ":"); j > 0 {
+					m.tags[tag[:j]] = tag[j+1:]
+				} else {
+					m.tags[tag] = "true"
+				}
+			}
+		}
+		// other sections, such as container IDs, are ignored
+	}
+	return m, nil
+}
+
+// dogStatsDSeries is the state of one series accumulated since the last flush
+type dogStatsDSeries struct {
+	name    string
+	tags    map[string]string
+	kind    string
+	value   float64
+	count   float64
+	sum     float64
+	min     float64
+	max     float64
+	members map[string]struct{}
+}
+
+// measurement returns the Measurement of the series: the last value of a gauge, the sum of a count, the number of
+// distinct members of a set and a summary of the values of histograms, timers and distributions
+func (s *dogStatsDSeries) measurement(t int64) appoptics.Measurement {
+	m := appoptics.Measurement{Name: s.name, Tags: s.tags, Time: t}
+	switch s.kind {
+	case dogStatsDGauge, dogStatsDCount:
+		m.Value = s.value
+	case dogStatsDSet:
+		m.Value = float64(len(s.members))
+	default:
+		m.Count, m.Sum, m.Min, m.Max = int(math.Floor(s.count+0.5)), s.sum, s.min, s.max
+	}
+	return m
+}
+
+// DogStatsDReceiver listens for DogStatsD packets on a UDP address, for applications instrumented with a Datadog
+// client, and submits the metrics they carry to AppOptics every flush interval. Counts and the number of values of
+// histograms, timers and distributions are scaled up by their sample rate. Events and service checks are ignored.
+type DogStatsDReceiver struct {
+	addr          string
+	svc           appoptics.MeasurementsCommunicator
+	flushInterval time.Duration
+	pipeline      *Pipeline
+	now           func() time.Time
+
+	mu     sync.Mutex
+	series map[string]*dogStatsDSeries
+
+	conn     net.PacketConn
+	stopOnce sync.Once
+	stopped  chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDogStatsDReceiver returns a DogStatsDReceiver listening on addr, e.g. ":8125", and submitting to svc
+func NewDogStatsDReceiver(addr string, svc appoptics.MeasurementsCommunicator) *DogStatsDReceiver {
+	return &DogStatsDReceiver{
+		addr:          addr,
+		svc:           svc,
+		flushInterval: DefaultDogStatsDFlushInterval,
+		now:           time.Now,
+		series:        make(map[string]*dogStatsDSeries),
+		stopped:       make(chan struct{}),
+	}
+}
+
+// SetFlushInterval sets how often the DogStatsDReceiver submits what it received. It must be called before Start.
+func (dr *DogStatsDReceiver) SetFlushInterval(interval time.Duration) {
+	dr.flushInterval = interval
+}
+
+// SetPipeline runs the Measurements through the Stages of pipeline, such as the metric filter and measurement checks,
+// before they are submitted. It must be called before Start.
+func (dr *DogStatsDReceiver) SetPipeline(pipeline *Pipeline) {
+	dr.pipeline = pipeline
+}
+
+// Start listens on the address and receives packets until Stop is called or ctx is done
+func (dr *DogStatsDReceiver) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", dr.addr)
+	if err != nil {
+		return err
+	}
+	dr.conn = conn
+
+	dr.wg.Add(2)
+	go dr.receive()
+	go dr.flushLoop()
+	go func() {
+		select {
+		case <-ctx.Done():
+			dr.Stop()
+		case <-dr.stopped:
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the DogStatsDReceiver listens on, which tells the port picked for a ":0" address
+func (dr *DogStatsDReceiver) Addr() net.Addr {
+	return dr.conn.LocalAddr()
+}
+
+// Stop closes the listener and submits whatever was received since the last flush
+func (dr *DogStatsDReceiver) Stop() error {
+	var err error
+	dr.stopOnce.Do(func() {
+		close(dr.stopped)
+		if dr.conn != nil {
+			err = dr.conn.Close()
+		}
+		dr.wg.Wait()
+		dr.Flush()
+	})
+	return err
+}
+
+// receive reads packets until the listener is closed
+func (dr *DogStatsDReceiver) receive() {
+	defer dr.wg.Done()
+	buf := make([]byte, dogStatsDMaxPacket)
+	for {
+		n, _, err := dr.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-dr.stopped:
+				return
+			default:
+			}
+			log.Printf("reading DogStatsD packet: %s\n", err)
+			continue
+		}
+		dr.handlePacket(string(buf[:n]))
+	}
+}
+
+// handlePacket adds every metric line of a packet, logging and skipping those that do not parse
+func (dr *DogStatsDReceiver) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+			continue
+		}
+		m, err := parseDogStatsDLine(line)
+		if err != nil {
+			log.Printf("skipping DogStatsD metric: %s\n", err)
+			continue
+		}
+		dr.add(m)
+	}
+}
+
+// add accumulates the values of m in its series
+func (dr *DogStatsDReceiver) add(m dogStatsDMetric) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	key := m.kind + "\xff" + seriesKey(appoptics.Measurement{Name: m.name, Tags: m.tags})
+	s, ok := dr.series[key]
+	if !ok {
+		s = &dogStatsDSeries{name: m.name, tags: m.tags, kind: m.kind}
+		dr.series[key] = s
+	}
+	for _, raw := range m.values {
+		if m.kind == dogStatsDSet {
+			if s.members == nil {
+				s.members = make(map[string]struct{})
+			}
+			s.members[raw] = struct{}{}
+			continue
+		}
+		v, _ := strconv.ParseFloat(raw, 64)
+		switch m.kind {
+		case dogStatsDGauge:
+			s.value = v
+		case dogStatsDCount:
+			s.value += v / m.rate
+		default:
+			if s.count == 0 || v < s.min {
+				s.min = v
+			}
+			if s.count == 0 || v > s.max {
+				s.max = v
+			}
+			s.count += 1 / m.rate
+			s.sum += v / m.rate
+		}
+	}
+}
+
+// flushLoop flushes every flush interval until the receiver is stopped
+func (dr *DogStatsDReceiver) flushLoop() {
+	defer dr.wg.Done()
+	ticker := time.NewTicker(dr.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dr.Flush()
+		case <-dr.stopped:
+			return
+		}
+	}
+}
+
+// Flush submits a Measurement for every series received since the last flush that the pipeline, if any, lets through,
+// in batches of at most appoptics.MeasurementPostMaxBatchSize, and starts accumulating afresh
+func (dr *DogStatsDReceiver) Flush() {
+	dr.mu.Lock()
+	series := dr.series
+	dr.series = make(map[string]*dogStatsDSeries)
+	dr.mu.Unlock()
+	if len(series) == 0 {
+		return
+	}
+
+	t := dr.now().Unix()
+	measurements := make([]appoptics.Measurement, 0, len(series))
+	for _, s := range series {
+		measurements = append(measurements, s.measurement(t))
+	}
+	if dr.pipeline != nil {
+		measurements = dr.pipeline.ProcessMeasurements(measurements)
+	}
+	for start := 0; start < len(measurements); start += appoptics.MeasurementPostMaxBatchSize {
+		end := start + appoptics.MeasurementPostMaxBatchSize
+		if end > len(measurements) {
+			end = len(measurements)
+		}
+		if _, err := dr.svc.Create(&appoptics.MeasurementsBatch{Measurements: measurements[start:end]}); err != nil {
+			LogError("submitting %d DogStatsD measurements: %s\n", end-start, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package promadapter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseDogStatsDLine(t *testing.T) {
+	t.Run("tags and sample rates are parsed", func(t *testing.T) {
+		m, err := parseDogStatsDLine("page.views:1|c|@0.5|#env:prod,canary")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if m.name != "page.views" || m.kind != dogStatsDCount || m.rate != 0.5 || len(m.values) != 1 || m.values[0] != "1" {
+			t.Errorf("expected a count of 1 sampled at 0.5 but got %+v", m)
+		}
+		if m.tags["env"] != "prod" || m.tags["canary"] != "true" {
+			t.Errorf("expected env:prod and canary tags but got %v", m.tags)
+		}
+	})
+
+	t.Run("several values are parsed", func(t *testing.T) {
+		m, err := parseDogStatsDLine("request.latency:12:15:9|ms")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(m.values) != 3 || m.rate != 1 {
+			t.Errorf("expected 3 unsampled values but got %+v", m)
+		}
+	})
+
+	for _, line := range []string{"page.views", "page.views:1", "page.views:one|c", "page.views:1|x", ":1|c", "page.views:1|c|@2"} {
+		if _, err := parseDogStatsDLine(line); err == nil {
+			t.Errorf("expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestDogStatsDReceiverPipeline(t *testing.T) {
+	stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+	stats := NewStats()
+	filter, err := NewMetricFilter(nil, []string{"^debug\\..*"}, stats)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	dr := NewDogStatsDReceiver("127.0.0.1:0", stub)
+	dr.SetPipeline(NewPipeline(stats, filter))
+	dr.handlePacket("debug.allocs:5|c\nrequests:3|c")
+	dr.Flush()
+
+	if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 1 || stub.batches[0].Measurements[0].Name != "requests" {
+		t.Errorf("expected only requests to pass the filter but got %+v", stub.batches)
+	}
+}
+
+func TestDogStatsDReceiver(t *testing.T) {
+	stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+	dr := NewDogStatsDReceiver("127.0.0.1:0", stub)
+	dr.SetFlushInterval(time.Hour)
+	dr.now = func() time.Time { return time.Unix(timestampFixture, 0) }
+	if err := dr.Start(context.Background()); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	conn, err := net.Dial("udp", dr.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer conn.Close()
+	packet := "temperature:20|g|#room:kitchen\ntemperature:21|g|#room:kitchen\n" +
+		"requests:3|c|@0.5\nlatency:10:30|h\nusers:alice|s\nusers:bob|s\nusers:alice|s\n" +
+		"_e{5,4}:title|text\nbroken"
+	conn.Write([]byte(packet))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dr.mu.Lock()
+		received := len(dr.series)
+		dr.mu.Unlock()
+		if received == 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := dr.Stop(); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	if len(stub.batches) != 1 {
+		t.Fatalf("expected the final flush to submit one batch but got %d", len(stub.batches))
+	}
+	byName := make(map[string]int)
+	for i, m := range stub.batches[0].Measurements {
+		byName[m.Name] = i
+		if m.Time != timestampFixture {
+			t.Errorf("expected %s to be timed at the flush but got %d", m.Name, m.Time)
+		}
+	}
+	if len(byName) != 4 {
+		t.Fatalf("expected 4 measurements but got %v", stub.batches[0].Measurements)
+	}
+	ms := stub.batches[0].Measurements
+	if m := ms[byName["temperature"]]; m.Value != 21.0 || m.Tags["room"] != "kitchen" {
+		t.Errorf("expected the last gauge value with its tag but got %+v", m)
+	}
+	if m := ms[byName["requests"]]; m.Value != 6.0 {
+		t.Errorf("expected the count scaled by its sample rate but got %v", m.Value)
+	}
+	if m := ms[byName["latency"]]; m.Count != 2 || m.Sum != 40.0 || m.Min != 10.0 || m.Max != 30.0 {
+		t.Errorf("expected a summary of the histogram but got %+v", m)
+	}
+	if m := ms[byName["users"]]; m.Value != 2.0 {
+		t.Errorf("expected 2 distinct set members but got %v", m.Value)
+	}
+}
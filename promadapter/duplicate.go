@@ -0,0 +1,68 @@
+package promadapter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DuplicatePolicy decides what happens to a batch AppOptics rejects because a Measurement already exists at its
+// timestamp, which is common when a batch that was in fact ingested is resent after a timeout
+type DuplicatePolicy int
+
+const (
+	// DuplicateFail treats the rejection like any other and drops the batch as failed
+	DuplicateFail DuplicatePolicy = iota
+	// DuplicateIgnore treats the batch as already ingested and so as successfully submitted
+	DuplicateIgnore
+)
+
+// ParseDuplicatePolicy converts "fail" or "ignore" into a DuplicatePolicy
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch s {
+	case "fail":
+		return DuplicateFail, nil
+	case "ignore":
+		return DuplicateIgnore, nil
+	}
+	return DuplicateFail, fmt.Errorf("unknown duplicate policy %q", s)
+}
+
+// alreadyExists matches the message AppOptics rejects a Measurement already stored at its timestamp with
+var alreadyExists = regexp.MustCompile(`(?i)already exists`)
+
+// IsAlreadyExists returns true if the submission failed because a Measurement already exists at its timestamp.
+// Errors from the client library are not typed, so their text is checked along with the response status.
+func IsAlreadyExists(resp *http.Response, err error) bool {
+	if partial, ok := err.(*PartialSubmissionError); ok {
+		err = partial.Err
+	}
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.StatusCode == http.StatusBadRequest && alreadyExists.MatchString(apiErr.Message)
+	}
+	return err != nil && resp != nil && resp.StatusCode == http.StatusBadRequest && alreadyExists.MatchString(err.Error())
+}
+
+// DuplicateTolerantCommunicator wraps a MeasurementsCommunicator, treating batches rejected because their
+// Measurements already exist as successfully submitted. AppOptics rejects a batch as a whole, so any Measurements of
+// it that were not duplicates are lost.
+type DuplicateTolerantCommunicator struct {
+	mc appoptics.MeasurementsCommunicator
+}
+
+// NewDuplicateTolerantCommunicator returns a DuplicateTolerantCommunicator sending through mc
+func NewDuplicateTolerantCommunicator(mc appoptics.MeasurementsCommunicator) *DuplicateTolerantCommunicator {
+	return &DuplicateTolerantCommunicator{mc: mc}
+}
+
+// Create implements appoptics.MeasurementsCommunicator
+func (dc *DuplicateTolerantCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	resp, err := dc.mc.Create(batch)
+	if IsAlreadyExists(resp, err) {
+		LogError("treating batch of %d measurements as already ingested: %s\n", len(batch.Measurements), err)
+		return resp, nil
+	}
+	return resp, err
+}
@@ -0,0 +1,62 @@
+package promadapter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestDuplicateTolerantCommunicator(t *testing.T) {
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"errors":{"params":{"time":["measurement already exists at timestamp"]}}}`))
+	}))
+	defer server.Close()
+
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture}}}
+	nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, server.Client())
+
+	t.Run("the batch is successful under the lenient policy", func(t *testing.T) {
+		stats := NewStats()
+		mc := NewInstrumentedCommunicator(NewDuplicateTolerantCommunicator(nc), stats)
+		if _, err := mc.Create(batch); err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+		if stats.Submitted() != 1 || stats.Errors() != 0 {
+			t.Errorf("expected the batch to count as submitted but got %d submitted and %d errors", stats.Submitted(), stats.Errors())
+		}
+	})
+
+	t.Run("the batch fails without it", func(t *testing.T) {
+		_, err := nc.Create(batch)
+		if err == nil {
+			t.Fatal("expected an error for a 400")
+		}
+		if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected an *APIError with status 400 but got %#v", err)
+		}
+	})
+
+	t.Run("other errors still fail", func(t *testing.T) {
+		status = http.StatusUnprocessableEntity
+		defer func() { status = http.StatusBadRequest }()
+		if _, err := NewDuplicateTolerantCommunicator(nc).Create(batch); err == nil {
+			t.Error("expected an error for a 422")
+		}
+	})
+
+	t.Run("untyped errors are recognised by their text", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusBadRequest}
+		if !IsAlreadyExists(resp, errors.New("400 Bad Request: measurement already exists at timestamp")) {
+			t.Error("expected the library error to be recognised")
+		}
+		if IsAlreadyExists(resp, errors.New("400 Bad Request: invalid name")) {
+			t.Error("expected other 400s not to be recognised")
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DefaultEncodeCacheSize bounds how many encoded tag sets a measurementEncoder keeps
+const DefaultEncodeCacheSize = 10000
+
+// measurementEncoder encodes Measurements to JSON exactly like json.Marshal does, reusing the encoding of tag sets it
+// has seen before instead of encoding the same tags for every Measurement of a series. It is safe for concurrent use.
+type measurementEncoder struct {
+	// integers renders whole values as integers, see integerValues
+	integers bool
+
+	mu   sync.Mutex
+	tags *lru
+}
+
+// newMeasurementEncoder returns a measurementEncoder caching the encoding of at most size tag sets
+func newMeasurementEncoder(size int) *measurementEncoder {
+	return &measurementEncoder{tags: newLRU(size, nil)}
+}
+
+// Encode returns the JSON encoding of m. Tags are the second field of a Measurement, so m is encoded without them
+// and the cached tags are spliced in after its name. Empty Tags are omitted like json.Marshal omits them.
+func (me *measurementEncoder) Encode(m appoptics.Measurement) ([]byte, error) {
+	if me.integers {
+		m = integerValues(m)
+	}
+	if len(m.Tags) == 0 {
+		return json.Marshal(m)
+	}
+	tags, err := me.encodeTags(m.Tags)
+	if err != nil {
+		return nil, err
+	}
+	untagged := m
+	untagged.Tags = nil
+	rest, err := json.Marshal(untagged)
+	if err != nil {
+		return nil, err
+	}
+	prefix := nameEnd(rest)
+
+	encoded := make([]byte, 0, len(rest)+len(`,"tags":`)+len(tags))
+	encoded = append(encoded, rest[:prefix]...)
+	encoded = append(encoded, `,"tags":`...)
+	encoded = append(encoded, tags...)
+	return append(encoded, rest[prefix:]...), nil
+}
+
+// encodeTags returns the JSON encoding of tags, from the cache if the same tag set was encoded before
+func (me *measurementEncoder) encodeTags(tags map[string]string) ([]byte, error) {
+	key := tagSetKey(tags)
+	me.mu.Lock()
+	cached, ok := me.tags.Get(key)
+	me.mu.Unlock()
+	if ok {
+		return cached.([]byte), nil
+	}
+
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	me.mu.Lock()
+	me.tags.Add(key, encoded)
+	me.mu.Unlock()
+	return encoded, nil
+}
+
+// integerValues returns m with its whole float64 values replaced by int64s, which always encode as integers.
+// encoding/json already writes whole float64s without a fraction, but negative zero as "-0" and those above 2^53 in
+// their shortest form, e.g. 2^60 as 1152921504606847000, which integer parsers take for a different number.
+// Fractional values, and whole ones outside the int64 range, are kept as they are.
+func integerValues(m appoptics.Measurement) appoptics.Measurement {
+	m.Value = integerValue(m.Value)
+	m.Sum = integerValue(m.Sum)
+	m.Min = integerValue(m.Min)
+	m.Max = integerValue(m.Max)
+	m.Last = integerValue(m.Last)
+	return m
+}
+
+// integerValue returns v as an int64 if it is a whole float64 within the int64 range, and v otherwise
+func integerValue(v interface{}) interface{} {
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return v
+	}
+	return int64(f)
+}
+
+// nameEnd returns the offset just past the name of an encoded Measurement, which starts with {"name":"
+func nameEnd(encoded []byte) int {
+	i := len(`{"name":"`)
+	for encoded[i] != '"' {
+		if encoded[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	return i + 1
+}
+
+// tagSetKey returns a string uniquely identifying a tag set, built from its pairs sorted by key
+func tagSetKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xff)
+		b.WriteString(tags[k])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
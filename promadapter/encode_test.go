@@ -0,0 +1,89 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestMeasurementEncoder(t *testing.T) {
+	measurements := []appoptics.Measurement{
+		{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture},
+		{Name: metricNameFixture, Tags: map[string]string{}, Value: valueFixture, Time: timestampFixture},
+		{Name: metricNameFixture, Tags: map[string]string{"job": "node", "instance": "host-1:9100"}, Value: valueFixture, Time: timestampFixture},
+		{Name: metricNameFixture, Tags: map[string]string{"instance": "host-1:9100", "job": "node"}, Value: 2.5, Time: timestampFixture},
+		{Name: `escaped"<name>`, Tags: map[string]string{"path": `<a href="/">&</a>`}, Value: valueFixture},
+		{Name: metricNameFixture, Tags: map[string]string{"job": "node"}, Count: 3, Sum: 4.5, Min: 1.0, Max: 2.0},
+		{Name: metricNameFixture, Tags: map[string]string{"job": "node"}, Attributes: map[string]interface{}{"aggregate": true}},
+	}
+
+	// a cache of one exercises both hits and evictions
+	for _, size := range []int{1, DefaultEncodeCacheSize} {
+		me := newMeasurementEncoder(size)
+		for pass := 0; pass < 2; pass++ {
+			for _, m := range measurements {
+				expected, err := json.Marshal(m)
+				if err != nil {
+					t.Fatalf("Expected no error but received %s", err.Error())
+				}
+				encoded, err := me.Encode(m)
+				if err != nil {
+					t.Fatalf("Expected no error but received %s", err.Error())
+				}
+				if string(encoded) != string(expected) {
+					t.Errorf("expected %s but got %s", expected, encoded)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkMeasurementEncoding(b *testing.B) {
+	batch := benchmarkBatch(10000)
+
+	b.Run("cached tags", func(b *testing.B) {
+		me := newMeasurementEncoder(DefaultEncodeCacheSize)
+		for i := 0; i < b.N; i++ {
+			for _, m := range batch {
+				me.Encode(m)
+			}
+		}
+	})
+
+	b.Run("json.Marshal", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, m := range batch {
+				json.Marshal(m)
+			}
+		}
+	})
+}
+
+func TestMeasurementEncoderIntegerValues(t *testing.T) {
+	me := newMeasurementEncoder(DefaultEncodeCacheSize)
+	me.integers = true
+
+	for _, tc := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{5.0, `5`},
+		{5.5, `5.5`},
+		{math.Copysign(0, -1), `0`},
+		{-3.0, `-3`},
+		{float64(1 << 60), `1152921504606846976`},
+		{1e21, `1e+21`},
+		{7, `7`},
+	} {
+		encoded, err := me.Encode(appoptics.Measurement{Name: metricNameFixture, Value: tc.value})
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		expected := `{"name":"` + metricNameFixture + `","value":` + tc.expected + `,"time":0}`
+		if string(encoded) != expected {
+			t.Errorf("expected %s but got %s", expected, encoded)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package promadapter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultAPIURL is the base URL of the AppOptics REST API
+const DefaultAPIURL = "https://api.appoptics.com/v1/"
+
+// Paths of the AppOptics API endpoints the adapter calls itself, relative to the API URL
+const (
+	MeasurementsPath = "measurements"
+	ValidatePath     = "measurements/validate"
+	MetricsPath      = "metrics"
+	AnnotationsPath  = "annotations"
+	AlertsPath       = "alerts"
+	ServicesPath     = "services"
+	SpacesPath       = "spaces"
+	TagsPath         = "tags"
+	SnapshotsPath    = "snapshots"
+)
+
+// ParseAPIURL validates the base URL of the AppOptics API, which may carry a path prefix when AppOptics is exposed
+// through a gateway, and returns it with a trailing slash so relative endpoint paths resolve beneath it
+func ParseAPIURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL %q: %s", s, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid API URL %q: expected an absolute http or https URL", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid API URL %q: must not have a query or fragment", s)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+// EndpointURL returns the URL of the endpoint at path relative to the API URL
+func EndpointURL(api *url.URL, path string) string {
+	return api.ResolveReference(&url.URL{Path: strings.TrimLeft(path, "/")}).String()
+}
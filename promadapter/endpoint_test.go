@@ -0,0 +1,53 @@
+package promadapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestParseAPIURL(t *testing.T) {
+	for in, expected := range map[string]string{
+		DefaultAPIURL: DefaultAPIURL,
+		"https://gateway.example.com/appoptics/v1": "https://gateway.example.com/appoptics/v1/",
+	} {
+		u, err := ParseAPIURL(in)
+		if err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+			continue
+		}
+		if u.String() != expected {
+			t.Errorf("expected %s but got %s", expected, u)
+		}
+	}
+
+	for _, in := range []string{"api.appoptics.com/v1", "ftp://api.appoptics.com/v1/", "https://api.appoptics.com/v1/?token=x", "://"} {
+		if _, err := ParseAPIURL(in); err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestEndpointURLWithPrefix(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	api, err := ParseAPIURL(server.URL + "/appoptics/v1")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	v := NewValidator(EndpointURL(api, ValidatePath), "token", server.Client())
+	if _, err := v.Validate(context.Background(), []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if len(paths) != 1 || paths[0] != "/appoptics/v1/measurements/validate" {
+		t.Errorf("expected the prefixed validate path but got %v", paths)
+	}
+}
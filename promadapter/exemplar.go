@@ -0,0 +1,313 @@
+package promadapter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenMetricsContentType is the media type of the OpenMetrics text format, the exposition format carrying exemplars
+const OpenMetricsContentType = "application/openmetrics-text"
+
+// ExemplarTraceIDLabel is the exemplar label holding the ID of the trace an exemplar was recorded in
+const ExemplarTraceIDLabel = "trace_id"
+
+// defaultExemplarKeys is how many annotated exemplars an ExemplarAnnotator remembers, as the same exemplar is exposed
+// on every scrape until the series records a new one
+const defaultExemplarKeys = 10000
+
+// defaultExemplarQueue is how many scrapes' worth of exemplars an ExemplarAnnotator holds for its worker, further
+// ones being dropped until it catches up
+const defaultExemplarQueue = 16
+
+// defaultExemplarTimeout bounds the time an ExemplarAnnotator spends annotating the exemplars of one scrape
+const defaultExemplarTimeout = 10 * time.Second
+
+// Exemplar is an exemplar of an OpenMetrics sample: a value observed by the series, with labels usually naming the
+// trace it was recorded in
+type Exemplar struct {
+	Metric    string
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// openMetricsToText converts an OpenMetrics text exposition into the Prometheus text format expfmt decodes, returning
+// the exemplars it carried. Comment lines are dropped, as OpenMetrics types and names its counters differently, so
+// every series is decoded untyped, which leaves its samples the same. The _created samples of counters, histograms
+// and summaries are dropped too, as they hold when the series was reset rather than a value of it. Timestamps are
+// converted from seconds to milliseconds.
+func openMetricsToText(body []byte) ([]byte, []Exemplar, error) {
+	var text bytes.Buffer
+	var exemplars []Exemplar
+	// created is the name of the _created sample of the family the lines belong to, if it has one
+	var created string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "# EOF" {
+			break
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			created = ""
+			if fields := strings.Fields(line); len(fields) == 4 && hasCreatedSample(fields[3]) {
+				created = fields[2] + "_created"
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		series, name, rest, err := splitSeries(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == created {
+			continue
+		}
+		var exemplar string
+		if i := strings.Index(rest, " # "); i >= 0 {
+			rest, exemplar = rest[:i], strings.TrimSpace(rest[i+3:])
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 1 || len(fields) > 2 {
+			return nil, nil, fmt.Errorf("expected a value and an optional timestamp in %q", line)
+		}
+		text.WriteString(series)
+		text.WriteByte(' ')
+		text.WriteString(fields[0])
+		if len(fields) == 2 {
+			ts, err := parseOpenMetricsTimestamp(fields[1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid timestamp in %q", line)
+			}
+			text.WriteByte(' ')
+			text.WriteString(strconv.FormatInt(ts.UnixNano()/int64(time.Millisecond), 10))
+		}
+		text.WriteByte('\n')
+
+		if exemplar != "" {
+			e, err := parseExemplar(name, exemplar)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid exemplar in %q: %s", line, err)
+			}
+			exemplars = append(exemplars, e)
+		}
+	}
+	return text.Bytes(), exemplars, scanner.Err()
+}
+
+// hasCreatedSample reports whether the families of an OpenMetrics type expose a _created sample
+func hasCreatedSample(metricType string) bool {
+	switch metricType {
+	case "counter", "histogram", "summary":
+		return true
+	}
+	return false
+}
+
+// splitSeries splits a sample line into its series, i.e. its name and labels, the name alone and the rest of the line
+func splitSeries(line string) (string, string, string, error) {
+	i := strings.IndexAny(line, "{ ")
+	if i < 1 {
+		return "", "", "", fmt.Errorf("expected a metric name in %q", line)
+	}
+	if line[i] == ' ' {
+		return line[:i], line[:i], line[i:], nil
+	}
+	end, err := labelsEnd(line, i)
+	if err != nil {
+		return "", "", "", err
+	}
+	return line[:end], line[:i], line[end:], nil
+}
+
+// labelsEnd returns the offset just past the label set starting with the brace at start, skipping braces in quoted
+// label values
+func labelsEnd(s string, start int) (int, error) {
+	quoted := false
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == '}':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated label set in %q", s)
+}
+
+// parseLabels parses the inside of a label set, e.g. trace_id="abc",span_id="def"
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; {
+		eq := strings.Index(s, "=")
+		if eq < 1 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, fmt.Errorf("expected name=\"value\" in %q", s)
+		}
+		end := eq + 2
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("unterminated label value in %q", s)
+		}
+		value, err := strconv.Unquote(s[eq+1 : end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value in %q", s)
+		}
+		labels[strings.TrimSpace(s[:eq])] = value
+		s = strings.TrimLeft(strings.TrimSpace(s[end+1:]), ",")
+		s = strings.TrimSpace(s)
+	}
+	return labels, nil
+}
+
+// parseExemplar parses the exemplar of a sample of the named metric, e.g. {trace_id="abc"} 0.67 1520879607.789
+func parseExemplar(metric, s string) (Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return Exemplar{}, fmt.Errorf("expected a label set")
+	}
+	end, err := labelsEnd(s, 0)
+	if err != nil {
+		return Exemplar{}, err
+	}
+	labels, err := parseLabels(s[1 : end-1])
+	if err != nil {
+		return Exemplar{}, err
+	}
+	fields := strings.Fields(s[end:])
+	if len(fields) < 1 || len(fields) > 2 {
+		return Exemplar{}, fmt.Errorf("expected a value and an optional timestamp")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Exemplar{}, fmt.Errorf("invalid value %q", fields[0])
+	}
+	e := Exemplar{Metric: metric, Labels: labels, Value: value}
+	if len(fields) == 2 {
+		if e.Timestamp, err = parseOpenMetricsTimestamp(fields[1]); err != nil {
+			return Exemplar{}, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+	}
+	return e, nil
+}
+
+// parseOpenMetricsTimestamp parses a timestamp in seconds, which may have a fraction
+func parseOpenMetricsTimestamp(s string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(math.Floor(frac*1e9+0.5))), nil
+}
+
+// ExemplarAnnotator records exemplars as events on an annotation stream, linking the traces they name to the
+// metrics they were observed by: the title is the trace ID, the description the exemplar value and the source the
+// metric name. Exemplars without a trace ID are skipped, and each is annotated only once however often it is scraped.
+// Exemplars handed over with Enqueue are annotated by a worker of its own, so scrapes never wait on the annotations
+// API.
+type ExemplarAnnotator struct {
+	ac      AnnotationsCommunicator
+	now     func() time.Time
+	timeout time.Duration
+	queue   chan []Exemplar
+	// pending counts the enqueued exemplars not yet annotated
+	pending sync.WaitGroup
+
+	mu   sync.Mutex
+	seen *lru
+}
+
+// NewExemplarAnnotator returns an ExemplarAnnotator creating events through ac, and starts its worker
+func NewExemplarAnnotator(ac AnnotationsCommunicator) *ExemplarAnnotator {
+	ea := &ExemplarAnnotator{
+		ac:      ac,
+		now:     time.Now,
+		timeout: defaultExemplarTimeout,
+		queue:   make(chan []Exemplar, defaultExemplarQueue),
+		seen:    newLRU(defaultExemplarKeys, nil),
+	}
+	go ea.work()
+	return ea
+}
+
+// Enqueue hands exemplars to the worker without waiting, dropping them if it is too far behind
+func (ea *ExemplarAnnotator) Enqueue(exemplars []Exemplar) {
+	if len(exemplars) == 0 {
+		return
+	}
+	ea.pending.Add(1)
+	select {
+	case ea.queue <- exemplars:
+	default:
+		ea.pending.Done()
+		LogError("dropping %d exemplars, the annotations API is falling behind\n", len(exemplars))
+	}
+}
+
+// work annotates the enqueued exemplars, giving those of each scrape at most ea.timeout
+func (ea *ExemplarAnnotator) work() {
+	for exemplars := range ea.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), ea.timeout)
+		if err := ea.Annotate(ctx, exemplars); err != nil {
+			LogError("annotating exemplars: %s\n", err)
+		}
+		cancel()
+		ea.pending.Done()
+	}
+}
+
+// Annotate creates an event for every exemplar not annotated before, returning the first error met
+func (ea *ExemplarAnnotator) Annotate(ctx context.Context, exemplars []Exemplar) error {
+	var firstErr error
+	for _, e := range exemplars {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		traceID := e.Labels[ExemplarTraceIDLabel]
+		if traceID == "" {
+			continue
+		}
+		key := e.Metric + "\xff" + traceID
+		ea.mu.Lock()
+		_, seen := ea.seen.Get(key)
+		ea.mu.Unlock()
+		if seen {
+			continue
+		}
+
+		start := e.Timestamp
+		if start.IsZero() {
+			start = ea.now()
+		}
+		_, err := ea.ac.CreateAnnotation(ctx, &AnnotationEvent{
+			Title:       traceID,
+			Description: strconv.FormatFloat(e.Value, 'g', -1, 64),
+			Source:      e.Metric,
+			StartTime:   start.Unix(),
+		})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ea.mu.Lock()
+		ea.seen.Add(key, struct{}{})
+		ea.mu.Unlock()
+	}
+	return firstErr
+}
@@ -0,0 +1,121 @@
+package promadapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const openMetricsFixture = `# TYPE http_request_duration_seconds histogram
+# UNIT http_request_duration_seconds seconds
+http_request_duration_seconds_bucket{le="0.1",path="/a{b}"} 8 1500000000.5 # {trace_id="4bf92f3577b34da6"} 0.067 1500000000.25
+http_request_duration_seconds_bucket{le="+Inf",path="/a{b}"} 10 1500000000.5 # {span_id="00f067aa"} 0.9
+http_request_duration_seconds_sum{path="/a{b}"} 1.5 1500000000.5
+http_request_duration_seconds_count{path="/a{b}"} 10 1500000000.5
+http_request_duration_seconds_created{path="/a{b}"} 1499990000.5 1500000000.5
+# TYPE rpc_widgets counter
+rpc_widgets_total 42 # {trace_id="a3ce929d0e0e4736"} 1
+rpc_widgets_created 1499990000
+# TYPE rpc_widgets_created gauge
+rpc_widgets_created 3
+# EOF
+`
+
+func TestFederateSourceExemplars(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Accept"), OpenMetricsContentType) {
+			t.Errorf("expected OpenMetrics to be asked for but got %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", OpenMetricsContentType+"; version=0.0.1; charset=utf-8")
+		w.Write([]byte(openMetricsFixture))
+	}))
+	defer server.Close()
+
+	svc := &stubAnnotations{}
+	fs, _ := NewFederateSource(server.URL, nil, time.Minute, server.Client(), WithExemplarAnnotations(svc))
+	fs.exemplars.now = func() time.Time { return time.Unix(timestampFixture, 0) }
+	samples, err := fs.Fetch()
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	fs.exemplars.pending.Wait()
+
+	t.Run("samples are decoded without their exemplars", func(t *testing.T) {
+		if len(samples) != 6 {
+			t.Fatalf("expected 6 samples but got %d", len(samples))
+		}
+		var found bool
+		for _, s := range samples {
+			if s.Metric["le"] != "0.1" {
+				continue
+			}
+			found = true
+			if s.Metric["path"] != "/a{b}" || s.Value != 8 || s.Timestamp != 1500000000500 {
+				t.Errorf("expected the first bucket with its timestamp in milliseconds but got %s", s)
+			}
+		}
+		if !found {
+			t.Error("expected the first bucket to be decoded")
+		}
+	})
+
+	t.Run("_created samples are dropped", func(t *testing.T) {
+		for _, s := range samples {
+			if s.Metric[model.MetricNameLabel] == "http_request_duration_seconds_created" || s.Value == 1499990000 {
+				t.Errorf("expected the _created samples to be dropped but got %s", s)
+			}
+		}
+	})
+
+	t.Run("exemplars with a trace ID are annotated", func(t *testing.T) {
+		if len(svc.created) != 2 {
+			t.Fatalf("expected 2 annotations but got %d", len(svc.created))
+		}
+		first, second := svc.created[0], svc.created[1]
+		if first.Title != "4bf92f3577b34da6" || first.Description != "0.067" || first.Source != "http_request_duration_seconds_bucket" || first.StartTime != 1500000000 {
+			t.Errorf("unexpected annotation %+v", first)
+		}
+		if second.Title != "a3ce929d0e0e4736" || second.Source != "rpc_widgets_total" || second.StartTime != timestampFixture {
+			t.Errorf("expected an exemplar without a timestamp to be annotated now but got %+v", second)
+		}
+	})
+
+	t.Run("exemplars are annotated once", func(t *testing.T) {
+		if _, err := fs.Fetch(); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		fs.exemplars.pending.Wait()
+		if len(svc.created) != 2 {
+			t.Errorf("expected no new annotations but got %d", len(svc.created)-2)
+		}
+	})
+}
+
+// blockingAnnotations blocks every annotation until its context is done
+type blockingAnnotations struct {
+	stubAnnotations
+	err error
+}
+
+func (ba *blockingAnnotations) CreateAnnotation(ctx context.Context, event *AnnotationEvent) (*AnnotationEvent, error) {
+	<-ctx.Done()
+	ba.err = ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestExemplarAnnotatorDeadline(t *testing.T) {
+	svc := &blockingAnnotations{}
+	ea := NewExemplarAnnotator(svc)
+	ea.timeout = 10 * time.Millisecond
+
+	ea.Enqueue([]Exemplar{{Metric: "rpc_widgets_total", Labels: map[string]string{ExemplarTraceIDLabel: "a3ce929d0e0e4736"}}})
+	ea.pending.Wait()
+	if svc.err != context.DeadlineExceeded {
+		t.Errorf("expected the annotation to be cut off at the deadline but got %v", svc.err)
+	}
+}
@@ -0,0 +1,267 @@
+package promadapter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// ErrFederationForbidden is returned when a Prometheus server refuses access to its /federate endpoint
+var ErrFederationForbidden = errors.New("federation endpoint responded 403 Forbidden: check that /federate is enabled and reachable from the adapter")
+
+// FederateSource periodically pulls samples from a Prometheus server's /federate endpoint and feeds them through a
+// Pipeline, for setups where remote_write cannot be configured
+type FederateSource struct {
+	url        string
+	selectors  []string
+	interval   time.Duration
+	httpClient *http.Client
+	retry      RetryPolicy
+	sleep      func(time.Duration)
+
+	basicUser       string
+	basicPassword   string
+	bearerToken     string
+	bearerTokenFile string
+	secretNamespace string
+	secretName      string
+	kubernetes      *KubernetesClient
+	secret          *SecretWatcher
+
+	exemplars *ExemplarAnnotator
+}
+
+// ScraperOption configures a FederateSource, e.g. how it authenticates with the Prometheus server
+type ScraperOption func(*FederateSource)
+
+// WithHTTPBasicAuth authenticates every request with HTTP basic auth
+func WithHTTPBasicAuth(user, password string) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.basicUser, fs.basicPassword = user, password
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token
+func WithBearerToken(token string) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.bearerToken = token
+	}
+}
+
+// WithBearerTokenFile authenticates every request with the bearer token in a file. The file is read again for every
+// request, so rotated tokens such as Kubernetes service account tokens are picked up.
+func WithBearerTokenFile(path string) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.bearerTokenFile = path
+	}
+}
+
+// WithScrapeSecretRef authenticates every request with the credentials in a Kubernetes Secret, its token field as a
+// bearer token or else its username and password fields for basic auth. The Secret is watched while the
+// FederateSource runs, so rotated credentials are picked up. If it does not exist a warning is logged and requests go
+// unauthenticated.
+func WithScrapeSecretRef(namespace, secretName string) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.secretNamespace, fs.secretName = namespace, secretName
+	}
+}
+
+// WithKubernetesClient sets the client the Secret of WithScrapeSecretRef is read through, by default the one for the
+// cluster the adapter runs in
+func WithKubernetesClient(kc *KubernetesClient) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.kubernetes = kc
+	}
+}
+
+// WithExemplarAnnotations asks for the OpenMetrics format, and records the exemplars of a response in it as events
+// created through ac, see ExemplarAnnotator. Servers answering in the Prometheus text format, as /federate itself
+// does, are decoded as before.
+func WithExemplarAnnotations(ac AnnotationsCommunicator) ScraperOption {
+	return func(fs *FederateSource) {
+		fs.exemplars = NewExemplarAnnotator(ac)
+	}
+}
+
+// NewFederateSource returns a FederateSource pulling series matching selectors from the Prometheus server at
+// baseURL every interval. Basic auth, a bearer token, a bearer token file and a Secret are mutually exclusive, as
+// they are in Prometheus' own scrape configuration.
+func NewFederateSource(baseURL string, selectors []string, interval time.Duration, httpClient *http.Client, opts ...ScraperOption) (*FederateSource, error) {
+	fs := &FederateSource{
+		url:        strings.TrimRight(baseURL, "/") + "/federate",
+		selectors:  selectors,
+		interval:   interval,
+		httpClient: httpClient,
+		retry:      DefaultRetryPolicy(),
+		sleep:      time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	var methods int
+	for _, set := range []bool{fs.basicUser != "", fs.bearerToken != "", fs.bearerTokenFile != "", fs.secretName != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return nil, errors.New("at most one of basic auth, a bearer token, a bearer token file and a secret can be used")
+	}
+
+	if fs.secretName != "" {
+		if fs.kubernetes == nil {
+			kc, err := NewInClusterKubernetesClient()
+			if err != nil {
+				return nil, err
+			}
+			fs.kubernetes = kc
+		}
+		sw, err := NewSecretWatcher(fs.kubernetes, fs.secretNamespace, fs.secretName)
+		if err != nil {
+			return nil, err
+		}
+		fs.secret = sw
+	}
+	return fs, nil
+}
+
+// Run fetches samples every interval, processes them with pipeline and sends the result to sink until stop is closed
+func (fs *FederateSource) Run(pipeline *Pipeline, sink chan<- []appoptics.Measurement, stop <-chan struct{}) {
+	if fs.secret != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go fs.secret.Run(done)
+	}
+
+	ticker := time.NewTicker(fs.interval)
+	defer ticker.Stop()
+	for {
+		samples, err := fs.Fetch()
+		if err != nil {
+			log.Println(err)
+		} else if measurements := pipeline.ProcessSamples(samples); len(measurements) > 0 {
+			sink <- measurements
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Fetch pulls the current value of every matching series, retrying network errors and 5xx responses with backoff
+func (fs *FederateSource) Fetch() (model.Samples, error) {
+	for attempt := 1; ; attempt++ {
+		samples, resp, err := fs.fetchOnce()
+		retryable := (err != nil && resp == nil) || (resp != nil && resp.StatusCode >= 500)
+		if attempt >= fs.retry.MaxAttempts || !retryable {
+			return samples, err
+		}
+
+		log.Printf("retrying federation request after attempt %d failed: %s\n", attempt, err)
+		fs.sleep(fs.retry.Delay(attempt, resp, time.Now()))
+	}
+}
+
+// authorize adds the configured credentials to req
+func (fs *FederateSource) authorize(req *http.Request) error {
+	switch {
+	case fs.basicUser != "":
+		req.SetBasicAuth(fs.basicUser, fs.basicPassword)
+	case fs.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+fs.bearerToken)
+	case fs.bearerTokenFile != "":
+		token, err := ioutil.ReadFile(fs.bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("reading bearer token: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case fs.secret != nil:
+		credentials := fs.secret.Credentials()
+		if credentials.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+credentials.Token)
+		} else if credentials.Username != "" {
+			req.SetBasicAuth(credentials.Username, credentials.Password)
+		}
+	}
+	return nil
+}
+
+func (fs *FederateSource) fetchOnce() (model.Samples, *http.Response, error) {
+	query := url.Values{}
+	for _, selector := range fs.selectors {
+		query.Add("match[]", selector)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fs.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fs.exemplars != nil {
+		req.Header.Set("Accept", OpenMetricsContentType+"; version=0.0.1,"+string(expfmt.FmtText)+";q=0.5")
+	} else {
+		req.Header.Set("Accept", string(expfmt.FmtText))
+	}
+	if err := fs.authorize(req); err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := fs.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return nil, resp, ErrFederationForbidden
+	case resp.StatusCode > 299:
+		return nil, resp, fmt.Errorf("federation endpoint responded %s", resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	format := expfmt.ResponseFormat(resp.Header)
+	if fs.exemplars != nil && strings.HasPrefix(resp.Header.Get("Content-Type"), OpenMetricsContentType) {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, resp, err
+		}
+		text, exemplars, err := openMetricsToText(data)
+		if err != nil {
+			return nil, resp, err
+		}
+		fs.exemplars.Enqueue(exemplars)
+		body, format = bytes.NewReader(text), expfmt.FmtText
+	}
+
+	decoder := &expfmt.SampleDecoder{
+		Dec:  expfmt.NewDecoder(body, format),
+		Opts: &expfmt.DecodeOptions{Timestamp: model.Now()},
+	}
+	var samples model.Samples
+	for {
+		var vector model.Vector
+		if err := decoder.Decode(&vector); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, resp, err
+		}
+		samples = append(samples, vector...)
+	}
+	return samples, resp, nil
+}
@@ -0,0 +1,116 @@
+package promadapter
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// MetricFilter is a Stage that only lets through Measurements whose name matches the allowlist, if one is set, and
+// does not match the denylist. Both lists can be replaced at any time while Measurements are being processed.
+type MetricFilter struct {
+	// lists holds the current filterLists, replaced as a whole so that Process never sees one list without the other
+	lists atomic.Value
+	stats *Stats
+
+	// mu serializes the setters, which replace one list and keep the other
+	mu sync.Mutex
+}
+
+// filterLists are the compiled allowlist and denylist of a MetricFilter
+type filterLists struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// NewMetricFilter returns a MetricFilter for the given allowlist and denylist regular expressions. Patterns must
+// match the whole metric name.
+func NewMetricFilter(allow, deny []string, stats *Stats) (*MetricFilter, error) {
+	f := &MetricFilter{stats: stats}
+	if err := f.SetLists(allow, deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetAllowlist replaces the allowlist. An empty allowlist lets every metric through. If any pattern is invalid the
+// current allowlist is left in place.
+func (f *MetricFilter) SetAllowlist(patterns []string) error {
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists.Store(filterLists{allow: compiled, deny: f.lists.Load().(filterLists).deny})
+	return nil
+}
+
+// SetDenylist replaces the denylist. If any pattern is invalid the current denylist is left in place.
+func (f *MetricFilter) SetDenylist(patterns []string) error {
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists.Store(filterLists{allow: f.lists.Load().(filterLists).allow, deny: compiled})
+	return nil
+}
+
+// SetLists replaces both lists together. If any pattern in either list is invalid both current lists are left in
+// place.
+func (f *MetricFilter) SetLists(allow, deny []string) error {
+	compiledAllow, err := compilePatterns(allow)
+	if err != nil {
+		return err
+	}
+	compiledDeny, err := compilePatterns(deny)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists.Store(filterLists{allow: compiledAllow, deny: compiledDeny})
+	return nil
+}
+
+// Process implements Stage
+func (f *MetricFilter) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	lists := f.lists.Load().(filterLists)
+
+	kept := measurements[:0]
+	for _, m := range measurements {
+		if (len(lists.allow) > 0 && !matchesAny(lists.allow, m.Name)) || matchesAny(lists.deny, m.Name) {
+			f.stats.AddDropped(DropReasonFiltered, 1)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// compilePatterns compiles each pattern anchored to match a whole name
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
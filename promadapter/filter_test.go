@@ -0,0 +1,55 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestMetricFilter(t *testing.T) {
+	measurements := func() []appoptics.Measurement {
+		return []appoptics.Measurement{
+			{Name: "http_requests_total", Value: 1.0},
+			{Name: "http_request_duration_seconds", Value: 1.0},
+			{Name: "go_goroutines", Value: 1.0},
+		}
+	}
+
+	stats := NewStats()
+	f, err := NewMetricFilter(nil, []string{"go_.*"}, stats)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	if out := f.Process(measurements()); len(out) != 2 {
+		t.Errorf("expected the denylist to drop 1 measurement but %d were kept", len(out))
+	}
+
+	if err := f.SetAllowlist([]string{"http_requests_.*"}); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	out := f.Process(measurements())
+	if len(out) != 1 || out[0].Name != "http_requests_total" {
+		t.Errorf("expected only http_requests_total to be kept but got %+v", out)
+	}
+
+	t.Run("invalid patterns keep the current list", func(t *testing.T) {
+		if err := f.SetAllowlist([]string{"("}); err == nil {
+			t.Error("expected an error but got none")
+		}
+		if out := f.Process(measurements()); len(out) != 1 {
+			t.Errorf("expected the previous allowlist to still apply but %d were kept", len(out))
+		}
+	})
+
+	t.Run("patterns match whole names", func(t *testing.T) {
+		f.SetAllowlist([]string{"http"})
+		if out := f.Process(measurements()); len(out) != 0 {
+			t.Errorf("expected no partial matches but %d were kept", len(out))
+		}
+	})
+
+	if stats.Dropped()[DropReasonFiltered] == 0 {
+		t.Error("expected filtered measurements to be counted")
+	}
+}
@@ -0,0 +1,76 @@
+package promadapter
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// fingerprintCache remembers the series key of the tag maps it has seen, keyed by the address of the map, so that a
+// Measurement whose Tags are the very map of an earlier one, e.g. one resubmitted from a cache, skips sorting and
+// joining them again. It is not safe for concurrent use.
+//
+// Each entry holds on to its map, so the address cannot be reused by another map while it is cached, and to a copy of
+// the tags, so that a map modified in place since is not mistaken for a hit.
+type fingerprintCache struct {
+	entries *lru
+	lookups uint64
+	hits    uint64
+}
+
+type fingerprintEntry struct {
+	tags     map[string]string
+	snapshot map[string]string
+	key      string
+}
+
+// newFingerprintCache returns a fingerprintCache remembering at most size tag maps
+func newFingerprintCache(size int) *fingerprintCache {
+	return &fingerprintCache{entries: newLRU(size, nil)}
+}
+
+// seriesKey returns the same key as the seriesKey function, from the cache if the Tags of m were seen before
+func (fc *fingerprintCache) seriesKey(m appoptics.Measurement) string {
+	if len(m.Tags) == 0 {
+		return m.Name
+	}
+
+	fc.lookups++
+	id := strconv.FormatUint(uint64(reflect.ValueOf(m.Tags).Pointer()), 16)
+	if cached, ok := fc.entries.Get(id); ok {
+		if entry := cached.(*fingerprintEntry); sameTags(entry.snapshot, m.Tags) {
+			fc.hits++
+			return m.Name + entry.key
+		}
+	}
+
+	snapshot := make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		snapshot[k] = v
+	}
+	key := seriesTagsKey(m.Tags)
+	fc.entries.Add(id, &fingerprintEntry{tags: m.Tags, snapshot: snapshot, key: key})
+	return m.Name + key
+}
+
+// HitRatio returns the fraction of lookups of Measurements with tags answered from the cache
+func (fc *fingerprintCache) HitRatio() float64 {
+	if fc.lookups == 0 {
+		return 0
+	}
+	return float64(fc.hits) / float64(fc.lookups)
+}
+
+// sameTags returns true if a and b hold the same pairs
+func sameTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
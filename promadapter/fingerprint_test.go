@@ -0,0 +1,49 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestFingerprintCache(t *testing.T) {
+	tags := map[string]string{"instance": "a", "job": "node"}
+	m := appoptics.Measurement{Name: metricNameFixture, Tags: tags, Value: valueFixture, Time: timestampFixture}
+	fc := newFingerprintCache(10)
+
+	t.Run("the same map is a hit", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			if key := fc.seriesKey(m); key != seriesKey(m) {
+				t.Fatalf("expected %q but got %q", seriesKey(m), key)
+			}
+		}
+		if fc.HitRatio() != 0.75 {
+			t.Errorf("expected a hit ratio of 0.75 but got %g", fc.HitRatio())
+		}
+	})
+
+	t.Run("an equal but different map is a miss", func(t *testing.T) {
+		hits := fc.hits
+		copied := m
+		copied.Tags = map[string]string{"instance": "a", "job": "node"}
+		if key := fc.seriesKey(copied); key != seriesKey(m) {
+			t.Errorf("expected %q but got %q", seriesKey(m), key)
+		}
+		if fc.hits != hits {
+			t.Error("expected a miss for a different map")
+		}
+	})
+
+	t.Run("a map modified in place is not mistaken for a hit", func(t *testing.T) {
+		tags["instance"] = "b"
+		if key := fc.seriesKey(m); key != seriesKey(m) {
+			t.Errorf("expected %q but got %q", seriesKey(m), key)
+		}
+	})
+
+	t.Run("measurements without tags are keyed by name", func(t *testing.T) {
+		if key := fc.seriesKey(appoptics.Measurement{Name: metricNameFixture}); key != metricNameFixture {
+			t.Errorf("expected %q but got %q", metricNameFixture, key)
+		}
+	})
+}
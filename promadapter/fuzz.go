@@ -0,0 +1,58 @@
+//go:build gofuzz
+// +build gofuzz
+
+package promadapter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/prometheus/common/model"
+)
+
+// Fuzz is a go-fuzz entry point checking that any sample an exporter could send converts to Measurements that encode
+// as valid JSON, both as a batch and as NDJSON lines. The first 8 bytes of the input are the value as a little-endian
+// float64, the rest is split on NUL bytes into a metric name followed by label name/value pairs.
+//
+//	go-fuzz-build github.com/solarwinds/prometheus2appoptics/promadapter
+//	go-fuzz -bin=promadapter-fuzz.zip -workdir=promadapter/testdata/fuzz
+func Fuzz(data []byte) int {
+	if len(data) < 8 {
+		return -1
+	}
+	value := math.Float64frombits(binary.LittleEndian.Uint64(data[:8]))
+	fields := bytes.Split(data[8:], []byte{0})
+
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(fields[0])}
+	for i := 1; i+1 < len(fields); i += 2 {
+		metric[model.LabelName(fields[i])] = model.LabelValue(fields[i+1])
+	}
+
+	measurements := SamplesToMeasurements(model.Samples{{Metric: metric, Value: model.SampleValue(value)}})
+	measurements = NewBucketLabels("le", "quantile").Process(measurements)
+
+	batch, err := json.Marshal(appoptics.MeasurementsBatch{Measurements: measurements})
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(batch, new(interface{})); err != nil {
+		panic("invalid batch JSON: " + string(batch))
+	}
+	for _, m := range measurements {
+		line, err := json.Marshal(m)
+		if err != nil {
+			panic(err)
+		}
+		if bytes.IndexByte(line, '\n') >= 0 {
+			panic("NDJSON line contains a newline: " + string(line))
+		}
+	}
+
+	if len(measurements) == 0 {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,121 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// HealthStatusTag is the tag a HealthReporter sets to the HealthStatus
+const HealthStatusTag = "status"
+
+// HealthStatus describes how submissions to AppOptics fared over an interval
+type HealthStatus string
+
+// HealthStatus values
+const (
+	// HealthHealthy means no submission failed
+	HealthHealthy HealthStatus = "healthy"
+	// HealthDegraded means some submissions failed
+	HealthDegraded HealthStatus = "degraded"
+	// HealthFailing means every submission failed
+	HealthFailing HealthStatus = "failing"
+)
+
+// HealthStatusOf returns the HealthStatus of the window r describes
+func HealthStatusOf(r WindowReport) HealthStatus {
+	switch {
+	case r.ErrorRate == 0:
+		return HealthHealthy
+	case r.ErrorRate == 1:
+		return HealthFailing
+	}
+	return HealthDegraded
+}
+
+// HealthReporter submits a gauge describing the adapter's own health to AppOptics at the end of every interval, so
+// that alerts can be set up on it. The gauge is 1 while healthy and 0 otherwise, tagged with the HealthStatus.
+type HealthReporter struct {
+	mc   appoptics.MeasurementsCommunicator
+	name string
+	wr   *WindowReporter
+}
+
+// NewHealthReporter returns a HealthReporter submitting the gauge metricName through mc every interval, judging health
+// by the submissions recorded in stats. mc should not itself record in stats, or the gauge would count towards the
+// adapter's health.
+func NewHealthReporter(mc appoptics.MeasurementsCommunicator, stats *Stats, metricName string, interval time.Duration) *HealthReporter {
+	hr := &HealthReporter{mc: mc, name: metricName}
+	hr.wr = NewWindowReporter(stats, interval, hr.report)
+	return hr
+}
+
+// Run reports health at the end of every interval until stop is closed
+func (hr *HealthReporter) Run(stop <-chan struct{}) {
+	hr.wr.Run(stop)
+}
+
+// report submits the gauge for the window r describes
+func (hr *HealthReporter) report(r WindowReport) {
+	status := HealthStatusOf(r)
+	value := 0.0
+	if status == HealthHealthy {
+		value = 1.0
+	}
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{
+		Name:  hr.name,
+		Value: value,
+		Time:  r.End.Unix(),
+		Tags:  map[string]string{HealthStatusTag: string(status)},
+	}}}
+	if _, err := hr.mc.Create(batch); err != nil {
+		LogError("submitting health metric %s: %s\n", hr.name, err)
+	}
+}
+
+// livenessResponse is the body a LivenessCheck answers with
+type livenessResponse struct {
+	Healthy     bool       `json:"healthy"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Window      string     `json:"window"`
+}
+
+// LivenessCheck is an http.Handler reporting the adapter unhealthy once no submission has succeeded within a window,
+// catching stalls where nothing reaches AppOptics but no error fires either. Until the first success the window runs
+// from when the check was created.
+type LivenessCheck struct {
+	stats   *Stats
+	window  time.Duration
+	started time.Time
+	now     func() time.Time
+}
+
+// NewLivenessCheck returns a LivenessCheck judging the successes recorded in stats against window
+func NewLivenessCheck(stats *Stats, window time.Duration) *LivenessCheck {
+	return &LivenessCheck{stats: stats, window: window, started: time.Now(), now: time.Now}
+}
+
+// Healthy returns true if a submission succeeded within the window, or the window has not passed since the check was
+// created
+func (lc *LivenessCheck) Healthy() bool {
+	last := lc.stats.LastSuccess()
+	if last.IsZero() {
+		last = lc.started
+	}
+	return lc.now().Sub(last) <= lc.window
+}
+
+// ServeHTTP answers with 200 while healthy and 503 otherwise, along with the time of the last successful submission
+func (lc *LivenessCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := livenessResponse{Healthy: lc.Healthy(), Window: lc.window.String()}
+	if last := lc.stats.LastSuccess(); !last.IsZero() {
+		resp.LastSuccess = &last
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
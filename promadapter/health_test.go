@@ -0,0 +1,82 @@
+package promadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthReporter(t *testing.T) {
+	clock := time.Unix(1500000000, 0)
+	stats := NewStats()
+	stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+	hr := NewHealthReporter(stub, stats, "prometheus2appoptics.health", time.Minute)
+	hr.wr.now = func() time.Time { return clock }
+	hr.wr.reset()
+
+	cases := []struct {
+		name      string
+		submitted int
+		failed    int
+		status    HealthStatus
+		value     float64
+	}{
+		{"no failures", 100, 0, HealthHealthy, 1},
+		{"some failures", 100, 10, HealthDegraded, 0},
+		{"only failures", 0, 10, HealthFailing, 0},
+		{"idle", 0, 0, HealthHealthy, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub.batches = nil
+			stats.AddSubmitted(tc.submitted)
+			stats.AddDropped(DropReasonSubmissionFailed, tc.failed)
+			clock = clock.Add(time.Minute)
+			hr.wr.Tick()
+
+			if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 1 {
+				t.Fatalf("expected one health measurement but got %+v", stub.batches)
+			}
+			m := stub.batches[0].Measurements[0]
+			if m.Name != "prometheus2appoptics.health" || m.Time != clock.Unix() {
+				t.Errorf("expected the health metric at %d but got %+v", clock.Unix(), m)
+			}
+			if m.Value != tc.value || m.Tags[HealthStatusTag] != string(tc.status) {
+				t.Errorf("expected value %v with status %s but got %v with %v", tc.value, tc.status, m.Value, m.Tags)
+			}
+		})
+	}
+}
+
+func TestLivenessCheck(t *testing.T) {
+	clock := time.Unix(1500000000, 0)
+	stats := NewStats()
+	lc := NewLivenessCheck(stats, 5*time.Minute)
+	lc.started = clock
+	lc.now = func() time.Time { return clock }
+
+	status := func() int {
+		rec := httptest.NewRecorder()
+		lc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	if status() != http.StatusOK {
+		t.Error("expected to be healthy before the window has passed")
+	}
+	clock = clock.Add(6 * time.Minute)
+	if status() != http.StatusServiceUnavailable || lc.Healthy() {
+		t.Error("expected to be unhealthy once the window passed without a submission")
+	}
+
+	stats.SetLastSuccess(clock)
+	clock = clock.Add(time.Minute)
+	if status() != http.StatusOK {
+		t.Error("expected to be healthy after a successful submission")
+	}
+	clock = clock.Add(5 * time.Minute)
+	if status() != http.StatusServiceUnavailable {
+		t.Error("expected to be unhealthy once the window passed since the last success")
+	}
+}
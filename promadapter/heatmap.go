@@ -0,0 +1,162 @@
+package promadapter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/prometheus/common/model"
+)
+
+// HistogramMode selects how Prometheus histograms are forwarded
+type HistogramMode int
+
+const (
+	// HistogramBuckets forwards every bucket as its own Measurement tagged with its bound
+	HistogramBuckets HistogramMode = iota
+	// HistogramHeatmap folds the buckets, sum and count of a histogram into one heatmap Measurement
+	HistogramHeatmap
+)
+
+// ParseHistogramMode converts "buckets" or "heatmap" into a HistogramMode
+func ParseHistogramMode(s string) (HistogramMode, error) {
+	switch s {
+	case "buckets":
+		return HistogramBuckets, nil
+	case "heatmap":
+		return HistogramHeatmap, nil
+	}
+	return HistogramBuckets, fmt.Errorf("unknown histogram mode %q", s)
+}
+
+// HeatmapAttribute is the Measurement attribute holding the encoded histogram of a heatmap Measurement
+const HeatmapAttribute = "histogram"
+
+// heatmapBucket is one cumulative histogram bucket
+type heatmapBucket struct {
+	le    float64
+	count float64
+}
+
+// heatmapGroup collects the series of one histogram at one point in time
+type heatmapGroup struct {
+	m       appoptics.Measurement
+	buckets []heatmapBucket
+}
+
+// Heatmap is a Stage replacing the "_bucket" series of every histogram with a single Measurement per histogram and
+// timestamp. Its HeatmapAttribute holds the non-cumulative bucket counts as "H[bound]=count,...", its Count the total
+// count and its Sum the matching "_sum" series, which is removed along with "_count". It must run before the "le"
+// label is renamed.
+type Heatmap struct{}
+
+// NewHeatmap returns a Heatmap
+func NewHeatmap() *Heatmap {
+	return &Heatmap{}
+}
+
+// Process implements Stage
+func (h *Heatmap) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	groups := make(map[string]*heatmapGroup)
+	var order []*heatmapGroup
+	kept := make([]appoptics.Measurement, 0, len(measurements))
+
+	for _, m := range measurements {
+		le, isBucket := bucketBound(m)
+		if !isBucket {
+			kept = append(kept, m)
+			continue
+		}
+
+		base := appoptics.Measurement{Name: strings.TrimSuffix(m.Name, "_bucket"), Time: m.Time, Tags: withoutTag(m.Tags, model.BucketLabel)}
+		key := heatmapKey(base)
+		g, ok := groups[key]
+		if !ok {
+			g = &heatmapGroup{m: base}
+			groups[key] = g
+			order = append(order, g)
+		}
+		g.buckets = append(g.buckets, heatmapBucket{le: le, count: m.Value.(float64)})
+	}
+	if len(groups) == 0 {
+		return measurements
+	}
+
+	out := kept[:0]
+	for _, m := range kept {
+		var name string
+		switch {
+		case strings.HasSuffix(m.Name, "_sum"):
+			name = strings.TrimSuffix(m.Name, "_sum")
+		case strings.HasSuffix(m.Name, "_count"):
+			name = strings.TrimSuffix(m.Name, "_count")
+		default:
+			out = append(out, m)
+			continue
+		}
+		g, ok := groups[heatmapKey(appoptics.Measurement{Name: name, Time: m.Time, Tags: m.Tags})]
+		if !ok {
+			out = append(out, m)
+			continue
+		}
+		if strings.HasSuffix(m.Name, "_sum") {
+			g.m.Sum = m.Value
+		}
+	}
+
+	for _, g := range order {
+		g.m.Count, g.m.Attributes = encodeHeatmap(g.buckets)
+		out = append(out, g.m)
+	}
+	return out
+}
+
+// bucketBound returns the parsed "le" label of a histogram bucket Measurement, and false for anything else
+func bucketBound(m appoptics.Measurement) (float64, bool) {
+	if !strings.HasSuffix(m.Name, "_bucket") {
+		return 0, false
+	}
+	if _, ok := m.Value.(float64); !ok {
+		return 0, false
+	}
+	le, err := strconv.ParseFloat(m.Tags[model.BucketLabel], 64)
+	if err != nil {
+		return 0, false
+	}
+	return le, true
+}
+
+// encodeHeatmap converts cumulative buckets to the total count and the attributes of a heatmap Measurement
+func encodeHeatmap(buckets []heatmapBucket) (float64, map[string]interface{}) {
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+	parts := make([]string, len(buckets))
+	var previous float64
+	for i, b := range buckets {
+		count := b.count - previous
+		// a counter reset between scrapes of neighbouring buckets must not produce a negative count
+		if count < 0 {
+			count = 0
+		}
+		previous = b.count
+		parts[i] = fmt.Sprintf("H[%s]=%s", formatBound(strconv.FormatFloat(b.le, 'g', -1, 64)), strconv.FormatFloat(count, 'f', -1, 64))
+	}
+	return previous, map[string]interface{}{HeatmapAttribute: strings.Join(parts, ",")}
+}
+
+func heatmapKey(m appoptics.Measurement) string {
+	return strconv.FormatInt(m.Time, 10) + "\xff" + seriesKey(m)
+}
+
+// withoutTag returns a copy of tags without key
+func withoutTag(tags map[string]string, key string) map[string]string {
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		if k != key {
+			c[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,59 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestHeatmap(t *testing.T) {
+	tags := func(le string) map[string]string {
+		t := map[string]string{"job": "api"}
+		if le != "" {
+			t["le"] = le
+		}
+		return t
+	}
+
+	out := NewHeatmap().Process([]appoptics.Measurement{
+		{Name: "up", Value: 1.0, Time: 100, Tags: tags("")},
+		{Name: "request_seconds_bucket", Value: 6.0, Time: 100, Tags: tags("+Inf")},
+		{Name: "request_seconds_bucket", Value: 2.0, Time: 100, Tags: tags("0.1")},
+		{Name: "request_seconds_bucket", Value: 5.0, Time: 100, Tags: tags("0.5")},
+		{Name: "request_seconds_sum", Value: 1.2, Time: 100, Tags: tags("")},
+		{Name: "request_seconds_count", Value: 6.0, Time: 100, Tags: tags("")},
+	})
+
+	if len(out) != 2 {
+		t.Fatalf("expected up and one heatmap measurement but got %v", out)
+	}
+	if out[0].Name != "up" {
+		t.Errorf("expected up to pass through but got %s", out[0].Name)
+	}
+
+	hm := out[1]
+	if hm.Name != "request_seconds" || hm.Time != 100 {
+		t.Errorf("expected request_seconds at 100 but got %s at %d", hm.Name, hm.Time)
+	}
+	if _, ok := hm.Tags["le"]; ok || hm.Tags["job"] != "api" {
+		t.Errorf("expected only the job tag but got %v", hm.Tags)
+	}
+	if hm.Attributes[HeatmapAttribute] != "H[0.1]=2,H[0.5]=3,H[+Inf]=1" {
+		t.Errorf("unexpected histogram %v", hm.Attributes[HeatmapAttribute])
+	}
+	if hm.Count != 6.0 || hm.Sum != 1.2 {
+		t.Errorf("expected a count of 6 and a sum of 1.2 but got %v and %v", hm.Count, hm.Sum)
+	}
+}
+
+func TestHeatmapSeparatesSeries(t *testing.T) {
+	out := NewHeatmap().Process([]appoptics.Measurement{
+		{Name: "request_seconds_bucket", Value: 1.0, Time: 100, Tags: map[string]string{"le": "+Inf", "code": "200"}},
+		{Name: "request_seconds_bucket", Value: 3.0, Time: 100, Tags: map[string]string{"le": "+Inf", "code": "500"}},
+		{Name: "request_seconds_bucket", Value: 4.0, Time: 160, Tags: map[string]string{"le": "+Inf", "code": "200"}},
+	})
+
+	if len(out) != 3 {
+		t.Errorf("expected a heatmap per tag set and timestamp but got %d", len(out))
+	}
+}
@@ -0,0 +1,82 @@
+package promadapter
+
+import (
+	"math"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// HistogramMeasurement is an AppOptics summary measurement of many values, including the sum of their squares from
+// which AppOptics derives their variance and standard deviation. Fields that are nil are left out when encoded.
+type HistogramMeasurement struct {
+	Name       string            `json:"name"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Time       int64             `json:"time,omitempty"`
+	Count      *int              `json:"count,omitempty"`
+	Sum        *float64          `json:"sum,omitempty"`
+	Min        *float64          `json:"min,omitempty"`
+	Max        *float64          `json:"max,omitempty"`
+	SumSquares *float64          `json:"sum_squares,omitempty"`
+}
+
+// sumOfSquares accumulates the sum of squares of values with Welford's online algorithm, which stays numerically
+// stable where summing the squares directly loses precision
+type sumOfSquares struct {
+	count int
+	mean  float64
+	// m2 is the sum of squared differences from the mean
+	m2 float64
+}
+
+func (s *sumOfSquares) add(v float64) {
+	s.count++
+	delta := v - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (v - s.mean)
+}
+
+// value returns the sum of squares of the values added, following from m2 and the mean
+func (s *sumOfSquares) value() float64 {
+	return s.m2 + float64(s.count)*s.mean*s.mean
+}
+
+// NewHistogramMeasurement summarizes values in a single pass. Without values only the name is set.
+func NewHistogramMeasurement(name string, values []float64) HistogramMeasurement {
+	hm := HistogramMeasurement{Name: name}
+	if len(values) == 0 {
+		return hm
+	}
+
+	var sum float64
+	var squares sumOfSquares
+	min, max := values[0], values[0]
+	for _, v := range values {
+		sum += v
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+		squares.add(v)
+	}
+	count, sumSquares := len(values), squares.value()
+
+	hm.Count, hm.Sum, hm.Min, hm.Max, hm.SumSquares = &count, &sum, &min, &max, &sumSquares
+	return hm
+}
+
+// Measurement returns the HistogramMeasurement as an appoptics.Measurement. The client library's Measurement has no
+// sum of squares, so the standard deviation it carries is derived from it instead.
+func (hm HistogramMeasurement) Measurement() appoptics.Measurement {
+	m := appoptics.Measurement{Name: hm.Name, Tags: hm.Tags, Time: hm.Time}
+	if hm.Count != nil {
+		m.Count, m.Sum, m.Min, m.Max = *hm.Count, *hm.Sum, *hm.Min, *hm.Max
+		if hm.SumSquares != nil && *hm.Count > 0 {
+			n := float64(*hm.Count)
+			mean := *hm.Sum / n
+			m.StdDev = math.Sqrt(math.Max(0, *hm.SumSquares/n-mean*mean))
+		}
+	}
+	return m
+}
@@ -0,0 +1,40 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestNewHistogramMeasurement(t *testing.T) {
+	hm := NewHistogramMeasurement(metricNameFixture, []float64{2, 4, 4, 4, 5, 5, 7, 9})
+
+	if *hm.Count != 8 || *hm.Sum != 40 || *hm.Min != 2 || *hm.Max != 9 {
+		t.Errorf("expected count 8, sum 40, min 2 and max 9 but got %d, %v, %v and %v", *hm.Count, *hm.Sum, *hm.Min, *hm.Max)
+	}
+	// 4+16+16+16+25+25+49+81
+	if math.Abs(*hm.SumSquares-232) > 1e-9 {
+		t.Errorf("expected a sum of squares of 232 but got %v", *hm.SumSquares)
+	}
+
+	encoded, err := json.Marshal(hm)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(encoded, &fields)
+	for _, name := range []string{"count", "sum", "min", "max", "sum_squares"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected %s in %s", name, encoded)
+		}
+	}
+
+	empty, _ := json.Marshal(NewHistogramMeasurement(metricNameFixture, nil))
+	if expected := `{"name":"` + metricNameFixture + `"}`; string(empty) != expected {
+		t.Errorf("expected nil fields to be omitted in %s but got %s", expected, empty)
+	}
+
+	if m := hm.Measurement(); m.Count != 8 || m.Sum != 40.0 || m.StdDev != 2.0 {
+		t.Errorf("expected the summary fields and a standard deviation of 2 but got %+v", m)
+	}
+}
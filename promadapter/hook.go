@@ -0,0 +1,66 @@
+package promadapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DropReasonHook is recorded for Measurements removed by a SubmitHook or in a batch a SubmitHook rejected
+const DropReasonHook = "hook"
+
+// SubmitHook is called with every batch right before it is submitted. It returns the Measurements to submit, so it
+// may add tags, remove Measurements or pass them through unchanged, or an error to reject the whole batch.
+type SubmitHook func(ctx context.Context, batch []appoptics.Measurement) ([]appoptics.Measurement, error)
+
+// RequireTag returns a SubmitHook removing Measurements that lack the tag key
+func RequireTag(key string) SubmitHook {
+	return func(ctx context.Context, batch []appoptics.Measurement) ([]appoptics.Measurement, error) {
+		kept := make([]appoptics.Measurement, 0, len(batch))
+		for _, m := range batch {
+			if _, ok := m.Tags[key]; ok {
+				kept = append(kept, m)
+			}
+		}
+		return kept, nil
+	}
+}
+
+// HookedCommunicator wraps a MeasurementsCommunicator, running every batch through its SubmitHooks in order before
+// sending it. A batch a hook rejects is dropped and its error returned.
+type HookedCommunicator struct {
+	mc    appoptics.MeasurementsCommunicator
+	hooks []SubmitHook
+	stats *Stats
+}
+
+// NewHookedCommunicator returns a HookedCommunicator sending through mc
+func NewHookedCommunicator(mc appoptics.MeasurementsCommunicator, stats *Stats, hooks ...SubmitHook) *HookedCommunicator {
+	return &HookedCommunicator{mc: mc, hooks: hooks, stats: stats}
+}
+
+// Create runs the hooks and persists the Measurements they leave. Nothing is sent if no Measurements are left.
+func (hc *HookedCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	ctx := context.Background()
+	measurements := batch.Measurements
+	for i, hook := range hc.hooks {
+		out, err := hook(ctx, measurements)
+		if err != nil {
+			hc.stats.AddDropped(DropReasonHook, len(batch.Measurements))
+			return nil, fmt.Errorf("submit hook %d rejected the batch: %s", i+1, err)
+		}
+		measurements = out
+	}
+
+	if removed := len(batch.Measurements) - len(measurements); removed > 0 {
+		hc.stats.AddDropped(DropReasonHook, removed)
+	}
+	if len(measurements) == 0 {
+		return nil, nil
+	}
+	hooked := *batch
+	hooked.Measurements = measurements
+	return hc.mc.Create(&hooked)
+}
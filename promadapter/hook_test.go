@@ -0,0 +1,64 @@
+package promadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestHookedCommunicator(t *testing.T) {
+	batch := func() *appoptics.MeasurementsBatch {
+		return &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+			{Name: "tagged", Value: 1.0, Tags: map[string]string{"team": "payments"}},
+			{Name: "untagged", Value: 2.0},
+		}}
+	}
+	enrich := func(ctx context.Context, ms []appoptics.Measurement) ([]appoptics.Measurement, error) {
+		for i := range ms {
+			ms[i].Tags = map[string]string{"team": "platform", "region": "us-east-1"}
+		}
+		return ms, nil
+	}
+
+	t.Run("hooks are chained in order", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		stats := NewStats()
+		hc := NewHookedCommunicator(stub, stats, RequireTag("team"), enrich)
+
+		if _, err := hc.Create(batch()); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		sent := stub.batches[0].Measurements
+		if len(sent) != 1 || sent[0].Name != "tagged" || sent[0].Tags["region"] != "us-east-1" {
+			t.Errorf("expected only the tagged measurement, enriched, but got %v", sent)
+		}
+		if stats.Dropped()[DropReasonHook] != 1 {
+			t.Errorf("expected 1 measurement dropped by hooks but got %d", stats.Dropped()[DropReasonHook])
+		}
+	})
+
+	t.Run("an error rejects the batch", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		stats := NewStats()
+		var called bool
+		hc := NewHookedCommunicator(stub, stats, func(ctx context.Context, ms []appoptics.Measurement) ([]appoptics.Measurement, error) {
+			return nil, errors.New("no budget left")
+		}, func(ctx context.Context, ms []appoptics.Measurement) ([]appoptics.Measurement, error) {
+			called = true
+			return ms, nil
+		})
+
+		if _, err := hc.Create(batch()); err == nil {
+			t.Error("expected the batch to be rejected")
+		}
+		if called || len(stub.batches) != 0 {
+			t.Error("expected nothing to run or be sent after the rejection")
+		}
+		if stats.Dropped()[DropReasonHook] != 2 {
+			t.Errorf("expected 2 measurements dropped but got %d", stats.Dropped()[DropReasonHook])
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package promadapter
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Submission outcomes recorded by an InstrumentedCommunicator
+const (
+	OutcomeSuccess        = "success"
+	OutcomeRetryableError = "retryable_error"
+	OutcomePermanentError = "permanent_error"
+)
+
+// SubmissionOutcome labels the final outcome of a batch, once any retries are done
+type SubmissionOutcome struct {
+	// Outcome is OutcomeSuccess, OutcomeRetryableError or OutcomePermanentError
+	Outcome string
+	// StatusClass is the class of the response status, e.g. "4xx", or "none" if there was no response
+	StatusClass string
+}
+
+// newSubmissionOutcome classifies a batch that produced resp and err. Failures the RetryPolicy would retry are
+// retryable even though the retries ran out, telling an unavailable API apart from batches it will never accept.
+func newSubmissionOutcome(resp *http.Response, err error, policy RetryPolicy) SubmissionOutcome {
+	class := "none"
+	if resp != nil {
+		class = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	switch {
+	case err == nil:
+		return SubmissionOutcome{Outcome: OutcomeSuccess, StatusClass: class}
+	case policy.Retryable(resp, err):
+		return SubmissionOutcome{Outcome: OutcomeRetryableError, StatusClass: class}
+	}
+	return SubmissionOutcome{Outcome: OutcomePermanentError, StatusClass: class}
+}
+
+// InstrumentedCommunicator wraps a MeasurementsCommunicator, recording the outcome of every batch in Stats
+type InstrumentedCommunicator struct {
+	mc     appoptics.MeasurementsCommunicator
+	stats  *Stats
+	policy RetryPolicy
+	now    func() time.Time
+}
+
+// NewInstrumentedCommunicator returns an InstrumentedCommunicator sending through mc, classifying failures as
+// retryable as the DefaultRetryPolicy does
+func NewInstrumentedCommunicator(mc appoptics.MeasurementsCommunicator, stats *Stats) *InstrumentedCommunicator {
+	return &InstrumentedCommunicator{mc: mc, stats: stats, policy: DefaultRetryPolicy(), now: time.Now}
+}
+
+// SetRetryPolicy classifies failures as retryable as policy does, which should be the policy mc retries with
+func (ic *InstrumentedCommunicator) SetRetryPolicy(policy RetryPolicy) {
+	ic.policy = policy
+}
+
+// Create persists the batch and records it as submitted or dropped, along with the response. An empty batch is
+// neither sent, which would waste a request AppOptics may reject, nor recorded.
+func (ic *InstrumentedCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	if len(batch.Measurements) == 0 {
+		return nil, nil
+	}
+	timing := ic.stats.TimingEnabled()
+	var start time.Time
+	if timing {
+		start = ic.now()
+	}
+	resp, err := ic.mc.Create(batch)
+	if timing {
+		ic.stats.ObserveStage("submit", ic.now().Sub(start))
+	}
+	ic.stats.AddSubmissionOutcome(newSubmissionOutcome(resp, err, ic.policy))
+	if resp != nil {
+		ic.stats.SetLastResponse(resp.StatusCode, resp.Header.Get(RequestIDHeader))
+	}
+	if err != nil {
+		ic.stats.SetLastError(err)
+		ic.stats.AddErrors(1)
+		dropped := len(batch.Measurements)
+		if partial, ok := err.(*PartialSubmissionError); ok {
+			dropped = len(partial.Unsent)
+			ic.stats.AddSubmitted(len(batch.Measurements) - dropped)
+		}
+		ic.stats.AddDropped(DropReasonSubmissionFailed, dropped)
+		return resp, err
+	}
+
+	ic.stats.AddSubmitted(len(batch.Measurements))
+	ic.stats.SetLastSuccess(ic.now())
+	if oldest := oldestTime(batch.Measurements); oldest > 0 {
+		ic.stats.SetLag(ic.now().Sub(time.Unix(oldest, 0)))
+	}
+	return resp, err
+}
+
+// oldestTime returns the earliest Unix timestamp among the Measurements, or zero if none carry one
+func oldestTime(measurements []appoptics.Measurement) int64 {
+	var oldest int64
+	for _, m := range measurements {
+		if m.Time > 0 && (oldest == 0 || m.Time < oldest) {
+			oldest = m.Time
+		}
+	}
+	return oldest
+}
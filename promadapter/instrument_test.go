@@ -0,0 +1,83 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestInstrumentedCommunicator(t *testing.T) {
+	now := time.Unix(1000, 0)
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: metricNameFixture, Value: 1.0, Time: 990},
+		{Name: metricNameFixture, Value: 2.0, Time: 995},
+	}}
+
+	t.Run("success counts as submitted", func(t *testing.T) {
+		stats := NewStats()
+		ic := NewInstrumentedCommunicator(&stubCommunicator{statusCodes: []int{http.StatusAccepted}}, stats)
+		ic.now = func() time.Time { return now }
+
+		ic.Create(batch)
+
+		if stats.Submitted() != 2 {
+			t.Errorf("expected 2 submitted but got %d", stats.Submitted())
+		}
+		if !stats.LastSuccess().Equal(now) {
+			t.Errorf("expected the last success to be %s but got %s", now, stats.LastSuccess())
+		}
+		if stats.Lag() != 10*time.Second {
+			t.Errorf("expected lag of 10s but got %s", stats.Lag())
+		}
+	})
+
+	t.Run("failure counts as dropped", func(t *testing.T) {
+		stats := NewStats()
+		ic := NewInstrumentedCommunicator(&stubCommunicator{statusCodes: []int{http.StatusBadRequest}}, stats)
+
+		ic.Create(batch)
+
+		if stats.Submitted() != 0 {
+			t.Errorf("expected 0 submitted but got %d", stats.Submitted())
+		}
+		if stats.Errors() != 1 {
+			t.Errorf("expected 1 error but got %d", stats.Errors())
+		}
+		if stats.Dropped()[DropReasonSubmissionFailed] != 2 {
+			t.Errorf("expected 2 dropped but got %d", stats.Dropped()[DropReasonSubmissionFailed])
+		}
+		if status, _ := stats.LastResponse(); status != http.StatusBadRequest {
+			t.Errorf("expected the last status to be 400 but got %d", status)
+		}
+		if stats.LastError() != "Bad Request" {
+			t.Errorf("expected the last error to be recorded but got %q", stats.LastError())
+		}
+	})
+
+	t.Run("outcomes are labelled by class and status", func(t *testing.T) {
+		stats := NewStats()
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted, http.StatusBadRequest, http.StatusServiceUnavailable}}
+		ic := NewInstrumentedCommunicator(stub, stats)
+
+		ic.Create(batch)
+		ic.Create(batch)
+		ic.Create(batch)
+
+		expected := map[SubmissionOutcome]uint64{
+			{Outcome: OutcomeSuccess, StatusClass: "2xx"}:        1,
+			{Outcome: OutcomePermanentError, StatusClass: "4xx"}: 1,
+			{Outcome: OutcomeRetryableError, StatusClass: "5xx"}: 1,
+		}
+		outcomes := stats.SubmissionOutcomes()
+		if len(outcomes) != len(expected) {
+			t.Fatalf("expected %v but got %v", expected, outcomes)
+		}
+		for outcome, n := range expected {
+			if outcomes[outcome] != n {
+				t.Errorf("expected %d batches of %v but got %d", n, outcome, outcomes[outcome])
+			}
+		}
+	})
+}
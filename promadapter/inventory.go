@@ -0,0 +1,81 @@
+package promadapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Names of the gauges a MetricInventory submits
+const (
+	MetricFamiliesMetric        = "prometheus2appoptics.metric_families"
+	MeasurementsPerFamilyMetric = "prometheus2appoptics.measurements_per_family_avg"
+)
+
+// MetricInventory is a Stage that counts the distinct metric names passing through it and, at the end of every
+// interval, submits how many there were and how many Measurements each had on average to AppOptics, so that operators
+// can keep track of what the services behind the adapter send
+type MetricInventory struct {
+	mc       appoptics.MeasurementsCommunicator
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	families map[string]int
+}
+
+// NewMetricInventory returns a MetricInventory submitting its gauges through mc every interval
+func NewMetricInventory(mc appoptics.MeasurementsCommunicator, interval time.Duration) *MetricInventory {
+	return &MetricInventory{mc: mc, interval: interval, now: time.Now, families: make(map[string]int)}
+}
+
+// Process implements Stage. The Measurements are passed on unchanged.
+func (mi *MetricInventory) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	for _, m := range measurements {
+		mi.families[m.Name]++
+	}
+	return measurements
+}
+
+// Run submits the gauges at the end of every interval until stop is closed
+func (mi *MetricInventory) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(mi.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mi.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Flush submits the gauges for the metrics seen since the last Flush and starts counting anew
+func (mi *MetricInventory) Flush() {
+	mi.mu.Lock()
+	families := mi.families
+	mi.families = make(map[string]int, len(families))
+	mi.mu.Unlock()
+
+	var measurements int
+	for _, n := range families {
+		measurements += n
+	}
+	average := 0.0
+	if len(families) > 0 {
+		average = float64(measurements) / float64(len(families))
+	}
+
+	now := mi.now().Unix()
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: MetricFamiliesMetric, Value: float64(len(families)), Time: now},
+		{Name: MeasurementsPerFamilyMetric, Value: average, Time: now},
+	}}
+	if _, err := mi.mc.Create(batch); err != nil {
+		LogError("submitting metric inventory: %s\n", err)
+	}
+}
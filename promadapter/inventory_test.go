@@ -0,0 +1,41 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestMetricInventory(t *testing.T) {
+	stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted, http.StatusAccepted}}
+	mi := NewMetricInventory(stub, time.Minute)
+	mi.now = func() time.Time { return time.Unix(timestampFixture, 0) }
+
+	in := []appoptics.Measurement{{Name: "up"}, {Name: "up"}, {Name: "up"}, {Name: "node_load1"}}
+	if out := mi.Process(in); len(out) != len(in) {
+		t.Errorf("expected the measurements to be passed on but got %d", len(out))
+	}
+
+	expect := func(families, average float64) {
+		if len(stub.batches) != 1 || len(stub.batches[0].Measurements) != 2 {
+			t.Fatalf("expected one batch of two gauges but got %+v", stub.batches)
+		}
+		ms := stub.batches[0].Measurements
+		if ms[0].Name != MetricFamiliesMetric || ms[0].Value != families || ms[0].Time != timestampFixture {
+			t.Errorf("expected %v metric families but got %+v", families, ms[0])
+		}
+		if ms[1].Name != MeasurementsPerFamilyMetric || ms[1].Value != average {
+			t.Errorf("expected %v measurements per family but got %+v", average, ms[1])
+		}
+		stub.batches = nil
+	}
+
+	mi.Flush()
+	expect(2, 2)
+
+	// counting starts anew after every flush
+	mi.Flush()
+	expect(0, 0)
+}
@@ -0,0 +1,256 @@
+package promadapter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where a pod finds the credentials of its service account
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// secretWatchRetryDelay is how long a SecretWatcher waits before watching again after the watch ends or fails
+const secretWatchRetryDelay = 5 * time.Second
+
+// errSecretNotFound is returned when the Secret does not exist
+var errSecretNotFound = errors.New("secret not found")
+
+// ScrapeCredentials are the credentials a scrape is authenticated with, taken from the username and password or
+// token fields of a Kubernetes Secret
+type ScrapeCredentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// kubernetesSecret is the part of a Kubernetes Secret object the adapter reads. The API base64 encodes the data,
+// which decoding into []byte undoes.
+type kubernetesSecret struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string][]byte `json:"data"`
+}
+
+// credentials returns the scrape credentials in the Secret
+func (s *kubernetesSecret) credentials() ScrapeCredentials {
+	return ScrapeCredentials{
+		Username: string(s.Data["username"]),
+		Password: string(s.Data["password"]),
+		Token:    strings.TrimSpace(string(s.Data["token"])),
+	}
+}
+
+// KubernetesClient reads Secrets through the Kubernetes API with the credentials of the pod's service account. It
+// speaks to the REST API directly rather than through client-go, which would pull dozens of packages into the build
+// for two requests.
+type KubernetesClient struct {
+	url        string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewInClusterKubernetesClient returns a KubernetesClient for the cluster the adapter runs in, as described by the
+// environment and service account Kubernetes gives every pod
+func NewInClusterKubernetesClient() (*KubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the service account CA: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", serviceAccountCAFile)
+	}
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return NewKubernetesClient("https://"+net.JoinHostPort(host, port), serviceAccountTokenFile, &http.Client{Transport: transport}), nil
+}
+
+// NewKubernetesClient returns a KubernetesClient for the API server at apiURL, authenticating with the bearer token
+// in tokenFile, which is read again for every request as service account tokens are rotated
+func NewKubernetesClient(apiURL, tokenFile string, httpClient *http.Client) *KubernetesClient {
+	return &KubernetesClient{url: strings.TrimRight(apiURL, "/"), tokenFile: tokenFile, httpClient: httpClient}
+}
+
+// secretsURL returns the URL of the Secrets of the namespace
+func (kc *KubernetesClient) secretsURL(namespace string) string {
+	return kc.url + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets"
+}
+
+// get sends a GET request for endpoint, returning the response if it is a 200
+func (kc *KubernetesClient) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ioutil.ReadFile(kc.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the service account token: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := kc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, responseError("Kubernetes API", resp, msg)
+	}
+	return resp, nil
+}
+
+// getSecret returns the Secret, or errSecretNotFound
+func (kc *KubernetesClient) getSecret(ctx context.Context, namespace, name string) (*kubernetesSecret, error) {
+	resp, err := kc.get(ctx, kc.secretsURL(namespace)+"/"+url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var secret kubernetesSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// SecretWatcher keeps the scrape credentials of a Kubernetes Secret current, watching the Secret for updates so
+// that rotated credentials are used without a restart
+type SecretWatcher struct {
+	kc        *KubernetesClient
+	namespace string
+	name      string
+
+	mu              sync.RWMutex
+	credentials     ScrapeCredentials
+	resourceVersion string
+}
+
+// NewSecretWatcher returns a SecretWatcher for the Secret, reading it once. A Secret that does not exist is logged
+// and leaves the credentials empty, so scrapes go unauthenticated until it is created.
+func NewSecretWatcher(kc *KubernetesClient, namespace, name string) (*SecretWatcher, error) {
+	sw := &SecretWatcher{kc: kc, namespace: namespace, name: name}
+	secret, err := kc.getSecret(context.Background(), namespace, name)
+	switch {
+	case err == errSecretNotFound:
+		log.Printf("WARNING: secret %s/%s was not found, scraping without authentication\n", namespace, name)
+	case err != nil:
+		return nil, fmt.Errorf("reading secret %s/%s: %s", namespace, name, err)
+	default:
+		sw.update(secret)
+	}
+	return sw, nil
+}
+
+// Credentials returns the current credentials of the Secret
+func (sw *SecretWatcher) Credentials() ScrapeCredentials {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+	return sw.credentials
+}
+
+func (sw *SecretWatcher) update(secret *kubernetesSecret) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if secret == nil {
+		sw.credentials = ScrapeCredentials{}
+		return
+	}
+	sw.credentials = secret.credentials()
+	sw.resourceVersion = secret.Metadata.ResourceVersion
+}
+
+// Run watches the Secret, updating the credentials whenever it changes, until stop is closed. A watch that ends or
+// fails is started again after a delay.
+func (sw *SecretWatcher) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		if err := sw.watch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("watching secret %s/%s: %s\n", sw.namespace, sw.name, err)
+		}
+		select {
+		case <-time.After(secretWatchRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watch follows the watch events of the Secret until the API server ends the watch
+func (sw *SecretWatcher) watch(ctx context.Context) error {
+	sw.mu.RLock()
+	params := url.Values{
+		"watch":         {"true"},
+		"fieldSelector": {"metadata.name=" + sw.name},
+	}
+	if sw.resourceVersion != "" {
+		params.Set("resourceVersion", sw.resourceVersion)
+	}
+	sw.mu.RUnlock()
+
+	resp, err := sw.kc.get(ctx, sw.kc.secretsURL(sw.namespace)+"?"+params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var secret kubernetesSecret
+			if err := json.Unmarshal(event.Object, &secret); err != nil {
+				return err
+			}
+			sw.update(&secret)
+			log.Printf("scrape credentials updated from secret %s/%s\n", sw.namespace, sw.name)
+		case "DELETED":
+			sw.update(nil)
+			log.Printf("WARNING: secret %s/%s was deleted, scraping without authentication\n", sw.namespace, sw.name)
+		case "ERROR":
+			// most likely the resource version is too old, so the next watch starts from the current one
+			sw.mu.Lock()
+			sw.resourceVersion = ""
+			sw.mu.Unlock()
+			return fmt.Errorf("watch error: %s", event.Object)
+		}
+	}
+}
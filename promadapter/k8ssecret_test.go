@@ -0,0 +1,82 @@
+package promadapter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8ssecret")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("sa-token\n"), 0600)
+
+	rotated := make(chan struct{})
+	kubernetes := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			t.Errorf("expected the service account token but got %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/monitoring/secrets/prometheus-auth":
+			// "user" and "pass" base64 encoded
+			fmt.Fprint(w, `{"metadata":{"resourceVersion":"1"},"data":{"username":"dXNlcg==","password":"cGFzcw=="}}`)
+		case r.URL.Path == "/api/v1/namespaces/monitoring/secrets" && r.URL.Query().Get("watch") == "true":
+			if r.URL.Query().Get("fieldSelector") != "metadata.name=prometheus-auth" || r.URL.Query().Get("resourceVersion") != "1" {
+				t.Errorf("expected a watch of the secret from its version but got %q", r.URL.RawQuery)
+			}
+			// "rotated" base64 encoded
+			fmt.Fprint(w, `{"type":"MODIFIED","object":{"metadata":{"resourceVersion":"2"},"data":{"token":"cm90YXRlZA=="}}}`+"\n")
+			w.(http.Flusher).Flush()
+			close(rotated)
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer kubernetes.Close()
+	kc := NewKubernetesClient(kubernetes.URL, tokenFile, kubernetes.Client())
+
+	t.Run("credentials come from the secret and follow its updates", func(t *testing.T) {
+		sw, err := NewSecretWatcher(kc, "monitoring", "prometheus-auth")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if c := sw.Credentials(); c.Username != "user" || c.Password != "pass" || c.Token != "" {
+			t.Errorf("expected basic auth credentials from the secret but got %+v", c)
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go sw.Run(stop)
+		select {
+		case <-rotated:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the secret to be watched")
+		}
+		for deadline := time.Now().Add(5 * time.Second); sw.Credentials().Token == "" && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if c := sw.Credentials(); c.Token != "rotated" {
+			t.Errorf("expected the rotated token but got %+v", c)
+		}
+	})
+
+	t.Run("a missing secret leaves the credentials empty", func(t *testing.T) {
+		sw, err := NewSecretWatcher(kc, "monitoring", "missing")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if c := sw.Credentials(); c != (ScrapeCredentials{}) {
+			t.Errorf("expected no credentials but got %+v", c)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package promadapter
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// KeepAliveCommunicator wraps a MeasurementsCommunicator, warming the connection to AppOptics with a ping at startup
+// and pinging again whenever no batch has been sent for an interval, so the first submission after a quiet period
+// does not pay for a new TLS handshake
+type KeepAliveCommunicator struct {
+	mc       appoptics.MeasurementsCommunicator
+	ping     func() error
+	interval time.Duration
+	now      func() time.Time
+	last     int64
+}
+
+// NewKeepAliveCommunicator returns a KeepAliveCommunicator sending through mc. ping must make an authenticated request
+// over the same connections mc uses.
+func NewKeepAliveCommunicator(mc appoptics.MeasurementsCommunicator, ping func() error, interval time.Duration) *KeepAliveCommunicator {
+	return &KeepAliveCommunicator{mc: mc, ping: ping, interval: interval, now: time.Now}
+}
+
+// Create persists the batch, which also counts as activity on the connection
+func (kc *KeepAliveCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	kc.touch()
+	return kc.mc.Create(batch)
+}
+
+// Run pings once, then checks every interval whether the connection has been idle until stop is closed
+func (kc *KeepAliveCommunicator) Run(stop <-chan struct{}) {
+	kc.Ping()
+
+	ticker := time.NewTicker(kc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			kc.Tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Tick pings if nothing has been sent for at least the interval
+func (kc *KeepAliveCommunicator) Tick() {
+	last := time.Unix(0, atomic.LoadInt64(&kc.last))
+	if kc.now().Sub(last) >= kc.interval {
+		kc.Ping()
+	}
+}
+
+// Ping makes a request to keep the connection open, logging a failure rather than returning it
+func (kc *KeepAliveCommunicator) Ping() {
+	kc.touch()
+	if err := kc.ping(); err != nil {
+		LogError("keep-alive ping failed: %s\n", err)
+	}
+}
+
+func (kc *KeepAliveCommunicator) touch() {
+	atomic.StoreInt64(&kc.last, kc.now().UnixNano())
+}
@@ -0,0 +1,48 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestKeepAliveCommunicator(t *testing.T) {
+	clock := time.Unix(1500000000, 0)
+	var pings int
+	kc := NewKeepAliveCommunicator(
+		&stubCommunicator{statusCodes: []int{http.StatusAccepted}},
+		func() error { pings++; return nil },
+		time.Minute,
+	)
+	kc.now = func() time.Time { return clock }
+
+	stop := make(chan struct{})
+	close(stop)
+	kc.Run(stop)
+	if pings != 1 {
+		t.Fatalf("expected a ping at startup but got %d", pings)
+	}
+
+	clock = clock.Add(30 * time.Second)
+	kc.Tick()
+	if pings != 1 {
+		t.Errorf("expected no ping before the interval but got %d", pings)
+	}
+
+	clock = clock.Add(30 * time.Second)
+	kc.Tick()
+	if pings != 2 {
+		t.Errorf("expected a ping once idle for the interval but got %d", pings)
+	}
+
+	// a submission keeps the connection warm on its own
+	clock = clock.Add(50 * time.Second)
+	kc.Create(&appoptics.MeasurementsBatch{})
+	clock = clock.Add(50 * time.Second)
+	kc.Tick()
+	if pings != 2 {
+		t.Errorf("expected no ping after recent activity but got %d", pings)
+	}
+}
@@ -0,0 +1,57 @@
+package promadapter
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// LatencyAlertFunc is called with a metric whose Measurements reached AppOptics later than a threshold after they
+// were sampled, and the latency of its oldest Measurement
+type LatencyAlertFunc func(metricName string, latency time.Duration)
+
+// LatencyAlertCommunicator wraps a MeasurementsCommunicator, calling a LatencyAlertFunc for every metric of a
+// successfully submitted batch whose latency exceeds a threshold, so that users with freshness requirements learn when
+// they are not being met
+type LatencyAlertCommunicator struct {
+	mc        appoptics.MeasurementsCommunicator
+	threshold time.Duration
+	alert     LatencyAlertFunc
+	now       func() time.Time
+}
+
+// NewLatencyAlertCommunicator returns a LatencyAlertCommunicator sending through mc. alert is called on the goroutine
+// submitting the batch, once per late metric and batch, in order of metric name.
+func NewLatencyAlertCommunicator(mc appoptics.MeasurementsCommunicator, threshold time.Duration, alert LatencyAlertFunc) *LatencyAlertCommunicator {
+	return &LatencyAlertCommunicator{mc: mc, threshold: threshold, alert: alert, now: time.Now}
+}
+
+// Create implements appoptics.MeasurementsCommunicator
+func (lc *LatencyAlertCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	resp, err := lc.mc.Create(batch)
+	if err != nil {
+		return resp, err
+	}
+
+	now := lc.now()
+	late := make(map[string]time.Duration)
+	for _, m := range batch.Measurements {
+		if m.Time <= 0 {
+			continue
+		}
+		if latency := now.Sub(time.Unix(m.Time, 0)); latency > lc.threshold && latency > late[m.Name] {
+			late[m.Name] = latency
+		}
+	}
+	names := make([]string, 0, len(late))
+	for name := range late {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lc.alert(name, late[name])
+	}
+	return resp, err
+}
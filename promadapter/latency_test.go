@@ -0,0 +1,51 @@
+package promadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestLatencyAlertCommunicator(t *testing.T) {
+	now := time.Unix(timestampFixture, 0)
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "node_load1", Value: 1.0, Time: timestampFixture - 10},
+		{Name: "node_load1", Value: 1.0, Time: timestampFixture - 90},
+		{Name: "up", Value: 1.0, Time: timestampFixture - 120},
+		{Name: "fresh", Value: 1.0, Time: timestampFixture - 30},
+		{Name: "untimed", Value: 1.0},
+	}}
+
+	var alerts []string
+	var latencies []time.Duration
+	alert := func(name string, latency time.Duration) {
+		alerts = append(alerts, name)
+		latencies = append(latencies, latency)
+	}
+
+	t.Run("late metrics are reported", func(t *testing.T) {
+		lc := NewLatencyAlertCommunicator(&stubCommunicator{statusCodes: []int{http.StatusAccepted}}, time.Minute, alert)
+		lc.now = func() time.Time { return now }
+		if _, err := lc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(alerts) != 2 || alerts[0] != "node_load1" || alerts[1] != "up" {
+			t.Fatalf("expected node_load1 and up to be reported but got %v", alerts)
+		}
+		if latencies[0] != 90*time.Second || latencies[1] != 2*time.Minute {
+			t.Errorf("expected the latency of each metric's oldest measurement but got %v", latencies)
+		}
+	})
+
+	t.Run("failed batches are not reported", func(t *testing.T) {
+		alerts = nil
+		lc := NewLatencyAlertCommunicator(&stubCommunicator{statusCodes: []int{http.StatusInternalServerError}}, time.Minute, alert)
+		lc.now = func() time.Time { return now }
+		lc.Create(batch)
+		if len(alerts) != 0 {
+			t.Errorf("expected no alerts but got %v", alerts)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package promadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+	"golang.org/x/time/rate"
+)
+
+// LoadTestMetricPrefix starts the name of every metric a LoadGenerator generates
+const LoadTestMetricPrefix = "loadtest."
+
+// LoadTestConfig describes the synthetic load RunLoadTest submits
+type LoadTestConfig struct {
+	// MetricCount is the number of distinct metric names
+	MetricCount int
+	// TagsPerMetric is the number of tags of every series
+	TagsPerMetric int
+	// SeriesPerMetric is the number of distinct tag sets of every metric
+	SeriesPerMetric int
+	// SubmissionRate is the number of Measurements submitted per second
+	SubmissionRate float64
+	// Duration is how long Measurements are submitted for
+	Duration time.Duration
+	// Seed makes the generated values reproducible
+	Seed int64
+}
+
+// Validate returns an error if the LoadTestConfig cannot generate any load
+func (cfg LoadTestConfig) Validate() error {
+	switch {
+	case cfg.MetricCount < 1:
+		return errors.New("a load test needs at least one metric")
+	case cfg.SeriesPerMetric < 1:
+		return errors.New("a load test needs at least one series per metric")
+	case cfg.TagsPerMetric < 0:
+		return errors.New("a load test cannot have a negative number of tags")
+	case cfg.SubmissionRate <= 0:
+		return errors.New("a load test needs a positive submission rate")
+	case cfg.Duration <= 0:
+		return errors.New("a load test needs a positive duration")
+	}
+	return nil
+}
+
+// LoadGenerator generates synthetic Measurements, cycling through every series of a LoadTestConfig with values drawn
+// from a seeded random source, so that runs with the same seed submit the same values
+type LoadGenerator struct {
+	series []appoptics.Measurement
+	next   int
+	rand   *rand.Rand
+}
+
+// NewLoadGenerator returns a LoadGenerator for the series cfg describes
+func NewLoadGenerator(cfg LoadTestConfig) *LoadGenerator {
+	series := make([]appoptics.Measurement, 0, cfg.MetricCount*cfg.SeriesPerMetric)
+	for m := 0; m < cfg.MetricCount; m++ {
+		name := LoadTestMetricPrefix + "metric_" + strconv.Itoa(m)
+		for s := 0; s < cfg.SeriesPerMetric; s++ {
+			tags := make(map[string]string, cfg.TagsPerMetric)
+			for t := 0; t < cfg.TagsPerMetric; t++ {
+				// the first tag tells the series of a metric apart, the others only add weight
+				value := "value_" + strconv.Itoa(t)
+				if t == 0 {
+					value = "series_" + strconv.Itoa(s)
+				}
+				tags["tag_"+strconv.Itoa(t)] = value
+			}
+			series = append(series, appoptics.Measurement{Name: name, Tags: tags})
+		}
+	}
+	return &LoadGenerator{series: series, rand: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Next returns the next n Measurements, timed at now
+func (lg *LoadGenerator) Next(n int, now time.Time) []appoptics.Measurement {
+	measurements := make([]appoptics.Measurement, n)
+	for i := range measurements {
+		m := lg.series[lg.next]
+		m.Value = lg.rand.Float64() * 100
+		m.Time = now.Unix()
+		measurements[i] = m
+		lg.next = (lg.next + 1) % len(lg.series)
+	}
+	return measurements
+}
+
+// LoadTestResult is what a load test submitted
+type LoadTestResult struct {
+	Submitted int
+	Failed    int
+	Elapsed   time.Duration
+}
+
+// RunLoadTest submits Measurements from a LoadGenerator to sink at the configured rate, in chunks of at most
+// batchSize, until the configured duration has passed or ctx is done. It takes the place of Prometheus as the source
+// of Measurements for capacity testing the adapter and an AppOptics account.
+func RunLoadTest(ctx context.Context, cfg LoadTestConfig, batchSize int, sink Sink) (LoadTestResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return LoadTestResult{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	chunk := batchSize
+	if r := int(cfg.SubmissionRate); r < chunk {
+		chunk = r
+	}
+	if chunk < 1 {
+		chunk = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(cfg.SubmissionRate), chunk)
+	lg := NewLoadGenerator(cfg)
+
+	var result LoadTestResult
+	start := time.Now()
+	for {
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			break
+		}
+		if err := sink.Submit(ctx, lg.Next(chunk, time.Now())); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			result.Failed += chunk
+			continue
+		}
+		result.Submitted += chunk
+	}
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// String summarizes the LoadTestResult for logging
+func (r LoadTestResult) String() string {
+	return fmt.Sprintf("submitted %d measurements (%d failed) in %s, %.1f per second",
+		r.Submitted, r.Failed, r.Elapsed, float64(r.Submitted)/r.Elapsed.Seconds())
+}
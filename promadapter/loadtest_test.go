@@ -0,0 +1,54 @@
+package promadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadGenerator(t *testing.T) {
+	cfg := LoadTestConfig{MetricCount: 3, TagsPerMetric: 2, SeriesPerMetric: 4, SubmissionRate: 1000, Duration: time.Second, Seed: 42}
+	now := time.Unix(timestampFixture, 0)
+
+	ms := NewLoadGenerator(cfg).Next(24, now)
+	series := make(map[string]bool)
+	for _, m := range ms {
+		series[seriesKey(m)] = true
+		if len(m.Tags) != 2 || m.Time != timestampFixture {
+			t.Errorf("expected 2 tags at %d but got %+v", timestampFixture, m)
+		}
+	}
+	if len(series) != 12 {
+		t.Errorf("expected every one of the 12 series twice but got %d distinct series", len(series))
+	}
+
+	if again := NewLoadGenerator(cfg).Next(24, now); !reflect.DeepEqual(ms, again) {
+		t.Error("expected the same seed to generate the same measurements")
+	}
+}
+
+func TestRunLoadTest(t *testing.T) {
+	sink := &fakeSink{}
+	cfg := LoadTestConfig{MetricCount: 2, TagsPerMetric: 1, SeriesPerMetric: 5, SubmissionRate: 200, Duration: 500 * time.Millisecond}
+	result, err := RunLoadTest(context.Background(), cfg, 50, sink)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	var submitted int
+	for _, ms := range sink.submitted {
+		if len(ms) > 50 {
+			t.Errorf("expected chunks of at most 50 measurements but got %d", len(ms))
+		}
+		submitted += len(ms)
+	}
+	// the limiter starts with a full burst, then allows 200 per second
+	if submitted != result.Submitted || submitted < 100 || submitted > 200 {
+		t.Errorf("expected about 150 measurements in half a second at 200 per second but got %d (%+v)", submitted, result)
+	}
+
+	if _, err := RunLoadTest(context.Background(), LoadTestConfig{}, 50, sink); err == nil {
+		t.Error("expected an error for an empty configuration")
+	}
+}
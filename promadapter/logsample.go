@@ -0,0 +1,120 @@
+package promadapter
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLogSamplerKeys is how many distinct lines a LogSampler keeps track of
+const defaultLogSamplerKeys = 1000
+
+// errorLogf logs the errors that repeat for every batch while AppOptics is unavailable
+var errorLogf = log.Printf
+
+// SetErrorLog routes the errors that repeat for every batch through logf, e.g. the Printf of a LogSampler. It must be
+// called before the adapter starts submitting.
+func SetErrorLog(logf func(format string, v ...interface{})) {
+	errorLogf = logf
+}
+
+// LogError logs an error that may repeat for every batch through the error log set with SetErrorLog
+func LogError(format string, v ...interface{}) {
+	errorLogf(format, v...)
+}
+
+// logSample is the sampling state of one distinct line
+type logSample struct {
+	seen       uint64
+	suppressed uint64
+	last       time.Time
+}
+
+// LogSamplerOption configures a LogSampler
+type LogSamplerOption func(*LogSampler)
+
+// WithLogSampleRate logs 1 in n of each distinct line, starting with the first
+func WithLogSampleRate(n int) LogSamplerOption {
+	return func(ls *LogSampler) {
+		ls.rate = n
+	}
+}
+
+// WithLogSampleInterval logs the first of each distinct line and then at most one every interval. It takes precedence
+// over WithLogSampleRate.
+func WithLogSampleInterval(interval time.Duration) LogSamplerOption {
+	return func(ls *LogSampler) {
+		ls.interval = interval
+	}
+}
+
+// LogSampler logs only a sample of identical lines, so that an outage failing every batch does not flood the logs.
+// A logged line tells how many identical ones were suppressed since the last. It is safe for concurrent use.
+type LogSampler struct {
+	logf     func(format string, v ...interface{})
+	stats    *Stats
+	rate     int
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	samples *lru
+}
+
+// NewLogSampler returns a LogSampler writing through log.Printf and counting suppressed lines in stats. Without
+// options every line is logged.
+func NewLogSampler(stats *Stats, opts ...LogSamplerOption) *LogSampler {
+	ls := &LogSampler{
+		logf:    log.Printf,
+		stats:   stats,
+		rate:    1,
+		now:     time.Now,
+		samples: newLRU(defaultLogSamplerKeys, nil),
+	}
+	for _, opt := range opts {
+		opt(ls)
+	}
+	return ls
+}
+
+// Printf formats a line like log.Printf and logs it if it is sampled
+func (ls *LogSampler) Printf(format string, v ...interface{}) {
+	line := fmt.Sprintf(format, v...)
+
+	ls.mu.Lock()
+	now := ls.now()
+	var sample *logSample
+	if s, ok := ls.samples.Get(line); ok {
+		sample = s.(*logSample)
+	} else {
+		sample = &logSample{}
+		ls.samples.Add(line, sample)
+	}
+	sampled := true
+	switch {
+	case ls.interval > 0:
+		sampled = sample.seen == 0 || now.Sub(sample.last) >= ls.interval
+	case ls.rate > 1:
+		sampled = sample.seen%uint64(ls.rate) == 0
+	}
+	sample.seen++
+	suppressed := sample.suppressed
+	if sampled {
+		sample.suppressed = 0
+		sample.last = now
+	} else {
+		sample.suppressed++
+	}
+	ls.mu.Unlock()
+
+	if !sampled {
+		ls.stats.AddLogsSuppressed(1)
+		return
+	}
+	if suppressed > 0 {
+		line = fmt.Sprintf("%s (%d identical lines suppressed)\n", strings.TrimSuffix(line, "\n"), suppressed)
+	}
+	ls.logf("%s", line)
+}
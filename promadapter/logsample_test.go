@@ -0,0 +1,64 @@
+package promadapter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLogSampler(t *testing.T) {
+	newSampler := func(opts ...LogSamplerOption) (*LogSampler, *Stats, *[]string) {
+		var lines []string
+		stats := NewStats()
+		ls := NewLogSampler(stats, opts...)
+		ls.logf = func(format string, v ...interface{}) { lines = append(lines, fmt.Sprintf(format, v...)) }
+		return ls, stats, &lines
+	}
+
+	t.Run("1 in N identical lines is logged", func(t *testing.T) {
+		ls, stats, lines := newSampler(WithLogSampleRate(3))
+		for i := 0; i < 7; i++ {
+			ls.Printf("retrying batch after attempt %d failed: %s\n", 1, "503 Service Unavailable")
+		}
+		if len(*lines) != 3 {
+			t.Fatalf("expected 3 of 7 lines to be logged but got %q", *lines)
+		}
+		if (*lines)[1] != "retrying batch after attempt 1 failed: 503 Service Unavailable (2 identical lines suppressed)\n" {
+			t.Errorf("expected the suppressed lines to be counted but got %q", (*lines)[1])
+		}
+		if stats.LogsSuppressed() != 4 {
+			t.Errorf("expected 4 suppressed lines but got %d", stats.LogsSuppressed())
+		}
+	})
+
+	t.Run("distinct lines are sampled apart", func(t *testing.T) {
+		ls, _, lines := newSampler(WithLogSampleRate(10))
+		ls.Printf("submitting health metric %s: %s\n", "up", "timeout")
+		ls.Printf("submitting metric inventory: %s\n", "timeout")
+		if len(*lines) != 2 {
+			t.Errorf("expected the first of each line to be logged but got %q", *lines)
+		}
+	})
+
+	t.Run("identical lines are logged at most once per interval", func(t *testing.T) {
+		ls, stats, lines := newSampler(WithLogSampleRate(2), WithLogSampleInterval(time.Minute))
+		now := time.Unix(timestampFixture, 0)
+		ls.now = func() time.Time { return now }
+		for i := 0; i < 5; i++ {
+			ls.Printf("keep-alive ping failed: %s\n", "connection refused")
+			now = now.Add(20 * time.Second)
+		}
+		if len(*lines) != 2 || stats.LogsSuppressed() != 3 {
+			t.Errorf("expected the lines at 0s and 60s to be logged but got %q", *lines)
+		}
+	})
+
+	t.Run("every line is logged by default", func(t *testing.T) {
+		ls, stats, lines := newSampler()
+		ls.Printf("persisting batch of %d measurements: %s\n", 10, "error")
+		ls.Printf("persisting batch of %d measurements: %s\n", 10, "error")
+		if len(*lines) != 2 || stats.LogsSuppressed() != 0 {
+			t.Errorf("expected both lines to be logged but got %q", *lines)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/common/model"
+)
+
+// FieldMapping maps fields of JSON log lines to the metric names their numeric values are sent as. Nested fields are
+// addressed with dots, e.g. "response.duration_ms".
+type FieldMapping map[string]string
+
+// ParseFieldMapping builds a FieldMapping from "field=metric" pairs
+func ParseFieldMapping(pairs []string) (FieldMapping, error) {
+	fm := make(FieldMapping, len(pairs))
+	for _, pair := range pairs {
+		i := strings.LastIndex(pair, "=")
+		if i < 1 || i == len(pair)-1 {
+			return nil, fmt.Errorf("expected field=metric but got %q", pair)
+		}
+		fm[pair[:i]] = pair[i+1:]
+	}
+	return fm, nil
+}
+
+// lokiTailResponse is a message on the Loki tail WebSocket
+type lokiTailResponse struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// LokiSource tails a Grafana Loki log stream and turns numeric fields of its JSON log lines into samples fed through
+// a Pipeline, bridging log-based metrics to AppOptics. The stream labels become tags.
+type LokiSource struct {
+	url    string
+	fields FieldMapping
+	dialer *websocket.Dialer
+	sleep  func(time.Duration)
+}
+
+// NewLokiSource returns a LokiSource tailing the streams matching the LogQL query from the Loki server at baseURL
+func NewLokiSource(baseURL, query string, fields FieldMapping, dialer *websocket.Dialer) (*LokiSource, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/") + "/loki/api/v1/tail")
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.RawQuery = url.Values{"query": {query}}.Encode()
+
+	return &LokiSource{url: u.String(), fields: fields, dialer: dialer, sleep: time.Sleep}, nil
+}
+
+// Run tails the stream, processes the extracted samples with pipeline and sends the result to sink until stop is
+// closed, reconnecting with backoff whenever the connection fails
+func (ls *LokiSource) Run(pipeline *Pipeline, sink chan<- []appoptics.Measurement, stop <-chan struct{}) {
+	backoff := DefaultRetryPolicy().Backoff
+	var attempt int
+	for {
+		err := ls.Tail(func(samples model.Samples) {
+			if measurements := pipeline.ProcessSamples(samples); len(measurements) > 0 {
+				sink <- measurements
+			}
+			attempt = 0
+		}, stop)
+		if err == nil {
+			return
+		}
+
+		attempt++
+		delay := backoff.NextDelay(attempt, nil)
+		log.Printf("tailing Loki failed, reconnecting in %s: %s\n", delay, err)
+		ls.sleep(delay)
+	}
+}
+
+// Tail connects to Loki and hands the samples extracted from every message to handle. It returns nil once stop is
+// closed and an error if the connection fails.
+func (ls *LokiSource) Tail(handle func(model.Samples), stop <-chan struct{}) error {
+	conn, _, err := ls.dialer.Dial(ls.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		samples, err := ls.extract(msg)
+		if err != nil {
+			log.Printf("skipping Loki message: %s\n", err)
+			continue
+		}
+		if len(samples) > 0 {
+			handle(samples)
+		}
+	}
+}
+
+// extract returns a sample for every mapped numeric field of every JSON log line in a tail message. Lines that are
+// not JSON objects and fields that are missing or not numeric are skipped.
+func (ls *LokiSource) extract(msg []byte) (model.Samples, error) {
+	var resp lokiTailResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return nil, err
+	}
+
+	var samples model.Samples
+	for _, stream := range resp.Streams {
+		for _, entry := range stream.Values {
+			ns, err := strconv.ParseInt(entry[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			var line map[string]interface{}
+			if err := json.Unmarshal([]byte(entry[1]), &line); err != nil {
+				continue
+			}
+
+			for field, name := range ls.fields {
+				value, ok := numericField(line, field)
+				if !ok {
+					continue
+				}
+				metric := make(model.Metric, len(stream.Stream)+1)
+				for k, v := range stream.Stream {
+					metric[model.LabelName(k)] = model.LabelValue(v)
+				}
+				metric[model.MetricNameLabel] = model.LabelValue(name)
+				samples = append(samples, &model.Sample{
+					Metric:    metric,
+					Value:     model.SampleValue(value),
+					Timestamp: model.TimeFromUnixNano(ns),
+				})
+			}
+		}
+	}
+	return samples, nil
+}
+
+// numericField returns the number at the dotted path in a decoded JSON object, accepting numeric strings
+func numericField(obj map[string]interface{}, path string) (float64, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := obj[part].(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		obj = next
+	}
+
+	switch v := obj[parts[len(parts)-1]].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package promadapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/common/model"
+)
+
+const lokiMessageFixture = `{"streams":[{"stream":{"app":"checkout"},"values":[
+	["1500000000000000000","{\"duration_ms\":42.5,\"response\":{\"bytes\":\"512\"},\"path\":\"/cart\"}"],
+	["1500000001000000000","not json"],
+	["1500000002000000000","{\"duration_ms\":\"slow\"}"]
+]}]}`
+
+func TestLokiSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/tail" || r.URL.Query().Get("query") != `{app="checkout"}` {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(lokiMessageFixture))
+		// keep the connection open until the client goes away
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	fields, err := ParseFieldMapping([]string{"duration_ms=checkout_duration_ms", "response.bytes=checkout_response_bytes"})
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	ls, err := NewLokiSource(server.URL, `{app="checkout"}`, fields, websocket.DefaultDialer)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if !strings.HasPrefix(ls.url, "ws://") {
+		t.Errorf("expected a WebSocket URL but got %s", ls.url)
+	}
+
+	received := make(chan model.Samples, 1)
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() { errs <- ls.Tail(func(s model.Samples) { received <- s }, stop) }()
+
+	var samples model.Samples
+	select {
+	case samples = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected samples from the tail")
+	}
+	close(stop)
+	if err := <-errs; err != nil {
+		t.Errorf("expected Tail to return cleanly once stopped but got %s", err)
+	}
+
+	values := make(map[string]float64)
+	for _, s := range samples {
+		values[string(s.Metric[model.MetricNameLabel])] = float64(s.Value)
+		if s.Metric["app"] != "checkout" {
+			t.Errorf("expected the stream labels on every sample but got %s", s.Metric)
+		}
+		if s.Timestamp != model.Time(1500000000000) {
+			t.Errorf("expected the entry timestamp but got %d", s.Timestamp)
+		}
+	}
+	if len(samples) != 2 || values["checkout_duration_ms"] != 42.5 || values["checkout_response_bytes"] != 512 {
+		t.Errorf("unexpected samples %v", samples)
+	}
+}
+
+func TestParseFieldMapping(t *testing.T) {
+	if _, err := ParseFieldMapping([]string{"duration_ms"}); err == nil {
+		t.Error("expected an error for a missing metric name")
+	}
+}
@@ -0,0 +1,75 @@
+package promadapter
+
+import "container/list"
+
+// DefaultMaxTrackedSeries bounds how many series the adapter keeps per-series state for
+const DefaultMaxTrackedSeries = 100000
+
+// lru is a size-bounded map discarding its least recently used entries first. It is not safe for concurrent use.
+type lru struct {
+	max     int
+	ll      *list.List
+	items   map[string]*list.Element
+	onEvict func(key string, value interface{})
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+// newLRU returns an lru holding at most max entries. onEvict, if not nil, is called for every entry pushed out.
+func newLRU(max int, onEvict func(key string, value interface{})) *lru {
+	return &lru{
+		max:     max,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *lru) Get(key string) (interface{}, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+// Add stores value under key, evicting the least recently used entry if the lru is full
+func (c *lru) Add(key string, value interface{}) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*lruEntry).value = value
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	if c.max > 0 && c.ll.Len() > c.max {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove deletes the entry stored under key without calling onEvict
+func (c *lru) Remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Len returns the number of entries held
+func (c *lru) Len() int {
+	return c.ll.Len()
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	entry := el.Value.(*lruEntry)
+	delete(c.items, entry.key)
+	if c.onEvict != nil {
+		c.onEvict(entry.key, entry.value)
+	}
+}
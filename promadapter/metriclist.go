@@ -0,0 +1,147 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultMetricPageSize is how many metrics are listed per request, the most AppOptics allows
+const DefaultMetricPageSize = 100
+
+// MetricDefinition is an AppOptics metric as the metrics API lists it
+type MetricDefinition struct {
+	Name        string           `json:"name"`
+	DisplayName string           `json:"display_name"`
+	Type        string           `json:"type"`
+	Description string           `json:"description"`
+	Period      int              `json:"period"`
+	Attributes  MetricAttributes `json:"attributes"`
+}
+
+// MetricListOptions narrow down the metrics that are listed
+type MetricListOptions struct {
+	// NamePrefix restricts the metrics listed to those whose names start with it
+	NamePrefix string
+	// PageSize is the number of metrics requested at a time, DefaultMetricPageSize if zero
+	PageSize int
+}
+
+// metricListResponse is the body of an AppOptics metrics list response
+type metricListResponse struct {
+	Query struct {
+		Offset int `json:"offset"`
+		Length int `json:"length"`
+		Found  int `json:"found"`
+	} `json:"query"`
+	Metrics []MetricDefinition `json:"metrics"`
+}
+
+// ListMetrics returns the definitions of every metric matching opts, requesting as many pages as it takes, e.g. to
+// find forwarded metrics that no longer exist in AppOptics. AppOptics filters metrics by a substring of their name,
+// so those not starting with the prefix are filtered out here.
+func (qc *QueryClient) ListMetrics(ctx context.Context, opts MetricListOptions) ([]MetricDefinition, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultMetricPageSize
+	}
+
+	var metrics []MetricDefinition
+	for offset := 0; ; {
+		params := url.Values{}
+		if opts.NamePrefix != "" {
+			params.Set("name", opts.NamePrefix)
+		}
+		params.Set("offset", strconv.Itoa(offset))
+		params.Set("length", strconv.Itoa(pageSize))
+
+		var body metricListResponse
+		if err := qc.get(ctx, qc.metricsURL+"?"+params.Encode(), &body); err != nil {
+			return nil, err
+		}
+		for _, m := range body.Metrics {
+			if strings.HasPrefix(m.Name, opts.NamePrefix) {
+				metrics = append(metrics, m)
+			}
+		}
+
+		offset += len(body.Metrics)
+		if len(body.Metrics) == 0 || offset >= body.Query.Found {
+			return metrics, nil
+		}
+	}
+}
+
+// DefaultMetricDeleteBatchSize is how many metrics DeleteStaleMetrics deletes per request
+const DefaultMetricDeleteBatchSize = 100
+
+// ErrDeletionNotConfirmed is returned by DeleteStaleMetrics when it was not explicitly told to delete
+var ErrDeletionNotConfirmed = errors.New("deleting metrics requires explicit confirmation")
+
+// MetricDeleter deletes metrics, along with all of their measurements, from AppOptics
+type MetricDeleter interface {
+	DeleteMetrics(ctx context.Context, names []string) error
+}
+
+// DeleteMetrics deletes the named metrics in a single request. Metrics that do not exist are treated as already
+// deleted.
+func (qc *QueryClient) DeleteMetrics(ctx context.Context, names []string) error {
+	body, err := json.Marshal(struct {
+		Names []string `json:"names"`
+	}{names})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, qc.metricsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(qc.token, "")
+
+	resp, err := qc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 && resp.StatusCode != http.StatusNotFound {
+		return responseError("metrics deletion", resp, msg)
+	}
+	return nil
+}
+
+// DeleteStaleMetrics deletes the named metrics, e.g. those reconciliation found no longer forwarded, through md in
+// batches of batchSize. Nothing is deleted unless confirmed is true, to avoid deleting metrics and their history by
+// accident. It returns the number of metrics deleted before any error.
+func DeleteStaleMetrics(ctx context.Context, md MetricDeleter, names []string, batchSize int, confirmed bool) (int, error) {
+	if !confirmed {
+		return 0, ErrDeletionNotConfirmed
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultMetricDeleteBatchSize
+	}
+
+	var deleted int
+	for start := 0; start < len(names); start += batchSize {
+		end := start + batchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		if err := md.DeleteMetrics(ctx, names[start:end]); err != nil {
+			return deleted, err
+		}
+		deleted = end
+	}
+	return deleted, nil
+}
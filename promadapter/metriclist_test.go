@@ -0,0 +1,136 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListMetrics(t *testing.T) {
+	names := []string{"node_cpu_seconds_total", "node_load1", "my_node_errors", "node_load5", "up"}
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		length, _ := strconv.Atoi(q.Get("length"))
+
+		var matching []MetricDefinition
+		for _, name := range names {
+			if strings.Contains(name, q.Get("name")) {
+				matching = append(matching, MetricDefinition{Name: name, Type: "gauge", Period: 60})
+			}
+		}
+		var body metricListResponse
+		body.Query.Offset, body.Query.Found = offset, len(matching)
+		if offset < len(matching) {
+			end := offset + length
+			if end > len(matching) {
+				end = len(matching)
+			}
+			body.Metrics = matching[offset:end]
+		}
+		body.Query.Length = len(body.Metrics)
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	qc := NewQueryClient(server.URL+"/measurements", server.URL+"/metrics", "token", server.Client())
+
+	t.Run("every page is collected", func(t *testing.T) {
+		requests = 0
+		metrics, err := qc.ListMetrics(context.Background(), MetricListOptions{PageSize: 2})
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(metrics) != len(names) || requests != 3 {
+			t.Fatalf("expected %d metrics in 3 requests but got %d in %d", len(names), len(metrics), requests)
+		}
+		for i, m := range metrics {
+			if m.Name != names[i] || m.Period != 60 {
+				t.Errorf("expected %s but got %+v", names[i], m)
+			}
+		}
+	})
+
+	t.Run("metrics are filtered by prefix", func(t *testing.T) {
+		metrics, err := qc.ListMetrics(context.Background(), MetricListOptions{NamePrefix: "node_", PageSize: 2})
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(metrics) != 3 {
+			t.Fatalf("expected the 3 metrics starting with node_ but got %+v", metrics)
+		}
+		for _, m := range metrics {
+			if !strings.HasPrefix(m.Name, "node_") {
+				t.Errorf("expected only metrics starting with node_ but got %s", m.Name)
+			}
+		}
+	})
+}
+
+func TestDeleteStaleMetrics(t *testing.T) {
+	var deletes [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/metrics" {
+			t.Errorf("expected DELETE /metrics but got %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Names []string `json:"names"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("expected a list of names: %s", err.Error())
+		}
+		deletes = append(deletes, body.Names)
+		switch body.Names[0] {
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": {"request": ["not found"]}}`))
+		case "forbidden":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": {"request": ["forbidden"]}}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	qc := NewQueryClient(server.URL+"/measurements", server.URL+"/metrics", "token", server.Client())
+	ctx := context.Background()
+	stale := []string{"a", "b", "c", "gone", "d"}
+
+	t.Run("nothing is deleted without confirmation", func(t *testing.T) {
+		if n, err := DeleteStaleMetrics(ctx, qc, stale, 3, false); err != ErrDeletionNotConfirmed || n != 0 {
+			t.Errorf("expected %v but got %d deleted and %v", ErrDeletionNotConfirmed, n, err)
+		}
+		if len(deletes) != 0 {
+			t.Errorf("expected no requests but got %v", deletes)
+		}
+	})
+
+	t.Run("metrics are deleted in batches", func(t *testing.T) {
+		deletes = nil
+		n, err := DeleteStaleMetrics(ctx, qc, stale, 3, true)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if n != 5 || len(deletes) != 2 || len(deletes[0]) != 3 || deletes[1][0] != "gone" {
+			t.Errorf("expected 5 metrics deleted in batches of 3 but got %d in %v", n, deletes)
+		}
+	})
+
+	t.Run("other errors stop the deletion", func(t *testing.T) {
+		deletes = nil
+		n, err := DeleteStaleMetrics(ctx, qc, []string{"a", "forbidden", "b"}, 1, true)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusForbidden {
+			t.Errorf("expected an *APIError with status 403 but got %#v", err)
+		}
+		if n != 1 || len(deletes) != 2 {
+			t.Errorf("expected 1 metric deleted before the error but got %d in %v", n, deletes)
+		}
+	})
+}
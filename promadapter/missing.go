@@ -0,0 +1,86 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// NullValue is the Value of a Measurement marking that its series had no data. The Value of a Measurement is omitted
+// from JSON when it is nil, so an explicit JSON null is used instead.
+var NullValue = json.RawMessage("null")
+
+// MissingSeriesTracker is a Stage recording the series passing through it, so that Run can submit a Measurement with
+// a NullValue for every series seen during one interval but not the next. This tells "no data" apart from a value
+// of 0 for the consumers of those metrics. Only the interval after a series disappears gets a null.
+type MissingSeriesTracker struct {
+	maxSeries int
+	now       func() time.Time
+
+	mu       sync.Mutex
+	previous map[string]appoptics.Measurement
+	current  map[string]appoptics.Measurement
+}
+
+// NewMissingSeriesTracker returns a MissingSeriesTracker tracking at most maxSeries series per interval
+func NewMissingSeriesTracker(maxSeries int) *MissingSeriesTracker {
+	return &MissingSeriesTracker{
+		maxSeries: maxSeries,
+		now:       time.Now,
+		previous:  make(map[string]appoptics.Measurement),
+		current:   make(map[string]appoptics.Measurement),
+	}
+}
+
+// Process implements Stage. The Measurements are passed on unchanged.
+func (mt *MissingSeriesTracker) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	for _, m := range measurements {
+		key := seriesKey(m)
+		if _, ok := mt.current[key]; !ok && len(mt.current) < mt.maxSeries {
+			mt.current[key] = appoptics.Measurement{Name: m.Name, Tags: m.Tags}
+		}
+	}
+	return measurements
+}
+
+// Missing ends the current interval and returns a null Measurement for every series seen in the previous interval
+// but not in the one that ended
+func (mt *MissingSeriesTracker) Missing() []appoptics.Measurement {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	now := mt.now().Unix()
+	var missing []appoptics.Measurement
+	for key, m := range mt.previous {
+		if _, ok := mt.current[key]; !ok {
+			m.Value = NullValue
+			m.Time = now
+			missing = append(missing, m)
+		}
+	}
+	mt.previous, mt.current = mt.current, make(map[string]appoptics.Measurement, len(mt.current))
+	return missing
+}
+
+// Run submits the null Measurements to sink at the end of every interval until ctx is done
+func (mt *MissingSeriesTracker) Run(ctx context.Context, interval time.Duration, sink Sink) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if missing := mt.Missing(); len(missing) > 0 {
+				if err := sink.Submit(ctx, missing); err != nil {
+					LogError("submitting %d null measurements for missing series: %s\n", len(missing), err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
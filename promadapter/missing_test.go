@@ -0,0 +1,46 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestMissingSeriesTracker(t *testing.T) {
+	mt := NewMissingSeriesTracker(DefaultMaxTrackedSeries)
+	mt.now = func() time.Time { return time.Unix(timestampFixture, 0) }
+	series := func(instance string) appoptics.Measurement {
+		return appoptics.Measurement{Name: metricNameFixture, Tags: map[string]string{"instance": instance}, Value: valueFixture, Time: timestampFixture}
+	}
+
+	mt.Process([]appoptics.Measurement{series("a"), series("b")})
+	if missing := mt.Missing(); len(missing) != 0 {
+		t.Fatalf("expected no missing series after the first interval but got %+v", missing)
+	}
+
+	mt.Process([]appoptics.Measurement{series("a")})
+	missing := mt.Missing()
+	if len(missing) != 1 || missing[0].Tags["instance"] != "b" || missing[0].Time != timestampFixture {
+		t.Fatalf("expected series b to be missing but got %+v", missing)
+	}
+
+	t.Run("the value is encoded as null", func(t *testing.T) {
+		encoded, err := json.Marshal(missing[0])
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if !strings.Contains(string(encoded), `"value":null`) {
+			t.Errorf("expected a null value but got %s", encoded)
+		}
+	})
+
+	t.Run("a null is only sent once", func(t *testing.T) {
+		mt.Process([]appoptics.Measurement{series("a")})
+		if missing := mt.Missing(); len(missing) != 0 {
+			t.Errorf("expected no missing series but got %+v", missing)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// MultiSink is a MeasurementsCommunicator that sends every batch to several MeasurementsCommunicators at once
+type MultiSink struct {
+	sinks []appoptics.MeasurementsCommunicator
+}
+
+// MultiSinkError collects the errors of the sinks that failed to persist a batch, in the order the sinks were given
+type MultiSinkError struct {
+	Errors []error
+}
+
+func (e *MultiSinkError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d sink(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// NewMultiSink returns a MultiSink sending to sinks
+func NewMultiSink(sinks ...appoptics.MeasurementsCommunicator) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// Create sends the batch to every sink concurrently. It returns the first sink's response, and a *MultiSinkError if
+// any sink failed.
+func (ms *MultiSink) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	resps := make([]*http.Response, len(ms.sinks))
+	errs := make([]error, len(ms.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range ms.sinks {
+		wg.Add(1)
+		go func(i int, sink appoptics.MeasurementsCommunicator) {
+			defer wg.Done()
+			resps[i], errs[i] = sink.Create(batch)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	var resp *http.Response
+	if len(resps) > 0 {
+		resp = resps[0]
+	}
+	if len(failed) > 0 {
+		return resp, &MultiSinkError{Errors: failed}
+	}
+	return resp, nil
+}
+
+// LogFormat selects how a LogSink writes Measurements
+type LogFormat int
+
+const (
+	// LogJSON writes one JSON object per Measurement per line
+	LogJSON LogFormat = iota
+	// LogCSV writes one name,time,value,tags row per Measurement, tags as sorted key=value pairs separated by ';'
+	LogCSV
+)
+
+// ParseLogFormat converts "json" or "csv" into a LogFormat
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch s {
+	case "json":
+		return LogJSON, nil
+	case "csv":
+		return LogCSV, nil
+	}
+	return LogJSON, fmt.Errorf("unknown log format %q", s)
+}
+
+// LogSink is a MeasurementsCommunicator that writes Measurements to a Writer, e.g. to keep a local audit trail
+type LogSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format LogFormat
+}
+
+// NewLogSink returns a LogSink writing to w in the given format
+func NewLogSink(w io.Writer, format LogFormat) *LogSink {
+	return &LogSink{w: w, format: format}
+}
+
+// Create writes every Measurement in the batch. There is no HTTP exchange so the response is always nil.
+func (ls *LogSink) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	var buf bytes.Buffer
+	switch ls.format {
+	case LogCSV:
+		cw := csv.NewWriter(&buf)
+		for _, m := range batch.Measurements {
+			cw.Write([]string{m.Name, strconv.FormatInt(m.Time, 10), fmt.Sprint(m.Value), joinTags(m.Tags)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		enc := json.NewEncoder(&buf)
+		for _, m := range batch.Measurements {
+			if err := enc.Encode(m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	_, err := ls.w.Write(buf.Bytes())
+	return nil, err
+}
+
+// joinTags renders tags as key=value pairs sorted by key and separated by ';'
+func joinTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,66 @@
+package promadapter
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestMultiSink(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: metricNameFixture, Value: 1.5, Time: 1500000000, Tags: map[string]string{"job": "api", "env": "prod"}},
+	}}
+
+	t.Run("every sink receives the batch", func(t *testing.T) {
+		var logged bytes.Buffer
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		ms := NewMultiSink(stub, NewLogSink(&logged, LogCSV))
+
+		resp, err := ms.Create(batch)
+		if err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("expected the first sink's response but got %d", resp.StatusCode)
+		}
+		if len(stub.batches) != 1 {
+			t.Errorf("expected 1 batch to be sent but got %d", len(stub.batches))
+		}
+		expected := metricNameFixture + ",1500000000,1.5,env=prod;job=api\n"
+		if logged.String() != expected {
+			t.Errorf("expected %q but got %q", expected, logged.String())
+		}
+	})
+
+	t.Run("failures are collected", func(t *testing.T) {
+		ms := NewMultiSink(
+			&stubCommunicator{statusCodes: []int{http.StatusBadRequest}},
+			&stubCommunicator{statusCodes: []int{http.StatusAccepted}},
+			&stubCommunicator{statusCodes: []int{http.StatusInternalServerError}},
+		)
+
+		_, err := ms.Create(batch)
+		mse, ok := err.(*MultiSinkError)
+		if !ok {
+			t.Fatalf("expected a *MultiSinkError but got %v", err)
+		}
+		if len(mse.Errors) != 2 {
+			t.Errorf("expected 2 errors but got %d", len(mse.Errors))
+		}
+	})
+}
+
+func TestLogSinkJSON(t *testing.T) {
+	var logged bytes.Buffer
+	ls := NewLogSink(&logged, LogJSON)
+	ls.Create(&appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "a", Value: 1.0},
+		{Name: "b", Value: 2.0},
+	}})
+
+	if lines := bytes.Count(logged.Bytes(), []byte("\n")); lines != 2 {
+		t.Errorf("expected 2 lines but got %d", lines)
+	}
+}
@@ -0,0 +1,189 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// NDJSONContentType is the media type of newline-delimited JSON request bodies
+const NDJSONContentType = "application/x-ndjson"
+
+// NDJSONCommunicator is a MeasurementsCommunicator that streams Measurements to a bulk ingest endpoint as
+// newline-delimited JSON, one Measurement per line, instead of building one large JSON array
+type NDJSONCommunicator struct {
+	url          string
+	token        string
+	authEncoding BasicAuthEncoding
+	maxBytes     int
+	httpClient   *http.Client
+	priorities   *RequestPriorities
+	encoder      *measurementEncoder
+	strict       bool
+}
+
+// NewNDJSONCommunicator returns an NDJSONCommunicator posting to url, authenticating with token encoded as
+// authEncoding. Each request body is kept under maxBytes unless a single Measurement is larger than that on its own;
+// zero means no limit.
+func NewNDJSONCommunicator(url, token string, authEncoding BasicAuthEncoding, maxBytes int, httpClient *http.Client) *NDJSONCommunicator {
+	return &NDJSONCommunicator{
+		url:          url,
+		token:        token,
+		authEncoding: authEncoding,
+		maxBytes:     maxBytes,
+		httpClient:   httpClient,
+		encoder:      newMeasurementEncoder(DefaultEncodeCacheSize),
+	}
+}
+
+// SetRequestPriorities makes the NDJSONCommunicator send the Measurements of each batch grouped by their
+// RequestPriority, highest first, with each request's context carrying the priority for a PriorityTransport
+func (nc *NDJSONCommunicator) SetRequestPriorities(priorities RequestPriorities) {
+	nc.priorities = &priorities
+}
+
+// SetStrictResponses makes the NDJSONCommunicator fail requests answered with a 2xx whose body carries an "errors"
+// field, as some misconfigured gateways answer failed requests. It is off by default.
+func (nc *NDJSONCommunicator) SetStrictResponses(strict bool) {
+	nc.strict = strict
+}
+
+// SetIntegerValues makes the NDJSONCommunicator render whole values as JSON integers, e.g. 5 rather than 5.0, for
+// AppOptics metrics typed as integers. Fractional values are rendered as they are. It is off by default.
+func (nc *NDJSONCommunicator) SetIntegerValues(integers bool) {
+	nc.encoder.integers = integers
+}
+
+// PartialSubmissionError is the error of a batch only some of whose Measurements were accepted, as when it is sent in
+// several requests and a later one fails. Unsent holds the indices into the batch of the Measurements that were not
+// accepted, so that a retry can resend only them.
+type PartialSubmissionError struct {
+	Err    error
+	Unsent []int
+}
+
+func (e *PartialSubmissionError) Error() string {
+	return e.Err.Error()
+}
+
+// Create sends the batch in as many NDJSON requests as maxBytes requires, stopping at the first failure. If some
+// requests were accepted before it, the error is a *PartialSubmissionError.
+func (nc *NDJSONCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	return nc.CreateContext(context.Background(), batch)
+}
+
+// CreateContext is Create with the requests bounded by ctx
+func (nc *NDJSONCommunicator) CreateContext(ctx context.Context, batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	order := make([]int, len(batch.Measurements))
+	for i := range order {
+		order[i] = i
+	}
+	if nc.priorities == nil || len(nc.priorities.Metrics) == 0 {
+		resp, sent, err := nc.send(ctx, batch.Measurements, order)
+		return resp, partialError(err, order, sent)
+	}
+
+	groups := make(map[RequestPriority][]int)
+	for i, m := range batch.Measurements {
+		p := nc.priorities.of(m.Name)
+		groups[p] = append(groups[p], i)
+	}
+	priorities := []RequestPriority{PriorityHigh, PriorityNormal, PriorityLow}
+	order = order[:0]
+	for _, p := range priorities {
+		order = append(order, groups[p]...)
+	}
+	var resp *http.Response
+	var sent int
+	for _, p := range priorities {
+		if len(groups[p]) == 0 {
+			continue
+		}
+		var n int
+		var err error
+		resp, n, err = nc.send(WithRequestPriority(ctx, p), batch.Measurements, groups[p])
+		sent += n
+		if err != nil {
+			return resp, partialError(err, order, sent)
+		}
+	}
+	return resp, nil
+}
+
+// partialError returns err as a *PartialSubmissionError if some of the Measurements were accepted before it, the
+// first sent of order
+func partialError(err error, order []int, sent int) error {
+	if err == nil || sent == 0 {
+		return err
+	}
+	return &PartialSubmissionError{Err: err, Unsent: append([]int(nil), order[sent:]...)}
+}
+
+// send posts the Measurements at indices in as many NDJSON requests as maxBytes requires, stopping at the first
+// failure. It returns how many of them were accepted.
+func (nc *NDJSONCommunicator) send(ctx context.Context, measurements []appoptics.Measurement, indices []int) (*http.Response, int, error) {
+	var body bytes.Buffer
+	var resp *http.Response
+	var sent, pending int
+	for _, i := range indices {
+		line, err := nc.encoder.Encode(measurements[i])
+		if err != nil {
+			return nil, sent, err
+		}
+
+		if nc.maxBytes > 0 && body.Len() > 0 && body.Len()+len(line)+1 > nc.maxBytes {
+			if resp, err = nc.post(ctx, body.Bytes()); err != nil {
+				return resp, sent, err
+			}
+			sent += pending
+			pending = 0
+			body.Reset()
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+		pending++
+	}
+
+	if body.Len() == 0 {
+		return resp, sent, nil
+	}
+	resp, err := nc.post(ctx, body.Bytes())
+	if err != nil {
+		return resp, sent, err
+	}
+	return resp, sent + pending, nil
+}
+
+// post sends a single NDJSON body
+func (nc *NDJSONCommunicator) post(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, nc.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", NDJSONContentType)
+	req.Header.Set("Authorization", nc.authEncoding.Header(nc.token, ""))
+
+	resp, err := nc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp, responseError("NDJSON ingest", resp, msg)
+	}
+	if nc.strict {
+		msg, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return resp, err
+		}
+		if hasErrorsField(msg) {
+			return resp, responseError("NDJSON ingest", resp, msg)
+		}
+	}
+	return resp, nil
+}
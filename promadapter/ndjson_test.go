@@ -0,0 +1,169 @@
+package promadapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestNDJSONCommunicator(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var received []appoptics.Measurement
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		if ct := r.Header.Get("Content-Type"); ct != NDJSONContentType {
+			t.Errorf("expected content type %s but got %s", NDJSONContentType, ct)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var m appoptics.Measurement
+			if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+				t.Errorf("expected each line to be a valid measurement: %s", err.Error())
+			}
+			received = append(received, m)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "first", Value: 1.0, Time: timestampFixture, Tags: map[string]string{"environment": "production"}},
+		{Name: "second", Value: 2.0, Time: timestampFixture},
+		{Name: "third", Value: 3.0, Time: timestampFixture},
+	}}
+
+	nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 100, server.Client())
+	resp, err := nc.Create(batch)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected status 202 but received %d", resp.StatusCode)
+	}
+
+	if len(received) != len(batch.Measurements) {
+		t.Fatalf("expected %d measurements but got %d", len(batch.Measurements), len(received))
+	}
+	for i, m := range received {
+		if m.Name != batch.Measurements[i].Name {
+			t.Errorf("expected %s to match %s", m.Name, batch.Measurements[i].Name)
+		}
+	}
+	if requests < 2 {
+		t.Errorf("expected the batch to be split across requests but got %d", requests)
+	}
+}
+
+func TestNDJSONCommunicatorRetriesUnsentChunks(t *testing.T) {
+	var requests int
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var m appoptics.Measurement
+			json.Unmarshal(scanner.Bytes(), &m)
+			received = append(received, m.Name)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "first", Value: 1.0, Time: timestampFixture},
+		{Name: "second", Value: 2.0, Time: timestampFixture},
+		{Name: "third", Value: 3.0, Time: timestampFixture},
+	}}
+
+	nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 60, server.Client())
+	_, err := nc.Create(batch)
+	partial, ok := err.(*PartialSubmissionError)
+	if !ok || len(partial.Unsent) != 2 || partial.Unsent[0] != 1 || partial.Unsent[1] != 2 {
+		t.Fatalf("expected the second and third measurements to be reported unsent but got %v", err)
+	}
+
+	requests, received = 0, nil
+	stats := NewStats()
+	rc := NewRetryingCommunicator(nc, DefaultRetryPolicy(), stats)
+	rc.sleep = func(time.Duration) {}
+	if _, err := rc.Create(batch); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if fmt.Sprint(received) != "[first second third]" {
+		t.Errorf("expected every measurement to be sent once but got %v", received)
+	}
+}
+
+func TestNDJSONCommunicatorRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RequestIDHeader, "c0ffee")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid measurement"))
+	}))
+	defer server.Close()
+
+	nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, server.Client())
+	_, err := nc.Create(&appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: "first", Value: 1.0}}})
+	if err == nil {
+		t.Fatal("expected an error for a 400")
+	}
+	if expected := "NDJSON ingest responded with 400 (request ID c0ffee): invalid measurement"; err.Error() != expected {
+		t.Errorf("expected %q but got %q", expected, err.Error())
+	}
+}
+
+func TestNDJSONCommunicatorStrictResponses(t *testing.T) {
+	body := `{"errors":{"request":["upstream unavailable"]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: "first", Value: 1.0}}}
+
+	t.Run("lenient mode succeeds on a 200", func(t *testing.T) {
+		nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, server.Client())
+		if _, err := nc.Create(batch); err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+	})
+
+	t.Run("strict mode fails a 200 carrying errors", func(t *testing.T) {
+		nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, server.Client())
+		nc.SetStrictResponses(true)
+		_, err := nc.Create(batch)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusOK {
+			t.Fatalf("expected an *APIError with status 200 but got %#v", err)
+		}
+		if _, err := NewInstrumentedCommunicator(nc, NewStats()).Create(batch); err == nil {
+			t.Error("expected the submission to fail")
+		}
+	})
+
+	t.Run("strict mode accepts bodies without errors", func(t *testing.T) {
+		for _, ok := range []string{``, `{}`, `{"errors":{}}`, `{"errors":null}`, `accepted`} {
+			if hasErrorsField([]byte(ok)) {
+				t.Errorf("expected %q not to count as an error", ok)
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package promadapter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+	"github.com/prometheus/common/model"
+	promremote "github.com/prometheus/prometheus/storage/remote"
+)
+
+// Stage is a step Measurements pass through after conversion and before being batched for AppOptics. A Stage may
+// modify, drop or merely observe the Measurements it is given.
+type Stage interface {
+	Process(measurements []appoptics.Measurement) []appoptics.Measurement
+}
+
+// Pipeline converts Prometheus remote storage WriteRequests to AppOptics Measurements and runs them through its
+// Stages in order
+type Pipeline struct {
+	stats  *Stats
+	stages []Stage
+	now    func() time.Time
+}
+
+// NewPipeline returns a Pipeline recording dropped NaN and infinite samples in stats and applying the given Stages
+func NewPipeline(stats *Stats, stages ...Stage) *Pipeline {
+	return &Pipeline{stats: stats, stages: stages}
+}
+
+// SetTimestampFallback makes the Pipeline time Measurements converted from samples without a timestamp with now,
+// instead of leaving them at zero, which AppOptics rejects
+func (p *Pipeline) SetTimestampFallback(now func() time.Time) {
+	p.now = now
+}
+
+// Process converts the WriteRequest and returns the Measurements that survived every Stage
+func (p *Pipeline) Process(req *promremote.WriteRequest) []appoptics.Measurement {
+	return p.ProcessSamples(WriteRequestToSamples(req))
+}
+
+// ProcessSamples converts the Samples and returns the Measurements that survived every Stage
+func (p *Pipeline) ProcessSamples(samples model.Samples) []appoptics.Measurement {
+	timing := p.stats.TimingEnabled()
+
+	var start time.Time
+	if timing {
+		start = time.Now()
+	}
+	measurements := SamplesToMeasurements(samples)
+	if p.now != nil {
+		now := p.now().Unix()
+		for i := range measurements {
+			if measurements[i].Time == 0 {
+				measurements[i].Time = now
+			}
+		}
+	}
+	if timing {
+		p.stats.ObserveStage("convert", time.Since(start))
+	}
+	var inf int
+	for _, s := range samples {
+		if math.IsInf(float64(s.Value), 0) {
+			inf++
+		}
+	}
+	p.stats.AddDropped(DropReasonInf, inf)
+	p.stats.AddDropped(DropReasonNaN, len(samples)-len(measurements)-inf)
+	return p.ProcessMeasurements(measurements)
+}
+
+// ProcessMeasurements returns the Measurements that survived every Stage, for sources that do not need converting
+func (p *Pipeline) ProcessMeasurements(measurements []appoptics.Measurement) []appoptics.Measurement {
+	timing := p.stats.TimingEnabled()
+
+	var start time.Time
+	for _, stage := range p.stages {
+		if len(measurements) == 0 {
+			break
+		}
+		if timing {
+			start = time.Now()
+		}
+		measurements = stage.Process(measurements)
+		if timing {
+			p.stats.ObserveStage(stageName(stage), time.Since(start))
+		}
+	}
+	return measurements
+}
+
+// stageName returns the type name of a Stage, e.g. "MetricFilter", for use in stage timings
+func stageName(stage Stage) string {
+	name := fmt.Sprintf("%T", stage)
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,45 @@
+package promadapter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestPipelineStageTiming(t *testing.T) {
+	stats := NewStats()
+	stats.EnableTiming()
+	filter, _ := NewMetricFilter(nil, nil, stats)
+	pipeline := NewPipeline(stats, filter, NewSnapshot(DefaultMaxTrackedSeries))
+
+	samples := append(model.Samples{}, promSamples...)
+	samples = append(samples, &model.Sample{Metric: model.Metric(labels), Value: model.SampleValue(math.NaN())})
+	samples = append(samples, &model.Sample{Metric: model.Metric(labels), Value: model.SampleValue(math.Inf(-1))})
+
+	if out := pipeline.ProcessSamples(samples); len(out) != len(promSamples) {
+		t.Errorf("expected %d measurements but got %d", len(promSamples), len(out))
+	}
+	if stats.Dropped()[DropReasonNaN] != 1 {
+		t.Errorf("expected the NaN sample to be counted as dropped")
+	}
+	if stats.Dropped()[DropReasonInf] != 1 {
+		t.Errorf("expected the infinite sample to be counted as dropped")
+	}
+
+	timings := stats.StageTimings()
+	for _, stage := range []string{"convert", "MetricFilter", "Snapshot"} {
+		if timings[stage].Count != 1 {
+			t.Errorf("expected 1 timing for stage %s but got %d", stage, timings[stage].Count)
+		}
+	}
+}
+
+func TestPipelineWithoutTiming(t *testing.T) {
+	stats := NewStats()
+	NewPipeline(stats, NewSnapshot(DefaultMaxTrackedSeries)).ProcessSamples(promSamples)
+
+	if len(stats.StageTimings()) != 0 {
+		t.Errorf("expected no timings to be recorded but got %v", stats.StageTimings())
+	}
+}
@@ -0,0 +1,180 @@
+package promadapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// priorityRule assigns a priority to metrics whose name matches a pattern
+type priorityRule struct {
+	pattern  *regexp.Regexp
+	priority int
+}
+
+// bufferedMeasurement is a Measurement waiting in a PriorityBuffer along with its arrival order
+type bufferedMeasurement struct {
+	seq uint64
+	m   appoptics.Measurement
+}
+
+// PriorityBuffer holds Measurements between the pipeline and the batcher. Measurements leave in the order they
+// arrived, but when the buffer is full the oldest Measurement of the lowest priority present is dropped to make room,
+// so valuable metrics survive backpressure.
+type PriorityBuffer struct {
+	capacity int
+	rules    []priorityRule
+	stats    *Stats
+
+	mu       sync.Mutex
+	nonEmpty *sync.Cond
+	queues   map[int][]bufferedMeasurement
+	levels   []int
+	size     int
+	seq      uint64
+}
+
+// NewPriorityBuffer returns a PriorityBuffer holding up to capacity Measurements. priorities maps metric name patterns
+// to a priority, higher surviving longer; metrics matching no pattern have priority zero and the first matching
+// pattern in sorted order wins.
+func NewPriorityBuffer(capacity int, priorities map[string]int, stats *Stats) (*PriorityBuffer, error) {
+	patterns := make([]string, 0, len(priorities))
+	for p := range priorities {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]priorityRule, len(patterns))
+	for i, p := range patterns {
+		rules[i] = priorityRule{pattern: compiled[i], priority: priorities[p]}
+	}
+
+	pb := &PriorityBuffer{
+		capacity: capacity,
+		rules:    rules,
+		stats:    stats,
+		queues:   make(map[int][]bufferedMeasurement),
+	}
+	pb.nonEmpty = sync.NewCond(&pb.mu)
+	return pb, nil
+}
+
+// ParsePriority parses a "pattern=priority" pair
+func ParsePriority(s string) (string, int, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 {
+		return "", 0, fmt.Errorf("expected pattern=priority but got %q", s)
+	}
+	priority, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid priority in %q: %s", s, err)
+	}
+	return s[:i], priority, nil
+}
+
+// Run moves Measurements from in to the buffer and from the buffer to out, in batches of at most batchSize. It never
+// returns.
+func (pb *PriorityBuffer) Run(in <-chan []appoptics.Measurement, out chan<- []appoptics.Measurement, batchSize int) {
+	go func() {
+		for measurements := range in {
+			pb.Push(measurements)
+		}
+	}()
+
+	for {
+		out <- pb.Pop(batchSize)
+	}
+}
+
+// Push adds Measurements to the buffer without blocking, dropping the least valuable ones if it is full
+func (pb *PriorityBuffer) Push(measurements []appoptics.Measurement) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	for _, m := range measurements {
+		priority := pb.priority(m.Name)
+		if pb.size >= pb.capacity {
+			lowest := pb.lowestLevel()
+			if priority < lowest {
+				pb.drop(priority)
+				continue
+			}
+			pb.queues[lowest] = pb.queues[lowest][1:]
+			pb.size--
+			pb.drop(lowest)
+		}
+
+		if _, ok := pb.queues[priority]; !ok {
+			pb.levels = append(pb.levels, priority)
+			sort.Ints(pb.levels)
+		}
+		pb.seq++
+		pb.queues[priority] = append(pb.queues[priority], bufferedMeasurement{seq: pb.seq, m: m})
+		pb.size++
+	}
+	pb.nonEmpty.Signal()
+}
+
+// Pop blocks until the buffer holds Measurements and returns up to max of them, oldest first
+func (pb *PriorityBuffer) Pop(max int) []appoptics.Measurement {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for pb.size == 0 {
+		pb.nonEmpty.Wait()
+	}
+
+	var out []appoptics.Measurement
+	for len(out) < max && pb.size > 0 {
+		var oldest int
+		var oldestSeq uint64
+		for _, level := range pb.levels {
+			if q := pb.queues[level]; len(q) > 0 && (oldestSeq == 0 || q[0].seq < oldestSeq) {
+				oldest, oldestSeq = level, q[0].seq
+			}
+		}
+		out = append(out, pb.queues[oldest][0].m)
+		pb.queues[oldest] = pb.queues[oldest][1:]
+		pb.size--
+	}
+	return out
+}
+
+// Len returns the number of Measurements in the buffer
+func (pb *PriorityBuffer) Len() int {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return pb.size
+}
+
+func (pb *PriorityBuffer) priority(name string) int {
+	for _, rule := range pb.rules {
+		if rule.pattern.MatchString(name) {
+			return rule.priority
+		}
+	}
+	return 0
+}
+
+// lowestLevel returns the lowest priority with buffered Measurements
+func (pb *PriorityBuffer) lowestLevel() int {
+	for _, level := range pb.levels {
+		if len(pb.queues[level]) > 0 {
+			return level
+		}
+	}
+	return 0
+}
+
+func (pb *PriorityBuffer) drop(priority int) {
+	pb.stats.AddDropped(DropReasonBackpressure, 1)
+	pb.stats.AddDroppedByPriority(priority)
+}
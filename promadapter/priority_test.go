@@ -0,0 +1,58 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestPriorityBuffer(t *testing.T) {
+	stats := NewStats()
+	pb, err := NewPriorityBuffer(3, map[string]int{"slo_.*": 10}, stats)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	pb.Push([]appoptics.Measurement{
+		{Name: "debug_a", Value: 1.0},
+		{Name: "slo_latency", Value: 2.0},
+		{Name: "debug_b", Value: 3.0},
+	})
+	// the buffer is saturated: both high-priority points must displace the low-priority ones, oldest first
+	pb.Push([]appoptics.Measurement{
+		{Name: "slo_errors", Value: 4.0},
+		{Name: "slo_availability", Value: 5.0},
+	})
+	// a low-priority point arriving into a buffer full of high-priority ones is dropped itself
+	pb.Push([]appoptics.Measurement{{Name: "debug_c", Value: 6.0}})
+
+	if pb.Len() != 3 {
+		t.Fatalf("expected the buffer to hold 3 measurements but got %d", pb.Len())
+	}
+
+	out := pb.Pop(10)
+	expected := []string{"slo_latency", "slo_errors", "slo_availability"}
+	for i, name := range expected {
+		if out[i].Name != name {
+			t.Errorf("expected %s at position %d but got %s", name, i, out[i].Name)
+		}
+	}
+
+	if stats.DroppedByPriority()["0"] != 3 {
+		t.Errorf("expected 3 low-priority drops but got %d", stats.DroppedByPriority()["0"])
+	}
+	if stats.DroppedByPriority()["10"] != 0 {
+		t.Errorf("expected no high-priority drops but got %d", stats.DroppedByPriority()["10"])
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	pattern, priority, err := ParsePriority("http_.*=5")
+	if err != nil || pattern != "http_.*" || priority != 5 {
+		t.Errorf("unexpected result %q %d %v", pattern, priority, err)
+	}
+
+	if _, _, err := ParsePriority("http_.*"); err == nil {
+		t.Error("expected an error for a missing priority")
+	}
+}
@@ -0,0 +1,150 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+// Provisioning is the AppOptics resources a provisioning file declares, so that the Spaces the forwarded metrics are
+// charted in, the alerts on them and the Services the alerts are sent to exist wherever the adapter is deployed
+type Provisioning struct {
+	// Spaces are the names of the Spaces to create if they do not exist
+	Spaces []string `json:"spaces"`
+	// Services are created, or replace the Service of the same title
+	Services []NotificationService `json:"services"`
+	// Alerts are created, or replace the alert of the same name
+	Alerts []ProvisionedAlert `json:"alerts"`
+}
+
+// ProvisionedAlert is an Alert of a provisioning file, which names the Services it is sent to by title as their IDs
+// are not known until they are provisioned
+type ProvisionedAlert struct {
+	Alert
+	// Notify are the titles of provisioned Services the alert is sent to, in addition to those in Services
+	Notify []string `json:"notify"`
+}
+
+// LoadProvisioning reads a JSON provisioning file
+func LoadProvisioning(path string) (*Provisioning, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Provisioning
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+	return &p, nil
+}
+
+// Provisioner creates the AppOptics resources of a Provisioning that do not exist yet
+type Provisioner struct {
+	spaces   *SpacesClient
+	services NotificationServicesCommunicator
+	alerts   AlertsCommunicator
+}
+
+// NewProvisioner returns a Provisioner creating Spaces with spaces, Services with services and alerts with alerts
+func NewProvisioner(spaces *SpacesClient, services NotificationServicesCommunicator, alerts AlertsCommunicator) *Provisioner {
+	return &Provisioner{spaces: spaces, services: services, alerts: alerts}
+}
+
+// Provision creates every resource of p that does not exist yet. It can be run repeatedly, as existing Spaces are
+// left as they are and existing Services and alerts are updated to match p.
+func (pr *Provisioner) Provision(ctx context.Context, p *Provisioning) error {
+	for _, name := range p.Spaces {
+		space, err := pr.spaces.FindOrCreateSpace(ctx, name)
+		if err != nil {
+			return fmt.Errorf("provisioning space %q: %s", name, err)
+		}
+		log.Printf("provisioned space %q (%d)\n", space.Name, space.ID)
+	}
+
+	var serviceIDs map[string]int
+	if len(p.Services) > 0 {
+		var err error
+		if serviceIDs, err = pr.provisionServices(ctx, p.Services); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Alerts) > 0 {
+		return pr.provisionAlerts(ctx, p.Alerts, serviceIDs)
+	}
+	return nil
+}
+
+// provisionServices creates the Services, updating those that already exist by title, and returns their IDs keyed
+// by title
+func (pr *Provisioner) provisionServices(ctx context.Context, services []NotificationService) (map[string]int, error) {
+	existing, err := pr.services.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing services: %s", err)
+	}
+	ids := make(map[string]int, len(existing))
+	for _, s := range existing {
+		ids[s.Title] = s.ID
+	}
+
+	for i := range services {
+		service := services[i]
+		if id, ok := ids[service.Title]; ok {
+			service.ID = id
+			if err := pr.services.UpdateService(ctx, &service); err != nil {
+				return nil, fmt.Errorf("provisioning service %q: %s", service.Title, err)
+			}
+			log.Printf("updated service %q (%d)\n", service.Title, service.ID)
+			continue
+		}
+		created, err := pr.services.CreateService(ctx, &service)
+		if err != nil {
+			return nil, fmt.Errorf("provisioning service %q: %s", service.Title, err)
+		}
+		ids[service.Title] = created.ID
+		log.Printf("provisioned service %q (%d)\n", created.Title, created.ID)
+	}
+	return ids, nil
+}
+
+// provisionAlerts creates the alerts, updating those that already exist by name. The Services they notify are
+// looked up in serviceIDs by title.
+func (pr *Provisioner) provisionAlerts(ctx context.Context, alerts []ProvisionedAlert, serviceIDs map[string]int) error {
+	existing, err := pr.alerts.ListAlerts(ctx)
+	if err != nil {
+		return fmt.Errorf("listing alerts: %s", err)
+	}
+	ids := make(map[string]int, len(existing))
+	for _, a := range existing {
+		ids[a.Name] = a.ID
+	}
+
+	for i := range alerts {
+		alert := alerts[i].Alert
+		alert.Services = append([]int(nil), alert.Services...)
+		for _, title := range alerts[i].Notify {
+			id, ok := serviceIDs[title]
+			if !ok {
+				return fmt.Errorf("provisioning alert %q: service %q is not in the provisioning file", alert.Name, title)
+			}
+			alert.Services = append(alert.Services, id)
+		}
+
+		if id, ok := ids[alert.Name]; ok {
+			alert.ID = id
+			if err := pr.alerts.UpdateAlert(ctx, &alert); err != nil {
+				return fmt.Errorf("provisioning alert %q: %s", alert.Name, err)
+			}
+			log.Printf("updated alert %q (%d)\n", alert.Name, alert.ID)
+			continue
+		}
+		created, err := pr.alerts.CreateAlert(ctx, &alert)
+		if err != nil {
+			return fmt.Errorf("provisioning alert %q: %s", alert.Name, err)
+		}
+		log.Printf("provisioned alert %q (%d)\n", created.Name, created.ID)
+	}
+	return nil
+}
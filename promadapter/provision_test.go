@@ -0,0 +1,109 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const provisioningFixture = `{
+	"spaces": ["node", "kubernetes"],
+	"services": [
+		{"type": "slack", "title": "ops", "settings": {"url": "https://hooks.slack.com/services/T0/B0/x", "channel": "#ops"}},
+		{"type": "pagerduty", "title": "on call", "settings": {"service_key": "key"}}
+	],
+	"alerts": [
+		{"name": "disk full", "conditions": [{"type": "above", "metric_name": "node_filesystem_used", "threshold": 90}], "notify": ["ops"]},
+		{"name": "node down", "conditions": [{"type": "absent", "metric_name": "up", "duration": 300}], "services": [1], "notify": ["ops", "on call"]}
+	]
+}`
+
+func TestProvisioner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "provision.json")
+	ioutil.WriteFile(path, []byte(provisioningFixture), 0600)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/spaces":
+			var space Space
+			json.NewDecoder(r.Body).Decode(&space)
+			requests = append(requests, "space "+space.Name)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(space)
+		case r.Method == http.MethodGet && r.URL.Path == "/services":
+			fmt.Fprint(w, `{"services":[{"id":5,"type":"slack","title":"ops"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/alerts":
+			fmt.Fprint(w, `{"query":{"found":1},"alerts":[{"id":3,"name":"disk full"}]}`)
+		case strings.HasPrefix(r.URL.Path, "/services"):
+			var service NotificationService
+			json.NewDecoder(r.Body).Decode(&service)
+			requests = append(requests, r.Method+" "+r.URL.Path+" "+service.Title)
+			service.ID = 6
+			json.NewEncoder(w).Encode(service)
+		default:
+			var alert Alert
+			json.NewDecoder(r.Body).Decode(&alert)
+			requests = append(requests, fmt.Sprintf("%s %s %s %v", r.Method, r.URL.Path, alert.Name, alert.Services))
+			json.NewEncoder(w).Encode(alert)
+		}
+	}))
+	defer server.Close()
+
+	p, err := LoadProvisioning(path)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	pr := NewProvisioner(
+		NewSpacesClient(server.URL+"/spaces", "token", server.Client()),
+		NewNotificationServicesClient(server.URL+"/services", "token", server.Client()),
+		NewAlertsClient(server.URL+"/alerts", "token", server.Client()),
+	)
+	if err := pr.Provision(context.Background(), p); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	expected := []string{
+		"space node",
+		"space kubernetes",
+		"PUT /services/5 ops",
+		"POST /services on call",
+		"PUT /alerts/3 disk full [5]",
+		"POST /alerts node down [1 5 6]",
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected, requests)
+			break
+		}
+	}
+
+	t.Run("alerts can only notify provisioned services", func(t *testing.T) {
+		p := &Provisioning{Alerts: []ProvisionedAlert{{Alert: Alert{Name: "disk full"}, Notify: []string{"email"}}}}
+		if err := pr.Provision(context.Background(), p); err == nil {
+			t.Error("expected an error for an unknown service")
+		}
+	})
+
+	t.Run("a malformed file is an error", func(t *testing.T) {
+		ioutil.WriteFile(path, []byte(`{"spaces": "node"}`), 0600)
+		if _, err := LoadProvisioning(path); err == nil {
+			t.Error("expected an error for a malformed file")
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Resolution is the interval, in seconds, AppOptics rolls measurements up to when they are queried
+type Resolution int
+
+// Resolutions AppOptics can return measurements at
+const (
+	Res60    Resolution = 60
+	Res3600  Resolution = 3600
+	Res86400 Resolution = 86400
+)
+
+// Resolutions are the supported Resolutions, finest first
+var Resolutions = []Resolution{Res60, Res3600, Res86400}
+
+// queryResponse is the body of an AppOptics measurements query response
+type queryResponse struct {
+	Series []struct {
+		Tags         map[string]string `json:"tags"`
+		Measurements []struct {
+			Time  int64   `json:"time"`
+			Value float64 `json:"value"`
+		} `json:"measurements"`
+	} `json:"series"`
+	Links []struct {
+		Rel  string `json:"rel"`
+		Href string `json:"href"`
+	} `json:"links"`
+	Resolution int `json:"resolution"`
+}
+
+// MeasurementQueryOptions narrow down the measurements of a metric that are listed. Zero values are left out of the
+// query.
+type MeasurementQueryOptions struct {
+	StartTime  time.Time
+	EndTime    time.Time
+	Resolution Resolution
+	// Tags restricts the series listed to those with these tag values, which may contain * wildcards
+	Tags map[string]string
+	// Count is the maximum number of measurements per page
+	Count int
+	// Offset is the number of measurements to skip
+	Offset int
+	// GroupBy is the tag the series are combined by
+	GroupBy string
+}
+
+// values returns the options as query parameters
+func (o MeasurementQueryOptions) values() url.Values {
+	params := url.Values{}
+	if !o.StartTime.IsZero() {
+		params.Set("start_time", strconv.FormatInt(o.StartTime.Unix(), 10))
+	}
+	if !o.EndTime.IsZero() {
+		params.Set("end_time", strconv.FormatInt(o.EndTime.Unix(), 10))
+	}
+	if o.Resolution != 0 {
+		params.Set("resolution", strconv.Itoa(int(o.Resolution)))
+	}
+	for k, v := range o.Tags {
+		params.Set("tags["+k+"]", v)
+	}
+	if o.Count > 0 {
+		params.Set("count", strconv.Itoa(o.Count))
+	}
+	if o.Offset > 0 {
+		params.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.GroupBy != "" {
+		params.Set("group_by", o.GroupBy)
+	}
+	return params
+}
+
+// MeasurementPage is one page of the measurements of a metric
+type MeasurementPage struct {
+	DataPoints []DataPoint
+	// Links maps relations such as "next" and "prev" to the URLs of the neighbouring pages
+	Links map[string]string
+	// Resolution is the number of seconds the measurements were rolled up to
+	Resolution int
+}
+
+// QueryClient reads measurements back from the AppOptics API
+type QueryClient struct {
+	measurementsURL string
+	metricsURL      string
+	token           string
+	httpClient      *http.Client
+}
+
+// NewQueryClient returns a QueryClient querying the measurements and metrics API endpoints, e.g. the
+// MeasurementsPath and MetricsPath EndpointURLs
+func NewQueryClient(measurementsURL, metricsURL, token string, httpClient *http.Client) *QueryClient {
+	return &QueryClient{measurementsURL: measurementsURL, metricsURL: metricsURL, token: token, httpClient: httpClient}
+}
+
+// QueryWithResolution returns the points of every series of the named metric between start and end, rolled up to
+// resolution
+func (qc *QueryClient) QueryWithResolution(ctx context.Context, name string, start, end time.Time, resolution Resolution) ([]DataPoint, error) {
+	return qc.AllPages(ctx, name, MeasurementQueryOptions{StartTime: start, EndTime: end, Resolution: resolution})
+}
+
+// ListMeasurementValues returns the first page of the named metric's measurements
+func (qc *QueryClient) ListMeasurementValues(ctx context.Context, name string, opts MeasurementQueryOptions) (*MeasurementPage, error) {
+	return qc.page(ctx, name, qc.measurementsURL+"/"+url.PathEscape(name)+"?"+opts.values().Encode())
+}
+
+// AllPages follows the next links from the first page of the named metric's measurements and returns the points of
+// every page
+func (qc *QueryClient) AllPages(ctx context.Context, name string, opts MeasurementQueryOptions) ([]DataPoint, error) {
+	page, err := qc.ListMeasurementValues(ctx, name, opts)
+	seen := make(map[string]bool)
+	var points []DataPoint
+	for {
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, page.DataPoints...)
+
+		next := page.Links["next"]
+		if next == "" {
+			return points, nil
+		}
+		var endpoint string
+		if endpoint, err = resolveLink(qc.measurementsURL, next); err != nil {
+			return nil, err
+		}
+		if seen[endpoint] {
+			return points, nil
+		}
+		seen[endpoint] = true
+		page, err = qc.page(ctx, name, endpoint)
+	}
+}
+
+// page fetches the page of the named metric's measurements at endpoint
+func (qc *QueryClient) page(ctx context.Context, name, endpoint string) (*MeasurementPage, error) {
+	var body queryResponse
+	if err := qc.get(ctx, endpoint, &body); err != nil {
+		return nil, err
+	}
+
+	page := &MeasurementPage{Links: make(map[string]string, len(body.Links)), Resolution: body.Resolution}
+	for _, series := range body.Series {
+		for _, m := range series.Measurements {
+			page.DataPoints = append(page.DataPoints, DataPoint{Name: name, Tags: series.Tags, Time: time.Unix(m.Time, 0), Value: m.Value})
+		}
+	}
+	for _, link := range body.Links {
+		page.Links[link.Rel] = link.Href
+	}
+	return page, nil
+}
+
+// resolveLink returns the absolute URL of a link, which AppOptics may give relative to the API host
+func resolveLink(base, link string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	l, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid page link %q: %s", link, err)
+	}
+	return b.ResolveReference(l).String(), nil
+}
+
+// ListAvailableResolutions returns the Resolutions the named metric can be queried at. AppOptics keeps measurements
+// at the period they are reported at, so Resolutions finer than the metric's period are not available.
+func (qc *QueryClient) ListAvailableResolutions(ctx context.Context, name string) ([]Resolution, error) {
+	var metric struct {
+		Period int `json:"period"`
+	}
+	if err := qc.get(ctx, qc.metricsURL+"/"+url.PathEscape(name), &metric); err != nil {
+		return nil, err
+	}
+
+	var available []Resolution
+	for _, r := range Resolutions {
+		if int(r) >= metric.Period {
+			available = append(available, r)
+		}
+	}
+	return available, nil
+}
+
+// QueryRange returns the points between start and end of every series of the named metric having all the given tags,
+// grouped by series, like LocalStore.Query does. They are rolled up to the coarsest Resolution available that is no
+// coarser than step, or to the finest one available if they all are.
+func (qc *QueryClient) QueryRange(ctx context.Context, name string, tags map[string]string, start, end time.Time, step time.Duration) ([]DataPoint, error) {
+	available, err := qc.ListAvailableResolutions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("%s cannot be queried at any resolution", name)
+	}
+	resolution := available[0]
+	for _, r := range available[1:] {
+		if time.Duration(r)*time.Second <= step {
+			resolution = r
+		}
+	}
+
+	points, err := qc.AllPages(ctx, name, MeasurementQueryOptions{StartTime: start, EndTime: end, Resolution: resolution, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+	// AppOptics reads * in tag values as a wildcard, so the tags are matched exactly here as well
+	matching := points[:0]
+	for _, p := range points {
+		if hasTags(p.Tags, tags) {
+			matching = append(matching, p)
+		}
+	}
+	return matching, nil
+}
+
+// get fetches endpoint and decodes the JSON response into out
+func (qc *QueryClient) get(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(qc.token, "")
+
+	resp, err := qc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError("measurements query", resp, msg)
+	}
+	return json.Unmarshal(msg, out)
+}
@@ -0,0 +1,133 @@
+package promadapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/measurements/node_load1":
+			q := r.URL.Query()
+			if q.Get("start_time") != "1000" || q.Get("end_time") != "9000" || q.Get("resolution") != "3600" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"series": [
+				{"tags": {"host": "a"}, "measurements": [{"time": 3600, "value": 1.5}, {"time": 7200, "value": 2}]},
+				{"tags": {"host": "b"}, "measurements": [{"time": 3600, "value": 0.5}]}
+			], "resolution": 3600}`))
+		case "/metrics/node_load1":
+			w.Write([]byte(`{"name": "node_load1", "period": 300}`))
+		case "/metrics/up":
+			w.Write([]byte(`{"name": "up"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": {"params": {"name": ["is not present"]}}}`))
+		}
+	}))
+	defer server.Close()
+
+	qc := NewQueryClient(server.URL+"/measurements", server.URL+"/metrics", "token", server.Client())
+
+	t.Run("points are returned for every series", func(t *testing.T) {
+		points, err := qc.QueryWithResolution(context.Background(), "node_load1", time.Unix(1000, 0), time.Unix(9000, 0), Res3600)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(points) != 3 {
+			t.Fatalf("expected 3 points but got %d", len(points))
+		}
+		if p := points[1]; p.Name != "node_load1" || p.Tags["host"] != "a" || p.Time.Unix() != 7200 || p.Value != 2 {
+			t.Errorf("expected the second point of host a but got %+v", p)
+		}
+	})
+
+	t.Run("resolutions finer than the period are unavailable", func(t *testing.T) {
+		available, err := qc.ListAvailableResolutions(context.Background(), "node_load1")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(available) != 2 || available[0] != Res3600 || available[1] != Res86400 {
+			t.Errorf("expected [3600 86400] but got %v", available)
+		}
+
+		available, _ = qc.ListAvailableResolutions(context.Background(), "up")
+		if len(available) != len(Resolutions) {
+			t.Errorf("expected every resolution without a period but got %v", available)
+		}
+	})
+
+	t.Run("ranges are queried at the finest resolution available", func(t *testing.T) {
+		points, err := qc.QueryRange(context.Background(), "node_load1", map[string]string{"host": "a"}, time.Unix(1000, 0), time.Unix(9000, 0), time.Minute)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(points) != 2 || points[0].Tags["host"] != "a" || points[1].Tags["host"] != "a" {
+			t.Errorf("expected the 2 points of host a but got %+v", points)
+		}
+	})
+
+	t.Run("errors are returned", func(t *testing.T) {
+		if _, err := qc.ListAvailableResolutions(context.Background(), "missing"); err == nil {
+			t.Error("expected an error for a 404")
+		}
+	})
+}
+
+func TestQueryClientPagination(t *testing.T) {
+	var queries []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		switch r.URL.Query().Get("offset") {
+		case "":
+			w.Write([]byte(`{"series": [{"tags": {"host": "a"}, "measurements": [{"time": 60, "value": 1}, {"time": 120, "value": 2}]}],
+				"links": [{"rel": "next", "href": "/v1/measurements/node_load1?count=2&offset=2&tags%5Bhost%5D=a"}], "resolution": 60}`))
+		case "2":
+			w.Write([]byte(`{"series": [{"tags": {"host": "a"}, "measurements": [{"time": 180, "value": 3}, {"time": 240, "value": 4}]}],
+				"links": [{"rel": "prev", "href": "/v1/measurements/node_load1?count=2&tags%5Bhost%5D=a"},
+				          {"rel": "next", "href": "` + server.URL + `/v1/measurements/node_load1?count=2&offset=4&tags%5Bhost%5D=a"}], "resolution": 60}`))
+		default:
+			w.Write([]byte(`{"series": [{"tags": {"host": "a"}, "measurements": [{"time": 300, "value": 5}]}], "resolution": 60}`))
+		}
+	}))
+	defer server.Close()
+
+	qc := NewQueryClient(server.URL+"/v1/measurements", server.URL+"/v1/metrics", "token", server.Client())
+	opts := MeasurementQueryOptions{Tags: map[string]string{"host": "a"}, Count: 2, GroupBy: "host", Resolution: Res60}
+
+	t.Run("a single page carries its links", func(t *testing.T) {
+		queries = nil
+		page, err := qc.ListMeasurementValues(context.Background(), "node_load1", opts)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(page.DataPoints) != 2 || page.Resolution != 60 || page.Links["next"] == "" {
+			t.Errorf("expected 2 points at resolution 60 with a next link but got %+v", page)
+		}
+		if expected := "count=2&group_by=host&resolution=60&tags%5Bhost%5D=a"; queries[0] != expected {
+			t.Errorf("expected the query %s but got %s", expected, queries[0])
+		}
+	})
+
+	t.Run("every page is fetched", func(t *testing.T) {
+		queries = nil
+		points, err := qc.AllPages(context.Background(), "node_load1", opts)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(queries) != 3 {
+			t.Errorf("expected 3 pages to be fetched but got %d", len(queries))
+		}
+		if len(points) != 5 || points[4].Value != 5 || points[4].Time.Unix() != 300 {
+			t.Errorf("expected the 5 points of every page but got %+v", points)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package promadapter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+	"golang.org/x/time/rate"
+)
+
+// SeriesRateLimiter is a Stage that drops Measurements of any single series submitted more often than its rate
+// allows, so one high-cardinality metric cannot use up the whole AppOptics quota
+type SeriesRateLimiter struct {
+	limit       rate.Limit
+	burst       int
+	minInterval time.Duration
+	stats       *Stats
+	now         func() time.Time
+
+	mu       sync.Mutex
+	limiters *lru
+}
+
+// seriesLimit is the rate limiting state of one series
+type seriesLimit struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+// SeriesRateLimiterOption configures a SeriesRateLimiter
+type SeriesRateLimiterOption func(*SeriesRateLimiter)
+
+// WithMinimumSubmissionInterval drops Measurements of a series arriving less than d after the last one let through,
+// limiting each series by time rather than count, e.g. against a scraper gone wrong emitting samples every 100ms
+func WithMinimumSubmissionInterval(d time.Duration) SeriesRateLimiterOption {
+	return func(rl *SeriesRateLimiter) {
+		rl.minInterval = d
+	}
+}
+
+// NewSeriesRateLimiter returns a SeriesRateLimiter allowing rps Measurements per second for each series, or any number
+// if rps is zero, tracking at most maxSeries series before forgetting the least recently seen ones
+func NewSeriesRateLimiter(rps float64, maxSeries int, stats *Stats, opts ...SeriesRateLimiterOption) *SeriesRateLimiter {
+	rl := &SeriesRateLimiter{
+		limit:    rate.Limit(rps),
+		burst:    int(math.Max(1, math.Ceil(rps))),
+		stats:    stats,
+		now:      time.Now,
+		limiters: newLRU(maxSeries, nil),
+	}
+	if rps <= 0 {
+		rl.limit = rate.Inf
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	return rl
+}
+
+// Process implements Stage
+func (rl *SeriesRateLimiter) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	allowed := measurements[:0]
+	for _, m := range measurements {
+		key := seriesKey(m)
+		var sl *seriesLimit
+		if l, ok := rl.limiters.Get(key); ok {
+			sl = l.(*seriesLimit)
+		} else {
+			sl = &seriesLimit{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+			rl.limiters.Add(key, sl)
+		}
+
+		if rl.minInterval > 0 && !sl.last.IsZero() && now.Sub(sl.last) < rl.minInterval {
+			rl.stats.AddIntervalLimited(1)
+			continue
+		}
+		if !sl.limiter.AllowN(now, 1) {
+			rl.stats.AddRateLimited(m.Name)
+			continue
+		}
+		sl.last = now
+		allowed = append(allowed, m)
+	}
+	return allowed
+}
@@ -0,0 +1,70 @@
+package promadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestSeriesRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := NewStats()
+	rl := NewSeriesRateLimiter(1, 2, stats)
+	rl.now = func() time.Time { return now }
+
+	noisy := appoptics.Measurement{Name: "noisy", Value: 1.0, Tags: map[string]string{"pod": "a"}}
+	quiet := appoptics.Measurement{Name: "quiet", Value: 1.0}
+
+	out := rl.Process([]appoptics.Measurement{noisy, noisy, noisy, quiet})
+	if len(out) != 2 {
+		t.Fatalf("expected 2 measurements to pass but got %d", len(out))
+	}
+	if rl.stats.RateLimited()["noisy"] != 2 {
+		t.Errorf("expected 2 noisy measurements to be rate limited but got %d", stats.RateLimited()["noisy"])
+	}
+
+	now = now.Add(time.Second)
+	if out := rl.Process([]appoptics.Measurement{noisy}); len(out) != 1 {
+		t.Errorf("expected the series to be allowed again after a second")
+	}
+
+	t.Run("tracked series are bounded", func(t *testing.T) {
+		for _, pod := range []string{"b", "c", "d"} {
+			rl.Process([]appoptics.Measurement{{Name: "noisy", Value: 1.0, Tags: map[string]string{"pod": pod}}})
+		}
+		if rl.limiters.Len() != 2 {
+			t.Errorf("expected 2 tracked series but got %d", rl.limiters.Len())
+		}
+	})
+}
+
+func TestSeriesRateLimiterMinimumInterval(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := NewStats()
+	rl := NewSeriesRateLimiter(0, DefaultMaxTrackedSeries, stats, WithMinimumSubmissionInterval(time.Second))
+	rl.now = func() time.Time { return now }
+	noisy := appoptics.Measurement{Name: "noisy", Value: 1.0}
+	other := appoptics.Measurement{Name: "noisy", Value: 1.0, Tags: map[string]string{"pod": "b"}}
+
+	for i := 0; i < 10; i++ {
+		out := rl.Process([]appoptics.Measurement{noisy, other})
+		if i == 0 && len(out) != 2 {
+			t.Fatalf("expected the first measurement of each series to pass but got %d", len(out))
+		}
+		if i > 0 && len(out) != 0 {
+			t.Fatalf("expected measurements within the interval to be dropped but got %d after %s", len(out), time.Duration(i)*100*time.Millisecond)
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+	if stats.IntervalLimited() != 18 {
+		t.Errorf("expected 18 measurements to be limited but got %d", stats.IntervalLimited())
+	}
+	if len(stats.RateLimited()) != 0 {
+		t.Errorf("expected no count-based limiting but got %v", stats.RateLimited())
+	}
+
+	if out := rl.Process([]appoptics.Measurement{noisy}); len(out) != 1 {
+		t.Errorf("expected the series to pass again once the interval elapsed")
+	}
+}
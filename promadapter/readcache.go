@@ -0,0 +1,211 @@
+package promadapter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReadCacheSize is how many responses a ReadCacheTransport holds at most
+const DefaultReadCacheSize = 1000
+
+// cachedResponse is a 2xx response to a GET held by a ReadCacheTransport
+type cachedResponse struct {
+	path       string
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// ReadCacheOption configures a ReadCacheTransport
+type ReadCacheOption func(*ReadCacheTransport)
+
+// WithReadCache caches the 2xx responses to GET requests for ttl
+func WithReadCache(ttl time.Duration) ReadCacheOption {
+	return func(rc *ReadCacheTransport) {
+		rc.ttl = ttl
+	}
+}
+
+// WithReadCacheScope only caches responses from the given endpoints and the resources beneath them, e.g. the
+// MetricsPath EndpointURL. Without it nothing is cached, as the transport may carry requests to other servers whose
+// responses must stay fresh.
+func WithReadCacheScope(endpoints ...string) ReadCacheOption {
+	return func(rc *ReadCacheTransport) {
+		for _, endpoint := range endpoints {
+			if u, err := url.Parse(endpoint); err == nil {
+				rc.scope = append(rc.scope, u)
+			}
+		}
+	}
+}
+
+// WithReadCacheSize holds at most size responses, discarding the least recently used first
+func WithReadCacheSize(size int) ReadCacheOption {
+	return func(rc *ReadCacheTransport) {
+		rc.size = size
+	}
+}
+
+// ReadCacheTransport is an http.RoundTripper answering GET requests from an in-memory cache keyed by URL and
+// credentials, e.g. for metric definitions that rarely change. Only 2xx responses to requests within the scope set with
+// WithReadCacheScope are cached. A cached response is dropped once its TTL
+// expires or a PUT, POST, PATCH or DELETE is sent for the same resource.
+type ReadCacheTransport struct {
+	// hits and misses come first to be 64-bit aligned for atomic access
+	hits   uint64
+	misses uint64
+	next   http.RoundTripper
+	ttl    time.Duration
+	scope  []*url.URL
+	size   int
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache *lru
+}
+
+// NewReadCacheTransport returns a ReadCacheTransport sending requests through next, caching nothing unless
+// configured with WithReadCache
+func NewReadCacheTransport(next http.RoundTripper, opts ...ReadCacheOption) *ReadCacheTransport {
+	rc := &ReadCacheTransport{next: next, size: DefaultReadCacheSize, now: time.Now}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	rc.cache = newLRU(rc.size, nil)
+	return rc
+}
+
+// RoundTrip implements http.RoundTripper
+func (rc *ReadCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rc.ttl <= 0 {
+		return rc.next.RoundTrip(req)
+	}
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		rc.invalidate(req.URL.Path)
+		return rc.next.RoundTrip(req)
+	default:
+		return rc.next.RoundTrip(req)
+	}
+
+	if !rc.inScope(req.URL) {
+		return rc.next.RoundTrip(req)
+	}
+
+	// the credentials are part of the key, so a response is never handed to a request made with other ones
+	key := req.URL.String() + "\xff" + req.Header.Get("Authorization")
+	if cached, ok := rc.get(key); ok {
+		atomic.AddUint64(&rc.hits, 1)
+		return &http.Response{
+			Status:        cached.status,
+			StatusCode:    cached.statusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        cloneHeader(cached.header),
+			Body:          ioutil.NopCloser(bytes.NewReader(cached.body)),
+			ContentLength: int64(len(cached.body)),
+			Request:       req,
+		}, nil
+	}
+	atomic.AddUint64(&rc.misses, 1)
+
+	resp, err := rc.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	rc.mu.Lock()
+	rc.cache.Add(key, &cachedResponse{
+		path:       req.URL.Path,
+		status:     resp.Status,
+		statusCode: resp.StatusCode,
+		header:     cloneHeader(resp.Header),
+		body:       body,
+		expires:    rc.now().Add(rc.ttl),
+	})
+	rc.mu.Unlock()
+	return resp, nil
+}
+
+// inScope returns true if u is one of the endpoints set with WithReadCacheScope or a resource beneath one
+func (rc *ReadCacheTransport) inScope(u *url.URL) bool {
+	for _, endpoint := range rc.scope {
+		if u.Scheme != endpoint.Scheme || u.Host != endpoint.Host {
+			continue
+		}
+		prefix := strings.TrimSuffix(endpoint.Path, "/")
+		if u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the cached response under key, dropping it if it has expired
+func (rc *ReadCacheTransport) get(key string) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	v, ok := rc.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	cached := v.(*cachedResponse)
+	if !rc.now().Before(cached.expires) {
+		rc.cache.Remove(key)
+		return nil, false
+	}
+	return cached, true
+}
+
+// invalidate drops every cached response for the resource at path, whatever its query
+func (rc *ReadCacheTransport) invalidate(path string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for key, el := range rc.cache.items {
+		if el.Value.(*lruEntry).value.(*cachedResponse).path == path {
+			rc.cache.Remove(key)
+		}
+	}
+}
+
+// CacheSize returns the number of responses cached, including expired ones not yet dropped
+func (rc *ReadCacheTransport) CacheSize() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.cache.Len()
+}
+
+// CacheHits returns the number of GET requests answered from the cache
+func (rc *ReadCacheTransport) CacheHits() uint64 {
+	return atomic.LoadUint64(&rc.hits)
+}
+
+// CacheMisses returns the number of GET requests sent on because no fresh response was cached
+func (rc *ReadCacheTransport) CacheMisses() uint64 {
+	return atomic.LoadUint64(&rc.misses)
+}
+
+// cloneHeader returns a deep copy of h
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for k, v := range h {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
@@ -0,0 +1,99 @@
+package promadapter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadCacheTransport(t *testing.T) {
+	var gets int
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"name":"node_load1"}`))
+	}))
+	defer server.Close()
+
+	now := time.Unix(timestampFixture, 0)
+	rc := NewReadCacheTransport(http.DefaultTransport, WithReadCache(time.Minute), WithReadCacheScope(server.URL+"/v1/metrics"))
+	rc.now = func() time.Time { return now }
+	client := &http.Client{Transport: rc}
+	do := func(method, path string) string {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Basic dG9rZW46")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("a GET is answered from the cache", func(t *testing.T) {
+		do(http.MethodGet, "/v1/metrics/node_load1")
+		if body := do(http.MethodGet, "/v1/metrics/node_load1"); body != `{"name":"node_load1"}` {
+			t.Errorf("expected the cached body but got %q", body)
+		}
+		if gets != 1 || rc.CacheHits() != 1 || rc.CacheMisses() != 1 || rc.CacheSize() != 1 {
+			t.Errorf("expected 1 request, hit and miss but got %d requests, %d hits and %d misses", gets, rc.CacheHits(), rc.CacheMisses())
+		}
+	})
+
+	t.Run("a write drops the cached response", func(t *testing.T) {
+		do(http.MethodPut, "/v1/metrics/node_load1")
+		if rc.CacheSize() != 0 {
+			t.Errorf("expected the PUT to drop the cached response but %d remain", rc.CacheSize())
+		}
+		do(http.MethodGet, "/v1/metrics/node_load1")
+		if gets != 2 {
+			t.Errorf("expected the GET to be sent again but got %d requests", gets)
+		}
+	})
+
+	t.Run("an expired response is fetched again", func(t *testing.T) {
+		defer func(start time.Time) { now = start }(now)
+		now = now.Add(time.Minute)
+		do(http.MethodGet, "/v1/metrics/node_load1")
+		if gets != 3 {
+			t.Errorf("expected the GET to be sent again but got %d requests", gets)
+		}
+	})
+
+	t.Run("requests outside the scope are not cached", func(t *testing.T) {
+		do(http.MethodGet, "/federate")
+		do(http.MethodGet, "/federate")
+		do(http.MethodGet, "/v1/metricsfoo")
+		if gets != 6 {
+			t.Errorf("expected every GET to be sent but got %d requests", gets-3)
+		}
+	})
+
+	t.Run("responses are not shared between credentials", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/metrics/node_load1", nil)
+		req.Header.Set("Authorization", "Basic b3RoZXI6")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		resp.Body.Close()
+		if gets != 7 {
+			t.Errorf("expected the GET with other credentials to be sent but got %d requests", gets-6)
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		status = http.StatusNotFound
+		do(http.MethodGet, "/v1/metrics/missing")
+		do(http.MethodGet, "/v1/metrics/missing")
+		if gets != 9 {
+			t.Errorf("expected both GETs to be sent but got %d requests", gets-7)
+		}
+	})
+}
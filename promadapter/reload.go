@@ -0,0 +1,110 @@
+package promadapter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+// Outcomes of reloading a FileConfig
+const (
+	ReloadSuccess = "success"
+	ReloadError   = "error"
+)
+
+// FileConfig is the part of the adapter's configuration that can be kept in a YAML file and changed without a restart
+type FileConfig struct {
+	Allowlist     []string          `yaml:"allowlist"`
+	Denylist      []string          `yaml:"denylist"`
+	GlobalTags    map[string]string `yaml:"global_tags"`
+	LabelMappings map[string]string `yaml:"label_mappings"`
+}
+
+// LoadFileConfig reads and decodes the YAML file at path
+func LoadFileConfig(path string) (FileConfig, error) {
+	var fc FileConfig
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fc, fmt.Errorf("decoding %s: %s", path, err)
+	}
+	return fc, nil
+}
+
+// DefaultReloadDelay is how long a ConfigWatcher waits for changes to a file to settle before reloading it
+const DefaultReloadDelay = 100 * time.Millisecond
+
+// ConfigWatcher reloads a FileConfig whenever its file changes, handing it to apply. apply validates the new
+// configuration and must leave the current one in effect if it returns an error.
+type ConfigWatcher struct {
+	path  string
+	apply func(FileConfig) error
+	stats *Stats
+	delay time.Duration
+}
+
+// NewConfigWatcher returns a ConfigWatcher for the YAML file at path
+func NewConfigWatcher(path string, apply func(FileConfig) error, stats *Stats) *ConfigWatcher {
+	return &ConfigWatcher{path: path, apply: apply, stats: stats, delay: DefaultReloadDelay}
+}
+
+// Load reads the file and applies it once, recording the outcome
+func (cw *ConfigWatcher) Load() error {
+	fc, err := LoadFileConfig(cw.path)
+	if err == nil {
+		err = cw.apply(fc)
+	}
+	if err != nil {
+		cw.stats.AddConfigReload(ReloadError)
+		return err
+	}
+	cw.stats.AddConfigReload(ReloadSuccess)
+	return nil
+}
+
+// Watch reloads the file every time it is written or replaced until stop is closed. The file's directory is watched
+// rather than the file itself so that editors and ConfigMap updates that swap the file in are noticed too. Bursts of
+// changes, like a truncate followed by a write, cause a single reload once the file has been quiet for the delay, so a
+// half-written file is not mistaken for an empty configuration.
+func (cw *ConfigWatcher) Watch(stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(cw.path)); err != nil {
+		return err
+	}
+
+	settle := time.NewTimer(cw.delay)
+	settle.Stop()
+	defer settle.Stop()
+
+	target := filepath.Clean(cw.path)
+	for {
+		select {
+		case event := <-watcher.Events:
+			if filepath.Clean(event.Name) != target || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			settle.Reset(cw.delay)
+		case <-settle.C:
+			if err := cw.Load(); err != nil {
+				log.Printf("keeping the current configuration, reloading %s failed: %s\n", cw.path, err)
+				continue
+			}
+			log.Printf("reloaded %s\n", cw.path)
+		case err := <-watcher.Errors:
+			log.Printf("watching %s: %s\n", cw.path, err)
+		case <-stop:
+			return nil
+		}
+	}
+}
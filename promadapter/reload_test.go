@@ -0,0 +1,71 @@
+package promadapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus2appoptics")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("allowlist: [\"http_.*\"]\n"), 0644); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	applied := make(chan FileConfig, 10)
+	stats := NewStats()
+	cw := NewConfigWatcher(path, func(fc FileConfig) error {
+		applied <- fc
+		return nil
+	}, stats)
+
+	if err := cw.Load(); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if fc := <-applied; len(fc.Allowlist) != 1 || fc.Allowlist[0] != "http_.*" {
+		t.Errorf("unexpected initial config %+v", fc)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go cw.Watch(stop)
+	// give the watcher time to start before changing the file
+	time.Sleep(100 * time.Millisecond)
+
+	if err := ioutil.WriteFile(path, []byte("allowlist: [\n"), 0644); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	waitFor(t, func() bool { return stats.ConfigReloads()[ReloadError] > 0 })
+
+	if err := ioutil.WriteFile(path, []byte("global_tags: {env: prod}\nlabel_mappings: {instance: host}\n"), 0644); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	select {
+	case fc := <-applied:
+		if fc.GlobalTags["env"] != "prod" || fc.LabelMappings["instance"] != "host" {
+			t.Errorf("unexpected reloaded config %+v", fc)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the changed config to be applied")
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected a single reload but got %d more", len(applied))
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,75 @@
+package promadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDKey is the context key the ID of the request being handled is stored under
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "" if it carries none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 128-bit request ID, hex encoded
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIDHandler reads the request ID of every request from the header named incoming, generating one if the
+// header is missing, and passes it to next in the request context. The ID is echoed in the same response header so
+// callers can correlate their requests with the adapter's logs.
+func RequestIDHandler(incoming string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(incoming)
+		if id == "" {
+			id = NewRequestID()
+		}
+		w.Header().Set(incoming, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestIDTransport is an http.RoundTripper setting a request ID header on every request, forwarding the ID carried by
+// the request context and generating one if there is none
+type RequestIDTransport struct {
+	header string
+	next   http.RoundTripper
+}
+
+// NewRequestIDTransport returns a RequestIDTransport setting the header named header and sending requests through next
+func NewRequestIDTransport(header string, next http.RoundTripper) *RequestIDTransport {
+	return &RequestIDTransport{header: header, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(rt.header) != "" {
+		return rt.next.RoundTrip(req)
+	}
+	id := RequestIDFromContext(req.Context())
+	if id == "" {
+		id = NewRequestID()
+	}
+
+	tagged := new(http.Request)
+	*tagged = *req
+	tagged.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		tagged.Header[k] = v
+	}
+	tagged.Header.Set(rt.header, id)
+	return rt.next.RoundTrip(tagged)
+}
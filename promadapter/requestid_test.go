@@ -0,0 +1,58 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var forwarded []string
+	appOptics := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get("X-Request-Id"))
+		json.NewEncoder(w).Encode(AnnotationEvent{ID: 1})
+	}))
+	defer appOptics.Close()
+
+	client := &http.Client{Transport: NewRequestIDTransport("X-Request-Id", http.DefaultTransport)}
+	annotations := NewAnnotationsClient(appOptics.URL+"/annotations", "alerts", "token", client)
+	adapter := httptest.NewServer(RequestIDHandler("X-Trace-Id", AlertmanagerHandler(annotations)))
+	defer adapter.Close()
+
+	post := func(alertname, traceID string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, adapter.URL, bytes.NewBufferString(`{"alerts": [{"status": "firing", "labels": {"alertname": "`+alertname+`"}}]}`))
+		if traceID != "" {
+			req.Header.Set("X-Trace-Id", traceID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("incoming trace ids are forwarded", func(t *testing.T) {
+		forwarded = nil
+		resp := post("HighLatency", "trace-1234")
+		if len(forwarded) != 1 || forwarded[0] != "trace-1234" {
+			t.Errorf("expected the trace id to be forwarded but got %v", forwarded)
+		}
+		if id := resp.Header.Get("X-Trace-Id"); id != "trace-1234" {
+			t.Errorf("expected the trace id to be echoed but got %q", id)
+		}
+	})
+
+	t.Run("missing trace ids are generated", func(t *testing.T) {
+		forwarded = nil
+		resp := post("DiskFull", "")
+		if len(forwarded) != 1 || len(forwarded[0]) != 32 {
+			t.Fatalf("expected a generated request id to be forwarded but got %v", forwarded)
+		}
+		if id := resp.Header.Get("X-Trace-Id"); id != forwarded[0] {
+			t.Errorf("expected the generated id %s to be echoed but got %q", forwarded[0], id)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package promadapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PriorityHeader is the header AppOptics enterprise plans read the priority of a request from
+const PriorityHeader = "X-Priority"
+
+// RequestPriority is how urgently AppOptics should process a request during API congestion
+type RequestPriority int
+
+const (
+	// PriorityLow requests are processed after all others
+	PriorityLow RequestPriority = iota - 1
+	// PriorityNormal requests are sent without a priority header
+	PriorityNormal
+	// PriorityHigh requests are processed first
+	PriorityHigh
+)
+
+// ParseRequestPriority converts "low", "normal" or "high" into a RequestPriority
+func ParseRequestPriority(s string) (RequestPriority, error) {
+	switch s {
+	case "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown request priority %q", s)
+}
+
+// String returns the header value of the RequestPriority
+func (p RequestPriority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+// ParseMetricRequestPriority parses a "metric=priority" pair
+func ParseMetricRequestPriority(s string) (string, RequestPriority, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 {
+		return "", PriorityNormal, fmt.Errorf("expected metric=priority but got %q", s)
+	}
+	priority, err := ParseRequestPriority(s[i+1:])
+	if err != nil {
+		return "", PriorityNormal, err
+	}
+	return s[:i], priority, nil
+}
+
+// RequestPriorities decide the priority Measurements are sent with: that of their metric in Metrics, or Default
+type RequestPriorities struct {
+	Default RequestPriority
+	Metrics map[string]RequestPriority
+}
+
+// of returns the priority the Measurements of the named metric are sent with
+func (rp RequestPriorities) of(name string) RequestPriority {
+	if p, ok := rp.Metrics[name]; ok {
+		return p
+	}
+	return rp.Default
+}
+
+// requestPriorityKey is the context key the priority of a request is stored under
+type requestPriorityKey struct{}
+
+// WithRequestPriority returns a copy of ctx carrying the priority requests made with it are sent with
+func WithRequestPriority(ctx context.Context, p RequestPriority) context.Context {
+	return context.WithValue(ctx, requestPriorityKey{}, p)
+}
+
+// PriorityTransport is an http.RoundTripper setting the PriorityHeader of requests: to the RequestPriority their
+// context carries, or to a default. Requests of PriorityNormal are sent without the header.
+type PriorityTransport struct {
+	priority RequestPriority
+	next     http.RoundTripper
+}
+
+// NewPriorityTransport returns a PriorityTransport defaulting to priority and sending requests through next
+func NewPriorityTransport(priority RequestPriority, next http.RoundTripper) *PriorityTransport {
+	return &PriorityTransport{priority: priority, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (pt *PriorityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, ok := req.Context().Value(requestPriorityKey{}).(RequestPriority)
+	if !ok {
+		p = pt.priority
+	}
+	if p == PriorityNormal {
+		return pt.next.RoundTrip(req)
+	}
+
+	prioritized := new(http.Request)
+	*prioritized = *req
+	prioritized.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		prioritized.Header[k] = v
+	}
+	prioritized.Header.Set(PriorityHeader, p.String())
+	return pt.next.RoundTrip(prioritized)
+}
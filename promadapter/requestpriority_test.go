@@ -0,0 +1,97 @@
+package promadapter
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestRequestPriority(t *testing.T) {
+	var mu sync.Mutex
+	var priorities []string
+	var names [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var lines []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		mu.Lock()
+		priorities = append(priorities, r.Header.Get(PriorityHeader))
+		names = append(names, lines)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "node_load1", Value: valueFixture, Time: timestampFixture},
+		{Name: "up", Value: valueFixture, Time: timestampFixture},
+		{Name: "debug_info", Value: valueFixture, Time: timestampFixture},
+	}}
+
+	t.Run("the default priority is sent with every request", func(t *testing.T) {
+		priorities, names = nil, nil
+		client := &http.Client{Transport: NewPriorityTransport(PriorityLow, http.DefaultTransport)}
+		nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, client)
+		if _, err := nc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(priorities) != 1 || priorities[0] != "low" {
+			t.Errorf("expected a single low priority request but got %q", priorities)
+		}
+	})
+
+	t.Run("normal priority sends no header", func(t *testing.T) {
+		priorities, names = nil, nil
+		client := &http.Client{Transport: NewPriorityTransport(PriorityNormal, http.DefaultTransport)}
+		nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, client)
+		if _, err := nc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(priorities) != 1 || priorities[0] != "" {
+			t.Errorf("expected no priority header but got %q", priorities)
+		}
+	})
+
+	t.Run("metrics are sent in requests of their own priority, highest first", func(t *testing.T) {
+		priorities, names = nil, nil
+		client := &http.Client{Transport: NewPriorityTransport(PriorityNormal, http.DefaultTransport)}
+		nc := NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, client)
+		nc.SetRequestPriorities(RequestPriorities{
+			Default: PriorityNormal,
+			Metrics: map[string]RequestPriority{"up": PriorityHigh, "debug_info": PriorityLow},
+		})
+		if _, err := nc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		expected := []string{"high", "", "low"}
+		if len(priorities) != len(expected) {
+			t.Fatalf("expected %d requests but got %d", len(expected), len(priorities))
+		}
+		for i := range expected {
+			if priorities[i] != expected[i] || len(names[i]) != 1 {
+				t.Errorf("expected request %d to carry one measurement with priority %q but got %d with %q", i, expected[i], len(names[i]), priorities[i])
+			}
+		}
+	})
+
+	t.Run("metric=priority pairs are parsed", func(t *testing.T) {
+		name, priority, err := ParseMetricRequestPriority("up=high")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if name != "up" || priority != PriorityHigh {
+			t.Errorf("expected up and high but got %s and %s", name, priority)
+		}
+		for _, invalid := range []string{"up", "=high", "up=urgent"} {
+			if _, _, err := ParseMetricRequestPriority(invalid); err == nil {
+				t.Errorf("expected an error for %q", invalid)
+			}
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RequestIDHeader is the response header AppOptics identifies every request with
+const RequestIDHeader = "X-Request-Id"
+
+// maxErrorBody is how much of a response body is quoted in an error
+const maxErrorBody = 512
+
+// htmlTag matches HTML tags, along with the contents of head, script and style elements
+var htmlTag = regexp.MustCompile(`(?is)<(head|script|style)\b.*?</(head|script|style)>|<[^>]*>`)
+
+// APIError is an unsuccessful response from AppOptics or another endpoint the adapter calls itself
+type APIError struct {
+	// What names the endpoint, e.g. "NDJSON ingest"
+	What       string
+	StatusCode int
+	// RequestID is the ID the response was identified with, empty if there was none
+	RequestID string
+	// Message is a single line of text from the response body
+	Message string
+}
+
+// Error includes the request ID when there is one so that operators can quote it to AppOptics support
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s responded with %d (request ID %s): %s", e.What, e.StatusCode, e.RequestID, e.Message)
+	}
+	return fmt.Sprintf("%s responded with %d: %s", e.What, e.StatusCode, e.Message)
+}
+
+// responseError returns an *APIError describing an unsuccessful response from what
+func responseError(what string, resp *http.Response, body []byte) error {
+	return &APIError{
+		What:       what,
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(RequestIDHeader),
+		Message:    errorText(resp.Header.Get("Content-Type"), body),
+	}
+}
+
+// hasErrorsField returns true if body is a JSON object with a non-empty "errors" field, which is how AppOptics reports
+// errors. Misconfigured gateways have been seen to pass such bodies on with a 200.
+func hasErrorsField(body []byte) bool {
+	var parsed struct {
+		Errors json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return false
+	}
+	switch string(bytes.TrimSpace(parsed.Errors)) {
+	case "", "null", "{}", "[]", `""`:
+		return false
+	}
+	return true
+}
+
+// errorText returns a single line of at most maxErrorBody bytes from an error response body. The markup of HTML
+// pages, such as those returned by proxies and gateways, is removed so that only their message is left.
+func errorText(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	start := bytes.ToLower(bytes.TrimSpace(body))
+	if mediaType == "text/html" || bytes.HasPrefix(start, []byte("<html")) || bytes.HasPrefix(start, []byte("<!doctype html")) {
+		body = htmlTag.ReplaceAll(body, []byte(" "))
+	}
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if len(text) <= maxErrorBody {
+		return text
+	}
+
+	cut := maxErrorBody
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
@@ -0,0 +1,39 @@
+package promadapter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const gatewayTimeoutFixture = `<html>
+<head><title>504 Gateway Time-out</title><style>body { color: red; }</style></head>
+<body>
+<center><h1>504 Gateway Time-out</h1></center>
+<hr><center>nginx</center>
+</body>
+</html>`
+
+func TestResponseError(t *testing.T) {
+	t.Run("HTML pages are reduced to their text", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusGatewayTimeout, Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}}
+
+		err := responseError("NDJSON ingest", resp, []byte(gatewayTimeoutFixture))
+		if expected := "NDJSON ingest responded with 504: 504 Gateway Time-out nginx"; err.Error() != expected {
+			t.Errorf("expected %q but got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("long bodies are truncated", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}
+
+		err := responseError("NDJSON ingest", resp, []byte(strings.Repeat("é", maxErrorBody)))
+		text := strings.TrimPrefix(err.Error(), "NDJSON ingest responded with 502: ")
+		if !strings.HasSuffix(text, "...") || len(text) > maxErrorBody+3 {
+			t.Errorf("expected the body to be truncated but got %d bytes", len(text))
+		}
+		if !strings.HasPrefix(text, "é") || strings.ContainsRune(text, '�') {
+			t.Error("expected the body to be truncated on a rune boundary")
+		}
+	})
+}
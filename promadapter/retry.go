@@ -0,0 +1,148 @@
+package promadapter
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// RetryPolicy decides which failed submissions to AppOptics are worth attempting again
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a batch is sent before giving up
+	MaxAttempts int
+	// Backoff decides the pause before each retry, unless the response asks for one with a Retry-After header
+	Backoff Backoff
+	// StatusCodes are the 4xx response codes that are retried. 5xx responses and network errors are always retried.
+	StatusCodes map[int]bool
+	// Budget bounds the time all attempts at a batch and the pauses between them take together. Zero means no bound.
+	Budget time.Duration
+	// AttemptTimeout bounds the time a single attempt takes. Zero means only the Budget bounds it.
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns a RetryPolicy retrying network errors, 5xx, 408 and 429 responses with exponential
+// backoff starting at a second
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     ExponentialBackoff{Base: time.Second, Max: time.Minute, Jitter: 0.2},
+		StatusCodes: map[int]bool{
+			http.StatusRequestTimeout:  true,
+			http.StatusTooManyRequests: true,
+		},
+	}
+}
+
+// Retryable returns true if a submission that produced the given response and error should be attempted again
+func (p RetryPolicy) Retryable(resp *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	if resp == nil {
+		return true
+	}
+	if resp.StatusCode >= 500 {
+		return true
+	}
+	return p.StatusCodes[resp.StatusCode]
+}
+
+// Delay returns how long to wait after the given attempt failed with resp: what the response asks for in a
+// Retry-After header if anything, and what the Backoff decides otherwise
+func (p RetryPolicy) Delay(attempt int, resp *http.Response, now time.Time) time.Duration {
+	if d, ok := retryAfter(resp, now); ok {
+		return d
+	}
+	return p.Backoff.NextDelay(attempt, resp)
+}
+
+// ContextCommunicator is a MeasurementsCommunicator whose requests can be bounded by a context
+type ContextCommunicator interface {
+	appoptics.MeasurementsCommunicator
+	CreateContext(ctx context.Context, batch *appoptics.MeasurementsBatch) (*http.Response, error)
+}
+
+// RetryingCommunicator wraps a MeasurementsCommunicator, resending batches that fail according to its RetryPolicy
+type RetryingCommunicator struct {
+	mc     appoptics.MeasurementsCommunicator
+	policy RetryPolicy
+	stats  *Stats
+	sleep  func(time.Duration)
+	now    func() time.Time
+}
+
+// NewRetryingCommunicator returns a RetryingCommunicator sending through mc and counting retries in stats
+func NewRetryingCommunicator(mc appoptics.MeasurementsCommunicator, policy RetryPolicy, stats *Stats) *RetryingCommunicator {
+	return &RetryingCommunicator{mc: mc, policy: policy, stats: stats, sleep: time.Sleep, now: time.Now}
+}
+
+// Create persists the batch, retrying failures the RetryPolicy considers transient for as long as the Budget allows.
+// After a *PartialSubmissionError only the Measurements that were not accepted are sent again, and a final one
+// carries their indices into the original batch.
+func (rc *RetryingCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	var deadline time.Time
+	if rc.policy.Budget > 0 {
+		deadline = rc.now().Add(rc.policy.Budget)
+	}
+	// positions maps the indices of the batch being sent to those of the original one, once it has been narrowed
+	var positions []int
+	for attempt := 1; ; attempt++ {
+		resp, err := rc.attempt(batch, deadline)
+		partial, isPartial := err.(*PartialSubmissionError)
+		if isPartial && positions != nil {
+			unsent := make([]int, len(partial.Unsent))
+			for i, idx := range partial.Unsent {
+				unsent[i] = positions[idx]
+			}
+			err = &PartialSubmissionError{Err: partial.Err, Unsent: unsent}
+		}
+		if attempt >= rc.policy.MaxAttempts || !rc.policy.Retryable(resp, err) {
+			return resp, err
+		}
+		delay := rc.policy.Delay(attempt, resp, rc.now())
+		if !deadline.IsZero() && !rc.now().Add(delay).Before(deadline) {
+			LogError("giving up on batch after attempt %d failed, the retry budget is spent: %s\n", attempt, err)
+			return resp, err
+		}
+
+		if isPartial {
+			batch = unsentBatch(batch, partial.Unsent)
+			positions = err.(*PartialSubmissionError).Unsent
+		}
+		LogError("retrying batch after attempt %d failed: %s\n", attempt, err)
+		rc.stats.AddRetries(1)
+		rc.sleep(delay)
+	}
+}
+
+// unsentBatch returns a copy of batch holding only the Measurements at indices
+func unsentBatch(batch *appoptics.MeasurementsBatch, indices []int) *appoptics.MeasurementsBatch {
+	unsent := *batch
+	unsent.Measurements = make([]appoptics.Measurement, len(indices))
+	for i, idx := range indices {
+		unsent.Measurements[i] = batch.Measurements[idx]
+	}
+	return &unsent
+}
+
+// attempt sends the batch once. If the wrapped communicator is a ContextCommunicator its requests are bounded by the
+// AttemptTimeout or what is left of the budget before deadline, whichever is shorter, so that a single slow attempt
+// does not use up the whole budget. Otherwise the attempt is only bounded by the communicator's own HTTP client.
+func (rc *RetryingCommunicator) attempt(batch *appoptics.MeasurementsBatch, deadline time.Time) (*http.Response, error) {
+	cc, ok := rc.mc.(ContextCommunicator)
+	if !ok || (rc.policy.AttemptTimeout <= 0 && deadline.IsZero()) {
+		return rc.mc.Create(batch)
+	}
+
+	timeout := rc.policy.AttemptTimeout
+	if !deadline.IsZero() {
+		if remaining := deadline.Sub(rc.now()); timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return cc.CreateContext(ctx, batch)
+}
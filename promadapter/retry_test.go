@@ -0,0 +1,220 @@
+package promadapter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// stubCommunicator responds to each Create call with the next status code, recording every batch it receives
+type stubCommunicator struct {
+	statusCodes []int
+	batches     []*appoptics.MeasurementsBatch
+}
+
+func (sc *stubCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	code := sc.statusCodes[len(sc.batches)%len(sc.statusCodes)]
+	sc.batches = append(sc.batches, batch)
+	resp := &http.Response{StatusCode: code}
+	if code >= 300 {
+		return resp, errors.New(http.StatusText(code))
+	}
+	return resp, nil
+}
+
+func TestRetryingCommunicator(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}}
+
+	t.Run("408 is retried when configured", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusRequestTimeout, http.StatusAccepted}}
+		rc := NewRetryingCommunicator(stub, DefaultRetryPolicy(), NewStats())
+		rc.sleep = func(time.Duration) {}
+
+		resp, err := rc.Create(batch)
+		if err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("Expected status 202 but received %d", resp.StatusCode)
+		}
+		if len(stub.batches) != 2 {
+			t.Errorf("expected 2 attempts but got %d", len(stub.batches))
+		}
+	})
+
+	t.Run("408 is not retried when not configured", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusRequestTimeout, http.StatusAccepted}}
+		policy := DefaultRetryPolicy()
+		policy.StatusCodes = map[int]bool{}
+		rc := NewRetryingCommunicator(stub, policy, NewStats())
+		rc.sleep = func(time.Duration) {}
+
+		if _, err := rc.Create(batch); err == nil {
+			t.Error("expected an error but got none")
+		}
+		if len(stub.batches) != 1 {
+			t.Errorf("expected 1 attempt but got %d", len(stub.batches))
+		}
+	})
+
+	t.Run("400 is never retried", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusBadRequest}}
+		rc := NewRetryingCommunicator(stub, DefaultRetryPolicy(), NewStats())
+		rc.sleep = func(time.Duration) {}
+
+		if _, err := rc.Create(batch); err == nil {
+			t.Error("expected an error but got none")
+		}
+		if len(stub.batches) != 1 {
+			t.Errorf("expected 1 attempt but got %d", len(stub.batches))
+		}
+	})
+
+	t.Run("5xx is retried until attempts run out", func(t *testing.T) {
+		stub := &stubCommunicator{statusCodes: []int{http.StatusBadGateway}}
+		rc := NewRetryingCommunicator(stub, DefaultRetryPolicy(), NewStats())
+		rc.sleep = func(time.Duration) {}
+
+		if _, err := rc.Create(batch); err == nil {
+			t.Error("expected an error but got none")
+		}
+		if len(stub.batches) != 3 {
+			t.Errorf("expected 3 attempts but got %d", len(stub.batches))
+		}
+	})
+}
+
+// recordingBackoff is a Backoff returning attempt seconds and recording every attempt it is asked about
+type recordingBackoff struct {
+	attempts []int
+}
+
+func (rb *recordingBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	rb.attempts = append(rb.attempts, attempt)
+	return time.Duration(attempt) * time.Second
+}
+
+// communicatorFunc is a MeasurementsCommunicator calling itself
+type communicatorFunc func(*appoptics.MeasurementsBatch) (*http.Response, error)
+
+func (f communicatorFunc) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	return f(batch)
+}
+
+func TestRetryingCommunicatorBackoff(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}}
+
+	t.Run("a custom backoff decides the delays", func(t *testing.T) {
+		backoff := &recordingBackoff{}
+		policy := DefaultRetryPolicy()
+		policy.MaxAttempts = 4
+		policy.Backoff = backoff
+		rc := NewRetryingCommunicator(&stubCommunicator{statusCodes: []int{http.StatusBadGateway}}, policy, NewStats())
+		var delays []time.Duration
+		rc.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+		rc.Create(batch)
+
+		expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+		if len(delays) != len(expected) {
+			t.Fatalf("expected %v but got %v", expected, delays)
+		}
+		for i := range expected {
+			if delays[i] != expected[i] || backoff.attempts[i] != i+1 {
+				t.Errorf("expected delay %s after attempt %d but got %s after %d", expected[i], i+1, delays[i], backoff.attempts[i])
+			}
+		}
+	})
+
+	t.Run("Retry-After overrides the backoff", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.Backoff = &recordingBackoff{}
+		var calls int
+		mc := communicatorFunc(func(*appoptics.MeasurementsBatch) (*http.Response, error) {
+			calls++
+			if calls > 1 {
+				return &http.Response{StatusCode: http.StatusAccepted}, nil
+			}
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", "7")
+			return resp, errors.New("Too Many Requests")
+		})
+		rc := NewRetryingCommunicator(mc, policy, NewStats())
+		var delays []time.Duration
+		rc.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+		if _, err := rc.Create(batch); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(delays) != 1 || delays[0] != 7*time.Second {
+			t.Errorf("expected to wait the 7s asked for but got %v", delays)
+		}
+	})
+}
+
+// deadlineCommunicator is a ContextCommunicator recording how long each attempt was given, taking the time of the
+// attempt on a fake clock before failing with a 503
+type deadlineCommunicator struct {
+	clock    *time.Time
+	took     time.Duration
+	timeouts []time.Duration
+}
+
+func (dc *deadlineCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	return dc.CreateContext(context.Background(), batch)
+}
+
+func (dc *deadlineCommunicator) CreateContext(ctx context.Context, batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	dc.timeouts = append(dc.timeouts, timeout)
+	*dc.clock = dc.clock.Add(dc.took)
+	return &http.Response{StatusCode: http.StatusServiceUnavailable}, errors.New(http.StatusText(http.StatusServiceUnavailable))
+}
+
+func TestRetryingCommunicatorBudget(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}}
+	policy := DefaultRetryPolicy()
+	policy.Backoff = ConstantBackoff{Delay: 3 * time.Second}
+	policy.Budget = 10 * time.Second
+	policy.AttemptTimeout = 5 * time.Second
+
+	newCommunicator := func(dc *deadlineCommunicator) *RetryingCommunicator {
+		rc := NewRetryingCommunicator(dc, policy, NewStats())
+		rc.now = func() time.Time { return *dc.clock }
+		rc.sleep = func(d time.Duration) { *dc.clock = dc.clock.Add(d) }
+		return rc
+	}
+
+	t.Run("the last attempt gets what is left of the budget", func(t *testing.T) {
+		clock := time.Unix(timestampFixture, 0)
+		dc := &deadlineCommunicator{clock: &clock, took: 5 * time.Second}
+		if _, err := newCommunicator(dc).Create(batch); err == nil {
+			t.Fatal("expected the last failure to be returned")
+		}
+		if len(dc.timeouts) != 2 {
+			t.Fatalf("expected 2 attempts but got %d", len(dc.timeouts))
+		}
+		if dc.timeouts[0] > 5*time.Second || dc.timeouts[0] < 4*time.Second {
+			t.Errorf("expected the first attempt to get the attempt timeout of 5s but got %s", dc.timeouts[0])
+		}
+		if dc.timeouts[1] > 2*time.Second || dc.timeouts[1] < time.Second {
+			t.Errorf("expected the last attempt to get the 2s left of the budget but got %s", dc.timeouts[1])
+		}
+	})
+
+	t.Run("no attempt is made once the budget is spent", func(t *testing.T) {
+		clock := time.Unix(timestampFixture, 0)
+		dc := &deadlineCommunicator{clock: &clock, took: 8 * time.Second}
+		newCommunicator(dc).Create(batch)
+		if len(dc.timeouts) != 1 {
+			t.Errorf("expected a single attempt but got %d", len(dc.timeouts))
+		}
+	})
+}
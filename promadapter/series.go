@@ -0,0 +1,32 @@
+package promadapter
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// seriesKey returns a string uniquely identifying the series a Measurement belongs to, built from its name and its
+// Tags sorted by key
+func seriesKey(m appoptics.Measurement) string {
+	return m.Name + seriesTagsKey(m.Tags)
+}
+
+// seriesTagsKey returns the part of a series key built from the tags, empty if there are none
+func seriesTagsKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		b.WriteByte(0xff)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Types of NotificationService
+const (
+	SlackService     = "slack"
+	PagerDutyService = "pagerduty"
+	WebhookService   = "webhook"
+	MailService      = "mail"
+)
+
+// NotificationService is an AppOptics Service, where alerts are sent when they fire
+type NotificationService struct {
+	ID int `json:"id,omitempty"`
+	// Type is SlackService, PagerDutyService, WebhookService or MailService
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	// Settings are specific to the Type, e.g. the URL of a webhook
+	Settings map[string]string `json:"settings"`
+}
+
+// NewSlackService returns a Service posting alerts to the Slack channel through an incoming webhook
+func NewSlackService(webhookURL, channel string) *NotificationService {
+	return &NotificationService{
+		Type:     SlackService,
+		Title:    "Slack " + channel,
+		Settings: map[string]string{"url": webhookURL, "channel": channel},
+	}
+}
+
+// NewWebhookService returns a Service posting alerts to the URL
+func NewWebhookService(url string) *NotificationService {
+	return &NotificationService{Type: WebhookService, Title: "Webhook " + url, Settings: map[string]string{"url": url}}
+}
+
+// NewPagerDutyService returns a Service opening PagerDuty incidents for alerts with the integration key
+func NewPagerDutyService(apiKey string) *NotificationService {
+	return &NotificationService{Type: PagerDutyService, Title: "PagerDuty", Settings: map[string]string{"service_key": apiKey}}
+}
+
+// NotificationServicesCommunicator creates and manages the Services alerts are sent to
+type NotificationServicesCommunicator interface {
+	// CreateService creates the Service and returns it as created
+	CreateService(ctx context.Context, service *NotificationService) (*NotificationService, error)
+	// ListServices returns every Service of the account
+	ListServices(ctx context.Context) ([]NotificationService, error)
+	// GetService returns the Service with the ID
+	GetService(ctx context.Context, serviceID int) (*NotificationService, error)
+	// UpdateService replaces the Service with service.ID
+	UpdateService(ctx context.Context, service *NotificationService) error
+	// DeleteService deletes the Service with the ID
+	DeleteService(ctx context.Context, serviceID int) error
+	// TestService has AppOptics send a test notification through the Service with the ID
+	TestService(ctx context.Context, serviceID int) error
+}
+
+// NotificationServicesClient is a NotificationServicesCommunicator for the AppOptics services API
+type NotificationServicesClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewNotificationServicesClient returns a NotificationServicesClient for the services API at endpoint, e.g. the
+// ServicesPath EndpointURL
+func NewNotificationServicesClient(endpoint, token string, httpClient *http.Client) *NotificationServicesClient {
+	return &NotificationServicesClient{url: endpoint, token: token, httpClient: httpClient}
+}
+
+// CreateService implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) CreateService(ctx context.Context, service *NotificationService) (*NotificationService, error) {
+	var created NotificationService
+	if err := sc.do(ctx, http.MethodPost, sc.url, service, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListServices implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) ListServices(ctx context.Context) ([]NotificationService, error) {
+	var list struct {
+		Services []NotificationService `json:"services"`
+	}
+	if err := sc.do(ctx, http.MethodGet, sc.url, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Services, nil
+}
+
+// GetService implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) GetService(ctx context.Context, serviceID int) (*NotificationService, error) {
+	var service NotificationService
+	if err := sc.do(ctx, http.MethodGet, sc.serviceURL(serviceID), nil, &service); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+// UpdateService implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) UpdateService(ctx context.Context, service *NotificationService) error {
+	return sc.do(ctx, http.MethodPut, sc.serviceURL(service.ID), service, nil)
+}
+
+// DeleteService implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) DeleteService(ctx context.Context, serviceID int) error {
+	return sc.do(ctx, http.MethodDelete, sc.serviceURL(serviceID), nil, nil)
+}
+
+// TestService implements NotificationServicesCommunicator
+func (sc *NotificationServicesClient) TestService(ctx context.Context, serviceID int) error {
+	return sc.do(ctx, http.MethodPost, sc.serviceURL(serviceID)+"/test", nil, nil)
+}
+
+func (sc *NotificationServicesClient) serviceURL(serviceID int) string {
+	return sc.url + "/" + strconv.Itoa(serviceID)
+}
+
+// do sends body as JSON if it is not nil, decoding the response into out if it is not nil
+func (sc *NotificationServicesClient) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(sc.token, "")
+
+	resp, err := sc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError("services API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
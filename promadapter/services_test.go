@@ -0,0 +1,101 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotificationServicesClient(t *testing.T) {
+	var requests []string
+	var body NotificationService
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		service := NotificationService{ID: 5, Type: SlackService, Title: "Slack #alerts", Settings: map[string]string{"channel": "#alerts"}}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/services":
+			body = NotificationService{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Expected no error but received %s", err.Error())
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(service)
+		case r.Method == http.MethodGet && r.URL.Path == "/services":
+			json.NewEncoder(w).Encode(map[string][]NotificationService{"services": {service}})
+		case r.URL.Path == "/services/5" || r.URL.Path == "/services/5/test":
+			if r.Method == http.MethodGet {
+				json.NewEncoder(w).Encode(service)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": {"request": ["not found"]}}`))
+		}
+	}))
+	defer server.Close()
+
+	sc := NewNotificationServicesClient(server.URL+"/services", "token", server.Client())
+	ctx := context.Background()
+
+	created, err := sc.CreateService(ctx, NewSlackService("https://hooks.slack.com/services/T0/B0/x", "#alerts"))
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if created.ID != 5 {
+		t.Errorf("expected the created service but got %+v", created)
+	}
+	if body.Type != SlackService || body.Settings["url"] != "https://hooks.slack.com/services/T0/B0/x" || body.Settings["channel"] != "#alerts" {
+		t.Errorf("expected the slack settings to be sent but got %+v", body)
+	}
+
+	if services, err := sc.ListServices(ctx); err != nil || len(services) != 1 {
+		t.Errorf("expected 1 service but got %+v (%v)", services, err)
+	}
+	if service, err := sc.GetService(ctx, 5); err != nil || service.Title != "Slack #alerts" {
+		t.Errorf("expected the service but got %+v (%v)", service, err)
+	}
+	if err := sc.UpdateService(ctx, created); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if err := sc.TestService(ctx, 5); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if err := sc.DeleteService(ctx, 5); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+	if err := sc.DeleteService(ctx, 6); err == nil {
+		t.Error("expected an error for a missing service")
+	}
+
+	expected := []string{
+		"POST /services",
+		"GET /services",
+		"GET /services/5",
+		"PUT /services/5",
+		"POST /services/5/test",
+		"DELETE /services/5",
+		"DELETE /services/6",
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected, requests)
+			break
+		}
+	}
+
+	if s := NewPagerDutyService("key"); s.Type != PagerDutyService || s.Settings["service_key"] != "key" {
+		t.Errorf("expected a pagerduty service but got %+v", s)
+	}
+	if s := NewWebhookService("https://example.com/hook"); s.Type != WebhookService || s.Settings["url"] != "https://example.com/hook" {
+		t.Errorf("expected a webhook service but got %+v", s)
+	}
+}
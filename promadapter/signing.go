@@ -0,0 +1,68 @@
+package promadapter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers set by SigningTransport
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+)
+
+// SigningTransport is an http.RoundTripper adding an HMAC-SHA256 signature to every request, for deployments that
+// put an API gateway requiring signed requests in front of AppOptics
+type SigningTransport struct {
+	secret []byte
+	next   http.RoundTripper
+	now    func() time.Time
+}
+
+// NewSigningTransport returns a SigningTransport signing with secret and sending requests through next
+func NewSigningTransport(secret string, next http.RoundTripper) *SigningTransport {
+	return &SigningTransport{secret: []byte(secret), next: next, now: time.Now}
+}
+
+// RoundTrip implements http.RoundTripper
+func (st *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signed := new(http.Request)
+	*signed = *req
+	signed.Header = make(http.Header, len(req.Header)+2)
+	for k, v := range req.Header {
+		signed.Header[k] = v
+	}
+	if req.Body != nil {
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := strconv.FormatInt(st.now().Unix(), 10)
+	signed.Header.Set(SignatureTimestampHeader, timestamp)
+	signed.Header.Set(SignatureHeader, Sign(st.secret, req.Method, req.URL.Path, timestamp, body))
+
+	return st.next.RoundTrip(signed)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the method, path, timestamp and body, separated by newlines
+func Sign(secret []byte, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
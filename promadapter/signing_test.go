@@ -0,0 +1,48 @@
+package promadapter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSigningTransport(t *testing.T) {
+	body := []byte(`{"name":"rpc_widget_count","value":3.1415}`)
+
+	// HMAC-SHA256 of "POST\n/v1/measurements\n1500000000\n" followed by body, keyed with "s3cret"
+	const expected = "764fe93d19928f0a9e3fdb6eae3a493846c043a7eeeeb7b7473852e9b754d4e4"
+
+	var gotSignature, gotTimestamp string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(SignatureHeader)
+		gotTimestamp = r.Header.Get(SignatureTimestampHeader)
+		gotBody, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	st := NewSigningTransport("s3cret", http.DefaultTransport)
+	st.now = func() time.Time { return time.Unix(1500000000, 0) }
+	client := &http.Client{Transport: st}
+
+	req, _ := http.NewRequest("POST", server.URL+"/v1/measurements", bytes.NewReader(body))
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	if gotTimestamp != "1500000000" {
+		t.Errorf("expected timestamp 1500000000 but got %s", gotTimestamp)
+	}
+	if gotSignature != Sign([]byte("s3cret"), "POST", "/v1/measurements", "1500000000", body) {
+		t.Errorf("expected the signature to cover method, path, timestamp and body but got %s", gotSignature)
+	}
+	if gotSignature != expected {
+		t.Errorf("expected signature %s but got %s", expected, gotSignature)
+	}
+	if !bytes.Equal(gotBody, body) {
+		t.Errorf("expected the body to reach the server intact but got %s", gotBody)
+	}
+}
@@ -0,0 +1,87 @@
+package promadapter
+
+import (
+	"context"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Sink is where converted Measurements are submitted to: AppOptics, a file, stdout or a test double
+type Sink interface {
+	// Submit hands the Measurements over to the Sink, giving up once ctx is done
+	Submit(ctx context.Context, measurements []appoptics.Measurement) error
+}
+
+// AppOpticsSink is the default Sink, handing Measurements to the channel the AppOptics client batches and persists
+// them from
+type AppOpticsSink struct {
+	measurements chan<- []appoptics.Measurement
+}
+
+// NewAppOpticsSink returns an AppOpticsSink sending to measurements, e.g. the sink of an appoptics.BatchPersister
+func NewAppOpticsSink(measurements chan<- []appoptics.Measurement) *AppOpticsSink {
+	return &AppOpticsSink{measurements: measurements}
+}
+
+// Submit implements Sink. It blocks until the client takes the Measurements or ctx is done. Nothing is handed over
+// without Measurements.
+func (as *AppOpticsSink) Submit(ctx context.Context, measurements []appoptics.Measurement) error {
+	if len(measurements) == 0 {
+		return nil
+	}
+	select {
+	case as.measurements <- measurements:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CommunicatorSink is a Sink submitting every call as a single batch to a MeasurementsCommunicator, e.g. a LogSink
+// writing to a file or stdout
+type CommunicatorSink struct {
+	mc appoptics.MeasurementsCommunicator
+}
+
+// NewCommunicatorSink returns a CommunicatorSink submitting to mc
+func NewCommunicatorSink(mc appoptics.MeasurementsCommunicator) *CommunicatorSink {
+	return &CommunicatorSink{mc: mc}
+}
+
+// Submit implements Sink. MeasurementsCommunicators take no context, so ctx is only checked before submitting. No
+// batch is created without Measurements.
+func (cs *CommunicatorSink) Submit(ctx context.Context, measurements []appoptics.Measurement) error {
+	if len(measurements) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := cs.mc.Create(&appoptics.MeasurementsBatch{Measurements: measurements})
+	return err
+}
+
+// TeeSink is a Sink submitting to several Sinks in turn
+type TeeSink struct {
+	sinks []Sink
+}
+
+// NewTeeSink returns a TeeSink submitting to sinks in the order given
+func NewTeeSink(sinks ...Sink) *TeeSink {
+	return &TeeSink{sinks: sinks}
+}
+
+// Submit implements Sink. Every Sink is submitted to even if an earlier one fails, and a *MultiSinkError collects
+// the errors of those that did.
+func (ts *TeeSink) Submit(ctx context.Context, measurements []appoptics.Measurement) error {
+	var failed []error
+	for _, sink := range ts.sinks {
+		if err := sink.Submit(ctx, measurements); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return &MultiSinkError{Errors: failed}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// fakeSink records the Measurements submitted to it and fails with err
+type fakeSink struct {
+	submitted [][]appoptics.Measurement
+	err       error
+}
+
+func (fs *fakeSink) Submit(ctx context.Context, measurements []appoptics.Measurement) error {
+	fs.submitted = append(fs.submitted, measurements)
+	return fs.err
+}
+
+func TestSinks(t *testing.T) {
+	measurements := []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture, Time: timestampFixture}}
+
+	t.Run("the AppOptics sink hands measurements to the client", func(t *testing.T) {
+		ch := make(chan []appoptics.Measurement, 1)
+		if err := NewAppOpticsSink(ch).Submit(context.Background(), measurements); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if got := <-ch; len(got) != 1 || got[0].Name != metricNameFixture {
+			t.Errorf("expected the measurements on the channel but got %v", got)
+		}
+	})
+
+	t.Run("the AppOptics sink gives up when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := NewAppOpticsSink(make(chan []appoptics.Measurement)).Submit(ctx, measurements); err != context.Canceled {
+			t.Errorf("expected %v but got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("a communicator sink writes to a log sink", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := NewCommunicatorSink(NewLogSink(&buf, LogJSON)).Submit(context.Background(), measurements); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if !strings.Contains(buf.String(), metricNameFixture) {
+			t.Errorf("expected %s to be written but got %q", metricNameFixture, buf.String())
+		}
+	})
+
+	t.Run("a tee sink submits to every sink", func(t *testing.T) {
+		failing := &fakeSink{err: errors.New("unavailable")}
+		working := &fakeSink{}
+		err := NewTeeSink(failing, working).Submit(context.Background(), measurements)
+		if msErr, ok := err.(*MultiSinkError); !ok || len(msErr.Errors) != 1 {
+			t.Errorf("expected a *MultiSinkError with one error but got %#v", err)
+		}
+		if len(failing.submitted) != 1 || len(working.submitted) != 1 {
+			t.Errorf("expected both sinks to be submitted to but got %d and %d", len(failing.submitted), len(working.submitted))
+		}
+	})
+}
+
+func TestEmptySubmissions(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	stats := NewStats()
+	mc := NewInstrumentedCommunicator(NewNDJSONCommunicator(server.URL, "token", StandardPadded, 0, server.Client()), stats)
+
+	for name, measurements := range map[string][]appoptics.Measurement{"nil": nil, "empty": {}} {
+		t.Run(name+" batches make no request", func(t *testing.T) {
+			if err := NewCommunicatorSink(mc).Submit(context.Background(), measurements); err != nil {
+				t.Errorf("Expected no error but received %s", err.Error())
+			}
+			if _, err := mc.Create(&appoptics.MeasurementsBatch{Measurements: measurements}); err != nil {
+				t.Errorf("Expected no error but received %s", err.Error())
+			}
+			if errs, err := NewValidator(server.URL, "token", server.Client()).Validate(context.Background(), measurements); err != nil || len(errs) != 0 {
+				t.Errorf("expected nothing to validate but got %v and %v", errs, err)
+			}
+			if requests != 0 || len(stats.SubmissionOutcomes()) != 0 {
+				t.Errorf("expected no request and no submission but got %d requests", requests)
+			}
+		})
+	}
+
+	t.Run("the AppOptics sink hands nothing to the client", func(t *testing.T) {
+		if err := NewAppOpticsSink(make(chan []appoptics.Measurement)).Submit(context.Background(), nil); err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+	})
+}
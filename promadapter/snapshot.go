@@ -0,0 +1,59 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Snapshot retains the most recent Measurement of every series that has passed through the adapter so operators can
+// see what is being sent to AppOptics. Only the most recently seen series are kept, so churning series do not grow it
+// without bound.
+type Snapshot struct {
+	mu     sync.Mutex
+	latest *lru
+}
+
+// NewSnapshot returns an empty Snapshot retaining at most maxSeries series
+func NewSnapshot(maxSeries int) *Snapshot {
+	return &Snapshot{latest: newLRU(maxSeries, nil)}
+}
+
+// Record stores the Measurements, replacing any previous Measurement of the same series
+func (s *Snapshot) Record(measurements []appoptics.Measurement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range measurements {
+		s.latest.Add(seriesKey(m), m)
+	}
+}
+
+// Process implements Stage, recording the Measurements and passing them on unchanged
+func (s *Snapshot) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	s.Record(measurements)
+	return measurements
+}
+
+// JSONLines returns the retained Measurements as JSON, one Measurement per line, ordered by series
+func (s *Snapshot) JSONLines() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, s.latest.Len())
+	for k := range s.latest.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, k := range keys {
+		if err := enc.Encode(s.latest.items[k].Value.(*lruEntry).value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
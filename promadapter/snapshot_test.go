@@ -0,0 +1,57 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestSnapshotJSONLines(t *testing.T) {
+	snap := NewSnapshot(DefaultMaxTrackedSeries)
+	snap.Record([]appoptics.Measurement{
+		{Name: "b_metric", Value: 1.0, Time: 100, Tags: map[string]string{"env": "production"}},
+		{Name: "a_metric", Value: 2.0, Time: 100},
+	})
+	snap.Record([]appoptics.Measurement{
+		{Name: "b_metric", Value: 3.0, Time: 160, Tags: map[string]string{"env": "production"}},
+	})
+
+	out, err := snap.JSONLines()
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got %d", len(lines))
+	}
+
+	var m appoptics.Measurement
+	if err := json.Unmarshal(lines[1], &m); err != nil {
+		t.Fatalf("expected line to be valid JSON: %s", err.Error())
+	}
+
+	if m.Name != "b_metric" || m.Value != 3.0 || m.Time != 160 {
+		t.Errorf("expected the latest b_metric measurement but got %+v", m)
+	}
+}
+
+func TestSnapshotBounded(t *testing.T) {
+	snap := NewSnapshot(2)
+	snap.Record([]appoptics.Measurement{
+		{Name: "a_metric", Value: 1.0},
+		{Name: "b_metric", Value: 1.0},
+		{Name: "c_metric", Value: 1.0},
+	})
+
+	out, err := snap.JSONLines()
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	if len(lines) != 2 || !bytes.Contains(lines[0], []byte("b_metric")) {
+		t.Errorf("expected only the 2 most recent series but got %s", out)
+	}
+}
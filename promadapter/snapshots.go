@@ -0,0 +1,118 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SpaceSnapshot is an image of the charts of an AppOptics Space as they were when it was taken, for sharing
+type SpaceSnapshot struct {
+	ID        string    `json:"id"`
+	SpaceID   int       `json:"space_id"`
+	URL       string    `json:"href"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SnapshotsCommunicator takes and manages snapshots of Spaces
+type SnapshotsCommunicator interface {
+	// CreateSnapshot takes a snapshot of the Space and returns it as created
+	CreateSnapshot(ctx context.Context, spaceID int) (*SpaceSnapshot, error)
+	// GetSnapshot returns the snapshot with the ID
+	GetSnapshot(ctx context.Context, snapshotID string) (*SpaceSnapshot, error)
+	// ListSnapshots returns the snapshots taken of the Space
+	ListSnapshots(ctx context.Context, spaceID int) ([]SpaceSnapshot, error)
+	// DeleteSnapshot deletes the snapshot with the ID
+	DeleteSnapshot(ctx context.Context, snapshotID string) error
+}
+
+// SnapshotsClient is a SnapshotsCommunicator for the AppOptics snapshots API
+type SnapshotsClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewSnapshotsClient returns a SnapshotsClient for the snapshots API at endpoint, e.g. the SnapshotsPath EndpointURL
+func NewSnapshotsClient(endpoint, token string, httpClient *http.Client) *SnapshotsClient {
+	return &SnapshotsClient{url: endpoint, token: token, httpClient: httpClient}
+}
+
+// CreateSnapshot implements SnapshotsCommunicator
+func (sc *SnapshotsClient) CreateSnapshot(ctx context.Context, spaceID int) (*SpaceSnapshot, error) {
+	var created SpaceSnapshot
+	if err := sc.do(ctx, http.MethodPost, sc.url, &SpaceSnapshot{SpaceID: spaceID}, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetSnapshot implements SnapshotsCommunicator
+func (sc *SnapshotsClient) GetSnapshot(ctx context.Context, snapshotID string) (*SpaceSnapshot, error) {
+	var snapshot SpaceSnapshot
+	if err := sc.do(ctx, http.MethodGet, sc.url+"/"+url.PathEscape(snapshotID), nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots implements SnapshotsCommunicator
+func (sc *SnapshotsClient) ListSnapshots(ctx context.Context, spaceID int) ([]SpaceSnapshot, error) {
+	var list struct {
+		Snapshots []SpaceSnapshot `json:"snapshots"`
+	}
+	params := url.Values{"space_id": {strconv.Itoa(spaceID)}}
+	if err := sc.do(ctx, http.MethodGet, sc.url+"?"+params.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Snapshots, nil
+}
+
+// DeleteSnapshot implements SnapshotsCommunicator
+func (sc *SnapshotsClient) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	return sc.do(ctx, http.MethodDelete, sc.url+"/"+url.PathEscape(snapshotID), nil, nil)
+}
+
+// do sends body as JSON if it is not nil, decoding the response into out if it is not nil
+func (sc *SnapshotsClient) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(sc.token, "")
+
+	resp, err := sc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError("snapshots API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsClient(t *testing.T) {
+	created := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		snapshot := SpaceSnapshot{ID: "abc123", SpaceID: 7, URL: "https://snapshots.example.com/abc123.png", CreatedAt: created}
+		switch {
+		case r.Method == http.MethodPost:
+			var body SpaceSnapshot
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SpaceID != 7 {
+				t.Errorf("expected the space ID in the body but got %+v (%v)", body, err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(snapshot)
+		case r.Method == http.MethodGet && r.URL.Path == "/snapshots":
+			json.NewEncoder(w).Encode(map[string][]SpaceSnapshot{"snapshots": {snapshot, snapshot}})
+		case r.Method == http.MethodGet && r.URL.Path == "/snapshots/abc123":
+			json.NewEncoder(w).Encode(snapshot)
+		case r.Method == http.MethodDelete && r.URL.Path == "/snapshots/abc123":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": {"request": ["not found"]}}`))
+		}
+	}))
+	defer server.Close()
+
+	sc := NewSnapshotsClient(server.URL+"/snapshots", "token", server.Client())
+	ctx := context.Background()
+
+	snapshot, err := sc.CreateSnapshot(ctx, 7)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if snapshot.ID != "abc123" || snapshot.SpaceID != 7 || snapshot.URL == "" || !snapshot.CreatedAt.Equal(created) {
+		t.Errorf("expected the created snapshot but got %+v", snapshot)
+	}
+
+	if snapshot, err = sc.GetSnapshot(ctx, "abc123"); err != nil || snapshot.ID != "abc123" {
+		t.Errorf("expected the snapshot but got %+v (%v)", snapshot, err)
+	}
+
+	snapshots, err := sc.ListSnapshots(ctx, 7)
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("expected 2 snapshots but got %+v (%v)", snapshots, err)
+	}
+
+	if err := sc.DeleteSnapshot(ctx, "abc123"); err != nil {
+		t.Errorf("Expected no error but received %s", err.Error())
+	}
+
+	_, err = sc.GetSnapshot(ctx, "missing")
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an *APIError with status 404 but got %#v", err)
+	}
+
+	expected := []string{
+		"POST /snapshots",
+		"GET /snapshots/abc123",
+		"GET /snapshots?space_id=7",
+		"DELETE /snapshots/abc123",
+		"GET /snapshots/missing",
+	}
+	if len(requests) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, requests)
+	}
+	for i := range expected {
+		if requests[i] != expected[i] {
+			t.Errorf("expected %s but got %s", expected[i], requests[i])
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// DefaultSpacePageSize is how many Spaces are requested per page of a search, the most AppOptics allows
+const DefaultSpacePageSize = 100
+
+// findSpaceAttempts is how many times FindOrCreateSpace searches for a Space that already exists before giving up,
+// as a Space that was just created may not be listed yet
+const findSpaceAttempts = 3
+
+// ErrSpaceAlreadyExists is returned by CreateSpace when AppOptics responds 409 Conflict because a Space with the name
+// already exists
+var ErrSpaceAlreadyExists = errors.New("space already exists")
+
+// Space is an AppOptics Space as the spaces API lists it
+type Space struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// SpaceSearchOptions page and order the Spaces a search returns
+type SpaceSearchOptions struct {
+	// PageSize is the number of Spaces requested at a time, DefaultSpacePageSize if zero
+	PageSize int
+	// Sort orders the Spaces by name, "asc" or "desc", or in the order AppOptics picks if empty
+	Sort string
+}
+
+// spaceListResponse is the body of an AppOptics spaces list response, with the Spaces left to be decoded into the
+// type the caller asked for
+type spaceListResponse struct {
+	Query struct {
+		Offset int `json:"offset"`
+		Length int `json:"length"`
+		Found  int `json:"found"`
+	} `json:"query"`
+	Spaces json.RawMessage `json:"spaces"`
+}
+
+// SpacesClient creates and searches the Spaces of an AppOptics account
+type SpacesClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+	// backoff is the pause before FindOrCreateSpace searches again, doubled for every subsequent search
+	backoff time.Duration
+	sleep   func(time.Duration)
+}
+
+// NewSpacesClient returns a SpacesClient for the spaces API at endpoint, e.g. the SpacesPath EndpointURL
+func NewSpacesClient(endpoint, token string, httpClient *http.Client) *SpacesClient {
+	return &SpacesClient{
+		url:        endpoint,
+		token:      token,
+		httpClient: httpClient,
+		backoff:    500 * time.Millisecond,
+		sleep:      time.Sleep,
+	}
+}
+
+// CreateSpace creates a Space with the name and returns it as created, or ErrSpaceAlreadyExists if there already is
+// one
+func (sc *SpacesClient) CreateSpace(ctx context.Context, name string) (*Space, error) {
+	var created Space
+	if err := sc.do(ctx, http.MethodPost, sc.url, &Space{Name: name}, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// FindOrCreateSpace creates a Space with the name, or returns the one that already exists so provisioning can be
+// run repeatedly. AppOptics lists new Spaces with a delay, so the search is retried a few times if a Space that
+// already exists is not found.
+func (sc *SpacesClient) FindOrCreateSpace(ctx context.Context, name string) (*Space, error) {
+	space, err := sc.CreateSpace(ctx, name)
+	if err != ErrSpaceAlreadyExists {
+		return space, err
+	}
+	backoff := sc.backoff
+	for attempt := 1; ; attempt++ {
+		// the search matches the name anywhere in the names of the Spaces it returns
+		spaces, err := sc.SearchSpaces(ctx, name, SpaceSearchOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range spaces {
+			if spaces[i].Name == name {
+				return &spaces[i], nil
+			}
+		}
+		if attempt == findSpaceAttempts {
+			return nil, fmt.Errorf("space %q already exists but was not found in %d searches", name, attempt)
+		}
+		sc.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// SearchSpaces returns every Space whose name contains query. AppOptics does the filtering, which makes finding a
+// known Space far cheaper than listing them all.
+func (sc *SpacesClient) SearchSpaces(ctx context.Context, query string, opts SpaceSearchOptions) ([]Space, error) {
+	var spaces []Space
+	if err := sc.SearchSpacesInto(ctx, query, opts, &spaces); err != nil {
+		return nil, err
+	}
+	return spaces, nil
+}
+
+// SearchSpacesInto is SearchSpaces decoding the Spaces into out, a pointer to a slice of a type of the caller's
+// choosing, e.g. one with more of the fields the spaces API returns than Space has. The Spaces of every page are
+// appended to the slice.
+func (sc *SpacesClient) SearchSpacesInto(ctx context.Context, query string, opts SpaceSearchOptions, out interface{}) error {
+	dst := reflect.ValueOf(out)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || dst.Elem().Kind() != reflect.Slice {
+		return errors.New("spaces can only be decoded into a pointer to a slice")
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultSpacePageSize
+	}
+
+	for offset := 0; ; {
+		params := url.Values{}
+		params.Set("name", query)
+		params.Set("offset", strconv.Itoa(offset))
+		params.Set("length", strconv.Itoa(pageSize))
+		if opts.Sort != "" {
+			params.Set("sort", opts.Sort)
+		}
+
+		var body spaceListResponse
+		if err := sc.do(ctx, http.MethodGet, sc.url+"?"+params.Encode(), nil, &body); err != nil {
+			return err
+		}
+		page := reflect.New(dst.Elem().Type())
+		if len(body.Spaces) > 0 {
+			if err := json.Unmarshal(body.Spaces, page.Interface()); err != nil {
+				return err
+			}
+		}
+		dst.Elem().Set(reflect.AppendSlice(dst.Elem(), page.Elem()))
+
+		offset += page.Elem().Len()
+		if page.Elem().Len() == 0 || offset >= body.Query.Found {
+			return nil
+		}
+	}
+}
+
+// do sends body as JSON if it is not nil, decoding the response into out if it is not nil
+func (sc *SpacesClient) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(sc.token, "")
+
+	resp, err := sc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return ErrSpaceAlreadyExists
+	}
+	if resp.StatusCode > 299 {
+		return responseError("spaces API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFindOrCreateSpace(t *testing.T) {
+	var searches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "token" {
+			t.Errorf("expected basic auth with the token but got %q", r.Header.Get("Authorization"))
+		}
+		if r.Method == http.MethodPost {
+			var space Space
+			json.NewDecoder(r.Body).Decode(&space)
+			if space.Name == "new" {
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"id":9,"name":"new"}`)
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"errors":{"params":{"name":["has already been taken"]}}}`)
+			return
+		}
+		searches++
+		if r.URL.Query().Get("name") == "" {
+			t.Errorf("expected a search by name but got %q", r.URL.RawQuery)
+		}
+		// the space is only listed from the second search, like one that was just created
+		if searches < 2 {
+			fmt.Fprint(w, `{"spaces":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"spaces":[{"id":3,"name":"nodes"},{"id":4,"name":"node"}]}`)
+	}))
+	defer server.Close()
+
+	sc := NewSpacesClient(server.URL+"/spaces", "token", server.Client())
+	sc.sleep = func(time.Duration) {}
+
+	t.Run("a new space is created", func(t *testing.T) {
+		space, err := sc.FindOrCreateSpace(context.Background(), "new")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if space.ID != 9 || searches != 0 {
+			t.Errorf("expected the created space without a search but got %+v after %d searches", space, searches)
+		}
+	})
+
+	t.Run("an existing space is found by its exact name", func(t *testing.T) {
+		space, err := sc.FindOrCreateSpace(context.Background(), "node")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if space.ID != 4 || searches != 2 {
+			t.Errorf("expected space 4 after 2 searches but got %+v after %d searches", space, searches)
+		}
+	})
+
+	t.Run("a conflict is reported as ErrSpaceAlreadyExists", func(t *testing.T) {
+		if _, err := sc.CreateSpace(context.Background(), "node"); err != ErrSpaceAlreadyExists {
+			t.Errorf("expected ErrSpaceAlreadyExists but got %v", err)
+		}
+	})
+
+	t.Run("a space that is never listed is an error", func(t *testing.T) {
+		searches = -10
+		if _, err := sc.FindOrCreateSpace(context.Background(), "gone"); err == nil || searches != -10+findSpaceAttempts {
+			t.Errorf("expected an error after %d searches but got %v after %d", findSpaceAttempts, err, searches+10)
+		}
+	})
+}
+
+func TestSpacesClient(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("name"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if r.URL.Query().Get("length") != "2" {
+			t.Errorf("expected pages of 2 but got %q", r.URL.Query().Get("length"))
+		}
+		spaces := []string{`{"id":1,"name":"node exporter","charts":4}`, `{"id":2,"name":"node & disk","charts":2}`, `{"id":3,"name":"nodes","charts":7}`}
+		page := spaces[offset:]
+		if len(page) > 2 {
+			page = page[:2]
+		}
+		body := "["
+		for i, s := range page {
+			if i > 0 {
+				body += ","
+			}
+			body += s
+		}
+		fmt.Fprintf(w, `{"query":{"offset":%d,"length":%d,"found":3},"spaces":%s]}`, offset, len(page), body)
+	}))
+	defer server.Close()
+
+	sc := NewSpacesClient(server.URL+"/spaces", "token", server.Client())
+	opts := SpaceSearchOptions{PageSize: 2}
+
+	t.Run("the query is sent and every page decoded", func(t *testing.T) {
+		queries = nil
+		spaces, err := sc.SearchSpaces(context.Background(), "node &", opts)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(queries) != 2 || queries[0] != "node &" {
+			t.Errorf("expected the query to be sent with both pages but got %q", queries)
+		}
+		if len(spaces) != 3 || spaces[1].ID != 2 || spaces[1].Name != "node & disk" {
+			t.Errorf("expected the 3 spaces but got %+v", spaces)
+		}
+	})
+
+	t.Run("spaces decode into the caller's type", func(t *testing.T) {
+		var spaces []struct {
+			Name   string `json:"name"`
+			Charts int    `json:"charts"`
+		}
+		if err := sc.SearchSpacesInto(context.Background(), "node", opts, &spaces); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if len(spaces) != 3 || spaces[2].Charts != 7 {
+			t.Errorf("expected the chart counts but got %+v", spaces)
+		}
+	})
+
+	t.Run("only slices can be decoded into", func(t *testing.T) {
+		var space Space
+		if err := sc.SearchSpacesInto(context.Background(), "node", opts, &space); err == nil {
+			t.Error("expected an error for a pointer to a struct")
+		}
+	})
+}
@@ -0,0 +1,472 @@
+package promadapter
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a Measurement may be dropped before reaching AppOptics
+const (
+	DropReasonNaN              = "nan"
+	DropReasonInf              = "inf"
+	DropReasonSubmissionFailed = "submission_failed"
+	DropReasonCardinality      = "cardinality"
+	DropReasonFiltered         = "filtered"
+	DropReasonBackpressure     = "backpressure"
+	DropReasonThrottled        = "throttled"
+)
+
+// Stats counts what happens to Measurements on their way through the adapter. It is safe for concurrent use.
+type Stats struct {
+	// the 64-bit counters come first to be 64-bit aligned for atomic access, the int32 flags last
+	submitted uint64
+	retries   uint64
+	interval  uint64
+	errors    uint64
+	trimmed   uint64
+	transform uint64
+	collision uint64
+	evictions uint64
+	cacheSize int64
+	lag       int64
+	maxLag    int64
+	lagTotal  int64
+	lagCount  uint64
+	success   int64
+	throttle  uint64
+	fpHits    uint64
+	silenced  uint64
+	errDrops  uint64
+	nameClash uint64
+	timing    int32
+
+	mu          sync.Mutex
+	dropped     map[string]uint64
+	rateLimited *lru
+	cardinality *lru
+	byPriority  map[string]uint64
+	reloads     map[string]uint64
+	conversions map[string]uint64
+	outcomes    map[SubmissionOutcome]uint64
+	stageTimes  map[string]StageTiming
+	lastError   string
+	lastStatus  int
+	lastReqID   string
+	degraded    func() bool
+}
+
+// StageTiming accumulates how long a pipeline stage has taken
+type StageTiming struct {
+	Count uint64
+	Total time.Duration
+}
+
+// NewStats returns a zeroed Stats
+func NewStats() *Stats {
+	return &Stats{
+		throttle:    math.Float64bits(1),
+		dropped:     make(map[string]uint64),
+		rateLimited: newLRU(DefaultMaxTrackedSeries, nil),
+		cardinality: newLRU(DefaultMaxTrackedSeries, nil),
+		byPriority:  make(map[string]uint64),
+		reloads:     make(map[string]uint64),
+		conversions: make(map[string]uint64),
+		outcomes:    make(map[SubmissionOutcome]uint64),
+		stageTimes:  make(map[string]StageTiming),
+	}
+}
+
+// EnableTiming turns on recording of per-stage durations. Until it is called ObserveStage is never needed.
+func (s *Stats) EnableTiming() {
+	atomic.StoreInt32(&s.timing, 1)
+}
+
+// TimingEnabled returns true if callers should measure and report stage durations with ObserveStage
+func (s *Stats) TimingEnabled() bool {
+	return atomic.LoadInt32(&s.timing) == 1
+}
+
+// ObserveStage records one run of the named stage taking d
+func (s *Stats) ObserveStage(stage string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stageTimes[stage]
+	st.Count++
+	st.Total += d
+	s.stageTimes[stage] = st
+}
+
+// StageTimings returns a copy of the accumulated durations keyed by stage name
+func (s *Stats) StageTimings() map[string]StageTiming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timings := make(map[string]StageTiming, len(s.stageTimes))
+	for stage, st := range s.stageTimes {
+		timings[stage] = st
+	}
+	return timings
+}
+
+// AddSubmitted records n Measurements accepted by AppOptics
+func (s *Stats) AddSubmitted(n int) {
+	atomic.AddUint64(&s.submitted, uint64(n))
+}
+
+// AddRetries records n resubmissions of a batch
+func (s *Stats) AddRetries(n int) {
+	atomic.AddUint64(&s.retries, uint64(n))
+}
+
+// AddIntervalLimited records n Measurements dropped for arriving within the minimum interval of their series
+func (s *Stats) AddIntervalLimited(n int) {
+	atomic.AddUint64(&s.interval, uint64(n))
+}
+
+// AddLogsSuppressed records n log lines a LogSampler did not log
+func (s *Stats) AddLogsSuppressed(n int) {
+	atomic.AddUint64(&s.silenced, uint64(n))
+}
+
+// AddDroppedErrors records n failed flushes not reported because the error channel was full
+func (s *Stats) AddDroppedErrors(n int) {
+	atomic.AddUint64(&s.errDrops, uint64(n))
+}
+
+// AddNameCollisions records n metrics that kept their name because translating it would merge them with another
+func (s *Stats) AddNameCollisions(n int) {
+	atomic.AddUint64(&s.nameClash, uint64(n))
+}
+
+// AddErrors records n batches AppOptics failed to accept
+func (s *Stats) AddErrors(n int) {
+	atomic.AddUint64(&s.errors, uint64(n))
+}
+
+// AddTrimmed records n Measurements trimmed to fit a PayloadBudget
+func (s *Stats) AddTrimmed(n int) {
+	atomic.AddUint64(&s.trimmed, uint64(n))
+}
+
+// AddTransformErrors records n Measurements a TemplateTransform failed to transform
+func (s *Stats) AddTransformErrors(n int) {
+	atomic.AddUint64(&s.transform, uint64(n))
+}
+
+// AddTagCollisions records n injected tags that collided with a Measurement's own tag
+func (s *Stats) AddTagCollisions(n int) {
+	atomic.AddUint64(&s.collision, uint64(n))
+}
+
+// AddDropped records n Measurements discarded for the given reason
+func (s *Stats) AddDropped(reason string, n int) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[reason] += uint64(n)
+}
+
+// AddDroppedByPriority records a Measurement of the given priority dropped by a full PriorityBuffer
+func (s *Stats) AddDroppedByPriority(priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byPriority[strconv.Itoa(priority)]++
+}
+
+// AddConfigReload records an attempt to reload the configuration file with the given outcome
+func (s *Stats) AddConfigReload(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reloads[status]++
+}
+
+// AddSubmissionOutcome records the final outcome of a batch
+func (s *Stats) AddSubmissionOutcome(outcome SubmissionOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[outcome]++
+}
+
+// AddValueTransform records a Measurement value converted by the given transform
+func (s *Stats) AddValueTransform(transform string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversions[transform]++
+}
+
+// AddRateLimited records a Measurement of the named metric dropped by a SeriesRateLimiter
+func (s *Stats) AddRateLimited(metric string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	incrementLRU(s.rateLimited, metric)
+}
+
+// SetCardinality records the estimated number of distinct tag sets of the named metric
+func (s *Stats) SetCardinality(metric string, estimate uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cardinality.Add(metric, estimate)
+}
+
+// SetLag records the age of the oldest Measurement in the most recently submitted batch
+func (s *Stats) SetLag(d time.Duration) {
+	atomic.StoreInt64(&s.lag, int64(d))
+	atomic.AddInt64(&s.lagTotal, int64(d))
+	atomic.AddUint64(&s.lagCount, 1)
+	for {
+		max := atomic.LoadInt64(&s.maxLag)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&s.maxLag, max, int64(d)) {
+			return
+		}
+	}
+}
+
+// AddCacheEvictions records n series evicted from a full LRUAggregationCache
+func (s *Stats) AddCacheEvictions(n int) {
+	atomic.AddUint64(&s.evictions, uint64(n))
+}
+
+// SetCacheSize records the number of series held by an LRUAggregationCache
+func (s *Stats) SetCacheSize(n int) {
+	atomic.StoreInt64(&s.cacheSize, int64(n))
+}
+
+// SetThrottleFactor records the fraction of Measurements a Throttle currently forwards
+func (s *Stats) SetThrottleFactor(factor float64) {
+	atomic.StoreUint64(&s.throttle, math.Float64bits(factor))
+}
+
+// SetDegradedCheck sets the function Degraded asks whether a DegradedModeCommunicator is currently holding back
+// submissions, so that degraded mode is worked out from its window when read rather than when a submission was last
+// recorded
+func (s *Stats) SetDegradedCheck(check func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degraded = check
+}
+
+// SetFingerprintCacheHitRatio records the fraction of series keys a Deduplicator found in its fingerprint cache
+func (s *Stats) SetFingerprintCacheHitRatio(ratio float64) {
+	atomic.StoreUint64(&s.fpHits, math.Float64bits(ratio))
+}
+
+// SetLastResponse records the status code and request ID of the most recent response to a submission
+func (s *Stats) SetLastResponse(status int, requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastStatus = status
+	s.lastReqID = requestID
+}
+
+// SetLastError records the most recent submission error
+func (s *Stats) SetLastError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+}
+
+// LastResponse returns the status code and request ID of the most recent response to a submission, zero and an empty
+// string if there has been none
+func (s *Stats) LastResponse() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastStatus, s.lastReqID
+}
+
+// LastError returns the message of the most recent submission error, or an empty string if there has been none
+func (s *Stats) LastError() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastError
+}
+
+// Submitted returns the number of Measurements accepted by AppOptics
+func (s *Stats) Submitted() uint64 {
+	return atomic.LoadUint64(&s.submitted)
+}
+
+// Retries returns the number of batch resubmissions
+func (s *Stats) Retries() uint64 {
+	return atomic.LoadUint64(&s.retries)
+}
+
+// IntervalLimited returns the number of Measurements dropped for arriving within the minimum interval of their series
+func (s *Stats) IntervalLimited() uint64 {
+	return atomic.LoadUint64(&s.interval)
+}
+
+// LogsSuppressed returns the number of log lines a LogSampler did not log
+func (s *Stats) LogsSuppressed() uint64 {
+	return atomic.LoadUint64(&s.silenced)
+}
+
+// DroppedErrors returns the number of failed flushes not reported because the error channel was full
+func (s *Stats) DroppedErrors() uint64 {
+	return atomic.LoadUint64(&s.errDrops)
+}
+
+// NameCollisions returns the number of metrics that kept their name because translating it would merge them with
+// another
+func (s *Stats) NameCollisions() uint64 {
+	return atomic.LoadUint64(&s.nameClash)
+}
+
+// Errors returns the number of batches AppOptics failed to accept
+func (s *Stats) Errors() uint64 {
+	return atomic.LoadUint64(&s.errors)
+}
+
+// Trimmed returns the number of Measurements trimmed to fit a PayloadBudget
+func (s *Stats) Trimmed() uint64 {
+	return atomic.LoadUint64(&s.trimmed)
+}
+
+// TransformErrors returns the number of Measurements a TemplateTransform failed to transform
+func (s *Stats) TransformErrors() uint64 {
+	return atomic.LoadUint64(&s.transform)
+}
+
+// TagCollisions returns the number of injected tags that collided with a Measurement's own tag
+func (s *Stats) TagCollisions() uint64 {
+	return atomic.LoadUint64(&s.collision)
+}
+
+// Dropped returns a copy of the number of discarded Measurements keyed by reason
+func (s *Stats) Dropped() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCounts(s.dropped)
+}
+
+// DroppedByPriority returns a copy of the number of Measurements dropped by a full PriorityBuffer keyed by priority
+func (s *Stats) DroppedByPriority() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCounts(s.byPriority)
+}
+
+// ConfigReloads returns a copy of the number of configuration file reloads keyed by outcome
+func (s *Stats) ConfigReloads() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCounts(s.reloads)
+}
+
+// ValueTransforms returns a copy of the number of converted Measurement values keyed by transform
+func (s *Stats) ValueTransforms() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCounts(s.conversions)
+}
+
+// SubmissionOutcomes returns a copy of the number of batches keyed by their final outcome
+func (s *Stats) SubmissionOutcomes() map[SubmissionOutcome]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := make(map[SubmissionOutcome]uint64, len(s.outcomes))
+	for k, n := range s.outcomes {
+		c[k] = n
+	}
+	return c
+}
+
+// RateLimited returns a copy of the number of rate limited Measurements keyed by metric name. Only the
+// DefaultMaxTrackedSeries metrics most recently rate limited are counted, as metric names have no bound of their own.
+func (s *Stats) RateLimited() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lruCounts(s.rateLimited)
+}
+
+// Cardinality returns a copy of the estimated number of distinct tag sets keyed by metric name, for the
+// DefaultMaxTrackedSeries metrics most recently estimated
+func (s *Stats) Cardinality() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lruCounts(s.cardinality)
+}
+
+// SetLastSuccess records the time of the most recent successful submission
+func (s *Stats) SetLastSuccess(t time.Time) {
+	atomic.StoreInt64(&s.success, t.UnixNano())
+}
+
+// LastSuccess returns the time of the most recent successful submission, or the zero Time if there has been none
+func (s *Stats) LastSuccess() time.Time {
+	ns := atomic.LoadInt64(&s.success)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Lag returns the age of the oldest Measurement in the most recently submitted batch
+func (s *Stats) Lag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.lag))
+}
+
+// MaxLag returns the largest lag recorded with SetLag, the longest any Measurement has taken to reach AppOptics
+func (s *Stats) MaxLag() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.maxLag))
+}
+
+// CacheEvictions returns the number of series evicted from a full LRUAggregationCache
+func (s *Stats) CacheEvictions() uint64 {
+	return atomic.LoadUint64(&s.evictions)
+}
+
+// CacheSize returns the number of series held by an LRUAggregationCache
+func (s *Stats) CacheSize() int {
+	return int(atomic.LoadInt64(&s.cacheSize))
+}
+
+// ThrottleFactor returns the fraction of Measurements currently forwarded, 1 unless a Throttle is holding back
+func (s *Stats) ThrottleFactor() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.throttle))
+}
+
+// Degraded returns true while a DegradedModeCommunicator is holding back submissions
+func (s *Stats) Degraded() bool {
+	s.mu.Lock()
+	check := s.degraded
+	s.mu.Unlock()
+	return check != nil && check()
+}
+
+// FingerprintCacheHitRatio returns the fraction of series keys found in the fingerprint cache, 0 without one
+func (s *Stats) FingerprintCacheHitRatio() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.fpHits))
+}
+
+// LagTotal returns the sum of every lag recorded with SetLag and how many there were
+func (s *Stats) LagTotal() (time.Duration, uint64) {
+	return time.Duration(atomic.LoadInt64(&s.lagTotal)), atomic.LoadUint64(&s.lagCount)
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(counts))
+	for k, n := range counts {
+		c[k] = n
+	}
+	return c
+}
+
+// incrementLRU adds one to the count held in counts under key
+func incrementLRU(counts *lru, key string) {
+	n, _ := counts.Get(key)
+	count, _ := n.(uint64)
+	counts.Add(key, count+1)
+}
+
+// lruCounts returns a copy of the counts held in an lru
+func lruCounts(counts *lru) map[string]uint64 {
+	c := make(map[string]uint64, counts.Len())
+	for k, el := range counts.items {
+		c[k] = el.Value.(*lruEntry).value.(uint64)
+	}
+	return c
+}
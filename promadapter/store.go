@@ -0,0 +1,161 @@
+package promadapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DataPoint is one value of a series kept by a LocalStore
+type DataPoint struct {
+	Name  string
+	Tags  map[string]string
+	Time  time.Time
+	Value float64
+}
+
+// storedSeries holds the retained points of one series, oldest first
+type storedSeries struct {
+	name   string
+	tags   map[string]string
+	points []DataPoint
+}
+
+// LocalStore is a Stage keeping the Measurements of the recent past in memory so they can be queried without going
+// to AppOptics, e.g. through a Prometheus-compatible query_range endpoint while developing
+type LocalStore struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu     sync.RWMutex
+	series map[string]*storedSeries
+}
+
+// NewLocalStore returns a LocalStore keeping points for retention
+func NewLocalStore(retention time.Duration) *LocalStore {
+	return &LocalStore{retention: retention, now: time.Now, series: make(map[string]*storedSeries)}
+}
+
+// Process implements Stage, recording the Measurements and passing them on unchanged. Series that have stopped
+// receiving points are pruned once their last point has aged out.
+func (ls *LocalStore) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for _, m := range measurements {
+		ls.Record(m)
+	}
+	ls.Prune()
+	return measurements
+}
+
+// Record stores the Measurement if it has a float value, dropping points of its series that have aged out
+func (ls *LocalStore) Record(m appoptics.Measurement) {
+	value, ok := m.Value.(float64)
+	if !ok {
+		return
+	}
+	t := time.Unix(m.Time, 0)
+	if m.Time == 0 {
+		t = ls.now()
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	key := seriesKey(m)
+	s, ok := ls.series[key]
+	if !ok {
+		s = &storedSeries{name: m.Name, tags: m.Tags}
+		ls.series[key] = s
+	}
+	s.points = append(s.points, DataPoint{Name: m.Name, Tags: m.Tags, Time: t, Value: value})
+	// points arrive mostly in order, so restoring the order is cheap
+	sort.SliceStable(s.points, func(i, j int) bool { return s.points[i].Time.Before(s.points[j].Time) })
+	s.points = s.points[ls.expired(s.points):]
+}
+
+// Query returns the points between from and to, inclusive, of every series of the named metric having all the given
+// tags, grouped by series and ordered by time
+func (ls *LocalStore) Query(name string, tags map[string]string, from, to time.Time) []DataPoint {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	keys := make([]string, 0)
+	for key, s := range ls.series {
+		if s.name == name && hasTags(s.tags, tags) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var points []DataPoint
+	for _, key := range keys {
+		for _, p := range ls.series[key].points {
+			if !p.Time.Before(from) && !p.Time.After(to) {
+				points = append(points, p)
+			}
+		}
+	}
+	return points
+}
+
+// Prune drops every point older than the retention period
+func (ls *LocalStore) Prune() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for key, s := range ls.series {
+		s.points = s.points[ls.expired(s.points):]
+		if len(s.points) == 0 {
+			delete(ls.series, key)
+		}
+	}
+}
+
+// expired returns the number of leading points older than the retention period
+func (ls *LocalStore) expired(points []DataPoint) int {
+	cutoff := ls.now().Add(-ls.retention)
+	return sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(cutoff) })
+}
+
+func hasTags(tags, want map[string]string) bool {
+	for k, v := range want {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorPattern matches a PromQL vector selector with optional label matchers
+var selectorPattern = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{(.*)\})?\s*$`)
+
+// matcherPattern matches one label="value" matcher at the start of a string
+var matcherPattern = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*("(?:[^"\\]|\\.)*")\s*(,|$)`)
+
+// ParseSelector parses the subset of PromQL a LocalStore can answer: a metric name with optional equality matchers,
+// e.g. `http_requests_total{code="200"}`
+func ParseSelector(query string) (string, map[string]string, error) {
+	parts := selectorPattern.FindStringSubmatch(query)
+	if parts == nil {
+		return "", nil, fmt.Errorf("unsupported query %q: only metric{label=\"value\"} selectors are supported", query)
+	}
+
+	tags := make(map[string]string)
+	matchers := parts[2]
+	for strings.TrimSpace(matchers) != "" {
+		m := matcherPattern.FindStringSubmatchIndex(matchers)
+		if m == nil {
+			return "", nil, fmt.Errorf("unsupported matchers %q: only label=\"value\" is supported", parts[2])
+		}
+		value, err := strconv.Unquote(matchers[m[4]:m[5]])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid label value %s: %s", matchers[m[4]:m[5]], err)
+		}
+		tags[matchers[m[2]:m[3]]] = value
+		matchers = matchers[m[1]:]
+	}
+	return parts[1], tags, nil
+}
@@ -0,0 +1,77 @@
+package promadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestLocalStoreQuery(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ls := NewLocalStore(time.Minute)
+	ls.now = func() time.Time { return now }
+
+	ls.Process([]appoptics.Measurement{
+		{Name: "requests", Value: 1.0, Time: 900, Tags: map[string]string{"code": "200"}},
+		{Name: "requests", Value: 2.0, Time: 960, Tags: map[string]string{"code": "200"}},
+		{Name: "requests", Value: 4.0, Time: 980, Tags: map[string]string{"code": "200"}},
+		{Name: "requests", Value: 3.0, Time: 970, Tags: map[string]string{"code": "500"}},
+		{Name: "latency", Value: 0.5, Time: 970},
+	})
+
+	t.Run("expired points are dropped", func(t *testing.T) {
+		points := ls.Query("requests", map[string]string{"code": "200"}, time.Unix(0, 0), now)
+		if len(points) != 2 || points[0].Value != 2.0 || points[1].Value != 4.0 {
+			t.Errorf("expected the points at 960 and 980 but got %+v", points)
+		}
+	})
+
+	t.Run("range is inclusive", func(t *testing.T) {
+		points := ls.Query("requests", map[string]string{"code": "200"}, time.Unix(960, 0), time.Unix(970, 0))
+		if len(points) != 1 || points[0].Value != 2.0 {
+			t.Errorf("expected the point at 960 but got %+v", points)
+		}
+	})
+
+	t.Run("series are matched by tag subset", func(t *testing.T) {
+		points := ls.Query("requests", nil, time.Unix(0, 0), now)
+		if len(points) != 3 {
+			t.Fatalf("expected 3 points but got %+v", points)
+		}
+		if points[0].Tags["code"] != "200" || points[2].Tags["code"] != "500" {
+			t.Errorf("expected the points grouped by series but got %+v", points)
+		}
+	})
+
+	t.Run("idle series are pruned", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		ls.Process([]appoptics.Measurement{{Name: "latency", Value: 0.7, Time: now.Unix()}})
+		if points := ls.Query("requests", nil, time.Unix(0, 0), now); len(points) != 0 {
+			t.Errorf("expected no points but got %+v", points)
+		}
+		if len(ls.series) != 1 {
+			t.Errorf("expected only the latency series to be kept but got %d", len(ls.series))
+		}
+	})
+}
+
+func TestParseSelector(t *testing.T) {
+	name, tags, err := ParseSelector(`http_requests_total{code="200", path="/a\"b"}`)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if name != "http_requests_total" || len(tags) != 2 || tags["code"] != "200" || tags["path"] != `/a"b` {
+		t.Errorf("expected http_requests_total with code and path but got %s %v", name, tags)
+	}
+
+	if name, tags, err = ParseSelector("up"); err != nil || name != "up" || len(tags) != 0 {
+		t.Errorf("expected a bare metric name to parse but got %s %v %v", name, tags, err)
+	}
+
+	for _, query := range []string{`rate(up[5m])`, `up{job=~"node"}`, `up{job="node"`, `{job="node"}`} {
+		if _, _, err := ParseSelector(query); err == nil {
+			t.Errorf("expected %s to be rejected", query)
+		}
+	}
+}
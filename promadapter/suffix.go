@@ -0,0 +1,159 @@
+package promadapter
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// SuffixMode selects what happens to the suffixes Prometheus naming conventions add to metric names
+type SuffixMode int
+
+const (
+	// SuffixKeep forwards metric names as they are
+	SuffixKeep SuffixMode = iota
+	// SuffixStrip removes the known suffixes, e.g. http_requests_total becomes http_requests
+	SuffixStrip
+	// SuffixMap replaces the known suffixes, by default with their dotted AppOptics form, e.g. http_requests.total
+	SuffixMap
+)
+
+// ParseSuffixMode converts "keep", "strip" or "map" into a SuffixMode
+func ParseSuffixMode(s string) (SuffixMode, error) {
+	switch s {
+	case "keep":
+		return SuffixKeep, nil
+	case "strip":
+		return SuffixStrip, nil
+	case "map":
+		return SuffixMap, nil
+	}
+	return SuffixKeep, fmt.Errorf("unknown name suffix mode %q", s)
+}
+
+// knownSuffixes are the suffixes Prometheus adds to the series of counters, histograms and summaries, in the order
+// they are tried
+var knownSuffixes = []string{"_bucket", "_sum", "_count", "_total"}
+
+// DefaultSuffixMapping is what SuffixMap replaces the known suffixes with unless told otherwise
+var DefaultSuffixMapping = map[string]string{
+	"_bucket": ".bucket",
+	"_sum":    ".sum",
+	"_count":  ".count",
+	"_total":  ".total",
+}
+
+// ParseSuffixMapping parses comma-separated suffix=replacement pairs, e.g. "_total=.count,_sum=.sum". Suffixes left
+// out are kept.
+func ParseSuffixMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("expected suffix=replacement but got %q", pair)
+		}
+		mapping[pair[:i]] = pair[i+1:]
+	}
+	return mapping, nil
+}
+
+// SuffixTranslator is a Stage stripping or mapping the suffixes of metric names. It runs after the heatmap and bucket
+// stages, so histograms folded into heatmaps have already lost theirs. A translated name is never allowed to merge two
+// metrics: the first metric to arrive under a name owns it, and any other metric that would be renamed onto it keeps
+// its original name instead, which is counted and logged. Stripping therefore suits counters best; the _sum and
+// _count series of a summary would collide, which mapping avoids.
+type SuffixTranslator struct {
+	mode    SuffixMode
+	mapping map[string]string
+	stats   *Stats
+
+	mu     sync.Mutex
+	owners *lru
+	logged map[string]bool
+}
+
+// NewSuffixTranslator returns a SuffixTranslator in mode, mapping suffixes with mapping in SuffixMap mode or
+// DefaultSuffixMapping if it is empty. At most maxNames translated names are remembered for collision checks.
+func NewSuffixTranslator(mode SuffixMode, mapping map[string]string, maxNames int, stats *Stats) *SuffixTranslator {
+	if len(mapping) == 0 {
+		mapping = DefaultSuffixMapping
+	}
+	return &SuffixTranslator{
+		mode:    mode,
+		mapping: mapping,
+		stats:   stats,
+		owners:  newLRU(maxNames, nil),
+		logged:  make(map[string]bool),
+	}
+}
+
+// Process implements Stage
+func (st *SuffixTranslator) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	if st.mode == SuffixKeep {
+		return measurements
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, m := range measurements {
+		measurements[i].Name = st.translateLocked(m.Name)
+	}
+	return measurements
+}
+
+// Translate returns the name name is forwarded under
+func (st *SuffixTranslator) Translate(name string) string {
+	if st.mode == SuffixKeep {
+		return name
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.translateLocked(name)
+}
+
+// translateLocked renames name and checks the result for collisions. st.mu must be held.
+func (st *SuffixTranslator) translateLocked(name string) string {
+	translated := st.rename(name)
+	owner, ok := st.owners.Get(translated)
+	if !ok {
+		st.owners.Add(translated, name)
+		return translated
+	}
+	if owner.(string) == name {
+		return translated
+	}
+
+	st.stats.AddNameCollisions(1)
+	if !st.logged[name] {
+		st.logged[name] = true
+		log.Printf("keeping the name of %s, renaming it to %s would merge it with %s\n", name, translated, owner)
+	}
+	if translated != name {
+		st.owners.Add(name, name)
+	}
+	return name
+}
+
+// rename strips or maps the first known suffix name ends with
+func (st *SuffixTranslator) rename(name string) string {
+	for _, suffix := range knownSuffixes {
+		if !strings.HasSuffix(name, suffix) || len(name) == len(suffix) {
+			continue
+		}
+		switch st.mode {
+		case SuffixStrip:
+			return strings.TrimSuffix(name, suffix)
+		case SuffixMap:
+			if replacement, ok := st.mapping[suffix]; ok {
+				return strings.TrimSuffix(name, suffix) + replacement
+			}
+		}
+		return name
+	}
+	return name
+}
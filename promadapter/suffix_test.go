@@ -0,0 +1,55 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestSuffixTranslator(t *testing.T) {
+	for _, tc := range []struct {
+		mode     SuffixMode
+		mapping  map[string]string
+		expected string
+	}{
+		{SuffixKeep, nil, "http_requests_total"},
+		{SuffixStrip, nil, "http_requests"},
+		{SuffixMap, nil, "http_requests.total"},
+		{SuffixMap, map[string]string{"_total": ".count"}, "http_requests.count"},
+		{SuffixMap, map[string]string{"_sum": ".sum"}, "http_requests_total"},
+	} {
+		st := NewSuffixTranslator(tc.mode, tc.mapping, DefaultMaxTrackedSeries, NewStats())
+		if name := st.Translate("http_requests_total"); name != tc.expected {
+			t.Errorf("expected http_requests_total to become %s but got %s", tc.expected, name)
+		}
+	}
+
+	t.Run("stripping never merges two metrics", func(t *testing.T) {
+		stats := NewStats()
+		st := NewSuffixTranslator(SuffixStrip, nil, DefaultMaxTrackedSeries, stats)
+		out := st.Process([]appoptics.Measurement{
+			{Name: "http_requests", Value: 1},
+			{Name: "http_requests_total", Value: 2},
+			{Name: "rpc_duration_seconds_sum", Value: 3},
+			{Name: "rpc_duration_seconds_count", Value: 4},
+		})
+		expected := []string{"http_requests", "http_requests_total", "rpc_duration_seconds", "rpc_duration_seconds_count"}
+		for i, m := range out {
+			if m.Name != expected[i] {
+				t.Errorf("expected %s but got %s", expected[i], m.Name)
+			}
+		}
+		if stats.NameCollisions() != 2 {
+			t.Errorf("expected 2 collisions to be counted but got %d", stats.NameCollisions())
+		}
+	})
+
+	t.Run("a metric keeps its translation", func(t *testing.T) {
+		st := NewSuffixTranslator(SuffixStrip, nil, DefaultMaxTrackedSeries, NewStats())
+		for i := 0; i < 2; i++ {
+			if name := st.Translate("http_requests_total"); name != "http_requests" {
+				t.Errorf("expected http_requests but got %s", name)
+			}
+		}
+	})
+}
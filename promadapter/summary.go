@@ -0,0 +1,141 @@
+package promadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// SummaryFormat selects how a SummaryPrinter renders a Summary
+type SummaryFormat int
+
+const (
+	// SummaryTable renders a Summary as an aligned, human-readable table
+	SummaryTable SummaryFormat = iota
+	// SummaryJSON renders a Summary as a single line of JSON
+	SummaryJSON
+)
+
+// ParseSummaryFormat converts "table" or "json" into a SummaryFormat
+func ParseSummaryFormat(s string) (SummaryFormat, error) {
+	switch s {
+	case "table":
+		return SummaryTable, nil
+	case "json":
+		return SummaryJSON, nil
+	}
+	return SummaryTable, fmt.Errorf("unknown summary format %q", s)
+}
+
+// Summary is a point-in-time view of the adapter's Stats
+type Summary struct {
+	Submitted   uint64            `json:"submitted"`
+	Errors      uint64            `json:"errors"`
+	Dropped     map[string]uint64 `json:"dropped"`
+	QueueDepth  int               `json:"queue_depth"`
+	LastSuccess *time.Time        `json:"last_success,omitempty"`
+}
+
+// NewSummary captures the current state of stats
+func NewSummary(stats *Stats, queueDepth int) Summary {
+	s := Summary{
+		Submitted:  stats.Submitted(),
+		Errors:     stats.Errors(),
+		Dropped:    stats.Dropped(),
+		QueueDepth: queueDepth,
+	}
+	if last := stats.LastSuccess(); !last.IsZero() {
+		s.LastSuccess = &last
+	}
+	return s
+}
+
+// StatsReport is a detailed point-in-time view of the adapter's Stats, served for operational inspection
+type StatsReport struct {
+	Summary
+	Retries        uint64            `json:"retries"`
+	LastStatus     int               `json:"last_status,omitempty"`
+	LastRequestID  string            `json:"last_request_id,omitempty"`
+	LastError      string            `json:"last_error,omitempty"`
+	RateLimited    bool              `json:"rate_limited"`
+	SeriesLimited  map[string]uint64 `json:"series_rate_limited"`
+	ThrottleFactor float64           `json:"throttle_factor"`
+	Degraded       bool              `json:"degraded_mode"`
+}
+
+// NewStatsReport captures the current state of stats. RateLimited is true if AppOptics responded to the most recent
+// submission with a 429.
+func NewStatsReport(stats *Stats, queueDepth int) StatsReport {
+	status, requestID := stats.LastResponse()
+	return StatsReport{
+		Summary:        NewSummary(stats, queueDepth),
+		Retries:        stats.Retries(),
+		LastStatus:     status,
+		LastRequestID:  requestID,
+		LastError:      stats.LastError(),
+		RateLimited:    status == http.StatusTooManyRequests,
+		SeriesLimited:  stats.RateLimited(),
+		ThrottleFactor: stats.ThrottleFactor(),
+		Degraded:       stats.Degraded(),
+	}
+}
+
+// Write renders the Summary to w in the given format
+func (s Summary) Write(w io.Writer, format SummaryFormat) error {
+	if format == SummaryJSON {
+		return json.NewEncoder(w).Encode(s)
+	}
+
+	lastSuccess := "never"
+	if s.LastSuccess != nil {
+		lastSuccess = s.LastSuccess.UTC().Format(time.RFC3339)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "submitted\t%d\n", s.Submitted)
+	fmt.Fprintf(tw, "errors\t%d\n", s.Errors)
+
+	reasons := make([]string, 0, len(s.Dropped))
+	for reason := range s.Dropped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(tw, "dropped (%s)\t%d\n", reason, s.Dropped[reason])
+	}
+
+	fmt.Fprintf(tw, "queue depth\t%d\n", s.QueueDepth)
+	fmt.Fprintf(tw, "last success\t%s\n", lastSuccess)
+	return tw.Flush()
+}
+
+// SummaryPrinter periodically writes a Summary of the adapter's Stats
+type SummaryPrinter struct {
+	stats      *Stats
+	queueDepth func() int
+	w          io.Writer
+	format     SummaryFormat
+}
+
+// NewSummaryPrinter returns a SummaryPrinter writing to w
+func NewSummaryPrinter(stats *Stats, queueDepth func() int, w io.Writer, format SummaryFormat) *SummaryPrinter {
+	return &SummaryPrinter{stats: stats, queueDepth: queueDepth, w: w, format: format}
+}
+
+// Run writes a Summary every interval until stop is closed
+func (sp *SummaryPrinter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			NewSummary(sp.stats, sp.queueDepth()).Write(sp.w, sp.format)
+		case <-stop:
+			return
+		}
+	}
+}
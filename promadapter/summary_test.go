@@ -0,0 +1,50 @@
+package promadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryWrite(t *testing.T) {
+	stats := NewStats()
+	stats.AddSubmitted(12)
+	stats.AddErrors(1)
+	stats.AddDropped(DropReasonNaN, 2)
+	stats.SetLastSuccess(time.Unix(1500000000, 0))
+	summary := NewSummary(stats, 3)
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := summary.Write(&buf, SummaryJSON); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		var decoded Summary
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("expected valid JSON but got %s", buf.String())
+		}
+		if decoded.Submitted != 12 || decoded.Errors != 1 || decoded.Dropped[DropReasonNaN] != 2 || decoded.QueueDepth != 3 {
+			t.Errorf("unexpected summary %+v", decoded)
+		}
+		if decoded.LastSuccess == nil || decoded.LastSuccess.Unix() != 1500000000 {
+			t.Errorf("expected the last success time to be kept but got %v", decoded.LastSuccess)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := summary.Write(&buf, SummaryTable); err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		normalized := strings.Join(strings.Fields(buf.String()), " ")
+		for _, line := range []string{"submitted 12", "dropped (nan) 2", "last success 2017-07-14T02:40:00Z"} {
+			if !strings.Contains(normalized, line) {
+				t.Errorf("expected the table to contain %q but got\n%s", line, buf.String())
+			}
+		}
+	})
+}
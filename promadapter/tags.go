@@ -0,0 +1,138 @@
+package promadapter
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DropReasonTagCollision is recorded for Measurements dropped by the CollisionError policy
+const DropReasonTagCollision = "tag_collision"
+
+// CollisionPolicy decides what happens when a Measurement already has a tag the adapter injects
+type CollisionPolicy int
+
+const (
+	// PreferMetric keeps the Measurement's own tag and discards the injected one
+	PreferMetric CollisionPolicy = iota
+	// PreferInjected overwrites the Measurement's own tag with the injected one
+	PreferInjected
+	// PrefixMetric keeps both, moving the Measurement's own tag to "exported_" plus its key like Prometheus does
+	PrefixMetric
+	// CollisionError drops the Measurement
+	CollisionError
+)
+
+// ParseCollisionPolicy converts "prefer-metric", "prefer-injected", "prefix" or "error" into a CollisionPolicy
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch s {
+	case "prefer-metric":
+		return PreferMetric, nil
+	case "prefer-injected":
+		return PreferInjected, nil
+	case "prefix":
+		return PrefixMetric, nil
+	case "error":
+		return CollisionError, nil
+	}
+	return PreferMetric, fmt.Errorf("unknown tag collision policy %q", s)
+}
+
+// tagRules are the global tags and tag key mappings a TagRewriter applies
+type tagRules struct {
+	global   map[string]string
+	mappings map[string]string
+}
+
+// TagRewriter is a Stage renaming tag keys and adding global tags to every Measurement. When a Measurement already
+// has a global tag's key the CollisionPolicy decides which value is kept. The rules can be replaced at any time while
+// Measurements are being processed.
+type TagRewriter struct {
+	rules  atomic.Value
+	policy CollisionPolicy
+	stats  *Stats
+}
+
+// NewTagRewriter returns a TagRewriter adding global tags and renaming tag keys according to mappings
+func NewTagRewriter(global, mappings map[string]string, policy CollisionPolicy, stats *Stats) (*TagRewriter, error) {
+	tr := &TagRewriter{policy: policy, stats: stats}
+	if err := tr.SetRules(global, mappings); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// SetRules replaces the global tags and tag key mappings. If any key is empty the current rules are left in place.
+func (tr *TagRewriter) SetRules(global, mappings map[string]string) error {
+	if err := ValidateTagRules(global, mappings); err != nil {
+		return err
+	}
+	tr.rules.Store(tagRules{global: global, mappings: mappings})
+	return nil
+}
+
+// ValidateTagRules returns an error if the global tags or tag key mappings contain an empty key
+func ValidateTagRules(global, mappings map[string]string) error {
+	for k := range global {
+		if k == "" {
+			return fmt.Errorf("global tags must not have an empty key")
+		}
+	}
+	for from, to := range mappings {
+		if from == "" || to == "" {
+			return fmt.Errorf("invalid tag mapping %q to %q", from, to)
+		}
+	}
+	return nil
+}
+
+// Process implements Stage
+func (tr *TagRewriter) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	rules := tr.rules.Load().(tagRules)
+	if len(rules.global) == 0 && len(rules.mappings) == 0 {
+		return measurements
+	}
+
+	kept := measurements[:0]
+	for _, m := range measurements {
+		tags := make(map[string]string, len(m.Tags)+len(rules.global))
+		for k, v := range m.Tags {
+			if to, ok := rules.mappings[k]; ok {
+				k = to
+			}
+			tags[k] = v
+		}
+		if !tr.inject(tags, rules.global) {
+			tr.stats.AddDropped(DropReasonTagCollision, 1)
+			continue
+		}
+		m.Tags = tags
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// inject adds the global tags to tags according to the CollisionPolicy. It returns false if the Measurement must be
+// dropped.
+func (tr *TagRewriter) inject(tags, global map[string]string) bool {
+	for k, v := range global {
+		own, collides := tags[k]
+		if !collides {
+			tags[k] = v
+			continue
+		}
+
+		tr.stats.AddTagCollisions(1)
+		switch tr.policy {
+		case PreferInjected:
+			tags[k] = v
+		case PrefixMetric:
+			tags["exported_"+k] = own
+			tags[k] = v
+		case CollisionError:
+			return false
+		}
+	}
+	return true
+}
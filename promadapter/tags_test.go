@@ -0,0 +1,75 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestTagRewriter(t *testing.T) {
+	tr, err := NewTagRewriter(map[string]string{"region": "us-east-1"}, map[string]string{"instance": "host"}, PreferMetric, NewStats())
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	out := tr.Process([]appoptics.Measurement{
+		{Name: metricNameFixture, Tags: map[string]string{"instance": "web-1"}},
+	})
+	expected := map[string]string{"host": "web-1", "region": "us-east-1"}
+	if len(out[0].Tags) != len(expected) {
+		t.Errorf("expected tags %v but got %v", expected, out[0].Tags)
+	}
+	for k, v := range expected {
+		if out[0].Tags[k] != v {
+			t.Errorf("expected tag %s=%q but got %q", k, v, out[0].Tags[k])
+		}
+	}
+
+	if err := tr.SetRules(nil, map[string]string{"instance": ""}); err == nil {
+		t.Error("expected an error for an empty mapping target")
+	}
+	out = tr.Process([]appoptics.Measurement{{Name: metricNameFixture, Tags: map[string]string{"instance": "web-1"}}})
+	if out[0].Tags["host"] != "web-1" {
+		t.Errorf("expected the previous rules to stay in place but got %v", out[0].Tags)
+	}
+}
+
+func TestTagRewriterCollisions(t *testing.T) {
+	for _, tc := range []struct {
+		policy   string
+		expected map[string]string
+	}{
+		{"prefer-metric", map[string]string{"env": "staging"}},
+		{"prefer-injected", map[string]string{"env": "prod"}},
+		{"prefix", map[string]string{"env": "prod", "exported_env": "staging"}},
+		{"error", nil},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			policy, err := ParseCollisionPolicy(tc.policy)
+			if err != nil {
+				t.Fatalf("Expected no error but received %s", err.Error())
+			}
+			stats := NewStats()
+			tr, _ := NewTagRewriter(map[string]string{"env": "prod"}, nil, policy, stats)
+
+			out := tr.Process([]appoptics.Measurement{{Name: metricNameFixture, Tags: map[string]string{"env": "staging"}}})
+			if stats.TagCollisions() != 1 {
+				t.Errorf("expected 1 collision but got %d", stats.TagCollisions())
+			}
+			if tc.expected == nil {
+				if len(out) != 0 || stats.Dropped()[DropReasonTagCollision] != 1 {
+					t.Errorf("expected the measurement to be dropped but got %v", out)
+				}
+				return
+			}
+			if len(out) != 1 || len(out[0].Tags) != len(tc.expected) {
+				t.Fatalf("expected tags %v but got %v", tc.expected, out)
+			}
+			for k, v := range tc.expected {
+				if out[0].Tags[k] != v {
+					t.Errorf("expected tag %s=%q but got %q", k, v, out[0].Tags[k])
+				}
+			}
+		})
+	}
+}
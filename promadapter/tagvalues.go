@@ -0,0 +1,211 @@
+package promadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPruneConcurrency is how many tag values PruneTagValues deletes at a time
+const DefaultPruneConcurrency = 4
+
+// AutoTagPruneInterval is how often the tag values of a WithAutoTagPrune option are pruned
+const AutoTagPruneInterval = 7 * 24 * time.Hour
+
+// TagValue is a value a tag of a metric has been reported with
+type TagValue struct {
+	Value        string `json:"value"`
+	LastReported int64  `json:"last_reported"`
+}
+
+// tagPrune is the tag of a metric whose values are pruned automatically once they are older than age
+type tagPrune struct {
+	metricName string
+	tagKey     string
+	age        time.Duration
+}
+
+// TagsClientOption configures a TagsClient
+type TagsClientOption func(*TagsClient)
+
+// WithPruneConcurrency sets how many tag values PruneTagValues deletes at a time
+func WithPruneConcurrency(n int) TagsClientOption {
+	return func(tc *TagsClient) {
+		if n > 0 {
+			tc.concurrency = n
+		}
+	}
+}
+
+// WithAutoTagPrune has Run prune the values of the metric's tag that have not been reported for age, at start and
+// then every AutoTagPruneInterval. Long running services accumulate stale values such as the IDs of old containers.
+func WithAutoTagPrune(metricName, tagKey string, age time.Duration) TagsClientOption {
+	return func(tc *TagsClient) {
+		tc.autoPrune = append(tc.autoPrune, tagPrune{metricName: metricName, tagKey: tagKey, age: age})
+	}
+}
+
+// ParseAutoTagPrune parses a metric:tag:age specification, e.g. container_cpu:container_id:720h, into a
+// WithAutoTagPrune option
+func ParseAutoTagPrune(spec string) (TagsClientOption, error) {
+	fields := strings.Split(spec, ":")
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+		return nil, fmt.Errorf("invalid tag prune %q, expected metric:tag:age", spec)
+	}
+	age, err := time.ParseDuration(fields[2])
+	if err != nil || age <= 0 {
+		return nil, fmt.Errorf("invalid age in tag prune %q", spec)
+	}
+	return WithAutoTagPrune(fields[0], fields[1], age), nil
+}
+
+// TagsClient lists and deletes the values of the tags of AppOptics metrics
+type TagsClient struct {
+	url         string
+	token       string
+	httpClient  *http.Client
+	concurrency int
+	autoPrune   []tagPrune
+	now         func() time.Time
+}
+
+// NewTagsClient returns a TagsClient for the tags API at endpoint, e.g. the TagsPath EndpointURL
+func NewTagsClient(endpoint, token string, httpClient *http.Client, opts ...TagsClientOption) *TagsClient {
+	tc := &TagsClient{url: endpoint, token: token, httpClient: httpClient, concurrency: DefaultPruneConcurrency, now: time.Now}
+	for _, opt := range opts {
+		opt(tc)
+	}
+	return tc
+}
+
+// ListTagValues returns every value the metric's tag has been reported with
+func (tc *TagsClient) ListTagValues(ctx context.Context, metricName, tagKey string) ([]TagValue, error) {
+	var list struct {
+		Values []TagValue `json:"values"`
+	}
+	if err := tc.do(ctx, http.MethodGet, tc.valuesURL(metricName, tagKey, ""), &list); err != nil {
+		return nil, err
+	}
+	return list.Values, nil
+}
+
+// DeleteTagValue deletes a value of the metric's tag
+func (tc *TagsClient) DeleteTagValue(ctx context.Context, metricName, tagKey, value string) error {
+	return tc.do(ctx, http.MethodDelete, tc.valuesURL(metricName, tagKey, value), nil)
+}
+
+// PruneTagValues deletes the values of the metric's tag last reported before olderThan and returns how many were
+// deleted. The values are deleted in parallel; if any deletion fails the others still go ahead and the first error
+// is returned with the count of those that succeeded.
+func (tc *TagsClient) PruneTagValues(ctx context.Context, metricName, tagKey string, olderThan time.Time) (int, error) {
+	values, err := tc.ListTagValues(ctx, metricName, tagKey)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		deleted  int
+		firstErr error
+	)
+	for i := 0; i < tc.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for value := range stale {
+				err := tc.DeleteTagValue(ctx, metricName, tagKey, value)
+				mu.Lock()
+				if err == nil {
+					deleted++
+				} else if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, v := range values {
+		if time.Unix(v.LastReported, 0).Before(olderThan) {
+			stale <- v.Value
+		}
+	}
+	close(stale)
+	wg.Wait()
+	return deleted, firstErr
+}
+
+// Run prunes the tag values of the WithAutoTagPrune options at start and then every AutoTagPruneInterval until stop
+// is closed
+func (tc *TagsClient) Run(stop <-chan struct{}) {
+	if len(tc.autoPrune) == 0 {
+		return
+	}
+	ticker := time.NewTicker(AutoTagPruneInterval)
+	defer ticker.Stop()
+	for {
+		tc.prune()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// prune prunes the tag values of every WithAutoTagPrune option once
+func (tc *TagsClient) prune() {
+	for _, p := range tc.autoPrune {
+		deleted, err := tc.PruneTagValues(context.Background(), p.metricName, p.tagKey, tc.now().Add(-p.age))
+		if err != nil {
+			log.Printf("pruning values of tag %s of %s: %s\n", p.tagKey, p.metricName, err)
+		}
+		if deleted > 0 {
+			log.Printf("pruned %d values of tag %s of %s not reported for %s\n", deleted, p.tagKey, p.metricName, p.age)
+		}
+	}
+}
+
+// valuesURL returns the URL of the values of the metric's tag, or of the one value if it is not empty
+func (tc *TagsClient) valuesURL(metricName, tagKey, value string) string {
+	endpoint := tc.url + "/" + url.PathEscape(tagKey) + "/values"
+	if value != "" {
+		endpoint += "/" + url.PathEscape(value)
+	}
+	return endpoint + "?" + url.Values{"metric": {metricName}}.Encode()
+}
+
+// do sends the request, decoding the response into out if it is not nil
+func (tc *TagsClient) do(ctx context.Context, method, endpoint string, out interface{}) error {
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(tc.token, "")
+
+	resp, err := tc.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		return responseError("tags API", resp, msg)
+	}
+	if out != nil {
+		return json.Unmarshal(msg, out)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package promadapter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPruneTagValues(t *testing.T) {
+	now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("metric") != "container_cpu" {
+			t.Errorf("expected the metric to be sent but got %q", r.URL.RawQuery)
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/tags/container_id/values":
+			fmt.Fprintf(w, `{"values":[{"value":"a","last_reported":%d},{"value":"b","last_reported":%d},{"value":"c","last_reported":%d},{"value":"d","last_reported":%d}]}`,
+				now.Add(-time.Hour).Unix(), now.Add(-48*time.Hour).Unix(), now.Add(-72*time.Hour).Unix(), now.Add(-96*time.Hour).Unix())
+		case r.Method == http.MethodDelete && r.URL.Path == "/tags/container_id/values/d":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deleted = append(deleted, r.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tc := NewTagsClient(server.URL+"/tags", "token", server.Client(), WithPruneConcurrency(2))
+	count, err := tc.PruneTagValues(context.Background(), "container_cpu", "container_id", now.Add(-24*time.Hour))
+	if err == nil {
+		t.Errorf("expected the failed deletion to be returned but got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 deleted values but got %d", count)
+	}
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "/tags/container_id/values/b" || deleted[1] != "/tags/container_id/values/c" {
+		t.Errorf("expected only the stale values to be deleted but got %v", deleted)
+	}
+
+	t.Run("auto prune runs at start", func(t *testing.T) {
+		deleted = nil
+		tc := NewTagsClient(server.URL+"/tags", "token", server.Client(), WithAutoTagPrune("container_cpu", "container_id", 24*time.Hour))
+		tc.now = func() time.Time { return now }
+		stop := make(chan struct{})
+		close(stop)
+		tc.Run(stop)
+		if len(deleted) != 2 {
+			t.Errorf("expected 2 stale values to be deleted but got %v", deleted)
+		}
+	})
+
+	t.Run("auto prune specifications are parsed", func(t *testing.T) {
+		opt, err := ParseAutoTagPrune("container_cpu:container_id:720h")
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		tc := NewTagsClient(server.URL+"/tags", "token", server.Client(), opt)
+		if len(tc.autoPrune) != 1 || tc.autoPrune[0] != (tagPrune{metricName: "container_cpu", tagKey: "container_id", age: 720 * time.Hour}) {
+			t.Errorf("expected the tag prune to be set but got %+v", tc.autoPrune)
+		}
+		for _, spec := range []string{"container_cpu:container_id", "container_cpu::720h", "container_cpu:container_id:soon"} {
+			if _, err := ParseAutoTagPrune(spec); err == nil {
+				t.Errorf("expected an error for %q", spec)
+			}
+		}
+	})
+}
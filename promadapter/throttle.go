@@ -0,0 +1,96 @@
+package promadapter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// Throttle is a Stage forwarding a fraction of the Measurements it is given, the throttle factor, which falls as the
+// queue in front of AppOptics fills up and recovers as it drains. Backpressure therefore thins every metric out
+// gradually instead of hard drops once the queue is full.
+//
+// Below start, as a fraction of capacity, everything is forwarded. Between start and full the factor falls linearly
+// to min, where it stays while the queue is fuller still.
+type Throttle struct {
+	capacity   int
+	start      float64
+	full       float64
+	min        float64
+	queueDepth func() int
+	stats      *Stats
+
+	mu     sync.Mutex
+	factor float64
+	credit float64
+}
+
+// NewThrottle returns a Throttle for a queue of the given capacity whose current depth is reported by queueDepth
+func NewThrottle(capacity int, start, full, min float64, queueDepth func() int, stats *Stats) (*Throttle, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("throttling needs a queue with a capacity")
+	}
+	if start < 0 || full > 1 || start >= full {
+		return nil, fmt.Errorf("throttle thresholds must satisfy 0 <= start < full <= 1 but got %g and %g", start, full)
+	}
+	if min <= 0 || min > 1 {
+		return nil, fmt.Errorf("minimum throttle factor must be in (0, 1] but got %g", min)
+	}
+	return &Throttle{
+		capacity:   capacity,
+		start:      start,
+		full:       full,
+		min:        min,
+		queueDepth: queueDepth,
+		stats:      stats,
+		factor:     1,
+	}, nil
+}
+
+// Factor returns the fraction of Measurements currently forwarded
+func (th *Throttle) Factor() float64 {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.factor
+}
+
+// Update recomputes the throttle factor from the queue depth and returns it
+func (th *Throttle) Update() float64 {
+	fill := float64(th.queueDepth()) / float64(th.capacity)
+
+	factor := 1.0
+	switch {
+	case fill >= th.full:
+		factor = th.min
+	case fill > th.start:
+		factor = 1 - (1-th.min)*(fill-th.start)/(th.full-th.start)
+	}
+
+	th.mu.Lock()
+	th.factor = factor
+	th.mu.Unlock()
+	th.stats.SetThrottleFactor(factor)
+	return factor
+}
+
+// Process implements Stage. The kept Measurements are spread evenly over the input rather than taken from its start.
+func (th *Throttle) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	factor := th.Update()
+	if factor >= 1 {
+		return measurements
+	}
+
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	kept := measurements[:0]
+	for _, m := range measurements {
+		th.credit += factor
+		if th.credit >= 1 {
+			th.credit--
+			kept = append(kept, m)
+		}
+	}
+	th.stats.AddDropped(DropReasonThrottled, len(measurements)-len(kept))
+	return kept
+}
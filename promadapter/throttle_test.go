@@ -0,0 +1,64 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestThrottle(t *testing.T) {
+	depth := 0
+	stats := NewStats()
+	th, err := NewThrottle(100, 0.5, 0.9, 0.1, func() int { return depth }, stats)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	measurements := func() []appoptics.Measurement {
+		ms := make([]appoptics.Measurement, 100)
+		for i := range ms {
+			ms[i] = appoptics.Measurement{Name: metricNameFixture, Value: valueFixture}
+		}
+		return ms
+	}
+
+	var previous float64 = 2
+	for _, depth = range []int{0, 50, 60, 70, 80, 90, 100} {
+		factor := th.Update()
+		if factor > previous {
+			t.Errorf("expected the factor to fall as the queue fills but got %g after %g at depth %d", factor, previous, depth)
+		}
+		previous = factor
+	}
+	if previous != 0.1 {
+		t.Errorf("expected the minimum factor on a full queue but got %g", previous)
+	}
+
+	depth = 70
+	if kept := len(th.Process(measurements())); kept != 55 {
+		t.Errorf("expected 55 of 100 measurements to be kept halfway between thresholds but got %d", kept)
+	}
+	if stats.ThrottleFactor() != th.Factor() {
+		t.Errorf("expected the factor %g to be exposed but got %g", th.Factor(), stats.ThrottleFactor())
+	}
+	if n := stats.Dropped()[DropReasonThrottled]; n != 45 {
+		t.Errorf("expected 45 throttled measurements but got %d", n)
+	}
+
+	depth = 10
+	if kept := len(th.Process(measurements())); kept != 100 {
+		t.Errorf("expected everything to be kept once the queue drained but got %d", kept)
+	}
+	if stats.ThrottleFactor() != 1 {
+		t.Errorf("expected the factor to recover to 1 but got %g", stats.ThrottleFactor())
+	}
+}
+
+func TestNewThrottleValidation(t *testing.T) {
+	depth := func() int { return 0 }
+	for _, args := range [][4]float64{{0, 0.5, 0.9, 0.1}, {100, 0.9, 0.5, 0.1}, {100, 0.5, 1.5, 0.1}, {100, 0.5, 0.9, 0}} {
+		if _, err := NewThrottle(int(args[0]), args[1], args[2], args[3], depth, NewStats()); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
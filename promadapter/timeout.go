@@ -0,0 +1,58 @@
+package promadapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// requestTimeoutKey is the context key the timeout override of a request is stored under
+type requestTimeoutKey struct{}
+
+// ContextWithRequestTimeout returns a copy of ctx carrying d as the timeout of requests made with it, overriding the
+// default for e.g. high-priority measurements. A RequestTimeoutTransport applies it; it can shorten but not extend
+// the Timeout of the http.Client the request is sent with, or a deadline ctx already has.
+func ContextWithRequestTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, d)
+}
+
+// RequestTimeoutTransport is an http.RoundTripper bounding every request whose context carries a timeout set with
+// ContextWithRequestTimeout by that timeout, from sending the request to closing the response body
+type RequestTimeoutTransport struct {
+	next http.RoundTripper
+}
+
+// NewRequestTimeoutTransport returns a RequestTimeoutTransport sending requests through next
+func NewRequestTimeoutTransport(next http.RoundTripper) *RequestTimeoutTransport {
+	return &RequestTimeoutTransport{next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *RequestTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d, ok := req.Context().Value(requestTimeoutKey{}).(time.Duration)
+	if !ok || d <= 0 {
+		return rt.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	resp, err := rt.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return resp, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose is a response body releasing the context of its request once closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (cc *cancelOnClose) Close() error {
+	err := cc.ReadCloser.Close()
+	cc.cancel()
+	return err
+}
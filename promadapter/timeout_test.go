@@ -0,0 +1,44 @@
+package promadapter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeoutTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRequestTimeoutTransport(http.DefaultTransport)}
+
+	t.Run("the override times the request out", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+		req = req.WithContext(ContextWithRequestTimeout(context.Background(), time.Millisecond))
+		_, err := client.Do(req)
+		if err == nil {
+			t.Fatal("expected the request to time out")
+		}
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("expected a timeout but got %s", err)
+		}
+	})
+
+	t.Run("requests without an override are left alone", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("expected a 202 but got %d", resp.StatusCode)
+		}
+	})
+}
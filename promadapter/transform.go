@@ -0,0 +1,104 @@
+package promadapter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// validMetricName matches the metric names AppOptics accepts
+var validMetricName = regexp.MustCompile(`^[A-Za-z0-9.:_\-]{1,255}$`)
+
+// transformFuncs are available to TemplateTransform templates in addition to the text/template builtins
+var transformFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// TemplateTransform is a Stage computing each Measurement's name, and optionally its tags, from Go text/templates
+// executed with the Measurement's Name and Tags, e.g. `{{.Tags.job}}.{{.Name}}`. The tags template renders one
+// key=value pair per line and replaces the original tags. A Measurement is left unchanged if either template fails,
+// refers to a missing tag, or renders an invalid name.
+type TemplateTransform struct {
+	name  *template.Template
+	tags  *template.Template
+	stats *Stats
+}
+
+// NewTemplateTransform parses the name and tags templates. Either may be empty to leave that part alone.
+func NewTemplateTransform(nameTemplate, tagsTemplate string, stats *Stats) (*TemplateTransform, error) {
+	tt := &TemplateTransform{stats: stats}
+	var err error
+	if tt.name, err = parseTransform("name", nameTemplate); err != nil {
+		return nil, err
+	}
+	if tt.tags, err = parseTransform("tags", tagsTemplate); err != nil {
+		return nil, err
+	}
+	return tt, nil
+}
+
+func parseTransform(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(transformFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %s", name, err)
+	}
+	return t, nil
+}
+
+// Process implements Stage
+func (tt *TemplateTransform) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for i, m := range measurements {
+		transformed, err := tt.transform(m)
+		if err != nil {
+			tt.stats.AddTransformErrors(1)
+			continue
+		}
+		measurements[i] = transformed
+	}
+	return measurements
+}
+
+// transform returns m with its name and tags computed by the templates, both from the original Measurement
+func (tt *TemplateTransform) transform(m appoptics.Measurement) (appoptics.Measurement, error) {
+	out := m
+	var buf bytes.Buffer
+	if tt.name != nil {
+		if err := tt.name.Execute(&buf, m); err != nil {
+			return m, err
+		}
+		out.Name = strings.TrimSpace(buf.String())
+		if !validMetricName.MatchString(out.Name) {
+			return m, fmt.Errorf("invalid metric name %q", out.Name)
+		}
+		buf.Reset()
+	}
+
+	if tt.tags != nil {
+		if err := tt.tags.Execute(&buf, m); err != nil {
+			return m, err
+		}
+		out.Tags = make(map[string]string)
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return m, fmt.Errorf("invalid tag %q", line)
+			}
+			out.Tags[kv[0]] = kv[1]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestTemplateTransform(t *testing.T) {
+	t.Run("name and tags are computed from labels", func(t *testing.T) {
+		tt, err := NewTemplateTransform(
+			`{{.Tags.team}}.{{replace "_" "." .Name}}`,
+			"{{range $k, $v := .Tags}}{{if ne $k \"team\"}}{{$k}}={{$v}}\n{{end}}{{end}}",
+			NewStats(),
+		)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		out := tt.Process([]appoptics.Measurement{
+			{Name: "http_requests_total", Value: 1.0, Tags: map[string]string{"team": "payments", "code": "200"}},
+		})
+		if out[0].Name != "payments.http.requests.total" {
+			t.Errorf("expected payments.http.requests.total but got %s", out[0].Name)
+		}
+		if len(out[0].Tags) != 1 || out[0].Tags["code"] != "200" {
+			t.Errorf("expected only the code tag but got %v", out[0].Tags)
+		}
+	})
+
+	t.Run("failing measurements are left unchanged", func(t *testing.T) {
+		stats := NewStats()
+		tt, err := NewTemplateTransform(`{{.Tags.team}}{{.Tags.suffix}}`, "", stats)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+
+		out := tt.Process([]appoptics.Measurement{
+			{Name: "missing_label", Tags: map[string]string{"team": "payments"}},
+			{Name: "invalid_name", Tags: map[string]string{"team": "pay ments", "suffix": ""}},
+			{Name: "ok", Tags: map[string]string{"team": "payments", "suffix": "_up"}},
+		})
+		if out[0].Name != "missing_label" || out[1].Name != "invalid_name" || out[2].Name != "payments_up" {
+			t.Errorf("unexpected names %s, %s and %s", out[0].Name, out[1].Name, out[2].Name)
+		}
+		if stats.TransformErrors() != 2 {
+			t.Errorf("expected 2 transform errors but got %d", stats.TransformErrors())
+		}
+	})
+
+	t.Run("bad templates are rejected", func(t *testing.T) {
+		if _, err := NewTemplateTransform(`{{.Name`, "", NewStats()); err == nil {
+			t.Error("expected an error for an unterminated action")
+		}
+	})
+}
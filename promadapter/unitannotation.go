@@ -0,0 +1,96 @@
+package promadapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// UnitsAttribute is the Measurement attribute AppOptics reads the short display unit of a metric from, as in
+// MetricAttributes
+const UnitsAttribute = "display_units_short"
+
+// DefaultUnits are the units a UnitAnnotator applies to metrics following the Prometheus naming conventions
+var DefaultUnits = map[string]string{
+	".*_bytes":   "B",
+	".*_seconds": "s",
+	".*_total":   "count",
+	".*_ratio":   "ratio",
+}
+
+// unitRule assigns a unit to metrics whose name matches a pattern
+type unitRule struct {
+	pattern *regexp.Regexp
+	unit    string
+}
+
+// ParseUnit parses a "pattern=unit" pair
+func ParseUnit(s string) (string, string, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 || i == len(s)-1 {
+		return "", "", fmt.Errorf("expected pattern=unit but got %q", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// UnitAnnotator is a Stage setting the UnitsAttribute of Measurements whose metric name matches a pattern, so that
+// AppOptics charts show their unit. Measurements already carrying the attribute are left alone.
+type UnitAnnotator struct {
+	rules []unitRule
+}
+
+// NewUnitAnnotator returns a UnitAnnotator applying units, a map of metric name patterns to units, and then
+// DefaultUnits. Patterns match whole names and are tried in sorted order, so the first matching one wins.
+func NewUnitAnnotator(units map[string]string) (*UnitAnnotator, error) {
+	var rules []unitRule
+	for _, set := range []map[string]string{units, DefaultUnits} {
+		patterns := make([]string, 0, len(set))
+		for p := range set {
+			patterns = append(patterns, p)
+		}
+		sort.Strings(patterns)
+
+		compiled, err := compilePatterns(patterns)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range patterns {
+			rules = append(rules, unitRule{pattern: compiled[i], unit: set[p]})
+		}
+	}
+	return &UnitAnnotator{rules: rules}, nil
+}
+
+// Process implements Stage. Attributes are copied before being annotated, as they may be shared between
+// Measurements.
+func (ua *UnitAnnotator) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for i, m := range measurements {
+		if _, ok := m.Attributes[UnitsAttribute]; ok {
+			continue
+		}
+		unit := ua.unit(m.Name)
+		if unit == "" {
+			continue
+		}
+		attributes := make(map[string]interface{}, len(m.Attributes)+1)
+		for k, v := range m.Attributes {
+			attributes[k] = v
+		}
+		attributes[UnitsAttribute] = unit
+		measurements[i].Attributes = attributes
+	}
+	return measurements
+}
+
+// unit returns the unit of the first rule matching name, or "" if none does
+func (ua *UnitAnnotator) unit(name string) string {
+	for _, r := range ua.rules {
+		if r.pattern.MatchString(name) {
+			return r.unit
+		}
+	}
+	return ""
+}
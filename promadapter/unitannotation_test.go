@@ -0,0 +1,57 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestUnitAnnotator(t *testing.T) {
+	ua, err := NewUnitAnnotator(map[string]string{"node_memory_.*": "MiB", "node_load.*": "load"})
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	shared := map[string]interface{}{"aggregate": true}
+	measurements := ua.Process([]appoptics.Measurement{
+		{Name: "http_response_size_bytes", Attributes: shared},
+		{Name: "http_request_duration_seconds"},
+		{Name: "http_requests_total"},
+		{Name: "cache_hit_ratio"},
+		{Name: "node_memory_free_bytes"},
+		{Name: "node_load1"},
+		{Name: "up"},
+		{Name: "process_cpu_seconds", Attributes: map[string]interface{}{UnitsAttribute: "ms"}},
+	})
+
+	for i, expected := range []string{"B", "s", "count", "ratio", "MiB", "load", "", "ms"} {
+		unit, _ := measurements[i].Attributes[UnitsAttribute].(string)
+		if unit != expected {
+			t.Errorf("expected %s to carry the unit %q but got %q", measurements[i].Name, expected, unit)
+		}
+	}
+	if len(shared) != 1 || measurements[0].Attributes["aggregate"] != true {
+		t.Error("expected the attributes to be copied before being annotated")
+	}
+
+	if _, err := NewUnitAnnotator(map[string]string{"(": "B"}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestUnitAnnotatorBeforeSuffixTranslator(t *testing.T) {
+	ua, err := NewUnitAnnotator(nil)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	for _, mode := range []SuffixMode{SuffixStrip, SuffixMap} {
+		st := NewSuffixTranslator(mode, nil, DefaultMaxTrackedSeries, NewStats())
+		measurements := st.Process(ua.Process([]appoptics.Measurement{{Name: "http_requests_total"}}))
+
+		if unit, _ := measurements[0].Attributes[UnitsAttribute].(string); unit != "count" {
+			t.Errorf("expected %s to carry the unit \"count\" but got %q", measurements[0].Name, unit)
+		}
+		if measurements[0].Name == "http_requests_total" {
+			t.Errorf("expected the suffix to be translated but got %s", measurements[0].Name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package promadapter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// ValueOperation is the arithmetic a ValueTransform applies to matching values
+type ValueOperation string
+
+// Operations a ValueTransform can apply
+const (
+	Multiply ValueOperation = "multiply"
+	Divide   ValueOperation = "divide"
+	Offset   ValueOperation = "offset"
+)
+
+// ValueTransform converts the values of metrics whose name matches Pattern, e.g. from bytes to megabytes
+type ValueTransform struct {
+	Pattern   string
+	Operation ValueOperation
+	Operand   float64
+}
+
+// String returns the transform in the form ParseValueTransform accepts, used to label which transforms applied
+func (vt ValueTransform) String() string {
+	return fmt.Sprintf("%s=%s:%s", vt.Pattern, vt.Operation, strconv.FormatFloat(vt.Operand, 'g', -1, 64))
+}
+
+// apply returns v with the transform applied
+func (vt ValueTransform) apply(v float64) float64 {
+	switch vt.Operation {
+	case Multiply:
+		return v * vt.Operand
+	case Divide:
+		return v / vt.Operand
+	default:
+		return v + vt.Operand
+	}
+}
+
+// ParseValueTransform parses a "pattern=operation:operand" transform, e.g. ".*_bytes=divide:1048576". Patterns must
+// match the whole metric name.
+func ParseValueTransform(s string) (ValueTransform, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 {
+		return ValueTransform{}, fmt.Errorf("expected pattern=operation:operand but got %q", s)
+	}
+	parts := strings.SplitN(s[i+1:], ":", 2)
+	if len(parts) != 2 {
+		return ValueTransform{}, fmt.Errorf("expected pattern=operation:operand but got %q", s)
+	}
+	operand, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return ValueTransform{}, fmt.Errorf("invalid operand in %q: %s", s, err)
+	}
+
+	vt := ValueTransform{Pattern: s[:i], Operation: ValueOperation(parts[0]), Operand: operand}
+	switch vt.Operation {
+	case Multiply, Offset:
+	case Divide:
+		if operand == 0 {
+			return ValueTransform{}, fmt.Errorf("cannot divide by zero in %q", s)
+		}
+	default:
+		return ValueTransform{}, fmt.Errorf("unknown operation %q in %q, expected multiply, divide or offset", parts[0], s)
+	}
+	return vt, nil
+}
+
+// UnitConversion is a Stage applying ValueTransforms to the values of the metrics they match, so values exported in
+// unexpected units can be normalized before they reach AppOptics. Every matching transform is applied in the order
+// given, and each application is counted by transform in Stats.
+type UnitConversion struct {
+	transforms []ValueTransform
+	patterns   []*regexp.Regexp
+	stats      *Stats
+}
+
+// NewUnitConversion returns a UnitConversion applying transforms
+func NewUnitConversion(transforms []ValueTransform, stats *Stats) (*UnitConversion, error) {
+	patterns := make([]string, len(transforms))
+	for i, vt := range transforms {
+		patterns[i] = vt.Pattern
+	}
+	compiled, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &UnitConversion{transforms: transforms, patterns: compiled, stats: stats}, nil
+}
+
+// Process implements Stage. Only float values are converted.
+func (uc *UnitConversion) Process(measurements []appoptics.Measurement) []appoptics.Measurement {
+	for i, m := range measurements {
+		value, ok := m.Value.(float64)
+		if !ok {
+			continue
+		}
+		for j, p := range uc.patterns {
+			if !p.MatchString(m.Name) {
+				continue
+			}
+			value = uc.transforms[j].apply(value)
+			uc.stats.AddValueTransform(uc.transforms[j].String())
+		}
+		measurements[i].Value = value
+	}
+	return measurements
+}
@@ -0,0 +1,51 @@
+package promadapter
+
+import (
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestUnitConversion(t *testing.T) {
+	vt, err := ParseValueTransform(".*_bytes=divide:1048576")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	stats := NewStats()
+	uc, err := NewUnitConversion([]ValueTransform{vt}, stats)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+
+	out := uc.Process([]appoptics.Measurement{
+		{Name: "memory_bytes", Value: 5242880.0},
+		{Name: "memory_bytes_total_requests", Value: 3.0},
+		{Name: "requests_total", Value: 42.0},
+	})
+
+	if out[0].Value != 5.0 {
+		t.Errorf("expected 5242880 bytes to become 5 but got %v", out[0].Value)
+	}
+	if out[1].Value != 3.0 || out[2].Value != 42.0 {
+		t.Errorf("expected unmatched metrics to pass through but got %v and %v", out[1].Value, out[2].Value)
+	}
+	if n := stats.ValueTransforms()[".*_bytes=divide:1.048576e+06"]; n != 1 {
+		t.Errorf("expected 1 recorded transform but got %v", stats.ValueTransforms())
+	}
+}
+
+func TestParseValueTransform(t *testing.T) {
+	vt, err := ParseValueTransform("temperature_kelvin=offset:-273.15")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if vt.Pattern != "temperature_kelvin" || vt.Operation != Offset || vt.apply(273.15) != 0 {
+		t.Errorf("expected an offset of -273.15 but got %+v", vt)
+	}
+
+	for _, s := range []string{"metric", "metric=divide:0", "metric=scale:2", "metric=multiply:x", "=multiply:2"} {
+		if _, err := ParseValueTransform(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package promadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DropReasonInvalid is recorded for Measurements rejected by the validation endpoint
+const DropReasonInvalid = "invalid"
+
+// ValidationError describes why the Measurement at Index was rejected
+type ValidationError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (ve ValidationError) Error() string {
+	return fmt.Sprintf("measurement %d: %s: %s", ve.Index, ve.Field, ve.Message)
+}
+
+// validationResponse is the body returned by the validation endpoint
+type validationResponse struct {
+	Errors []ValidationError `json:"errors"`
+}
+
+// Validator checks Measurements against the AppOptics validation endpoint, which validates Measurements without
+// storing them
+type Validator struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewValidator returns a Validator posting to url, authenticating with token
+func NewValidator(url, token string, httpClient *http.Client) *Validator {
+	return &Validator{url: url, token: token, httpClient: httpClient}
+}
+
+// Validate returns one ValidationError per invalid Measurement. The error is only non-nil when validation itself
+// could not be performed. A context that is already done fails immediately, without a request being made, and one
+// cancelled or expiring mid-request aborts it.
+func (v *Validator) Validate(ctx context.Context, measurements []appoptics.Measurement) ([]ValidationError, error) {
+	// the http.Client timeout may be far longer than the deadline, so don't even start once it has passed
+	if deadline, ok := ctx.Deadline(); ok && !deadline.After(time.Now()) {
+		return nil, context.DeadlineExceeded
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(measurements) == 0 {
+		return nil, nil
+	}
+
+	body, err := json.Marshal(appoptics.MeasurementsBatch{Measurements: measurements})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(v.token, "")
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// a 400 carries the validation errors, anything else unsuccessful means the endpoint could not validate
+	if resp.StatusCode > 299 && resp.StatusCode != http.StatusBadRequest {
+		return nil, responseError("validation endpoint", resp, msg)
+	}
+	if len(bytes.TrimSpace(msg)) == 0 {
+		return nil, nil
+	}
+
+	var vr validationResponse
+	if err := json.Unmarshal(msg, &vr); err != nil {
+		// most likely an error page from a proxy rather than AppOptics
+		return nil, responseError("validation endpoint", resp, msg)
+	}
+	return vr.Errors, nil
+}
+
+// PreValidatingCommunicator wraps a MeasurementsCommunicator, validating every batch first and dropping the invalid
+// Measurements so they cannot fail the whole batch. If validation itself fails the batch is sent unchanged.
+type PreValidatingCommunicator struct {
+	mc        appoptics.MeasurementsCommunicator
+	validator *Validator
+	stats     *Stats
+}
+
+// NewPreValidatingCommunicator returns a PreValidatingCommunicator sending through mc
+func NewPreValidatingCommunicator(mc appoptics.MeasurementsCommunicator, validator *Validator, stats *Stats) *PreValidatingCommunicator {
+	return &PreValidatingCommunicator{mc: mc, validator: validator, stats: stats}
+}
+
+// Create validates the batch and persists its valid Measurements
+func (pc *PreValidatingCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	errs, err := pc.validator.Validate(context.Background(), batch.Measurements)
+	if err != nil {
+		log.Printf("skipping validation: %s\n", err)
+		return pc.mc.Create(batch)
+	}
+	if len(errs) == 0 {
+		return pc.mc.Create(batch)
+	}
+
+	invalid := make(map[int]bool, len(errs))
+	for _, ve := range errs {
+		log.Printf("dropping invalid %s\n", ve)
+		invalid[ve.Index] = true
+	}
+	valid := make([]appoptics.Measurement, 0, len(batch.Measurements))
+	for i, m := range batch.Measurements {
+		if !invalid[i] {
+			valid = append(valid, m)
+		}
+	}
+	pc.stats.AddDropped(DropReasonInvalid, len(batch.Measurements)-len(valid))
+	if len(valid) == 0 {
+		return nil, nil
+	}
+
+	trimmed := *batch
+	trimmed.Measurements = valid
+	return pc.mc.Create(&trimmed)
+}
@@ -0,0 +1,109 @@
+package promadapter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func TestPreValidatingCommunicator(t *testing.T) {
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{
+		{Name: "valid_one", Value: 1.0},
+		{Name: "", Value: 2.0},
+		{Name: "valid_two", Value: 3.0},
+	}}
+
+	t.Run("invalid measurements are dropped", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, _, _ := r.BasicAuth(); user != "token" {
+				t.Errorf("expected the token as the basic auth user but got %q", user)
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"index":1,"field":"name","message":"must not be empty"}]}`))
+		}))
+		defer server.Close()
+
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		stats := NewStats()
+		pc := NewPreValidatingCommunicator(stub, NewValidator(server.URL, "token", server.Client()), stats)
+
+		if _, err := pc.Create(batch); err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+		sent := stub.batches[0].Measurements
+		if len(sent) != 2 || sent[0].Name != "valid_one" || sent[1].Name != "valid_two" {
+			t.Errorf("expected only the valid measurements to be sent but got %v", sent)
+		}
+		if stats.Dropped()[DropReasonInvalid] != 1 {
+			t.Errorf("expected 1 invalid drop but got %d", stats.Dropped()[DropReasonInvalid])
+		}
+	})
+
+	t.Run("batch is sent unchanged when validation is unavailable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		stub := &stubCommunicator{statusCodes: []int{http.StatusAccepted}}
+		pc := NewPreValidatingCommunicator(stub, NewValidator(server.URL, "token", server.Client()), NewStats())
+
+		if _, err := pc.Create(batch); err != nil {
+			t.Errorf("Expected no error but received %s", err.Error())
+		}
+		if len(stub.batches[0].Measurements) != 3 {
+			t.Errorf("expected all 3 measurements to be sent but got %d", len(stub.batches[0].Measurements))
+		}
+	})
+}
+
+func TestValidatorContext(t *testing.T) {
+	requests := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		// the connection is only watched for the client going away once the body has been read
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	v := NewValidator(server.URL, "token", &http.Client{Timeout: 30 * time.Second})
+	measurements := []appoptics.Measurement{{Name: metricNameFixture, Value: valueFixture}}
+
+	t.Run("an expired deadline returns before any request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := v.Validate(ctx, measurements); err != context.DeadlineExceeded {
+			t.Errorf("expected %s but got %v", context.DeadlineExceeded, err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("expected an immediate return but took %s", elapsed)
+		}
+		if len(requests) != 0 {
+			t.Error("expected no request to be made")
+		}
+	})
+
+	t.Run("a deadline passing mid-request aborts it", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := v.Validate(ctx, measurements); err == nil {
+			t.Error("expected the request to fail")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("expected the request to be aborted at the deadline but took %s", elapsed)
+		}
+		<-requests
+	})
+}
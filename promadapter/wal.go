@@ -0,0 +1,411 @@
+package promadapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+// DefaultWALSegmentBytes is the size a WAL segment grows to before a new one is started
+const DefaultWALSegmentBytes = 16 << 20
+
+// WALDeadLetterFile is the file in the WAL directory batches that failed permanently are moved to, one JSON record
+// per line
+const WALDeadLetterFile = "dead-letter.jsonl"
+
+// walSegmentSuffix is the file name suffix of WAL segments, which are named after the first sequence number written
+// to them
+const walSegmentSuffix = ".wal"
+
+// walRecord is a line of a WAL segment: a batch appended under Seq, the acknowledgement of the batch appended under
+// Seq, or the indices of the Measurements of that batch left unsent after it was accepted in part
+type walRecord struct {
+	Seq    uint64                       `json:"seq"`
+	Batch  *appoptics.MeasurementsBatch `json:"batch,omitempty"`
+	Ack    bool                         `json:"ack,omitempty"`
+	Unsent []int                        `json:"unsent,omitempty"`
+}
+
+// WALEntry is a batch in a WAL along with the sequence number it was appended under
+type WALEntry struct {
+	Seq   uint64
+	Batch *appoptics.MeasurementsBatch
+}
+
+// WAL is a durable, ordered write-ahead log of batches, kept as a directory of append-only segments of JSON lines.
+// Batches are appended before they are submitted and acknowledged once accepted, so those still unacknowledged when
+// the adapter crashes can be replayed in their original order on restart. Segments are rotated once they grow past a
+// size, and the oldest ones are deleted as soon as every batch in them has been acknowledged. It is safe for
+// concurrent use.
+type WAL struct {
+	dir          string
+	segmentBytes int64
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	current  uint64
+	segments []uint64
+	nextSeq  uint64
+	// location maps the sequence number of every unacknowledged batch to the segment holding it
+	location map[uint64]uint64
+	// unacked counts the unacknowledged batches of every segment
+	unacked map[uint64]int
+	// pending holds the unacknowledged batches in the order they were appended
+	pending []WALEntry
+}
+
+// OpenWAL opens the WAL in dir, creating the directory if needed, and reads back the batches left unacknowledged by
+// the last run. A final line cut short by a crash is ignored.
+func OpenWAL(dir string, segmentBytes int) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	w := &WAL{
+		dir:          dir,
+		segmentBytes: int64(segmentBytes),
+		location:     make(map[uint64]uint64),
+		unacked:      make(map[uint64]int),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		if !strings.HasSuffix(fi.Name(), walSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, id)
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+
+	pending := make(map[uint64]*appoptics.MeasurementsBatch)
+	for _, id := range w.segments {
+		if err := w.load(id, pending); err != nil {
+			return nil, err
+		}
+	}
+	for seq, batch := range pending {
+		w.pending = append(w.pending, WALEntry{Seq: seq, Batch: batch})
+	}
+	sort.Slice(w.pending, func(i, j int) bool { return w.pending[i].Seq < w.pending[j].Seq })
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotateLocked(); err != nil {
+		return nil, err
+	}
+	w.compactLocked()
+	return w, nil
+}
+
+// load reads the segment id, adding the batches it appends to pending and removing those it acknowledges
+func (w *WAL) load(id uint64, pending map[uint64]*appoptics.MeasurementsBatch) error {
+	f, err := os.Open(w.segmentPath(id))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w.unacked[id] = 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// a line without its newline was cut short by a crash
+			return nil
+		}
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("reading WAL segment %s: %s", w.segmentPath(id), err)
+		}
+		if rec.Seq >= w.nextSeq {
+			w.nextSeq = rec.Seq + 1
+		}
+		if rec.Ack {
+			if segment, ok := w.location[rec.Seq]; ok {
+				delete(w.location, rec.Seq)
+				delete(pending, rec.Seq)
+				w.unacked[segment]--
+			}
+			continue
+		}
+		if rec.Unsent != nil {
+			if batch, ok := pending[rec.Seq]; ok {
+				pending[rec.Seq] = unsentBatch(batch, rec.Unsent)
+			}
+			continue
+		}
+		if rec.Batch != nil {
+			pending[rec.Seq] = rec.Batch
+			w.location[rec.Seq] = id
+			w.unacked[id]++
+		}
+	}
+}
+
+// Unacknowledged returns the batches not acknowledged yet, including those the last run left, in the order they were
+// appended
+func (w *WAL) Unacknowledged() []WALEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]WALEntry(nil), w.pending...)
+}
+
+// Append durably writes batch to the WAL and returns the sequence number to acknowledge it with
+func (w *WAL) Append(batch *appoptics.MeasurementsBatch) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seq := w.nextSeq
+	if err := w.writeLocked(walRecord{Seq: seq, Batch: batch}); err != nil {
+		return 0, err
+	}
+	w.nextSeq++
+	w.location[seq] = w.current
+	w.unacked[w.current]++
+	w.pending = append(w.pending, WALEntry{Seq: seq, Batch: batch})
+	return seq, nil
+}
+
+// Ack records that the batch appended under seq was accepted, deleting the oldest segments once none of their batches
+// is left unacknowledged
+func (w *WAL) Ack(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ackLocked(seq)
+}
+
+// Narrow records that the batch appended under seq was accepted in part, leaving only the Measurements at the unsent
+// indices to be sent again
+func (w *WAL) Narrow(seq uint64, unsent []int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.location[seq]; !ok {
+		return nil
+	}
+	if err := w.writeLocked(walRecord{Seq: seq, Unsent: unsent}); err != nil {
+		return err
+	}
+	for i := range w.pending {
+		if w.pending[i].Seq == seq {
+			w.pending[i].Batch = unsentBatch(w.pending[i].Batch, unsent)
+			break
+		}
+	}
+	return nil
+}
+
+// DeadLetter moves the batch appended under seq to the WALDeadLetterFile and acknowledges it, so that a batch
+// AppOptics will never accept neither blocks those behind it nor keeps its segment from being deleted
+func (w *WAL) DeadLetter(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, entry := range w.pending {
+		if entry.Seq != seq {
+			continue
+		}
+		line, err := json.Marshal(walRecord{Seq: seq, Batch: entry.Batch})
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(w.dir, WALDeadLetterFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(line, '\n'))
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	return w.ackLocked(seq)
+}
+
+// ackLocked acknowledges the batch appended under seq. w.mu must be held.
+func (w *WAL) ackLocked(seq uint64) error {
+	segment, ok := w.location[seq]
+	if !ok {
+		return nil
+	}
+	if err := w.writeLocked(walRecord{Seq: seq, Ack: true}); err != nil {
+		return err
+	}
+	delete(w.location, seq)
+	w.unacked[segment]--
+	for i, entry := range w.pending {
+		if entry.Seq == seq {
+			w.pending = append(w.pending[:i], w.pending[i+1:]...)
+			break
+		}
+	}
+	w.compactLocked()
+	return nil
+}
+
+// Close closes the segment being written to
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// writeLocked appends rec to the current segment and syncs it to disk, starting a new segment first if the current
+// one is full. w.mu must be held.
+func (w *WAL) writeLocked(rec walRecord) error {
+	if w.segmentBytes > 0 && w.size >= w.segmentBytes {
+		if err := w.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	n, err := w.f.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// rotateLocked starts a new segment named after the next sequence number. w.mu must be held.
+func (w *WAL) rotateLocked() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+	}
+	id := w.nextSeq
+	if n := len(w.segments); n > 0 && w.segments[n-1] >= id {
+		// acknowledgements alone do not advance the sequence, so a segment of them may already be named id
+		id = w.segments[n-1] + 1
+	}
+	f, err := os.OpenFile(w.segmentPath(id), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w.f, w.size, w.current = f, 0, id
+	w.segments = append(w.segments, id)
+	w.unacked[id] = 0
+	return nil
+}
+
+// compactLocked deletes the oldest segments for as long as none of their batches is left unacknowledged. Only a
+// prefix of the segments is deleted, as the acknowledgements of a segment's batches may be in any later one. w.mu must
+// be held.
+func (w *WAL) compactLocked() {
+	for len(w.segments) > 1 && w.unacked[w.segments[0]] == 0 {
+		id := w.segments[0]
+		if err := os.Remove(w.segmentPath(id)); err != nil {
+			return
+		}
+		delete(w.unacked, id)
+		w.segments = w.segments[1:]
+	}
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, walSegmentSuffix))
+}
+
+// WALCommunicator wraps a MeasurementsCommunicator, appending every batch to a WAL before sending it and
+// acknowledging it once accepted, so that batches lost to a crash are sent on restart. Batches are always sent in the
+// order they were appended: while the oldest one keeps failing with an error its RetryPolicy considers transient, new
+// ones queue up behind it in the WAL, and every Create tries the queue again from its head. After a
+// *PartialSubmissionError only the Measurements that were not accepted are kept, so the rest are never sent twice.
+// Batches failing permanently are moved to the dead letter file instead. Wrap it around a RetryingCommunicator so only batches that
+// failed every attempt are held back.
+type WALCommunicator struct {
+	mc     appoptics.MeasurementsCommunicator
+	wal    *WAL
+	policy RetryPolicy
+
+	// mu serializes sending, so that no batch overtakes an earlier one
+	mu sync.Mutex
+}
+
+// NewWALCommunicator returns a WALCommunicator sending through mc, logging to wal and telling transient failures from
+// permanent ones with policy
+func NewWALCommunicator(mc appoptics.MeasurementsCommunicator, wal *WAL, policy RetryPolicy) *WALCommunicator {
+	return &WALCommunicator{mc: NewAckingCommunicator(mc, nil, nil), wal: wal, policy: policy}
+}
+
+// Replay sends the batches the WAL holds from the last run in their original order. If one fails transiently it and
+// those behind it stay queued, and are sent before the batch of the next Create.
+func (wc *WALCommunicator) Replay() error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	_, err := wc.drainLocked(0, false)
+	return err
+}
+
+// Create implements appoptics.MeasurementsCommunicator, sending any batches queued in the WAL before batch. A batch
+// that cannot be written to the WAL is not sent.
+func (wc *WALCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	seq, err := wc.wal.Append(batch)
+	if err != nil {
+		return nil, fmt.Errorf("writing batch to the WAL: %s", err)
+	}
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.drainLocked(seq, true)
+}
+
+// drainLocked sends the unacknowledged batches in order, stopping at the first transient failure, and returns the
+// outcome of the batch appended under target if it is reached, or the failure it stopped at otherwise. wc.mu must be
+// held.
+func (wc *WALCommunicator) drainLocked(target uint64, hasTarget bool) (*http.Response, error) {
+	queue := wc.wal.Unacknowledged()
+	for i, entry := range queue {
+		resp, err := wc.mc.Create(entry.Batch)
+		if partial, ok := err.(*PartialSubmissionError); ok {
+			if narrowErr := wc.wal.Narrow(entry.Seq, partial.Unsent); narrowErr != nil {
+				return resp, narrowErr
+			}
+		}
+		if err != nil && wc.policy.Retryable(resp, err) {
+			if hasTarget && entry.Seq == target {
+				return resp, err
+			}
+			return resp, fmt.Errorf("keeping %d batches in the WAL behind batch %d: %s", len(queue)-i, entry.Seq, err)
+		}
+		if err != nil {
+			LogError("moving batch %d to the dead letter file, it failed permanently: %s\n", entry.Seq, err)
+			if dlErr := wc.wal.DeadLetter(entry.Seq); dlErr != nil {
+				return resp, dlErr
+			}
+		} else if ackErr := wc.wal.Ack(entry.Seq); ackErr != nil {
+			return resp, ackErr
+		}
+		if hasTarget && entry.Seq == target {
+			return resp, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,237 @@
+package promadapter
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appoptics/appoptics-api-go"
+)
+
+func walBatch(name string) *appoptics.MeasurementsBatch {
+	return &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: name, Value: valueFixture}}}
+}
+
+func walSegments(t *testing.T, dir string) []string {
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+walSegmentSuffix))
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	return segments
+}
+
+func walNames(batches []*appoptics.MeasurementsBatch) string {
+	var names []string
+	for _, batch := range batches {
+		names = append(names, batch.Measurements[0].Name)
+	}
+	return fmt.Sprint(names)
+}
+
+func TestWALReplaysUnacknowledgedInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// a segment size of 1 byte rotates after every record
+	wal, err := OpenWAL(dir, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	for i := 0; i < 5; i++ {
+		seq, err := wal.Append(walBatch(fmt.Sprintf("m%d", i)))
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if i%2 == 0 && i < 4 {
+			wal.Ack(seq)
+		}
+	}
+	// crash halfway through writing a record, without closing the WAL
+	segments := walSegments(t, dir)
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	f.WriteString(`{"seq":5,"batch":{"measu`)
+	f.Close()
+
+	wal, err = OpenWAL(dir, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	var seqs []uint64
+	for _, entry := range wal.Unacknowledged() {
+		seqs = append(seqs, entry.Seq)
+	}
+	if fmt.Sprint(seqs) != "[1 3 4]" {
+		t.Fatalf("expected entries [1 3 4] to be left unacknowledged but got %v", seqs)
+	}
+
+	sc := &stubCommunicator{statusCodes: []int{http.StatusOK}}
+	wc := NewWALCommunicator(sc, wal, DefaultRetryPolicy())
+	if err := wc.Replay(); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	wc.Create(walBatch("m5"))
+	if names := walNames(sc.batches); names != "[m1 m3 m4 m5]" {
+		t.Errorf("expected the unacknowledged batches to be sent in order before new ones but got %s", names)
+	}
+	if segments := walSegments(t, dir); len(segments) != 1 {
+		t.Errorf("expected acknowledged segments to be compacted down to the current one but got %d", len(segments))
+	}
+	wal.Close()
+
+	wal, err = OpenWAL(dir, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer wal.Close()
+	if entries := wal.Unacknowledged(); len(entries) != 0 {
+		t.Errorf("expected nothing left to replay but got %d entries", len(entries))
+	}
+}
+
+func TestWALCommunicatorHoldsBackNewBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir, DefaultWALSegmentBytes)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer wal.Close()
+	sc := &stubCommunicator{statusCodes: []int{http.StatusServiceUnavailable}}
+	wc := NewWALCommunicator(sc, wal, DefaultRetryPolicy())
+
+	if _, err := wc.Create(walBatch("m0")); err == nil {
+		t.Error("expected the failed batch to be reported")
+	}
+	if _, err := wc.Create(walBatch("m1")); err == nil {
+		t.Error("expected the batch held back behind a failed one to be reported")
+	}
+	if names := walNames(sc.batches); names != "[m0 m0]" {
+		t.Errorf("expected only the oldest batch to be tried while it fails but got %s", names)
+	}
+
+	sc.statusCodes, sc.batches = []int{http.StatusOK}, nil
+	if _, err := wc.Create(walBatch("m2")); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if names := walNames(sc.batches); names != "[m0 m1 m2]" {
+		t.Errorf("expected the held back batches to be sent in order but got %s", names)
+	}
+	if entries := wal.Unacknowledged(); len(entries) != 0 {
+		t.Errorf("expected every batch to be acknowledged but %d are left", len(entries))
+	}
+}
+
+// partialCommunicator accepts only the first Measurement of every batch, then fails
+type partialCommunicator struct {
+	batches []*appoptics.MeasurementsBatch
+}
+
+func (pc *partialCommunicator) Create(batch *appoptics.MeasurementsBatch) (*http.Response, error) {
+	pc.batches = append(pc.batches, batch)
+	if len(batch.Measurements) < 2 {
+		return &http.Response{StatusCode: http.StatusAccepted}, nil
+	}
+	unsent := make([]int, len(batch.Measurements)-1)
+	for i := range unsent {
+		unsent[i] = i + 1
+	}
+	return nil, &PartialSubmissionError{Err: errors.New("connection reset"), Unsent: unsent}
+}
+
+func TestWALCommunicatorResendsOnlyUnsent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir, DefaultWALSegmentBytes)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	pc := &partialCommunicator{}
+	wc := NewWALCommunicator(pc, wal, DefaultRetryPolicy())
+
+	batch := &appoptics.MeasurementsBatch{Measurements: []appoptics.Measurement{{Name: "m0"}, {Name: "m1"}, {Name: "m2"}}}
+	if _, err := wc.Create(batch); err == nil {
+		t.Error("expected the partly accepted batch to be reported")
+	}
+	if entries := wal.Unacknowledged(); len(entries) != 1 || walNames([]*appoptics.MeasurementsBatch{entries[0].Batch}) != "[m1]" {
+		t.Fatalf("expected only the unsent measurements to be kept but got %+v", entries)
+	}
+	wal.Close()
+
+	t.Run("the narrowed batch is replayed after a restart", func(t *testing.T) {
+		wal, err := OpenWAL(dir, DefaultWALSegmentBytes)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		defer wal.Close()
+		entries := wal.Unacknowledged()
+		if len(entries) != 1 || len(entries[0].Batch.Measurements) != 2 || entries[0].Batch.Measurements[0].Name != "m1" {
+			t.Fatalf("expected m1 and m2 to be left to replay but got %+v", entries)
+		}
+
+		pc.batches = nil
+		wc := NewWALCommunicator(pc, wal, DefaultRetryPolicy())
+		wc.Replay()
+		wc.Replay()
+		if names := walNames(pc.batches); names != "[m1 m2]" {
+			t.Errorf("expected every measurement to be sent once more but got %s", names)
+		}
+		if entries := wal.Unacknowledged(); len(entries) != 0 {
+			t.Errorf("expected the batch to be acknowledged but %d entries are left", len(entries))
+		}
+	})
+}
+
+func TestWALCommunicatorDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir, 1)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer wal.Close()
+	sc := &stubCommunicator{statusCodes: []int{http.StatusBadRequest, http.StatusOK}}
+	wc := NewWALCommunicator(sc, wal, DefaultRetryPolicy())
+
+	if _, err := wc.Create(walBatch("m0")); err == nil {
+		t.Error("expected the rejected batch to be reported")
+	}
+	if _, err := wc.Create(walBatch("m1")); err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if entries := wal.Unacknowledged(); len(entries) != 0 {
+		t.Errorf("expected the rejected batch not to be kept for replay but %d entries are left", len(entries))
+	}
+	if segments := walSegments(t, dir); len(segments) != 1 {
+		t.Errorf("expected the rejected batch not to keep its segment but got %d segments", len(segments))
+	}
+	dead, err := ioutil.ReadFile(filepath.Join(dir, WALDeadLetterFile))
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if !strings.Contains(string(dead), `"m0"`) || strings.Contains(string(dead), `"m1"`) {
+		t.Errorf("expected only the rejected batch in the dead letter file but got %s", dead)
+	}
+}
@@ -0,0 +1,104 @@
+package promadapter
+
+import (
+	"time"
+)
+
+// WindowReport describes how the adapter performed between Start and End
+type WindowReport struct {
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Submitted  uint64            `json:"submitted"`
+	Retries    uint64            `json:"retries"`
+	Errors     uint64            `json:"errors"`
+	Dropped    map[string]uint64 `json:"dropped"`
+	AverageLag time.Duration     `json:"average_lag"`
+	// ErrorRate is the share of Measurements that reached submission but were not accepted
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// windowBaseline holds the Stats counters at the start of a window
+type windowBaseline struct {
+	start     time.Time
+	submitted uint64
+	retries   uint64
+	errors    uint64
+	dropped   map[string]uint64
+	lagTotal  time.Duration
+	lagCount  uint64
+}
+
+// WindowReporter turns the adapter's cumulative Stats into a WindowReport for every window of time, handing each to
+// a callback
+type WindowReporter struct {
+	stats    *Stats
+	window   time.Duration
+	report   func(WindowReport)
+	now      func() time.Time
+	baseline windowBaseline
+}
+
+// NewWindowReporter returns a WindowReporter whose first window starts now
+func NewWindowReporter(stats *Stats, window time.Duration, report func(WindowReport)) *WindowReporter {
+	wr := &WindowReporter{stats: stats, window: window, report: report, now: time.Now}
+	wr.reset()
+	return wr
+}
+
+// Run checks every second whether the current window has ended until stop is closed
+func (wr *WindowReporter) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			wr.Tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Tick reports the current window and starts the next one if the window has elapsed
+func (wr *WindowReporter) Tick() {
+	if wr.now().Sub(wr.baseline.start) < wr.window {
+		return
+	}
+	b := wr.baseline
+	wr.reset()
+	cur := wr.baseline
+
+	r := WindowReport{
+		Start:     b.start,
+		End:       cur.start,
+		Submitted: cur.submitted - b.submitted,
+		Retries:   cur.retries - b.retries,
+		Errors:    cur.errors - b.errors,
+		Dropped:   make(map[string]uint64),
+	}
+	for reason, n := range cur.dropped {
+		if d := n - b.dropped[reason]; d > 0 {
+			r.Dropped[reason] = d
+		}
+	}
+	if n := cur.lagCount - b.lagCount; n > 0 {
+		r.AverageLag = (cur.lagTotal - b.lagTotal) / time.Duration(n)
+	}
+	if failed := r.Dropped[DropReasonSubmissionFailed]; failed+r.Submitted > 0 {
+		r.ErrorRate = float64(failed) / float64(failed+r.Submitted)
+	}
+	wr.report(r)
+}
+
+func (wr *WindowReporter) reset() {
+	lagTotal, lagCount := wr.stats.LagTotal()
+	wr.baseline = windowBaseline{
+		start:     wr.now(),
+		submitted: wr.stats.Submitted(),
+		retries:   wr.stats.Retries(),
+		errors:    wr.stats.Errors(),
+		dropped:   wr.stats.Dropped(),
+		lagTotal:  lagTotal,
+		lagCount:  lagCount,
+	}
+}
@@ -0,0 +1,62 @@
+package promadapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowReporter(t *testing.T) {
+	clock := time.Unix(1500000000, 0)
+	stats := NewStats()
+	// activity before the reporter starts must not be counted
+	stats.AddSubmitted(100)
+
+	var reports []WindowReport
+	wr := NewWindowReporter(stats, time.Minute, func(r WindowReport) { reports = append(reports, r) })
+	wr.now = func() time.Time { return clock }
+	wr.reset()
+
+	stats.AddSubmitted(30)
+	stats.AddRetries(2)
+	stats.AddErrors(1)
+	stats.AddDropped(DropReasonSubmissionFailed, 10)
+	stats.AddDropped(DropReasonFiltered, 5)
+	stats.SetLag(1 * time.Second)
+	stats.SetLag(3 * time.Second)
+
+	clock = clock.Add(30 * time.Second)
+	wr.Tick()
+	if len(reports) != 0 {
+		t.Fatalf("expected no report before the window elapsed but got %d", len(reports))
+	}
+
+	clock = clock.Add(30 * time.Second)
+	wr.Tick()
+	if len(reports) != 1 {
+		t.Fatalf("expected 1 report but got %d", len(reports))
+	}
+
+	r := reports[0]
+	if !r.End.Equal(r.Start.Add(time.Minute)) {
+		t.Errorf("expected a one minute window but got %s to %s", r.Start, r.End)
+	}
+	if r.Submitted != 30 || r.Retries != 2 || r.Errors != 1 {
+		t.Errorf("expected 30 submitted, 2 retries and 1 error but got %d, %d and %d", r.Submitted, r.Retries, r.Errors)
+	}
+	if r.Dropped[DropReasonFiltered] != 5 || r.Dropped[DropReasonSubmissionFailed] != 10 {
+		t.Errorf("unexpected drops %v", r.Dropped)
+	}
+	if r.AverageLag != 2*time.Second {
+		t.Errorf("expected an average lag of 2s but got %s", r.AverageLag)
+	}
+	if r.ErrorRate != 0.25 {
+		t.Errorf("expected an error rate of 0.25 but got %f", r.ErrorRate)
+	}
+
+	// the next window starts empty
+	clock = clock.Add(time.Minute)
+	wr.Tick()
+	if reports[1].Submitted != 0 || len(reports[1].Dropped) != 0 || reports[1].AverageLag != 0 {
+		t.Errorf("expected an empty second window but got %+v", reports[1])
+	}
+}
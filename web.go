@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"net/http/pprof"
+	"strconv"
 	"time"
 
 	"fmt"
@@ -12,13 +18,14 @@ import (
 	"github.com/golang/snappy"
 	"github.com/prometheus/common/model"
 	promremote "github.com/prometheus/prometheus/storage/remote"
+	"github.com/solarwinds/prometheus2appoptics/config"
 	"github.com/solarwinds/prometheus2appoptics/promadapter"
 
 	"github.com/appoptics/appoptics-api-go"
 )
 
 // receiveHandler implements the code path for handling incoming Prometheus metrics
-func receiveHandler(prepChan chan<- []appoptics.Measurement) http.Handler {
+func receiveHandler(sink promadapter.Sink, pipeline *promadapter.Pipeline) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		compressed, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -35,10 +42,16 @@ func receiveHandler(prepChan chan<- []appoptics.Measurement) http.Handler {
 		}
 
 		// TODO: make this conditional upon log level
-		convertedData := promadapter.PromDataToAppOpticsMeasurements(&data)
+		convertedData := pipeline.Process(&data)
 		log.Println("measurements received - ", len(convertedData))
 
-		prepChan <- convertedData
+		if len(convertedData) > 0 {
+			if err := sink.Submit(r.Context(), convertedData); err != nil {
+				promadapter.LogError("%s\n", err)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
 		w.WriteHeader(http.StatusAccepted)
 	})
 }
@@ -96,6 +109,232 @@ func testMetricHandler(lc appoptics.ServiceAccessor) http.Handler {
 	})
 }
 
+// snapshotHandler writes the most recent Measurement of every series seen by the adapter as JSON Lines
+func snapshotHandler(snap *promadapter.Snapshot) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := snap.JSONLines()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(data)
+	})
+}
+
+// statsHandler writes a StatsReport of the adapter's pipeline as JSON
+func statsHandler(stats *promadapter.Stats, queueDepth func() int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(promadapter.NewStatsReport(stats, queueDepth()))
+	})
+}
+
+// configHandler writes the effective configuration of the adapter as JSON, with credentials redacted
+func configHandler(ec config.EffectiveConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ec)
+	})
+}
+
+// queryRangeResult is one series of a query_range response, with [timestamp, "value"] pairs as Prometheus renders them
+type queryRangeResult struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+}
+
+// rangeQuerier returns the points between start and end of every series of the named metric having all the given
+// tags, grouped by series. Points may be rolled up to at most step.
+type rangeQuerier interface {
+	QueryRange(ctx context.Context, name string, tags map[string]string, start, end time.Time, step time.Duration) ([]promadapter.DataPoint, error)
+}
+
+// localStoreQuerier queries a LocalStore, which returns every stored point in range whatever the step
+type localStoreQuerier struct {
+	store *promadapter.LocalStore
+}
+
+func (q localStoreQuerier) QueryRange(ctx context.Context, name string, tags map[string]string, start, end time.Time, step time.Duration) ([]promadapter.DataPoint, error) {
+	return q.store.Query(name, tags, start, end), nil
+}
+
+// queryRangeHandler answers the subset of the Prometheus /api/v1/query_range API a LocalStore or AppOptics supports:
+// selectors of a metric name and label equality matchers
+func queryRangeHandler(q rangeQuerier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, tags, err := promadapter.ParseSelector(r.FormValue("query"))
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		start, err := parseQueryTime(r.FormValue("start"))
+		if err != nil {
+			writeQueryError(w, fmt.Errorf("invalid start: %s", err))
+			return
+		}
+		end, err := parseQueryTime(r.FormValue("end"))
+		if err != nil {
+			writeQueryError(w, fmt.Errorf("invalid end: %s", err))
+			return
+		}
+		step, err := parseQueryStep(r.FormValue("step"))
+		if err != nil {
+			writeQueryError(w, fmt.Errorf("invalid step: %s", err))
+			return
+		}
+		points, err := q.QueryRange(r.Context(), name, tags, start, end, step)
+		if err != nil {
+			log.Println(err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "error", "errorType": "unavailable", "error": err.Error()})
+			return
+		}
+
+		results := make([]*queryRangeResult, 0)
+		var current *queryRangeResult
+		var currentTags map[string]string
+		// Query returns the points of each series together, so a new series starts whenever the tags change
+		for _, p := range points {
+			if current == nil || !equalTags(p.Tags, currentTags) {
+				metric := map[string]string{model.MetricNameLabel: p.Name}
+				for k, v := range p.Tags {
+					metric[k] = v
+				}
+				current = &queryRangeResult{Metric: metric}
+				currentTags = p.Tags
+				results = append(results, current)
+			}
+			ts := float64(p.Time.UnixNano()) / float64(time.Second)
+			current.Values = append(current.Values, []interface{}{ts, strconv.FormatFloat(p.Value, 'f', -1, 64)})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "matrix", "result": results},
+		})
+	})
+}
+
+// parseQueryTime parses a query_range time given as Unix seconds or RFC 3339, like Prometheus does
+func parseQueryTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseQueryStep parses a query_range step given as seconds or a duration such as 5m, like Prometheus does
+func parseQueryStep(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := model.ParseDuration(s)
+	return time.Duration(d), err
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// writeQueryError responds to a bad query the way the Prometheus HTTP API does
+func writeQueryError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"status": "error", "errorType": "bad_data", "error": err.Error()})
+}
+
+// patternList is the request body accepted by patternListHandler
+type patternList struct {
+	Patterns []string `json:"patterns"`
+}
+
+// patternListHandler replaces a list of metric name patterns with the ones PUT to it, using set
+func patternListHandler(name string, set func([]string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body patternList
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := set(body.Patterns); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		log.Printf("%s replaced with %q\n", name, body.Patterns)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// managedByFileHandler rejects every request with a 409 Conflict, for settings read from a watched file that would
+// silently replace any change made over HTTP the next time the file changes
+func managedByFileHandler(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "managed by %s, change it there instead\n", path)
+	})
+}
+
+// registerPprofHandlers mounts the net/http/pprof profiling handlers under /debug/pprof/, behind basic auth if user
+// is not empty
+func registerPprofHandlers(mux *http.ServeMux, user, password string) {
+	handlers := map[string]http.Handler{
+		"/debug/pprof/":        http.HandlerFunc(pprof.Index),
+		"/debug/pprof/cmdline": http.HandlerFunc(pprof.Cmdline),
+		"/debug/pprof/profile": http.HandlerFunc(pprof.Profile),
+		"/debug/pprof/symbol":  http.HandlerFunc(pprof.Symbol),
+		"/debug/pprof/trace":   http.HandlerFunc(pprof.Trace),
+	}
+	for path, handler := range handlers {
+		if user != "" {
+			handler = basicAuthHandler(user, password, handler)
+		}
+		mux.Handle(path, handler)
+	}
+}
+
+// basicAuthHandler only passes requests carrying the given basic auth credentials on to next
+func basicAuthHandler(user, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+config.AppName+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // processRequestData returns a Prometheus remote storage WriteRequest from the raw HTTP body data
 func processRequestData(reqBytes []byte) (promremote.WriteRequest, error) {
 	var req promremote.WriteRequest
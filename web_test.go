@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
 	"testing"
+	"time"
 
 	"net/http/httptest"
 
@@ -10,16 +16,13 @@ import (
 	"bytes"
 
 	"github.com/appoptics/appoptics-api-go"
+	"github.com/solarwinds/prometheus2appoptics/config"
+	"github.com/solarwinds/prometheus2appoptics/promadapter"
 )
 
 func TestReceiveHandler(t *testing.T) {
-	// simple hack to ensure we don't block forever
-	prepChan := make(chan []appoptics.Measurement)
-	go func(prepChan <-chan []appoptics.Measurement) {
-		_ = <-prepChan
-	}(prepChan)
-
-	server := httptest.NewServer(receiveHandler(prepChan))
+	sink := &fakeSink{}
+	server := httptest.NewServer(receiveHandler(sink, promadapter.NewPipeline(promadapter.NewStats())))
 	defer server.Close()
 
 	t.Run("data is well-formed", func(t *testing.T) {
@@ -33,10 +36,258 @@ func TestReceiveHandler(t *testing.T) {
 		if resp.StatusCode != http.StatusAccepted {
 			t.Errorf("Expected status 202 but received %d", resp.StatusCode)
 		}
+		if len(sink.submitted) != 1 || len(sink.submitted[0]) == 0 {
+			t.Errorf("expected the converted measurements to be submitted to the sink but got %v", sink.submitted)
+		}
+	})
+
+	t.Run("the sink fails", func(t *testing.T) {
+		sink.err = errors.New("unavailable")
+		defer func() { sink.err = nil }()
+		resp, err := postToReceive(server, FixtureSamplePayload())
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 but received %d", resp.StatusCode)
+		}
+	})
+}
+
+// fakeSink records the Measurements submitted to it and fails with err
+type fakeSink struct {
+	submitted [][]appoptics.Measurement
+	err       error
+}
+
+func (fs *fakeSink) Submit(ctx context.Context, measurements []appoptics.Measurement) error {
+	fs.submitted = append(fs.submitted, measurements)
+	return fs.err
+}
+
+func TestPatternListHandler(t *testing.T) {
+	var current []string
+	set := func(patterns []string) error {
+		if _, err := promadapter.NewMetricFilter(patterns, nil, promadapter.NewStats()); err != nil {
+			return err
+		}
+		current = patterns
+		return nil
+	}
+	server := httptest.NewServer(patternListHandler("allowlist", set))
+	defer server.Close()
+
+	put := func(body string) *http.Response {
+		req, _ := http.NewRequest("PUT", server.URL, bytes.NewBufferString(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		return resp
+	}
+
+	t.Run("valid patterns are applied", func(t *testing.T) {
+		resp := put(`{"patterns": ["http_.*", "node_.*"]}`)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status 204 but received %d", resp.StatusCode)
+		}
+		if len(current) != 2 {
+			t.Errorf("expected 2 patterns to be applied but got %v", current)
+		}
+	})
+
+	t.Run("invalid patterns are rejected", func(t *testing.T) {
+		resp := put(`{"patterns": ["("]}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 but received %d", resp.StatusCode)
+		}
+		if len(current) != 2 {
+			t.Errorf("expected previous patterns to be kept but got %v", current)
+		}
 	})
 }
 
+func TestManagedByFileHandler(t *testing.T) {
+	server := httptest.NewServer(managedByFileHandler("config.yml"))
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL, bytes.NewBufferString(`{"patterns": ["http_.*"]}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 but received %d", resp.StatusCode)
+	}
+}
+
+func TestBasicAuthHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(basicAuthHandler("admin", "secret", ok))
+	defer server.Close()
+
+	cases := []struct {
+		name     string
+		user     string
+		password string
+		status   int
+	}{
+		{"correct credentials", "admin", "secret", http.StatusOK},
+		{"wrong password", "admin", "guess", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			if c.user != "" {
+				req.SetBasicAuth(c.user, c.password)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error but received %s", err.Error())
+			}
+			if resp.StatusCode != c.status {
+				t.Errorf("Expected status %d but received %d", c.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	server := httptest.NewServer(configHandler(config.Effective()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("expected a JSON response: %s", err.Error())
+	}
+	if body["bind-port"] != 4567.0 || body["retry-status-codes"] == nil {
+		t.Errorf("expected the effective configuration including defaults but got %v", body)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 but received %d", resp.StatusCode)
+	}
+}
+
 // postToReceive sends the payload bytes to the endpoint via HTTP POST
+func TestStatsHandler(t *testing.T) {
+	stats := promadapter.NewStats()
+	stats.AddSubmitted(5)
+	stats.AddDropped(promadapter.DropReasonNaN, 2)
+	stats.AddRetries(1)
+	stats.SetLastResponse(http.StatusTooManyRequests, "c0ffee")
+	stats.SetLastError(errors.New("Too Many Requests"))
+
+	server := httptest.NewServer(statsHandler(stats, func() int { return 3 }))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error but received %s", err.Error())
+	}
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("expected a JSON response: %s", err.Error())
+	}
+
+	expected := map[string]interface{}{
+		"submitted":       5.0,
+		"retries":         1.0,
+		"queue_depth":     3.0,
+		"last_status":     429.0,
+		"last_request_id": "c0ffee",
+		"last_error":      "Too Many Requests",
+		"rate_limited":    true,
+		"throttle_factor": 1.0,
+	}
+	for field, value := range expected {
+		if body[field] != value {
+			t.Errorf("expected %s to be %v but got %v", field, value, body[field])
+		}
+	}
+	if dropped, ok := body["dropped"].(map[string]interface{}); !ok || dropped["nan"] != 2.0 {
+		t.Errorf("expected 2 NaN drops but got %v", body["dropped"])
+	}
+}
+
+func TestQueryRangeHandler(t *testing.T) {
+	now := time.Now().Unix()
+	store := promadapter.NewLocalStore(time.Hour)
+	store.Process([]appoptics.Measurement{
+		{Name: "requests", Value: 1.0, Time: now - 60, Tags: map[string]string{"code": "200"}},
+		{Name: "requests", Value: 2.5, Time: now, Tags: map[string]string{"code": "200"}},
+		{Name: "requests", Value: 3.0, Time: now, Tags: map[string]string{"code": "500"}},
+	})
+	server := httptest.NewServer(queryRangeHandler(localStoreQuerier{store}))
+	defer server.Close()
+
+	get := func(query, start, end string) (*http.Response, map[string]interface{}) {
+		params := url.Values{"query": {query}, "start": {start}, "end": {end}, "step": {"15"}}
+		resp, err := http.Get(server.URL + "?" + params.Encode())
+		if err != nil {
+			t.Fatalf("Expected no error but received %s", err.Error())
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("expected a JSON response: %s", err.Error())
+		}
+		return resp, body
+	}
+
+	t.Run("matching series are returned as a matrix", func(t *testing.T) {
+		resp, body := get(`requests{code="200"}`, strconv.FormatInt(now-300, 10), time.Unix(now, 0).Format(time.RFC3339))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 but received %d", resp.StatusCode)
+		}
+		result := body["data"].(map[string]interface{})["result"].([]interface{})
+		if len(result) != 1 {
+			t.Fatalf("expected 1 series but got %v", result)
+		}
+		series := result[0].(map[string]interface{})
+		metric := series["metric"].(map[string]interface{})
+		if metric["__name__"] != "requests" || metric["code"] != "200" {
+			t.Errorf("expected requests{code=\"200\"} but got %v", metric)
+		}
+		values := series["values"].([]interface{})
+		if len(values) != 2 {
+			t.Fatalf("expected 2 values but got %v", values)
+		}
+		last := values[1].([]interface{})
+		if last[0] != float64(now) || last[1] != "2.5" {
+			t.Errorf("expected [%d, \"2.5\"] but got %v", now, last)
+		}
+	})
+
+	t.Run("each series is returned separately", func(t *testing.T) {
+		_, body := get("requests", strconv.FormatInt(now-300, 10), strconv.FormatInt(now, 10))
+		if result := body["data"].(map[string]interface{})["result"].([]interface{}); len(result) != 2 {
+			t.Errorf("expected 2 series but got %v", result)
+		}
+	})
+
+	t.Run("unsupported queries are rejected", func(t *testing.T) {
+		resp, body := get("rate(requests[5m])", "0", "1")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 but received %d", resp.StatusCode)
+		}
+		if body["status"] != "error" || body["errorType"] != "bad_data" {
+			t.Errorf("expected a bad_data error but got %v", body)
+		}
+	})
+}
+
 func postToReceive(server *httptest.Server, payload []byte) (*http.Response, error) {
 	client := new(http.Client)
 	reader := bytes.NewReader(payload)